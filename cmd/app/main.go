@@ -2,31 +2,38 @@ package main
 
 import (
 	"context"
-	dialog_repo "github.com/antonpriyma/otus-highload/internal/app/dialog/repository/mysql"
+	"github.com/antonpriyma/otus-highload/internal/app/migrations"
 	"github.com/antonpriyma/otus-highload/internal/app/models"
+	notification_delivery "github.com/antonpriyma/otus-highload/internal/app/notification/delivery/http"
+	notification_repo "github.com/antonpriyma/otus-highload/internal/app/notification/repository/mysql"
+	notification_usecase "github.com/antonpriyma/otus-highload/internal/app/notification/usecase"
 	post_delivery "github.com/antonpriyma/otus-highload/internal/app/post/delivery/http"
-	"github.com/antonpriyma/otus-highload/internal/app/post/notifer"
 	post_repo "github.com/antonpriyma/otus-highload/internal/app/post/repository/mysql"
 	post_usecase "github.com/antonpriyma/otus-highload/internal/app/post/usecase"
 	map_repository "github.com/antonpriyma/otus-highload/internal/app/session/repository/map"
 	user_delivery "github.com/antonpriyma/otus-highload/internal/app/user/delivery/http"
 	user_repo "github.com/antonpriyma/otus-highload/internal/app/user/repository/mysql"
+	user_search "github.com/antonpriyma/otus-highload/internal/app/user/repository/redis"
 	"github.com/antonpriyma/otus-highload/internal/app/user/usecase"
 	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
 	"github.com/antonpriyma/otus-highload/internal/pkg/middleware"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
 	"github.com/antonpriyma/otus-highload/pkg/context/reqid"
 	"github.com/antonpriyma/otus-highload/pkg/dialogs/github.com/antonpriyma/otus-highload/pkg/dialogs"
 	"github.com/antonpriyma/otus-highload/pkg/errors"
 	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoapi"
 	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoerrors"
 	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoutils"
+	"github.com/antonpriyma/otus-highload/pkg/framework/grpc/auth"
 	"github.com/antonpriyma/otus-highload/pkg/framework/grpc/interceptors/client"
+	grpc_utils "github.com/antonpriyma/otus-highload/pkg/framework/grpc/utils"
 	"github.com/antonpriyma/otus-highload/pkg/framework/service"
 	"github.com/antonpriyma/otus-highload/pkg/utils"
 	"github.com/google/uuid"
 	"github.com/labstack/echo"
-	amqp "github.com/rabbitmq/amqp091-go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"log"
 	"math/rand"
 	"net/http"
@@ -36,23 +43,33 @@ import (
 
 type AppConfig struct {
 	service.Config `mapstructure:",squash"`
-	UsersConfig    UsersConfig   `mapstructure:"users"`
-	PostsConfig    PostsConfig   `mapstructure:"posts"`
-	DialogsConfig  DialogsConfig `mapstructure:"dialogs"`
+	Database       mysql_client.Config `mapstructure:"database"`
+	Schema         migrations.Config   `mapstructure:"schema"`
+	PostsConfig    PostsConfig         `mapstructure:"posts"`
+	UsersConfig    UsersConfig         `mapstructure:"users"`
+	DialogsConfig  DialogsConfig       `mapstructure:"dialogs"`
+
+	NotificationsConfig NotificationsConfig `mapstructure:"notifications"`
+}
+
+type NotificationsConfig struct {
+	Inbox notification_usecase.InboxConfig `mapstructure:"inbox"`
 }
 
 type DialogsConfig struct {
-	Repo       dialog_repo.Config `mapstructure:"repository"`
-	GRPCAddr   string             `mapstructure:"grpc_addr"`
-	RabbitAddr string             `mapstructure:"rabbit_addr"`
+	GRPCAddr string `mapstructure:"grpc_addr"`
+	// Credentials authenticate the app in the dialogs serverside ACL.
+	Credentials grpc_utils.RPCCredentialsConfig `mapstructure:"credentials"`
+	ActorHeader string                          `mapstructure:"actor_header"`
 }
 
 type UsersConfig struct {
-	Repo user_repo.Config `mapstructure:"repository"`
+	SearchIndex user_search.Config `mapstructure:"search_index"`
 }
 
 type PostsConfig struct {
-	Repo post_repo.Config `mapstructure:"repository"`
+	Repo    post_repo.Config    `mapstructure:"repository"`
+	Usecase post_usecase.Config `mapstructure:"usecase"`
 }
 
 func (a AppConfig) APIConfig() echoapi.Config {
@@ -74,31 +91,45 @@ func main() {
 
 	svc := echoapi.New(&cfg)
 
-	userRepository, err := user_repo.NewUserRepository(cfg.UsersConfig.Repo, svc.Logger)
-	utils.Must(svc.Logger, err, "failed to create users repository")
+	db, err := mysql_client.NewProvider(cfg.Database, svc.StatRegistry, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to connect to mysql")
+	defer db.Close()
 
-	sessionRepository := map_repository.NewSessionRepository(svc.Logger)
+	err = migrations.Check(context.Background(), cfg.Schema, db.Primary().DB, svc.Logger)
+	utils.Must(svc.Logger, err, "unexpected schema version")
 
-	usersUsecase := usecase.NewUserUsecase(userRepository, sessionRepository, svc.Logger)
-	usersDelivery := user_delivery.NewUserDelivery(usersUsecase, svc.Logger)
+	userRepository := user_repo.NewUserRepository(db, svc.Logger)
 
-	postRepository, err := post_repo.NewPostRepository(cfg.PostsConfig.Repo, svc.Logger)
+	sessionRepository := map_repository.NewSessionRepository(svc.Logger)
+
+	postRepository, err := post_repo.NewPostRepository(cfg.PostsConfig.Repo, db, svc.Logger)
 	utils.Must(svc.Logger, err, "failed to create posts repository")
 
-	conn, err := amqp.Dial(cfg.DialogsConfig.RabbitAddr)
-	utils.Must(svc.Logger, err, "Failed to connect to RabbitMQ")
-	defer conn.Close()
+	outboxRepository := notification_repo.NewOutboxRepository(db, svc.Logger)
 
-	ch, err := conn.Channel()
-	utils.Must(svc.Logger, err, "Failed to open a channel")
-	defer ch.Close()
+	var searchIndex models.UserSearchIndex
+	if cfg.UsersConfig.SearchIndex.Enabled {
+		searchIndex, err = user_search.NewUserSearchIndex(cfg.UsersConfig.SearchIndex, svc.Logger)
+		utils.Must(svc.Logger, err, "failed to connect to user search index")
+	}
 
-	notifier, err := notifer.NewNotifer(ch)
-	utils.Must(svc.Logger, err, "Failed to create notifier")
+	usersUsecase := usecase.NewUserUsecase(userRepository, postRepository, sessionRepository, outboxRepository, searchIndex, db, svc.Logger)
+	usersDelivery := user_delivery.NewUserDelivery(usersUsecase, svc.Logger)
 
-	postUsecase := post_usecase.NewPostUsecase(postRepository, userRepository, notifier, svc.Logger)
+	postUsecase, err := post_usecase.NewPostUsecase(cfg.PostsConfig.Usecase, postRepository, userRepository, db, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to create posts usecase")
 	postDelivery := post_delivery.NewPostDelivery(postUsecase, svc.Logger)
 
+	preferencesRepository := notification_repo.NewPreferencesRepository(db, svc.Logger)
+
+	preferencesUsecase := notification_usecase.NewPreferencesUsecase(preferencesRepository, svc.Logger)
+	preferencesDelivery := notification_delivery.NewPreferencesDelivery(preferencesUsecase, svc.Logger)
+
+	inboxRepository := notification_repo.NewInboxRepository(db, svc.Logger)
+
+	inboxUsecase := notification_usecase.NewInboxUsecase(cfg.NotificationsConfig.Inbox, inboxRepository, svc.Logger)
+	inboxDelivery := notification_delivery.NewInboxDelivery(inboxUsecase, svc.Logger)
+
 	svc.API.Use(middleware.AuthMiddleware)
 	svc.API.GET("/user/register", func(c echo.Context) error {
 		req := models.User{
@@ -175,6 +206,139 @@ func main() {
 		return c.JSON(http.StatusOK, nil)
 	})
 
+	svc.API.GET("/notifications", func(c echo.Context) error {
+		limit := 0
+		if limitRaw := c.QueryParam("limit"); limitRaw != "" {
+			var err error
+			limit, err = strconv.Atoi(limitRaw)
+			if err != nil {
+				return echoerrors.ValidationError(err, "limit is not valid", echoerrors.ValidationErrorFields{"limit": echoerrors.FieldInvalid})
+			}
+		}
+
+		page, err := inboxDelivery.GetNotifications(echoutils.MustGetContext(c), models.NotificationID(c.QueryParam("before")), limit)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, page)
+	})
+
+	svc.API.POST("/notifications/read", func(c echo.Context) error {
+		type ReadRequest struct {
+			IDs []models.NotificationID `json:"ids"`
+		}
+
+		req := new(ReadRequest)
+		if err := c.Bind(req); err != nil {
+			return echoerrors.ValidationError(err, "failed to bind request", echoerrors.ValidationErrorFields{})
+		}
+
+		err := inboxDelivery.MarkNotificationsRead(echoutils.MustGetContext(c), req.IDs)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.POST("/notifications/read_all", func(c echo.Context) error {
+		err := inboxDelivery.MarkAllNotificationsRead(echoutils.MustGetContext(c))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.GET("/notifications/preferences", func(c echo.Context) error {
+		disabled, err := preferencesDelivery.GetDisabledNotifications(echoutils.MustGetContext(c))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"version":  models.NotificationSchemaVersion,
+			"disabled": disabled,
+		})
+	})
+
+	svc.API.POST("/notifications/preferences/:type/enable", func(c echo.Context) error {
+		typ := models.NotificationType(c.Param("type"))
+
+		err := preferencesDelivery.SetNotificationEnabled(echoutils.MustGetContext(c), typ, true)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.POST("/notifications/preferences/:type/disable", func(c echo.Context) error {
+		typ := models.NotificationType(c.Param("type"))
+
+		err := preferencesDelivery.SetNotificationEnabled(echoutils.MustGetContext(c), typ, false)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.GET("/notifications/preferences/digest", func(c echo.Context) error {
+		settings, err := preferencesDelivery.GetDigestSettings(echoutils.MustGetContext(c))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, settings)
+	})
+
+	svc.API.POST("/notifications/preferences/digest", func(c echo.Context) error {
+		req := new(models.DigestSettings)
+		if err := c.Bind(req); err != nil {
+			return echoerrors.ValidationError(err, "failed to bind request", echoerrors.ValidationErrorFields{})
+		}
+
+		err := preferencesDelivery.SetDigestSettings(echoutils.MustGetContext(c), *req)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.POST("/user/block/:id", func(c echo.Context) error {
+		id := c.Param("id")
+
+		err := usersDelivery.BlockUser(echoutils.MustGetContext(c), models.UserID(id))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.POST("/user/unblock/:id", func(c echo.Context) error {
+		id := c.Param("id")
+
+		err := usersDelivery.UnblockUser(echoutils.MustGetContext(c), models.UserID(id))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.POST("/user/delete", func(c echo.Context) error {
+		err := usersDelivery.DeleteUser(echoutils.MustGetContext(c))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
 	svc.API.GET("/post/feed", func(c echo.Context) error {
 		userID, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
 		if !ok {
@@ -242,21 +406,47 @@ func main() {
 		})
 	})
 
-	grpcConn, err := grpc.Dial(
-		cfg.DialogsConfig.GRPCAddr,
+	svc.API.POST("/post/:id/delete", func(c echo.Context) error {
+		id := c.Param("id")
+
+		err := postDelivery.DeletePost(echoutils.MustGetContext(c), models.PostID(id))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	grpcOpts := []grpc.DialOption{
 		grpc.WithInsecure(),
-		grpc.WithUnaryInterceptor(client.NewUnaryClientRequestIDInterceptor(func(ctx context.Context) string {
-			reqID := reqid.GetRequestID(ctx)
-			if reqID == "" {
-				reqID = uuid.New().String()
-			}
+		grpc.WithChainUnaryInterceptor(
+			client.NewUnaryClientRequestIDInterceptor(func(ctx context.Context) string {
+				reqID := reqid.GetRequestID(ctx)
+				if reqID == "" {
+					reqID = uuid.New().String()
+				}
+
+				return reqID
+			}),
+			client.NewUnaryClientActorInterceptor(cfg.DialogsConfig.ActorHeader, func(ctx context.Context) string {
+				userID, _ := contextlib.GetUserID(ctx)
+				return string(userID)
+			}),
+			client.NewUnaryClientLoggingInterceptor(svc.Logger, client.LogParams{
+				Debug: true,
+			}),
+			client.NewUnaryClientStatInterceptor(client.StatConfig{Service: "dialogs"}, svc.StatRegistry),
+		),
+	}
+	if cfg.DialogsConfig.Credentials.Token != "" {
+		grpcOpts = append(grpcOpts, grpc.WithPerRPCCredentials(auth.NewPerRPCCredentials(
+			cfg.DialogsConfig.Credentials.Token,
+			cfg.DialogsConfig.Credentials.HeaderName,
+			cfg.DialogsConfig.Credentials.WithSecurity,
+		)))
+	}
 
-			return reqID
-		})),
-		grpc.WithUnaryInterceptor(client.NewUnaryClientLoggingInterceptor(svc.Logger, client.LogParams{
-			Debug: true,
-		})),
-		grpc.WithUnaryInterceptor(client.NewUnaryClientStatInterceptor(client.StatConfig{Service: "dialogs"}, svc.StatRegistry)))
+	grpcConn, err := grpc.Dial(cfg.DialogsConfig.GRPCAddr, grpcOpts...)
 	utils.Must(svc.Logger, err, "failed to dial grpc dialogs")
 	defer func() {
 		if err := grpcConn.Close(); err != nil {
@@ -268,7 +458,8 @@ func main() {
 	svc.API.POST("/dialog/:user_id/send", func(context echo.Context) error {
 		friendID := context.Param("user_id")
 		type SendRequest struct {
-			Text string `json:"text"`
+			Text            string `json:"text"`
+			ClientMessageID string `json:"client_msg_id"`
 		}
 
 		req := new(SendRequest)
@@ -276,56 +467,389 @@ func main() {
 			return echoerrors.ValidationError(err, "failed to bind request", echoerrors.ValidationErrorFields{})
 		}
 
-		userID, ok := contextlib.GetUserID(echoutils.MustGetContext(context))
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(context))
 		if !ok {
 			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
 		}
 
-		_, err = dialogsClient.SendMessage(context.Request().Context(), &dialogs.SendMessageRequest{
+		// key is generated once per HTTP request so gRPC retries are deduplicated
+		if req.ClientMessageID == "" {
+			req.ClientMessageID = uuid.New().String()
+		}
+
+		resp, err := dialogsClient.SendMessage(echoutils.MustGetContext(context), &dialogs.SendMessageRequest{
 			Message: &dialogs.Message{
-				From: string(userID),
 				To:   friendID,
 				Text: req.Text,
 			},
+			ClientMsgId: req.ClientMessageID,
 		})
 		if err != nil {
-			return err
+			return convertDialogsError(err, "message")
+		}
+
+		type SendResponse struct {
+			MessageID models.MessageID `json:"message_id"`
 		}
 
-		return context.JSON(http.StatusOK, nil)
+		return context.JSON(http.StatusOK, SendResponse{
+			MessageID: models.MessageID(resp.MessageId),
+		})
 	})
 
 	svc.API.GET("/dialog/:user_id/list", func(c echo.Context) error {
 		friendID := c.Param("user_id")
 
-		userID, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
 		if !ok {
 			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
 		}
-		grpcMessages, err := dialogsClient.GetMessages(c.Request().Context(), &dialogs.GetMessagesRequest{
+		grpcMessages, err := dialogsClient.GetMessages(echoutils.MustGetContext(c), &dialogs.GetMessagesRequest{
 			From: friendID,
-			User: string(userID),
 		})
 		if err != nil {
-			return err
+			return convertDialogsError(err, "user")
 		}
 
 		messages := make([]models.Message, 0, len(grpcMessages.Messages))
 		for _, grpcMessage := range grpcMessages.Messages {
-			messages = append(messages, models.Message{
-				From: models.UserID(grpcMessage.From),
-				To:   models.UserID(grpcMessage.To),
-				Text: grpcMessage.Text,
-			})
+			messages = append(messages, convertGRPCMessage(grpcMessage))
 		}
 
 		return c.JSON(http.StatusOK, messages)
 
 	})
 
+	svc.API.POST("/dialog/message/:message_id/edit", func(c echo.Context) error {
+		messageID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "message_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		type EditRequest struct {
+			Text string `json:"text"`
+		}
+
+		req := new(EditRequest)
+		if err := c.Bind(req); err != nil {
+			return echoerrors.ValidationError(err, "failed to bind request", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		resp, err := dialogsClient.EditMessage(echoutils.MustGetContext(c), &dialogs.EditMessageRequest{
+			MessageId: messageID,
+			Text:      req.Text,
+		})
+		if err != nil {
+			return convertDialogsError(err, "message")
+		}
+
+		return c.JSON(http.StatusOK, convertGRPCMessage(resp.Message))
+	})
+
+	svc.API.POST("/dialog/message/:message_id/delete", func(c echo.Context) error {
+		messageID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "message_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		resp, err := dialogsClient.DeleteMessage(echoutils.MustGetContext(c), &dialogs.DeleteMessageRequest{
+			MessageId: messageID,
+		})
+		if err != nil {
+			return convertDialogsError(err, "message")
+		}
+
+		return c.JSON(http.StatusOK, convertGRPCMessage(resp.Message))
+	})
+
+	svc.API.POST("/dialog/message/:message_id/hide", func(c echo.Context) error {
+		messageID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "message_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		_, err = dialogsClient.HideMessage(echoutils.MustGetContext(c), &dialogs.HideMessageRequest{
+			MessageId: messageID,
+		})
+		if err != nil {
+			return convertDialogsError(err, "message")
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.POST("/group/create", func(c echo.Context) error {
+		type CreateGroupRequest struct {
+			Name    string   `json:"name"`
+			Members []string `json:"members"`
+		}
+
+		req := new(CreateGroupRequest)
+		if err := c.Bind(req); err != nil {
+			return echoerrors.ValidationError(err, "failed to bind request", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		resp, err := dialogsClient.CreateGroup(echoutils.MustGetContext(c), &dialogs.CreateGroupRequest{
+			Name:    req.Name,
+			Members: req.Members,
+		})
+		if err != nil {
+			return convertDialogsError(err, "group")
+		}
+
+		type CreateGroupResponse struct {
+			GroupID models.GroupID `json:"group_id"`
+		}
+
+		return c.JSON(http.StatusOK, CreateGroupResponse{
+			GroupID: models.GroupID(resp.GroupId),
+		})
+	})
+
+	svc.API.POST("/group/:group_id/member/add", func(c echo.Context) error {
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "group_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		type AddMemberRequest struct {
+			UserID string           `json:"user_id"`
+			Role   models.GroupRole `json:"role"`
+		}
+
+		req := new(AddMemberRequest)
+		if err := c.Bind(req); err != nil {
+			return echoerrors.ValidationError(err, "failed to bind request", echoerrors.ValidationErrorFields{})
+		}
+
+		if req.Role == "" {
+			req.Role = models.GroupRoleMember
+		}
+
+		role, ok := groupRoles[req.Role]
+		if !ok {
+			return echoerrors.ValidationError(errors.New("unknown role"), "role is not valid", echoerrors.ValidationErrorFields{
+				"role": echoerrors.FieldInvalid,
+			})
+		}
+
+		_, ok = contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		_, err = dialogsClient.AddGroupMember(echoutils.MustGetContext(c), &dialogs.AddGroupMemberRequest{
+			GroupId: groupID,
+			Member: &dialogs.GroupMember{
+				User: req.UserID,
+				Role: role,
+			},
+		})
+		if err != nil {
+			return convertDialogsError(err, "member")
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.POST("/group/:group_id/member/:user_id/remove", func(c echo.Context) error {
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "group_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		_, err = dialogsClient.RemoveGroupMember(echoutils.MustGetContext(c), &dialogs.RemoveGroupMemberRequest{
+			GroupId: groupID,
+			Member:  c.Param("user_id"),
+		})
+		if err != nil {
+			return convertDialogsError(err, "member")
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	})
+
+	svc.API.GET("/group/:group_id/members", func(c echo.Context) error {
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "group_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		resp, err := dialogsClient.GetGroupMembers(echoutils.MustGetContext(c), &dialogs.GetGroupMembersRequest{
+			GroupId: groupID,
+		})
+		if err != nil {
+			return convertDialogsError(err, "group")
+		}
+
+		type GroupMember struct {
+			UserID models.UserID    `json:"user_id"`
+			Role   models.GroupRole `json:"role"`
+		}
+
+		members := make([]GroupMember, 0, len(resp.Members))
+		for _, member := range resp.Members {
+			for role, grpcRole := range groupRoles {
+				if grpcRole == member.Role {
+					members = append(members, GroupMember{
+						UserID: models.UserID(member.User),
+						Role:   role,
+					})
+				}
+			}
+		}
+
+		return c.JSON(http.StatusOK, members)
+	})
+
+	svc.API.POST("/group/:group_id/send", func(c echo.Context) error {
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "group_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		type SendRequest struct {
+			Text            string `json:"text"`
+			ClientMessageID string `json:"client_msg_id"`
+		}
+
+		req := new(SendRequest)
+		if err := c.Bind(req); err != nil {
+			return echoerrors.ValidationError(err, "failed to bind request", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		if req.ClientMessageID == "" {
+			req.ClientMessageID = uuid.New().String()
+		}
+
+		resp, err := dialogsClient.SendGroupMessage(echoutils.MustGetContext(c), &dialogs.SendGroupMessageRequest{
+			GroupId: groupID,
+			Message: &dialogs.Message{
+				Text: req.Text,
+			},
+			ClientMsgId: req.ClientMessageID,
+		})
+		if err != nil {
+			return convertDialogsError(err, "message")
+		}
+
+		type SendResponse struct {
+			MessageID models.MessageID `json:"message_id"`
+		}
+
+		return c.JSON(http.StatusOK, SendResponse{
+			MessageID: models.MessageID(resp.MessageId),
+		})
+	})
+
+	svc.API.GET("/group/:group_id/list", func(c echo.Context) error {
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			return echoerrors.ValidationError(err, "group_id is not valid", echoerrors.ValidationErrorFields{})
+		}
+
+		_, ok := contextlib.GetUserID(echoutils.MustGetContext(c))
+		if !ok {
+			return echoerrors.UnauthorizedError(errors.New("user id not found"), "user id not found", "user id not found")
+		}
+
+		grpcMessages, err := dialogsClient.GetGroupMessages(echoutils.MustGetContext(c), &dialogs.GetGroupMessagesRequest{
+			GroupId: groupID,
+		})
+		if err != nil {
+			return convertDialogsError(err, "group")
+		}
+
+		messages := make([]models.Message, 0, len(grpcMessages.Messages))
+		for _, grpcMessage := range grpcMessages.Messages {
+			messages = append(messages, convertGRPCMessage(grpcMessage))
+		}
+
+		return c.JSON(http.StatusOK, messages)
+	})
+
 	svc.Run()
 }
 
+var groupRoles = map[models.GroupRole]dialogs.GroupRole{
+	models.GroupRoleOwner:  dialogs.GroupRole_GROUP_ROLE_OWNER,
+	models.GroupRoleAdmin:  dialogs.GroupRole_GROUP_ROLE_ADMIN,
+	models.GroupRoleMember: dialogs.GroupRole_GROUP_ROLE_MEMBER,
+}
+
+// convertDialogsError maps status codes of the dialogs service to http errors,
+// key names what the call is about.
+func convertDialogsError(err error, key string) error {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.NotFound:
+		return echoerrors.NotFoundError(err, key)
+	case codes.AlreadyExists:
+		return echoerrors.AlreadyExistsError(err, key)
+	case codes.PermissionDenied:
+		return echoerrors.ForbiddenError(err, echoerrors.ReasonNoAccess, st.Message())
+	case codes.FailedPrecondition:
+		return echoerrors.PreconditionFailedError(err, st.Message())
+	case codes.Unavailable:
+		return echoerrors.ServiceUnavailableError(err)
+	default:
+		return err
+	}
+}
+
+func convertGRPCMessage(grpcMessage *dialogs.Message) models.Message {
+	message := models.Message{
+		ID:        models.MessageID(grpcMessage.Id),
+		From:      models.UserID(grpcMessage.From),
+		To:        models.UserID(grpcMessage.To),
+		GroupID:   models.GroupID(grpcMessage.GroupId),
+		Text:      grpcMessage.Text,
+		CreatedAt: time.Unix(grpcMessage.CreatedAt, 0),
+		Deleted:   grpcMessage.Deleted,
+	}
+
+	if grpcMessage.EditedAt != 0 {
+		message.EditedAt = time.Unix(grpcMessage.EditedAt, 0)
+	}
+
+	return message
+}
+
 func generateSex() int {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Intn(1)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/datagen"
+	"github.com/antonpriyma/otus-highload/internal/app/migrations"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/framework/service"
+	"github.com/antonpriyma/otus-highload/pkg/utils"
+)
+
+type AppConfig struct {
+	service.Config `mapstructure:",squash"`
+
+	Database mysql_client.Config `mapstructure:"database"`
+	Schema   migrations.Config   `mapstructure:"schema"`
+	Datagen  datagen.Config      `mapstructure:"datagen"`
+}
+
+func main() {
+	var cfg AppConfig
+	cfg.Version = service.Version{
+		Dist:    "local",
+		Release: "local",
+	}
+
+	svc := service.New(&cfg)
+	ctx := context.Background()
+
+	var db *mysql_client.Provider
+	if cfg.Datagen.Output.Format == "" || cfg.Datagen.Output.Format == datagen.FormatMySQL {
+		var err error
+		db, err = mysql_client.NewProvider(cfg.Database, svc.StatRegistry, svc.Logger)
+		utils.Must(svc.Logger, err, "failed to connect to mysql")
+		defer db.Close()
+
+		err = migrations.Check(ctx, cfg.Schema, db.Primary().DB, svc.Logger)
+		utils.Must(svc.Logger, err, "unexpected schema version")
+	}
+
+	generator, err := datagen.New(cfg.Datagen, db, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to create generator")
+
+	err = generator.Generate(ctx)
+	utils.Must(svc.Logger, err, "failed to generate data")
+
+	svc.Logger.Info("data generated")
+}
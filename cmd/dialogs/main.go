@@ -1,36 +1,47 @@
 package main
 
 import (
+	"context"
+
 	grpc2 "github.com/antonpriyma/otus-highload/internal/app/dialog/delivery/grpc"
+	"github.com/antonpriyma/otus-highload/internal/app/dialog/repository/memory"
 	dialog_repo "github.com/antonpriyma/otus-highload/internal/app/dialog/repository/mysql"
 	dialog_usecase "github.com/antonpriyma/otus-highload/internal/app/dialog/usecase"
+	"github.com/antonpriyma/otus-highload/internal/app/migrations"
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/app/notification/notifer"
+	notification_repo "github.com/antonpriyma/otus-highload/internal/app/notification/repository/mysql"
+	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
 	"github.com/antonpriyma/otus-highload/pkg/dialogs/github.com/antonpriyma/otus-highload/pkg/dialogs"
-	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoapi"
 	"github.com/antonpriyma/otus-highload/pkg/framework/grpc/interceptors/server"
+	grpc_service "github.com/antonpriyma/otus-highload/pkg/framework/grpc/service"
 	"github.com/antonpriyma/otus-highload/pkg/framework/service"
 	"github.com/antonpriyma/otus-highload/pkg/utils"
 	"google.golang.org/grpc"
-	"net"
-	"time"
 )
 
 type AppConfig struct {
 	service.Config `mapstructure:",squash"`
-	DialogsConfig  DialogsConfig `mapstructure:"dialogs"`
+	Server         grpc_service.Config `mapstructure:"server"`
+	Database       mysql_client.Config `mapstructure:"database"`
+	Schema         migrations.Config   `mapstructure:"schema"`
+	// Notifier pushes message edits and deletions to post-notifier.
+	Notifier      notifer.Config `mapstructure:"notifier"`
+	DialogsConfig DialogsConfig  `mapstructure:"dialogs"`
 }
 
 type DialogsConfig struct {
-	Repo dialog_repo.Config `mapstructure:"repository"`
+	Usecase dialog_usecase.Config `mapstructure:"usecase"`
+	// Repository is mysql or memory.
+	Repository string             `mapstructure:"repository"`
+	Memory     memory.Config      `mapstructure:"memory"`
+	ACL        server.ACLConfig   `mapstructure:"acl"`
+	Actor      server.ActorConfig `mapstructure:"actor"`
 }
 
-func (a AppConfig) APIConfig() echoapi.Config {
-	return echoapi.Config{
-		ServeConfig: service.ServeConfig{
-			GracefulWait: time.Second,
-			StopWait:     time.Second,
-		},
-		Listen: ":8082",
-	}
+func (a AppConfig) ServerConfig() grpc_service.Config {
+	return a.Server
 }
 
 func main() {
@@ -40,29 +51,63 @@ func main() {
 		Release: "local",
 	}
 
-	svc := echoapi.New(&cfg)
+	svc := grpc_service.New(&cfg)
+
+	db, err := mysql_client.NewProvider(cfg.Database, svc.StatRegistry, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to connect to mysql")
+	defer db.Close()
 
-	dialogRepo, err := dialog_repo.NewRepository(cfg.DialogsConfig.Repo, svc.Logger)
-	utils.Must(svc.Logger, err, "failed to create dialogs repository")
+	err = migrations.Check(context.Background(), cfg.Schema, db.Primary().DB, svc.Logger)
+	utils.Must(svc.Logger, err, "unexpected schema version")
+
+	var dialogRepo models.DialogRepository
+	switch cfg.DialogsConfig.Repository {
+	case "", "mysql":
+		dialogRepo = dialog_repo.NewRepository(db, svc.Logger)
+	case "memory":
+		memoryRepo, err := memory.NewRepository(
+			context.Background(),
+			cfg.DialogsConfig.Memory,
+			dialog_repo.NewRepository(db, svc.Logger),
+			dialog_repo.NewMemoryStore(db, svc.Logger),
+			svc.StatRegistry,
+			svc.Logger,
+		)
+		utils.Must(svc.Logger, err, "failed to recover dialogs memory")
+		// closed before the database, flushing what is left
+		defer memoryRepo.Close()
+		dialogRepo = memoryRepo
+	default:
+		svc.Logger.Fatalf("unknown dialogs repository %q", cfg.DialogsConfig.Repository)
+	}
 
-	dialogsUsecase := dialog_usecase.NewUsecase(dialogRepo, svc.Logger)
-	dialogsGRPCDelivery := grpc2.NewDelivery(dialogsUsecase, svc.Logger)
+	notifier, err := notifer.New(context.Background(), cfg.Notifier, svc.StatRegistry, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to create notifier")
+	defer notifier.Close()
 
+	preferencesRepo := notification_repo.NewPreferencesRepository(db, svc.Logger)
+
+	dialogsUsecase := dialog_usecase.NewUsecase(cfg.DialogsConfig.Usecase, dialogRepo, preferencesRepo, notifier, svc.Logger)
+	groupsUsecase := dialog_usecase.NewGroupUsecase(dialogRepo, svc.Logger)
+	dialogsGRPCDelivery := grpc2.NewDelivery(dialogsUsecase, groupsUsecase, svc.Logger)
+
+	publicMethods := server.DisabledHandlersList(grpc_service.HealthCheckMethod)
 	grpcServer := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
-			server.NewRequestIDInterceptor(svc.Logger),
-			server.NewLoggerStatInterceptor(svc.Logger),
-			server.NewAccessLogInterceptor(svc.Logger),
+			server.WrapInterceptorsWithErrorHandler(
+				server.DefaultErrorHandler{Logger: svc.Logger}.HandleError,
+				server.NewRequestIDInterceptor(svc.Logger),
+				server.NewLoggerStatInterceptor(svc.Logger),
+				server.NewAccessLogInterceptor(svc.Logger),
+				server.NewStatInterceptor(svc.StatRegistry),
+				server.RecoverInterceptor,
+				server.NewOptionalInterceptor(server.NewServersideACLInterceptor(cfg.DialogsConfig.ACL, svc.Logger), publicMethods),
+				server.NewOptionalInterceptor(server.NewActorInterceptor(cfg.DialogsConfig.Actor, contextlib.WithUserID, svc.Logger), publicMethods),
+			)...,
 		),
 	)
 	dialogs.RegisterDialogsServer(grpcServer, dialogsGRPCDelivery)
+	svc.SetServer(grpcServer)
 
-	lis, err := net.ListenTCP("tcp", &net.TCPAddr{
-		Port: 50051,
-	})
-	utils.Must(svc.Logger, err, "failed to listen tcp")
-
-	if err := grpcServer.Serve(lis); err != nil {
-		svc.Logger.Fatal(err)
-	}
+	svc.Serve()
 }
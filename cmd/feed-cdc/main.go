@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/migrations"
+	"github.com/antonpriyma/otus-highload/internal/app/post/cdc"
+	post_repo "github.com/antonpriyma/otus-highload/internal/app/post/repository/mysql"
+	user_repo "github.com/antonpriyma/otus-highload/internal/app/user/repository/mysql"
+	user_search "github.com/antonpriyma/otus-highload/internal/app/user/repository/redis"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor/middleware"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor/procservice"
+	"github.com/antonpriyma/otus-highload/pkg/framework/service"
+	"github.com/antonpriyma/otus-highload/pkg/utils"
+)
+
+type AppConfig struct {
+	service.Config `mapstructure:",squash"`
+
+	Processor   procservice.Config  `mapstructure:"processor"`
+	ServeConfig service.ServeConfig `mapstructure:"serve_config"`
+	Database    mysql_client.Config `mapstructure:"database"`
+	Schema      migrations.Config   `mapstructure:"schema"`
+	Posts       post_repo.Config    `mapstructure:"posts"`
+	SearchIndex user_search.Config  `mapstructure:"search_index"`
+	CDC         cdc.Config          `mapstructure:"cdc"`
+}
+
+func (a AppConfig) ProcessorConfig() procservice.Config {
+	return a.Processor
+}
+
+func main() {
+	var cfg AppConfig
+	cfg.Version = service.Version{
+		Dist:    "local",
+		Release: "local",
+	}
+
+	svc := procservice.New(&cfg)
+	ctx := context.Background()
+
+	db, err := mysql_client.NewProvider(cfg.Database, svc.StatRegistry, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to connect to mysql")
+	defer db.Close()
+
+	err = migrations.Check(ctx, cfg.Schema, db.Primary().DB, svc.Logger)
+	utils.Must(svc.Logger, err, "unexpected schema version")
+
+	userRepository := user_repo.NewUserRepository(db, svc.Logger)
+	postRepository, err := post_repo.NewPostRepository(cfg.Posts, db, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to create posts repository")
+	checkpointRepository := post_repo.NewCheckpointRepository(db, svc.Logger)
+
+	handlers := []cdc.Handler{cdc.NewFeedHandler(postRepository, userRepository, svc.Logger)}
+	if cfg.SearchIndex.Enabled {
+		searchIndex, err := user_search.NewUserSearchIndex(cfg.SearchIndex, svc.Logger)
+		utils.Must(svc.Logger, err, "failed to connect to user search index")
+		handlers = append(handlers, cdc.NewSearchHandler(searchIndex, svc.Logger))
+	}
+
+	consumer, err := cdc.NewConsumer(
+		ctx,
+		cfg.CDC,
+		checkpointRepository,
+		handlers,
+		svc.StatRegistry,
+		svc.Logger,
+	)
+	utils.Must(svc.Logger, err, "failed to start binlog consumer")
+	defer consumer.Close()
+
+	svc.SetProcessor(
+		consumer,
+		[]processor.MiddlewareFunc{
+			middleware.NewRecoverMiddleware(svc.Logger),
+			middleware.NewDefaultTaskLogMiddleware(svc.Logger),
+		},
+		nil,
+	)
+
+	service.Serve(ctx, svc.Logger, cfg.ServeConfig, svc)
+}
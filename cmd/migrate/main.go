@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/migrations"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/service"
+	"github.com/antonpriyma/otus-highload/pkg/migrate"
+	"github.com/antonpriyma/otus-highload/pkg/utils"
+)
+
+const usage = `usage: migrate -config migrate.yaml <command>
+
+commands:
+  up            apply all pending migrations
+  down [n]      revert the last n migrations, 1 by default
+  to <version>  migrate up or down to version, 0 reverts everything
+  status        list migrations and whether they are applied
+  version       print the schema version`
+
+type AppConfig struct {
+	service.Config `mapstructure:",squash"`
+
+	Database   mysql_client.Config `mapstructure:"database"`
+	Migrations migrate.Config      `mapstructure:"migrations"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	var cfg AppConfig
+	cfg.Version = service.Version{
+		Dist:    "local",
+		Release: "local",
+	}
+
+	svc := service.New(&cfg)
+	ctx := context.Background()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := mysql_client.NewProvider(cfg.Database, svc.StatRegistry, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to connect to mysql")
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(cfg.Migrations, db.Primary().DB, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to load migrations")
+
+	err = run(ctx, migrator, flag.Arg(0), flag.Args()[1:])
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	utils.Must(svc.Logger, err, "migrate failed")
+}
+
+var errUsage = errors.New("invalid usage")
+
+func run(ctx context.Context, migrator *migrate.Migrator, command string, args []string) error {
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return errUsage
+			}
+			steps = n
+		}
+		return migrator.Down(ctx, steps)
+	case "to":
+		if len(args) != 1 {
+			return errUsage
+		}
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version < 0 {
+			return errUsage
+		}
+		return migrator.To(ctx, version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(statuses)
+		return nil
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d (latest %d)\n", version, migrator.Latest())
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func printStatus(statuses []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		name, state, appliedAt := s.Migration.Name, "pending", ""
+		if name == "" {
+			name = "(unknown to this build)"
+		}
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Dirty {
+			state = "dirty"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Migration.Version, name, state, appliedAt)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/migrations"
+	"github.com/antonpriyma/otus-highload/internal/app/notification/digest"
+	notification_repo "github.com/antonpriyma/otus-highload/internal/app/notification/repository/mysql"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/email/smtp"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor/middleware"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor/procservice"
+	"github.com/antonpriyma/otus-highload/pkg/framework/service"
+	"github.com/antonpriyma/otus-highload/pkg/utils"
+)
+
+type AppConfig struct {
+	service.Config `mapstructure:",squash"`
+
+	Processor   procservice.Config  `mapstructure:"processor"`
+	ServeConfig service.ServeConfig `mapstructure:"serve_config"`
+	Database    mysql_client.Config `mapstructure:"database"`
+	Schema      migrations.Config   `mapstructure:"schema"`
+	SMTP        smtp.Config         `mapstructure:"smtp"`
+	Digest      digest.Config       `mapstructure:"digest"`
+}
+
+func (a AppConfig) ProcessorConfig() procservice.Config {
+	return a.Processor
+}
+
+func main() {
+	var cfg AppConfig
+	cfg.Version = service.Version{
+		Dist:    "local",
+		Release: "local",
+	}
+
+	svc := procservice.New(&cfg)
+	ctx := context.Background()
+
+	db, err := mysql_client.NewProvider(cfg.Database, svc.StatRegistry, svc.Logger)
+	utils.Must(svc.Logger, err, "failed to connect to mysql")
+	defer db.Close()
+
+	err = migrations.Check(ctx, cfg.Schema, db.Primary().DB, svc.Logger)
+	utils.Must(svc.Logger, err, "unexpected schema version")
+
+	digestRepository := notification_repo.NewDigestRepository(db, svc.Logger)
+	inboxRepository := notification_repo.NewInboxRepository(db, svc.Logger)
+
+	sender := smtp.NewSender(cfg.SMTP, nil, svc.Logger, svc.StatRegistry)
+
+	svc.SetProcessor(
+		digest.NewScheduler(cfg.Digest, digestRepository, inboxRepository, sender, svc.StatRegistry, svc.Logger),
+		[]processor.MiddlewareFunc{
+			middleware.NewRecoverMiddleware(svc.Logger),
+			middleware.NewDefaultTaskLogMiddleware(svc.Logger),
+		},
+		nil,
+	)
+
+	service.Serve(ctx, svc.Logger, cfg.ServeConfig, svc)
+}
@@ -7,17 +7,25 @@ import (
 	"time"
 
 	mysql2 "github.com/antonpriyma/otus-highload/internal/app/post/repository/mysql"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	redis_client "github.com/antonpriyma/otus-highload/pkg/clients/redis"
 	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
 )
 
 func main() {
-	postRepository, err := mysql2.NewPostRepository(mysql2.Config{DataSourceName: "otus:otus@tcp(localhost:s)/otus"}, log.Default())
+	db, err := mysql_client.NewProvider(mysql_client.Config{Primary: "otus:otus@tcp(localhost:3306)/otus"}, stub.NewStubRegistry(), log.Default())
+	if err != nil {
+		panic(err)
+	}
 
-	userRepository, err := mysql.NewUserRepository(mysql.Config{DataSourceName: "otus:otus@tcp(localhost:s)/otus"}, log.Default())
+	postRepository, err := mysql2.NewPostRepository(mysql2.Config{Redis: redis_client.Config{Addrs: []string{"localhost:6379"}}}, db, log.Default())
 	if err != nil {
 		panic(err)
 	}
 
+	userRepository := mysql.NewUserRepository(db, log.Default())
+
 	IDs, err := userRepository.GetAllUsersIDs(context.Background())
 	if err != nil {
 		panic(err)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	user_repo "github.com/antonpriyma/otus-highload/internal/app/user/repository/mysql"
+	user_search "github.com/antonpriyma/otus-highload/internal/app/user/repository/redis"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	redis_client "github.com/antonpriyma/otus-highload/pkg/clients/redis"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+)
+
+const batchSize = 1000
+
+// Adds existing users to the search index, cmd/feed-cdc keeps it from then on.
+// Indexing a user twice is harmless, so the script may run while feed-cdc does.
+func main() {
+	ctx := context.Background()
+
+	db, err := mysql_client.NewProvider(mysql_client.Config{Primary: "otus:otus@tcp(localhost:3306)/otus"}, stub.NewStubRegistry(), log.Default())
+	if err != nil {
+		panic(err)
+	}
+
+	index, err := user_search.NewUserSearchIndex(user_search.Config{Redis: redis_client.Config{Addrs: []string{"localhost:6379"}}}, log.Default())
+	if err != nil {
+		panic(err)
+	}
+
+	userRepository := user_repo.NewUserRepository(db, log.Default())
+
+	IDs, err := userRepository.GetAllUsersIDs(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Default().Info("Start indexing users")
+
+	for start := 0; start < len(IDs); start += batchSize {
+		end := start + batchSize
+		if end > len(IDs) {
+			end = len(IDs)
+		}
+
+		batch := make([]models.UserID, 0, end-start)
+		for _, id := range IDs[start:end] {
+			batch = append(batch, models.UserID(id))
+		}
+
+		users, err := userRepository.GetUsers(ctx, batch)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, user := range users {
+			if err := index.IndexUser(ctx, user.ID, user.FirstName, user.SecondName); err != nil {
+				panic(err)
+			}
+		}
+
+		log.Default().Infof("Indexed users %d/%d", end, len(IDs))
+	}
+}
@@ -0,0 +1,137 @@
+package datagen
+
+import (
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+type Format string
+
+const (
+	// FormatMySQL inserts the rows into the otus database.
+	FormatMySQL Format = "mysql"
+	// FormatCSV and FormatJSONL write a file per table and chunk, to build
+	// load test ammo from or to load elsewhere.
+	FormatCSV   Format = "csv"
+	FormatJSONL Format = "jsonl"
+)
+
+type Config struct {
+	// Seed makes runs reproducible: the same config gives the same rows,
+	// whatever the number of workers.
+	Seed int64 `mapstructure:"seed"`
+	// Until is the date, 2006-01-02, generated posts and messages end at.
+	// Today by default, set it to get the same timestamps on every run.
+	Until string `mapstructure:"until"`
+
+	Users    UsersConfig   `mapstructure:"users"`
+	Friends  FriendsConfig `mapstructure:"friends"`
+	Posts    HistoryConfig `mapstructure:"posts"`
+	Messages HistoryConfig `mapstructure:"messages"`
+	Output   OutputConfig  `mapstructure:"output"`
+
+	// ChunkSize is how many users, posts or messages are generated as a
+	// unit, chunks are what workers take and what is resumed.
+	ChunkSize int `mapstructure:"chunk_size"`
+	// BatchSize bounds the rows of one multi-row INSERT.
+	BatchSize int `mapstructure:"batch_size"`
+	Workers   int `mapstructure:"workers"`
+	// Progress is the file done chunks are recorded in. A rerun with the
+	// same config skips them, a different config is refused.
+	Progress string `mapstructure:"progress"`
+}
+
+type UsersConfig struct {
+	Count int `mapstructure:"count"`
+	// Password of every user, it is hashed once.
+	Password string `mapstructure:"password"`
+}
+
+// FriendsConfig describes the friendship graph. Every user befriends a
+// number of others drawn from a power law with exponent Alpha, bounded by
+// Min and Max, so that a few users have most of the friends. Min 0
+// generates no friendships.
+type FriendsConfig struct {
+	Min   int     `mapstructure:"min"`
+	Max   int     `mapstructure:"max"`
+	Alpha float64 `mapstructure:"alpha"`
+}
+
+type HistoryConfig struct {
+	Count int `mapstructure:"count"`
+	// Days is how far before Until the history starts.
+	Days int `mapstructure:"days"`
+}
+
+type OutputConfig struct {
+	Format Format `mapstructure:"format"`
+	// Dir is where files are written, unused for mysql.
+	Dir string `mapstructure:"dir"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Until == "" {
+		c.Until = time.Now().UTC().Format(dateLayout)
+	}
+	if c.Users.Password == "" {
+		c.Users.Password = "password"
+	}
+	if c.Friends.Max <= 0 {
+		c.Friends.Max = 1000
+	}
+	if c.Friends.Alpha <= 1 {
+		c.Friends.Alpha = 2.5
+	}
+	if c.Posts.Days <= 0 {
+		c.Posts.Days = 365
+	}
+	if c.Messages.Days <= 0 {
+		c.Messages.Days = 90
+	}
+	if c.Output.Format == "" {
+		c.Output.Format = FormatMySQL
+	}
+	if c.Output.Dir == "" {
+		c.Output.Dir = "datagen-output"
+	}
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = 10000
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 1000
+	}
+	if c.Workers <= 0 {
+		c.Workers = 4
+	}
+
+	return c
+}
+
+const dateLayout = "2006-01-02"
+
+func (c Config) validate() error {
+	if _, err := time.Parse(dateLayout, c.Until); err != nil {
+		return errors.Wrap(err, "until is not a date")
+	}
+	if c.Friends.Min < 0 || c.Friends.Min > c.Friends.Max {
+		return errors.Errorf("friends min %d is not within 0 and max %d", c.Friends.Min, c.Friends.Max)
+	}
+	if c.Users.Count < 2 && (c.Friends.Min > 0 || c.Messages.Count > 0) {
+		return errors.New("friends and messages need at least two users")
+	}
+	if c.Messages.Count > 0 && c.Friends.Min == 0 {
+		return errors.New("messages are sent to friends, friends min must be positive")
+	}
+	if c.Users.Count == 0 && c.Posts.Count > 0 {
+		return errors.New("posts need users")
+	}
+
+	switch c.Output.Format {
+	case FormatMySQL, FormatCSV, FormatJSONL:
+	default:
+		return errors.Errorf("unknown output format %q", c.Output.Format)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package datagen fills the otus database with generated users, friendships,
+// posts and messages for load tests, or exports them to files.
+package datagen
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// stage generates a table chunk by chunk. Stages run one after another, the
+// rows of a stage reference the ones of the previous stages.
+type stage struct {
+	name     string
+	count    int
+	generate func(chunk int) table
+}
+
+type Generator struct {
+	cfg    Config
+	gen    generator
+	sink   sink
+	logger log.Logger
+}
+
+// New needs db for the mysql format only.
+func New(cfg Config, db *mysql_client.Provider, logger log.Logger) (*Generator, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	until, _ := time.Parse(dateLayout, cfg.Until)
+
+	// users log in with the same password, there is no point in hashing it per user
+	password, err := bcrypt.GenerateFromPassword([]byte(cfg.Users.Password), bcrypt.MinCost)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hash password")
+	}
+
+	var s sink
+	switch cfg.Output.Format {
+	case FormatMySQL:
+		if db == nil {
+			return nil, errors.New("mysql output needs a database")
+		}
+		s = mysqlSink{db: db, batchSize: cfg.BatchSize}
+	default:
+		if err := os.MkdirAll(cfg.Output.Dir, 0o755); err != nil {
+			return nil, errors.Wrap(err, "failed to create output dir")
+		}
+		s = fileSink{dir: cfg.Output.Dir, format: cfg.Output.Format}
+	}
+
+	return &Generator{
+		cfg:    cfg,
+		gen:    generator{cfg: cfg, until: until, password: string(password)},
+		sink:   s,
+		logger: logger,
+	}, nil
+}
+
+// Generate skips the chunks recorded in the progress file, an interrupted
+// run is resumed by running it again.
+func (g *Generator) Generate(ctx context.Context) error {
+	p, err := openProgress(g.cfg.Progress, fingerprint(g.cfg))
+	if err != nil {
+		return err
+	}
+	defer p.close()
+
+	friendships := g.cfg.Users.Count
+	if g.cfg.Friends.Min == 0 {
+		friendships = 0
+	}
+
+	for _, s := range []stage{
+		{name: "users", count: g.cfg.Users.Count, generate: g.gen.users},
+		{name: "friends", count: friendships, generate: g.gen.friends},
+		{name: "posts", count: g.cfg.Posts.Count, generate: g.gen.posts},
+		{name: "messages", count: g.cfg.Messages.Count, generate: g.gen.messages},
+	} {
+		if err := g.run(ctx, s, p); err != nil {
+			return errors.Wrapf(err, "failed to generate %s", s.name)
+		}
+	}
+
+	return nil
+}
+
+func (g *Generator) run(ctx context.Context, s stage, p *progress) error {
+	chunks := (s.count + g.cfg.ChunkSize - 1) / g.cfg.ChunkSize
+	logger := g.logger.WithFields(log.Fields{"stage": s.name, "chunks": chunks})
+	logger.Info("stage started")
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	todo := make(chan int)
+	// a worker stops on its first error
+	errs := make(chan error, g.cfg.Workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < g.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for chunk := range todo {
+				t := s.generate(chunk)
+				err := g.sink.write(runCtx, t, chunk)
+				if err == nil {
+					err = p.markDone(s.name, chunk)
+				}
+				if err != nil {
+					errs <- errors.Wrapf(err, "chunk %d", chunk)
+					cancel()
+					return
+				}
+
+				logger.WithFields(log.Fields{"chunk": chunk, "rows": len(t.rows)}).Debug("chunk done")
+			}
+		}()
+	}
+
+feed:
+	for chunk := 0; chunk < chunks; chunk++ {
+		if p.isDone(s.name, chunk) {
+			continue
+		}
+
+		select {
+		case todo <- chunk:
+		case <-runCtx.Done():
+			break feed
+		}
+	}
+	close(todo)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	logger.Info("stage done")
+
+	return nil
+}
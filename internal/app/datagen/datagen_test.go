@@ -0,0 +1,136 @@
+package datagen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(dir string) Config {
+	return Config{
+		Seed:      7,
+		Until:     "2024-01-01",
+		Users:     UsersConfig{Count: 500},
+		Friends:   FriendsConfig{Min: 2, Max: 100, Alpha: 2.2},
+		Posts:     HistoryConfig{Count: 300},
+		Messages:  HistoryConfig{Count: 300},
+		Output:    OutputConfig{Format: FormatCSV, Dir: dir},
+		ChunkSize: 64,
+	}
+}
+
+func generate(t *testing.T, cfg Config) map[string]string {
+	g, err := New(cfg, nil, log.Null)
+	require.NoError(t, err)
+	// the hash is salted
+	g.gen.password = "hash"
+	require.NoError(t, g.Generate(context.Background()))
+
+	files := map[string]string{}
+	entries, err := os.ReadDir(cfg.Output.Dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(cfg.Output.Dir, entry.Name()))
+		require.NoError(t, err)
+		files[entry.Name()] = string(content)
+	}
+
+	return files
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.Workers = 1
+	one := generate(t, cfg)
+
+	cfg = testConfig(t.TempDir())
+	cfg.Workers = 4
+	many := generate(t, cfg)
+
+	// 8 chunks of users and friends, 5 of posts and messages
+	require.Len(t, one, 26)
+	require.Equal(t, one, many)
+}
+
+func TestFriendsFollowPowerLaw(t *testing.T) {
+	cfg := testConfig("").withDefaults()
+	g := generator{cfg: cfg}
+
+	degrees := make([]int, 0, cfg.Users.Count)
+	for user := 0; user < cfg.Users.Count; user++ {
+		friends := g.friendsOf(user)
+		require.Equal(t, friends, g.friendsOf(user))
+
+		seen := map[int]bool{}
+		for _, friend := range friends {
+			require.NotEqual(t, user, friend)
+			require.False(t, seen[friend])
+			seen[friend] = true
+		}
+		degrees = append(degrees, len(friends))
+	}
+
+	sort.Ints(degrees)
+	require.Equal(t, cfg.Friends.Min, degrees[0])
+	require.LessOrEqual(t, degrees[len(degrees)-1], cfg.Friends.Max)
+	// most users have few friends, some have a lot
+	require.LessOrEqual(t, degrees[len(degrees)/2], 3*cfg.Friends.Min)
+	require.GreaterOrEqual(t, degrees[len(degrees)-1], 10*cfg.Friends.Min)
+}
+
+// failingSink fails a chunk once.
+type failingSink struct {
+	mu      sync.Mutex
+	failed  bool
+	written []string
+}
+
+func (s *failingSink) write(_ context.Context, t table, chunk int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.name == "post" && chunk == 2 && !s.failed {
+		s.failed = true
+		return errors.New("write failed")
+	}
+	s.written = append(s.written, key(t.name, chunk))
+
+	return nil
+}
+
+func TestGenerateResumes(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.Workers = 1
+	cfg.Progress = filepath.Join(cfg.Output.Dir, "progress")
+
+	g, err := New(cfg, nil, log.Null)
+	require.NoError(t, err)
+	sink := &failingSink{}
+	g.sink = sink
+
+	require.Error(t, g.Generate(context.Background()))
+	require.Contains(t, sink.written, "post 1")
+	require.NotContains(t, sink.written, "messages 0")
+
+	// a torn record is not taken for chunk 1 of messages
+	f, err := os.OpenFile(cfg.Progress, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("messages 1")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	sink.written = nil
+	require.NoError(t, g.Generate(context.Background()))
+	require.Equal(t, []string{"post 2", "post 3", "post 4", "messages 0", "messages 1", "messages 2", "messages 3", "messages 4"}, sink.written)
+
+	cfg.Seed++
+	_, err = openProgress(cfg.Progress, fingerprint(cfg.withDefaults()))
+	require.ErrorIs(t, err, ErrProgressMismatch)
+}
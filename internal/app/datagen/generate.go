@@ -0,0 +1,229 @@
+package datagen
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// namespace of the ids of generated rows, they are derived from the seed and
+// the index of the row so that any chunk can be generated on its own.
+var namespace = uuid.MustParse("8f6b9a4e-3c2d-4f61-9d7a-5b0e2c1a7f34")
+
+// table is a generated chunk of rows of a table. Values are strings, ints,
+// times and uuids, sinks format them.
+type table struct {
+	name    string
+	columns []string
+	rows    [][]interface{}
+}
+
+// generator makes rows. A chunk depends on the config and its number only.
+type generator struct {
+	cfg   Config
+	until time.Time
+	// password is the hash shared by all users
+	password string
+}
+
+func (g generator) rand(kind string, n int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s/%d", g.cfg.Seed, kind, n)
+
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+func (g generator) id(kind string, n int) uuid.UUID {
+	return uuid.NewSHA1(namespace, []byte(fmt.Sprintf("%d/%s/%d", g.cfg.Seed, kind, n)))
+}
+
+// span returns the indexes of chunk out of count rows.
+func (g generator) span(chunk int, count int) (int, int) {
+	from := chunk * g.cfg.ChunkSize
+	to := from + g.cfg.ChunkSize
+	if to > count {
+		to = count
+	}
+
+	return from, to
+}
+
+func (g generator) users(chunk int) table {
+	rnd := g.rand("users", chunk)
+	t := table{
+		name:    "users",
+		columns: []string{"uuid", "username", "first_name", "second_name", "age", "sex", "biography", "city", "password"},
+	}
+
+	from, to := g.span(chunk, g.cfg.Users.Count)
+	for i := from; i < to; i++ {
+		sex := rnd.Intn(2)
+		firstName := maleFirstNames[rnd.Intn(len(maleFirstNames))]
+		secondName := surnames[rnd.Intn(len(surnames))]
+		if sex == 1 {
+			firstName = femaleFirstNames[rnd.Intn(len(femaleFirstNames))]
+			secondName += "а"
+		}
+
+		age := 18 + int(math.Abs(rnd.NormFloat64())*15)
+		if age > 90 {
+			age = 90
+		}
+
+		t.rows = append(t.rows, []interface{}{
+			g.id("users", i),
+			fmt.Sprintf("user_%d_%d", g.cfg.Seed, i),
+			firstName,
+			secondName,
+			age,
+			sex,
+			biography(rnd),
+			// the square leans towards the first, biggest cities
+			cities[int(math.Pow(rnd.Float64(), 2)*float64(len(cities)))],
+			g.password,
+		})
+	}
+
+	return t
+}
+
+func biography(rnd *rand.Rand) string {
+	n := 1 + rnd.Intn(3)
+	picked := make([]string, 0, n)
+	for _, i := range rnd.Perm(len(interests))[:n] {
+		picked = append(picked, interests[i])
+	}
+
+	return "Люблю " + strings.Join(picked, ", ")
+}
+
+// friendsOf returns the users that user befriends, users that befriend it
+// are not included. The number follows a power law.
+func (g generator) friendsOf(user int) []int {
+	rnd := g.rand("friends", user)
+	cfg := g.cfg.Friends
+
+	u := 1 - rnd.Float64()
+	degree := int(float64(cfg.Min) * math.Pow(u, -1/(cfg.Alpha-1)))
+	if degree > cfg.Max {
+		degree = cfg.Max
+	}
+	if degree > g.cfg.Users.Count-1 {
+		degree = g.cfg.Users.Count - 1
+	}
+
+	seen := make(map[int]bool, degree)
+	res := make([]int, 0, degree)
+	for len(res) < degree {
+		friend := rnd.Intn(g.cfg.Users.Count - 1)
+		if friend >= user {
+			friend++
+		}
+		if seen[friend] {
+			continue
+		}
+		seen[friend] = true
+		res = append(res, friend)
+	}
+
+	return res
+}
+
+// friends stores every friendship once, the lesser index first, both users
+// may pick each other.
+func (g generator) friends(chunk int) table {
+	t := table{
+		name:    "friends",
+		columns: []string{"user1", "user2"},
+	}
+
+	from, to := g.span(chunk, g.cfg.Users.Count)
+	for i := from; i < to; i++ {
+		for _, friend := range g.friendsOf(i) {
+			user1, user2 := i, friend
+			if user1 > user2 {
+				user1, user2 = user2, user1
+			}
+			t.rows = append(t.rows, []interface{}{g.id("users", user1), g.id("users", user2)})
+		}
+	}
+
+	return t
+}
+
+func (g generator) posts(chunk int) table {
+	rnd := g.rand("posts", chunk)
+	// a few users write most of the posts
+	authors := rand.NewZipf(rnd, 1.1, 100, uint64(g.cfg.Users.Count-1))
+	t := table{
+		name:    "post",
+		columns: []string{"uuid", "user_id", "text", "created_at"},
+	}
+
+	from, to := g.span(chunk, g.cfg.Posts.Count)
+	for i := from; i < to; i++ {
+		t.rows = append(t.rows, []interface{}{
+			g.id("post", i),
+			g.id("users", int(authors.Uint64())),
+			sentence(rnd, 5, 40),
+			g.moment(rnd, g.cfg.Posts.Days),
+		})
+	}
+
+	return t
+}
+
+// messages are exchanged by friends. The client message id keeps a rerun
+// from sending them twice.
+func (g generator) messages(chunk int) table {
+	rnd := g.rand("messages", chunk)
+	t := table{
+		name:    "messages",
+		columns: []string{"sender_uuid", "receiver_uuid", "text", "client_msg_id", "created_at"},
+	}
+
+	from, to := g.span(chunk, g.cfg.Messages.Count)
+	for i := from; i < to; i++ {
+		sender := rnd.Intn(g.cfg.Users.Count)
+		friends := g.friendsOf(sender)
+		receiver := friends[rnd.Intn(len(friends))]
+		if rnd.Intn(2) == 0 {
+			sender, receiver = receiver, sender
+		}
+
+		t.rows = append(t.rows, []interface{}{
+			g.id("users", sender),
+			g.id("users", receiver),
+			sentence(rnd, 1, 20),
+			fmt.Sprintf("datagen-%d-%d", g.cfg.Seed, i),
+			g.moment(rnd, g.cfg.Messages.Days),
+		})
+	}
+
+	return t
+}
+
+// moment returns a time within days before until.
+func (g generator) moment(rnd *rand.Rand, days int) time.Time {
+	return g.until.Add(-time.Duration(rnd.Int63n(int64(days) * int64(24*time.Hour)))).Truncate(time.Second)
+}
+
+func sentence(rnd *rand.Rand, least int, most int) string {
+	n := least + rnd.Intn(most-least+1)
+	picked := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		picked = append(picked, words[rnd.Intn(len(words))])
+	}
+
+	text := strings.Join(picked, " ")
+	first, size := utf8.DecodeRuneInString(text)
+
+	return string(unicode.ToUpper(first)) + text[size:] + "."
+}
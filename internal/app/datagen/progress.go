@@ -0,0 +1,123 @@
+package datagen
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+var ErrProgressMismatch = errors.New("progress was recorded for another config")
+
+// progress records done chunks in a file, a line per chunk after a line
+// with the fingerprint of the config.
+type progress struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]bool
+}
+
+// fingerprint covers what the rows depend on, workers and batches do not
+// change them.
+func fingerprint(cfg Config) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d|%s|%+v|%+v|%+v|%+v|%+v|%d",
+		cfg.Seed, cfg.Until, cfg.Users, cfg.Friends, cfg.Posts, cfg.Messages, cfg.Output, cfg.ChunkSize,
+	)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// openProgress keeps progress in memory only when path is empty.
+func openProgress(path string, fingerprint string) (*progress, error) {
+	p := &progress{done: make(map[string]bool)}
+	if path == "" {
+		return p, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to read progress")
+	}
+
+	// the part after the last newline is torn, "post 12" may be the start
+	// of "post 123"
+	lines := strings.Split(string(content), "\n")
+	torn := lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	for i, line := range lines {
+		if i == 0 {
+			if line != fingerprint {
+				return nil, errors.Wrapf(ErrProgressMismatch, "remove %s to start over", path)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		p.done[line] = true
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	header := ""
+	switch {
+	case len(lines) == 0:
+		flags |= os.O_TRUNC
+		header = fingerprint + "\n"
+	case torn != "":
+		// the newline makes a line of the torn part, it is skipped
+		header = "\n"
+	}
+
+	p.file, err = os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open progress")
+	}
+	if _, err := p.file.WriteString(header); err != nil {
+		_ = p.file.Close()
+		return nil, errors.Wrap(err, "failed to write progress")
+	}
+
+	return p, nil
+}
+
+func key(name string, chunk int) string {
+	return name + " " + strconv.Itoa(chunk)
+}
+
+func (p *progress) isDone(name string, chunk int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.done[key(name, chunk)]
+}
+
+func (p *progress) markDone(name string, chunk int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done[key(name, chunk)] = true
+	if p.file == nil {
+		return nil
+	}
+
+	_, err := fmt.Fprintln(p.file, key(name, chunk))
+	return errors.Wrap(err, "failed to write progress")
+}
+
+func (p *progress) close() error {
+	if p.file == nil {
+		return nil
+	}
+
+	return p.file.Close()
+}
@@ -0,0 +1,152 @@
+package datagen
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// sink stores a generated chunk. Storing a chunk again must not duplicate
+// its rows, interrupted chunks are redone on resume.
+type sink interface {
+	write(ctx context.Context, t table, chunk int) error
+}
+
+// mysqlSink inserts batches with INSERT IGNORE, rows of the chunk that are
+// already there are skipped.
+type mysqlSink struct {
+	db        *mysql_client.Provider
+	batchSize int
+}
+
+func (s mysqlSink) write(ctx context.Context, t table, _ int) error {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?,", len(t.columns)), ",") + ")"
+	prefix := "INSERT IGNORE INTO " + t.name + " (" + strings.Join(t.columns, ", ") + ") VALUES "
+
+	for from := 0; from < len(t.rows); from += s.batchSize {
+		to := from + s.batchSize
+		if to > len(t.rows) {
+			to = len(t.rows)
+		}
+
+		values := make([]string, 0, to-from)
+		args := make([]interface{}, 0, (to-from)*len(t.columns))
+		for _, row := range t.rows[from:to] {
+			values = append(values, placeholders)
+			for _, value := range row {
+				// uuid.UUID is a driver.Valuer of the string form
+				if id, ok := value.(uuid.UUID); ok {
+					value = id[:]
+				}
+				args = append(args, value)
+			}
+		}
+
+		_, err := s.db.Writer(ctx).ExecContext(ctx, prefix+strings.Join(values, ","), args...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to insert into %s", t.name)
+		}
+	}
+
+	return nil
+}
+
+// fileSink writes a file per chunk, it is renamed into place once complete.
+type fileSink struct {
+	dir    string
+	format Format
+}
+
+func (s fileSink) write(_ context.Context, t table, chunk int) (err error) {
+	path := filepath.Join(s.dir, fmt.Sprintf("%s-%06d.%s", t.name, chunk, s.format))
+
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create file")
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	switch s.format {
+	case FormatCSV:
+		err = writeCSV(w, t)
+	case FormatJSONL:
+		err = writeJSONL(w, t)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+
+	if err = w.Flush(); err != nil {
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close %s", path)
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), path), "failed to rename file")
+}
+
+func writeCSV(w *bufio.Writer, t table) error {
+	c := csv.NewWriter(w)
+	if err := c.Write(t.columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, value := range row {
+			record[i] = fmt.Sprint(exportValue(value))
+		}
+		if err := c.Write(record); err != nil {
+			return err
+		}
+	}
+	c.Flush()
+
+	return c.Error()
+}
+
+func writeJSONL(w *bufio.Writer, t table) error {
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+
+	for _, row := range t.rows {
+		object := make(map[string]interface{}, len(t.columns))
+		for i, value := range row {
+			object[t.columns[i]] = exportValue(value)
+		}
+		if err := e.Encode(object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportValue formats uuids and times the way MySQL accepts them.
+func exportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case uuid.UUID:
+		return v.String()
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05")
+	default:
+		return v
+	}
+}
@@ -0,0 +1,53 @@
+package datagen
+
+// Russian names with the female forms of surnames, the social network is
+// Russian speaking.
+var (
+	maleFirstNames = []string{
+		"Александр", "Алексей", "Андрей", "Антон", "Артём", "Борис", "Вадим", "Валерий",
+		"Василий", "Виктор", "Владимир", "Геннадий", "Георгий", "Глеб", "Григорий", "Даниил",
+		"Денис", "Дмитрий", "Евгений", "Егор", "Иван", "Игорь", "Илья", "Кирилл",
+		"Константин", "Леонид", "Максим", "Марк", "Михаил", "Никита", "Николай", "Олег",
+		"Павел", "Пётр", "Роман", "Руслан", "Сергей", "Станислав", "Степан", "Тимофей",
+		"Фёдор", "Юрий", "Ярослав",
+	}
+	femaleFirstNames = []string{
+		"Алёна", "Алина", "Алиса", "Анастасия", "Анна", "Валентина", "Валерия", "Варвара",
+		"Вера", "Вероника", "Виктория", "Галина", "Дарья", "Диана", "Ева", "Екатерина",
+		"Елена", "Елизавета", "Жанна", "Зоя", "Ирина", "Карина", "Кира", "Ксения",
+		"Лариса", "Любовь", "Людмила", "Маргарита", "Марина", "Мария", "Надежда", "Наталья",
+		"Нина", "Ольга", "Полина", "Светлана", "София", "Таисия", "Татьяна", "Ульяна",
+		"Юлия", "Яна",
+	}
+	// surnames are in the male form, "а" makes the female one
+	surnames = []string{
+		"Иванов", "Смирнов", "Кузнецов", "Попов", "Васильев", "Петров", "Соколов", "Михайлов",
+		"Новиков", "Фёдоров", "Морозов", "Волков", "Алексеев", "Лебедев", "Семёнов", "Егоров",
+		"Павлов", "Козлов", "Степанов", "Николаев", "Орлов", "Андреев", "Макаров", "Никитин",
+		"Захаров", "Зайцев", "Соловьёв", "Борисов", "Яковлев", "Григорьев", "Романов", "Воробьёв",
+		"Сергеев", "Кузьмин", "Фролов", "Александров", "Дмитриев", "Королёв", "Гусев", "Киселёв",
+		"Ильин", "Максимов", "Поляков", "Сорокин", "Виноградов", "Ковалёв", "Белов", "Медведев",
+		"Антонов", "Тарасов", "Жуков", "Баранов", "Филиппов", "Комаров", "Давыдов", "Беляев",
+	}
+	// cities are weighted by the order, the first ones are the biggest
+	cities = []string{
+		"Москва", "Санкт-Петербург", "Новосибирск", "Екатеринбург", "Казань", "Нижний Новгород",
+		"Челябинск", "Красноярск", "Самара", "Уфа", "Ростов-на-Дону", "Омск", "Краснодар",
+		"Воронеж", "Пермь", "Волгоград", "Саратов", "Тюмень", "Тольятти", "Барнаул",
+		"Ижевск", "Махачкала", "Хабаровск", "Ульяновск", "Иркутск", "Владивосток", "Ярославль",
+		"Томск", "Оренбург", "Кемерово", "Калининград", "Рязань", "Тула", "Пенза", "Киров",
+	}
+	interests = []string{
+		"книги", "путешествия", "фотография", "бег", "велосипед", "горы", "музыка", "кино",
+		"программирование", "шахматы", "кулинария", "футбол", "хоккей", "йога", "рыбалка",
+		"история", "театр", "настольные игры", "садоводство", "плавание", "живопись", "гитара",
+	}
+	words = []string{
+		"сегодня", "вчера", "наконец", "опять", "очень", "совсем", "просто", "кажется", "может",
+		"погода", "город", "работа", "отпуск", "выходные", "проект", "встреча", "друзья", "семья",
+		"кофе", "утро", "вечер", "дорога", "море", "лес", "книга", "фильм", "концерт", "поезд",
+		"отличный", "новый", "долгий", "смешной", "странный", "хороший", "тихий", "важный",
+		"был", "будет", "нашёл", "увидел", "прочитал", "написал", "закончил", "начал", "купил",
+		"и", "но", "а", "в", "на", "с", "по", "за", "после", "перед", "без", "про",
+	}
+)
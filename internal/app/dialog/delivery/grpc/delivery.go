@@ -3,54 +3,168 @@ package grpc
 import (
 	"context"
 	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
 	"github.com/antonpriyma/otus-highload/pkg/dialogs/github.com/antonpriyma/otus-highload/pkg/dialogs"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
 	"github.com/antonpriyma/otus-highload/pkg/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type dialogDelivery struct {
 	logger  log.Logger
 	dialogs models.DialogUsecase
+	groups  models.GroupUsecase
 	dialogs.UnimplementedDialogsServer
 }
 
 func (d dialogDelivery) SendMessage(ctx context.Context, request *dialogs.SendMessageRequest) (*dialogs.SendMessageResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Message == nil {
+		return nil, status.Error(codes.InvalidArgument, "message is required")
+	}
+
 	modelMessage := models.Message{
-		From: models.UserID(request.Message.From),
-		To:   models.UserID(request.Message.To),
-		Text: request.Message.Text,
+		From:            actor,
+		To:              models.UserID(request.Message.To),
+		Text:            request.Message.Text,
+		ClientMessageID: request.ClientMsgId,
 	}
 
-	err := d.dialogs.SendMessage(ctx, modelMessage)
+	messageID, err := d.dialogs.SendMessage(ctx, modelMessage)
 	if err != nil {
-		return nil, err
+		return nil, convertError(err)
 	}
 
-	return &dialogs.SendMessageResponse{}, nil
+	return &dialogs.SendMessageResponse{
+		MessageId: int64(messageID),
+	}, nil
 }
 
 func (d dialogDelivery) GetMessages(ctx context.Context, request *dialogs.GetMessagesRequest) (*dialogs.GetMessagesResponse, error) {
-	modelMessages, err := d.dialogs.GetDialog(ctx, models.UserID(request.User), models.UserID(request.From))
+	actor, err := getActor(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var messages []*dialogs.Message
-	for _, modelMessage := range modelMessages {
-		messages = append(messages, &dialogs.Message{
-			From: string(modelMessage.From),
-			To:   string(modelMessage.To),
-			Text: modelMessage.Text,
-		})
+	modelMessages, err := d.dialogs.GetDialog(ctx, actor, models.UserID(request.From))
+	if err != nil {
+		return nil, convertError(err)
 	}
 
 	return &dialogs.GetMessagesResponse{
-		Messages: messages,
+		Messages: convertModelsToMessages(modelMessages),
+	}, nil
+}
+
+func (d dialogDelivery) EditMessage(ctx context.Context, request *dialogs.EditMessageRequest) (*dialogs.EditMessageResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := d.dialogs.EditMessage(ctx, actor, models.MessageID(request.MessageId), request.Text)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.EditMessageResponse{
+		Message: convertModelToMessage(message),
+	}, nil
+}
+
+func (d dialogDelivery) DeleteMessage(ctx context.Context, request *dialogs.DeleteMessageRequest) (*dialogs.DeleteMessageResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := d.dialogs.DeleteMessage(ctx, actor, models.MessageID(request.MessageId))
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.DeleteMessageResponse{
+		Message: convertModelToMessage(message),
 	}, nil
 }
 
-func NewDelivery(dialogs models.DialogUsecase, logger log.Logger) dialogs.DialogsServer {
+func (d dialogDelivery) HideMessage(ctx context.Context, request *dialogs.HideMessageRequest) (*dialogs.HideMessageResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.dialogs.HideMessage(ctx, actor, models.MessageID(request.MessageId))
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.HideMessageResponse{}, nil
+}
+
+func convertModelToMessage(modelMessage models.Message) *dialogs.Message {
+	message := &dialogs.Message{
+		Id:        int64(modelMessage.ID),
+		From:      string(modelMessage.From),
+		To:        string(modelMessage.To),
+		GroupId:   int64(modelMessage.GroupID),
+		Text:      modelMessage.Text,
+		CreatedAt: modelMessage.CreatedAt.Unix(),
+		Deleted:   modelMessage.Deleted,
+	}
+
+	if modelMessage.Edited() {
+		message.EditedAt = modelMessage.EditedAt.Unix()
+	}
+
+	return message
+}
+
+func convertModelsToMessages(modelMessages []models.Message) []*dialogs.Message {
+	messages := make([]*dialogs.Message, 0, len(modelMessages))
+	for _, modelMessage := range modelMessages {
+		messages = append(messages, convertModelToMessage(modelMessage))
+	}
+
+	return messages
+}
+
+// getActor returns the acting user set by server.NewActorInterceptor.
+func getActor(ctx context.Context) (models.UserID, error) {
+	actor, ok := contextlib.GetUserID(ctx)
+	if !ok || actor == models.EmptyUserID {
+		return models.EmptyUserID, status.Error(codes.Unauthenticated, "actor not found")
+	}
+
+	return actor, nil
+}
+
+func convertError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrGroupNotFound, models.ErrGroupMemberNotFound, models.ErrMessageNotFound, models.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrGroupMemberAlreadyExists, models.ErrClientMessageIDConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, models.ErrGroupPermissionDenied, models.ErrMessageNotSender, models.ErrRecipientNotFriend, models.ErrSenderBlocked):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrMessageEditWindowExpired, models.ErrMessageDeleted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errors.ErrUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	return err
+}
+
+func NewDelivery(dialogs models.DialogUsecase, groups models.GroupUsecase, logger log.Logger) dialogs.DialogsServer {
 	return dialogDelivery{
 		logger:  logger,
 		dialogs: dialogs,
+		groups:  groups,
 	}
 }
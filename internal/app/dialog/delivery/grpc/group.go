@@ -0,0 +1,149 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/dialogs/github.com/antonpriyma/otus-highload/pkg/dialogs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	groupRolesToProto = map[models.GroupRole]dialogs.GroupRole{
+		models.GroupRoleOwner:  dialogs.GroupRole_GROUP_ROLE_OWNER,
+		models.GroupRoleAdmin:  dialogs.GroupRole_GROUP_ROLE_ADMIN,
+		models.GroupRoleMember: dialogs.GroupRole_GROUP_ROLE_MEMBER,
+	}
+	groupRolesFromProto = map[dialogs.GroupRole]models.GroupRole{
+		dialogs.GroupRole_GROUP_ROLE_UNSPECIFIED: models.GroupRoleMember,
+		dialogs.GroupRole_GROUP_ROLE_OWNER:       models.GroupRoleOwner,
+		dialogs.GroupRole_GROUP_ROLE_ADMIN:       models.GroupRoleAdmin,
+		dialogs.GroupRole_GROUP_ROLE_MEMBER:      models.GroupRoleMember,
+	}
+)
+
+func (d dialogDelivery) CreateGroup(ctx context.Context, request *dialogs.CreateGroupRequest) (*dialogs.CreateGroupResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]models.UserID, 0, len(request.Members))
+	for _, member := range request.Members {
+		members = append(members, models.UserID(member))
+	}
+
+	groupID, err := d.groups.CreateGroup(ctx, models.Group{
+		Name:  request.Name,
+		Owner: actor,
+	}, members)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.CreateGroupResponse{
+		GroupId: int64(groupID),
+	}, nil
+}
+
+func (d dialogDelivery) AddGroupMember(ctx context.Context, request *dialogs.AddGroupMemberRequest) (*dialogs.AddGroupMemberResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Member == nil {
+		return nil, status.Error(codes.InvalidArgument, "member is required")
+	}
+
+	err = d.groups.AddGroupMember(ctx, actor, models.GroupMember{
+		GroupID: models.GroupID(request.GroupId),
+		UserID:  models.UserID(request.Member.User),
+		Role:    groupRolesFromProto[request.Member.Role],
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.AddGroupMemberResponse{}, nil
+}
+
+func (d dialogDelivery) RemoveGroupMember(ctx context.Context, request *dialogs.RemoveGroupMemberRequest) (*dialogs.RemoveGroupMemberResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.groups.RemoveGroupMember(ctx, actor, models.GroupID(request.GroupId), models.UserID(request.Member))
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.RemoveGroupMemberResponse{}, nil
+}
+
+func (d dialogDelivery) GetGroupMembers(ctx context.Context, request *dialogs.GetGroupMembersRequest) (*dialogs.GetGroupMembersResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	modelMembers, err := d.groups.GetGroupMembers(ctx, actor, models.GroupID(request.GroupId))
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	members := make([]*dialogs.GroupMember, 0, len(modelMembers))
+	for _, modelMember := range modelMembers {
+		members = append(members, &dialogs.GroupMember{
+			User: string(modelMember.UserID),
+			Role: groupRolesToProto[modelMember.Role],
+		})
+	}
+
+	return &dialogs.GetGroupMembersResponse{
+		Members: members,
+	}, nil
+}
+
+func (d dialogDelivery) SendGroupMessage(ctx context.Context, request *dialogs.SendGroupMessageRequest) (*dialogs.SendMessageResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Message == nil {
+		return nil, status.Error(codes.InvalidArgument, "message is required")
+	}
+
+	messageID, err := d.groups.SendGroupMessage(ctx, models.Message{
+		From:            actor,
+		GroupID:         models.GroupID(request.GroupId),
+		Text:            request.Message.Text,
+		ClientMessageID: request.ClientMsgId,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.SendMessageResponse{
+		MessageId: int64(messageID),
+	}, nil
+}
+
+func (d dialogDelivery) GetGroupMessages(ctx context.Context, request *dialogs.GetGroupMessagesRequest) (*dialogs.GetMessagesResponse, error) {
+	actor, err := getActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	modelMessages, err := d.groups.GetGroupMessages(ctx, actor, models.GroupID(request.GroupId))
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &dialogs.GetMessagesResponse{
+		Messages: convertModelsToMessages(modelMessages),
+	}, nil
+}
@@ -11,13 +11,13 @@ type dialogDelivery struct {
 	dialogs models.DialogUsecase
 }
 
-func (d dialogDelivery) SendMessage(ctx context.Context, message models.Message) error {
-	err := d.dialogs.SendMessage(ctx, message)
+func (d dialogDelivery) SendMessage(ctx context.Context, message models.Message) (models.MessageID, error) {
+	messageID, err := d.dialogs.SendMessage(ctx, message)
 	if err != nil {
-		return err
+		return models.EmptyMessageID, err
 	}
 
-	return nil
+	return messageID, nil
 }
 
 func (d dialogDelivery) GetDialog(ctx context.Context, userID models.UserID, friendID models.UserID) ([]models.Message, error) {
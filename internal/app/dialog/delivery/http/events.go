@@ -0,0 +1,51 @@
+package http
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoerrors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type eventsDelivery struct {
+	logger log.Logger
+	events models.DialogEventUsecase
+}
+
+func NewEventsDelivery(events models.DialogEventUsecase, logger log.Logger) models.DialogEventDelivery {
+	return eventsDelivery{
+		logger: logger,
+		events: events,
+	}
+}
+
+func (d eventsDelivery) SendDialogEvent(ctx context.Context, event models.DialogEvent) error {
+	err := d.events.SendDialogEvent(ctx, event)
+	if err != nil {
+		return errors.Wrap(convertEventError(err), "failed to send dialog event")
+	}
+
+	return nil
+}
+
+// convertEventError answers foreign dialogs as not found, so that events do not reveal them.
+func convertEventError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrUnknownDialogEvent):
+		return echoerrors.ValidationError(err, "unknown dialog event", echoerrors.ValidationErrorFields{"type": echoerrors.FieldInvalid})
+	case errors.Is(err, models.ErrDialogEventRateLimited):
+		return echoerrors.TooManyRequestsError(err)
+	case errors.Is(err, models.ErrMessageNotFound):
+		return echoerrors.NotFoundError(err, "message")
+	case errors.Is(err, models.ErrGroupMemberNotFound, models.ErrGroupNotFound):
+		return echoerrors.NotFoundError(err, "group")
+	case errors.Is(err, models.ErrRecipientNotFriend, models.ErrSenderBlocked):
+		return echoerrors.ForbiddenError(err, echoerrors.ReasonNoAccess, "events can be sent to friends only")
+	case errors.Is(err, errors.ErrUnavailable):
+		return echoerrors.ServiceUnavailableError(err)
+	default:
+		return echoerrors.InternalError(err)
+	}
+}
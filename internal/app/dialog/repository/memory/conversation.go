@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+)
+
+type clientKey struct {
+	From            models.UserID
+	ClientMessageID string
+}
+
+// conversation is append-only, edits and deletes change messages in place.
+type conversation struct {
+	key       ConversationKey
+	messages  []models.Message
+	positions map[models.MessageID]int
+	clientIDs map[clientKey]models.MessageID
+	hidden    map[models.MessageID]map[models.UserID]struct{}
+	// pending ops are not flushed yet, the conversation is kept until they are
+	pending    int
+	lastAccess time.Time
+}
+
+func newConversation(c Conversation) *conversation {
+	conv := &conversation{
+		key:        c.Key,
+		messages:   make([]models.Message, 0, len(c.Messages)),
+		positions:  make(map[models.MessageID]int, len(c.Messages)),
+		clientIDs:  make(map[clientKey]models.MessageID),
+		hidden:     make(map[models.MessageID]map[models.UserID]struct{}, len(c.Hidden)),
+		lastAccess: time.Now(),
+	}
+
+	for _, message := range c.Messages {
+		conv.apply(Op{Type: OpSend, Message: message})
+	}
+	for id, users := range c.Hidden {
+		for _, userID := range users {
+			conv.apply(Op{Type: OpHide, MessageID: id, UserID: userID})
+		}
+	}
+
+	return conv
+}
+
+func (c *conversation) get(id models.MessageID) (models.Message, bool) {
+	pos, ok := c.positions[id]
+	if !ok {
+		return models.Message{}, false
+	}
+
+	return c.messages[pos], true
+}
+
+// apply is idempotent, replays after a crash apply ops already in MySQL.
+func (c *conversation) apply(op Op) {
+	switch op.Type {
+	case OpSend:
+		message := op.Message
+		if _, ok := c.positions[message.ID]; ok {
+			return
+		}
+
+		if n := len(c.messages); n > 0 && c.messages[n-1].ID > message.ID {
+			c.insert(message)
+		} else {
+			c.positions[message.ID] = len(c.messages)
+			c.messages = append(c.messages, message)
+		}
+		if message.ClientMessageID != "" {
+			c.clientIDs[clientKey{From: message.From, ClientMessageID: message.ClientMessageID}] = message.ID
+		}
+	case OpEdit:
+		pos, ok := c.positions[op.MessageID]
+		if !ok || c.messages[pos].Deleted {
+			return
+		}
+		c.messages[pos].Text = op.Text
+		c.messages[pos].EditedAt = op.At
+	case OpDelete:
+		pos, ok := c.positions[op.MessageID]
+		if !ok || c.messages[pos].Deleted {
+			return
+		}
+		c.messages[pos].Text = ""
+		c.messages[pos].Deleted = true
+	case OpHide:
+		users, ok := c.hidden[op.MessageID]
+		if !ok {
+			users = make(map[models.UserID]struct{}, 1)
+			c.hidden[op.MessageID] = users
+		}
+		users[op.UserID] = struct{}{}
+	}
+}
+
+func (c *conversation) insert(message models.Message) {
+	i := sort.Search(len(c.messages), func(i int) bool {
+		return c.messages[i].ID > message.ID
+	})
+
+	c.messages = append(c.messages, models.Message{})
+	copy(c.messages[i+1:], c.messages[i:])
+	c.messages[i] = message
+
+	for j := i; j < len(c.messages); j++ {
+		c.positions[c.messages[j].ID] = j
+	}
+}
+
+// visible returns the history as seen by userID.
+func (c *conversation) visible(userID models.UserID) []models.Message {
+	res := make([]models.Message, 0, len(c.messages))
+	for _, message := range c.messages {
+		if _, hidden := c.hidden[message.ID][userID]; hidden {
+			continue
+		}
+		res = append(res, message)
+	}
+
+	return res
+}
+
+func (c *conversation) snapshot() Conversation {
+	res := Conversation{
+		Key:      c.key,
+		Messages: append([]models.Message(nil), c.messages...),
+		Hidden:   make(map[models.MessageID][]models.UserID, len(c.hidden)),
+	}
+	for id, users := range c.hidden {
+		for userID := range users {
+			res.Hidden[id] = append(res.Hidden[id], userID)
+		}
+	}
+
+	return res
+}
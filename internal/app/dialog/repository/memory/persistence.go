@@ -0,0 +1,252 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/antonpriyma/otus-highload/pkg/wal"
+)
+
+type snapshot struct {
+	NextID        models.MessageID `json:"next_id"`
+	Conversations []Conversation   `json:"conversations"`
+	// Pending ops were not flushed when the snapshot was taken.
+	Pending []pendingOp `json:"pending"`
+}
+
+// recover loads the snapshot and replays the WAL after it. Ops replayed for
+// conversations missing in the snapshot are applied on top of the store,
+// they are flushed again anyway.
+func (r *Repository) recover(ctx context.Context) error {
+	snapshotLSN, data, err := wal.LoadSnapshot(r.cfg.WAL.Dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to load snapshot")
+	}
+
+	if data != nil {
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return errors.Wrap(err, "failed to unmarshal snapshot")
+		}
+
+		r.nextID = snap.NextID
+		for _, c := range snap.Conversations {
+			r.add(newConversation(c))
+		}
+		for _, op := range snap.Pending {
+			conv, err := r.recoveredConversation(ctx, op.Op.Conversation)
+			if err != nil {
+				return err
+			}
+			r.applyPending(conv, op)
+		}
+	}
+
+	r.wal, err = wal.Open(r.cfg.WAL, r.logger)
+	if err != nil {
+		return errors.Wrap(err, "failed to open wal")
+	}
+	if last := r.wal.LastLSN(); last < snapshotLSN {
+		return errors.Wrapf(wal.ErrCorrupted, "wal ends at %d before snapshot %d", last, snapshotLSN)
+	}
+
+	replayed := 0
+	err = r.wal.Replay(snapshotLSN, func(lsn uint64, data []byte) error {
+		var op Op
+		if err := json.Unmarshal(data, &op); err != nil {
+			return errors.Wrapf(err, "failed to unmarshal op %d", lsn)
+		}
+
+		conv, err := r.recoveredConversation(ctx, op.Conversation)
+		if err != nil {
+			return err
+		}
+		r.applyPending(conv, pendingOp{LSN: lsn, Op: op})
+		replayed++
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to replay wal")
+	}
+
+	maxID, err := r.store.MaxMessageID(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get max message id")
+	}
+	if maxID >= r.nextID {
+		r.nextID = maxID + 1
+	}
+
+	r.logger.Infof(
+		"recovered %d conversations from snapshot at %d and %d ops of wal, %d ops to flush",
+		len(r.conversations), snapshotLSN, replayed, len(r.pending),
+	)
+
+	return nil
+}
+
+func (r *Repository) recoveredConversation(ctx context.Context, key ConversationKey) (*conversation, error) {
+	if conv, ok := r.conversations[key]; ok {
+		return conv, nil
+	}
+
+	loaded, err := r.store.LoadConversation(ctx, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load conversation")
+	}
+	loaded.Key = key
+
+	return r.add(newConversation(loaded)), nil
+}
+
+func (r *Repository) run() {
+	defer close(r.done)
+
+	flushTicker := time.NewTicker(r.cfg.FlushInterval)
+	defer flushTicker.Stop()
+	snapshotTicker := time.NewTicker(r.cfg.SnapshotInterval)
+	defer snapshotTicker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			if err := r.flush(context.Background()); err != nil {
+				r.logger.WithError(err).Error("failed to flush dialogs on close, they are kept in wal")
+			}
+			if err := r.snapshot(); err != nil {
+				r.logger.WithError(err).Error("failed to save dialogs snapshot on close")
+			}
+			return
+		case <-flushTicker.C:
+			if err := r.flush(context.Background()); err != nil {
+				r.logger.WithError(err).Error("failed to flush dialogs")
+			}
+		case <-snapshotTicker.C:
+			r.evict()
+			if err := r.snapshot(); err != nil {
+				r.logger.WithError(err).Error("failed to save dialogs snapshot")
+			}
+		}
+	}
+}
+
+// flush writes pending ops to the store in batches, in the order of the WAL.
+func (r *Repository) flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	for {
+		r.mu.Lock()
+		n := len(r.pending)
+		if n > r.cfg.FlushBatch {
+			n = r.cfg.FlushBatch
+		}
+		ops := make([]Op, 0, n)
+		for _, op := range r.pending[:n] {
+			ops = append(ops, op.Op)
+		}
+		r.mu.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		err := r.store.Flush(ctx, ops)
+		if errors.Is(err, ErrOpRejected) {
+			// otherwise a single op that can never be applied would block all flushes
+			err = r.flushEach(ctx, ops)
+		}
+		r.Stat.Flushes.Counter(ctx).WithLabels(stat.Labels{"status": stat.TypedErrorLabel(ctx, err)}).Add(1)
+		if err != nil {
+			return errors.Wrap(err, "failed to flush ops")
+		}
+
+		r.mu.Lock()
+		for _, op := range ops {
+			if conv, ok := r.conversations[op.Conversation]; ok {
+				conv.pending--
+			}
+		}
+		r.pending = append([]pendingOp(nil), r.pending[n:]...)
+		r.mu.Unlock()
+
+		r.Stat.PendingOps.Gauge(ctx).Sub(float64(n))
+	}
+}
+
+// flushEach flushes ops one at a time, dropping the ones the store rejects.
+func (r *Repository) flushEach(ctx context.Context, ops []Op) error {
+	for _, op := range ops {
+		err := r.store.Flush(ctx, []Op{op})
+		if errors.Is(err, ErrOpRejected) {
+			r.logger.ForCtx(ctx).WithError(err).WithFields(log.Fields{
+				"op":         op.Type,
+				"message_id": op.Target(),
+			}).Error("dropped op rejected by the store")
+			r.Stat.DroppedOps.Counter(ctx).Add(1)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshot saves the memory and compacts the WAL up to it.
+func (r *Repository) snapshot() error {
+	r.mu.Lock()
+	// appends hold r.mu, the snapshot is the state exactly at lsn
+	if err := r.wal.Rotate(); err != nil {
+		r.mu.Unlock()
+		return errors.Wrap(err, "failed to rotate wal")
+	}
+	lsn := r.wal.LastLSN()
+
+	snap := snapshot{
+		NextID:        r.nextID,
+		Conversations: make([]Conversation, 0, len(r.conversations)),
+		Pending:       append([]pendingOp(nil), r.pending...),
+	}
+	for _, conv := range r.conversations {
+		snap.Conversations = append(snap.Conversations, conv.snapshot())
+	}
+	r.mu.Unlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal snapshot")
+	}
+
+	if err := wal.SaveSnapshot(r.cfg.WAL.Dir, lsn, data); err != nil {
+		return err
+	}
+
+	return errors.Wrap(r.wal.Compact(lsn), "failed to compact wal")
+}
+
+// evict drops flushed conversations idle for IdleTTL.
+func (r *Repository) evict() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deadline := time.Now().Add(-r.cfg.IdleTTL)
+	for key, conv := range r.conversations {
+		if conv.pending > 0 || conv.lastAccess.After(deadline) {
+			continue
+		}
+
+		for _, message := range conv.messages {
+			delete(r.messages, message.ID)
+		}
+		delete(r.conversations, key)
+		r.Stat.Evictions.Counter(context.Background()).Add(1)
+	}
+}
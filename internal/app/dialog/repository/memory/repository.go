@@ -0,0 +1,355 @@
+// Package memory keeps conversations in memory in front of MySQL.
+//
+// Every change is appended to a write-ahead log on local disk before it is
+// applied, so that it survives a restart. The memory is periodically saved as
+// a snapshot, which allows compacting the log, and changes are flushed to the
+// Store asynchronously. Message ids are allocated here, so only one instance
+// may serve the dialogs of a database.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/antonpriyma/otus-highload/pkg/wal"
+)
+
+type Config struct {
+	// WAL.Dir keeps snapshots too.
+	WAL              wal.Config    `mapstructure:"wal"`
+	SnapshotInterval time.Duration `mapstructure:"snapshot_interval"`
+	FlushInterval    time.Duration `mapstructure:"flush_interval"`
+	// FlushBatch is the most ops flushed in one transaction.
+	FlushBatch int `mapstructure:"flush_batch"`
+	// IdleTTL evicts flushed conversations nobody touched for this long, they
+	// are loaded from the store again on demand.
+	IdleTTL time.Duration `mapstructure:"idle_ttl"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.SnapshotInterval <= 0 {
+		c.SnapshotInterval = 5 * time.Minute
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.FlushBatch <= 0 {
+		c.FlushBatch = 500
+	}
+	if c.IdleTTL <= 0 {
+		c.IdleTTL = time.Hour
+	}
+
+	return c
+}
+
+type repositoryStat struct {
+	Flushes    stat.CounterCtor `labels:"status"`
+	Loads      stat.CounterCtor `labels:"status"`
+	Evictions  stat.CounterCtor
+	PendingOps stat.GaugeCtor
+	DroppedOps stat.CounterCtor
+}
+
+type pendingOp struct {
+	LSN uint64 `json:"lsn"`
+	Op  Op     `json:"op"`
+}
+
+// Repository serves messages from memory. Groups, friendships and blocks
+// are left to the wrapped repository.
+type Repository struct {
+	cfg      Config
+	groups   models.DialogRepository
+	store    Store
+	wal      *wal.Log
+	logger   log.Logger
+	Stat     repositoryStat
+	flushMu  sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu            sync.Mutex
+	conversations map[ConversationKey]*conversation
+	messages      map[models.MessageID]ConversationKey
+	nextID        models.MessageID
+	pending       []pendingOp
+}
+
+// NewRepository recovers the memory from the snapshot and the WAL and starts
+// flushing. Close flushes what is left.
+func NewRepository(
+	ctx context.Context,
+	cfg Config,
+	groups models.DialogRepository,
+	store Store,
+	registry stat.Registry,
+	logger log.Logger,
+) (*Repository, error) {
+	r := &Repository{
+		cfg:           cfg.withDefaults(),
+		groups:        groups,
+		store:         store,
+		logger:        logger,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		conversations: make(map[ConversationKey]*conversation),
+		messages:      make(map[models.MessageID]ConversationKey),
+		nextID:        1,
+	}
+	stat.NewRegistrar(registry.ForSubsystem("dialogs_memory")).MustRegister(&r.Stat)
+
+	if err := r.recover(ctx); err != nil {
+		if r.wal != nil {
+			r.wal.Close() // nolint:errcheck
+		}
+		return nil, err
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+func (r *Repository) SendMessage(ctx context.Context, message models.Message) (models.MessageID, error) {
+	message.GroupID = models.EmptyGroupID
+	return r.send(ctx, message)
+}
+
+func (r *Repository) SendGroupMessage(ctx context.Context, message models.Message) (models.MessageID, error) {
+	message.To = models.EmptyUserID
+	return r.send(ctx, message)
+}
+
+func (r *Repository) send(ctx context.Context, message models.Message) (models.MessageID, error) {
+	key := keyOf(message)
+	conv, err := r.lockConversation(ctx, key)
+	if err != nil {
+		return models.EmptyMessageID, err
+	}
+	defer r.mu.Unlock()
+
+	if message.ClientMessageID != "" {
+		if id, ok := conv.clientIDs[clientKey{From: message.From, ClientMessageID: message.ClientMessageID}]; ok {
+			if stored, _ := conv.get(id); !sameMessage(stored, message) {
+				return models.EmptyMessageID, models.ErrClientMessageIDConflict
+			}
+			return id, nil
+		}
+	}
+
+	message.ID = r.nextID
+	message.CreatedAt = time.Now().Truncate(time.Second)
+	message.EditedAt = time.Time{}
+	message.Deleted = false
+
+	if err := r.append(conv, Op{Type: OpSend, Conversation: key, Message: message}); err != nil {
+		return models.EmptyMessageID, err
+	}
+
+	return message.ID, nil
+}
+
+// sameMessage reports whether message is a retry of stored. Text of an edited
+// or deleted message has changed since, so it is not compared.
+func sameMessage(stored models.Message, message models.Message) bool {
+	if stored.To != message.To || stored.GroupID != message.GroupID {
+		return false
+	}
+	if !stored.EditedAt.IsZero() || stored.Deleted {
+		return true
+	}
+
+	return stored.Text == message.Text
+}
+
+func (r *Repository) GetDialog(ctx context.Context, userID models.UserID, friendID models.UserID) ([]models.Message, error) {
+	conv, err := r.lockConversation(ctx, DialogKey(userID, friendID))
+	if err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	return conv.visible(userID), nil
+}
+
+func (r *Repository) GetGroupMessages(ctx context.Context, groupID models.GroupID, userID models.UserID) ([]models.Message, error) {
+	conv, err := r.lockConversation(ctx, GroupKey(groupID))
+	if err != nil {
+		return nil, err
+	}
+	defer r.mu.Unlock()
+
+	return conv.visible(userID), nil
+}
+
+func (r *Repository) GetMessage(ctx context.Context, messageID models.MessageID) (models.Message, error) {
+	conv, err := r.lockMessage(ctx, messageID)
+	if err != nil {
+		return models.Message{}, err
+	}
+	defer r.mu.Unlock()
+
+	message, _ := conv.get(messageID)
+	return message, nil
+}
+
+func (r *Repository) EditMessage(ctx context.Context, messageID models.MessageID, text string) error {
+	return r.change(ctx, messageID, Op{Type: OpEdit, MessageID: messageID, Text: text, At: time.Now().Truncate(time.Second)})
+}
+
+func (r *Repository) DeleteMessage(ctx context.Context, messageID models.MessageID) error {
+	return r.change(ctx, messageID, Op{Type: OpDelete, MessageID: messageID, At: time.Now().Truncate(time.Second)})
+}
+
+func (r *Repository) HideMessage(ctx context.Context, messageID models.MessageID, userID models.UserID) error {
+	return r.change(ctx, messageID, Op{Type: OpHide, MessageID: messageID, UserID: userID})
+}
+
+func (r *Repository) change(ctx context.Context, messageID models.MessageID, op Op) error {
+	conv, err := r.lockMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	defer r.mu.Unlock()
+
+	op.Conversation = conv.key
+	return r.append(conv, op)
+}
+
+func (r *Repository) CreateGroup(ctx context.Context, group models.Group, members []models.GroupMember) (models.GroupID, error) {
+	return r.groups.CreateGroup(ctx, group, members)
+}
+
+func (r *Repository) GetGroupMember(ctx context.Context, groupID models.GroupID, userID models.UserID) (models.GroupMember, error) {
+	return r.groups.GetGroupMember(ctx, groupID, userID)
+}
+
+func (r *Repository) GetGroupMembers(ctx context.Context, groupID models.GroupID) ([]models.GroupMember, error) {
+	return r.groups.GetGroupMembers(ctx, groupID)
+}
+
+func (r *Repository) AddGroupMember(ctx context.Context, member models.GroupMember) error {
+	return r.groups.AddGroupMember(ctx, member)
+}
+
+func (r *Repository) RemoveGroupMember(ctx context.Context, groupID models.GroupID, userID models.UserID) error {
+	return r.groups.RemoveGroupMember(ctx, groupID, userID)
+}
+
+func (r *Repository) AreFriends(ctx context.Context, userID models.UserID, friendID models.UserID) (bool, error) {
+	return r.groups.AreFriends(ctx, userID, friendID)
+}
+
+func (r *Repository) IsBlocked(ctx context.Context, userID models.UserID, blockedID models.UserID) (bool, error) {
+	return r.groups.IsBlocked(ctx, userID, blockedID)
+}
+
+// Close stops background work, flushing pending ops and saving a snapshot.
+func (r *Repository) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+
+	return r.wal.Close()
+}
+
+// lockConversation returns the conversation of key with r.mu locked, loading
+// it from the store when it is not in memory.
+func (r *Repository) lockConversation(ctx context.Context, key ConversationKey) (*conversation, error) {
+	r.mu.Lock()
+	if conv, ok := r.conversations[key]; ok {
+		conv.lastAccess = time.Now()
+		return conv, nil
+	}
+	r.mu.Unlock()
+
+	loaded, err := r.store.LoadConversation(ctx, key)
+	r.Stat.Loads.Counter(ctx).WithLabels(stat.Labels{"status": stat.TypedErrorLabel(ctx, err)}).Add(1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load conversation")
+	}
+	loaded.Key = key
+
+	r.mu.Lock()
+	// a conversation only changes in memory, a concurrent load got the same
+	if conv, ok := r.conversations[key]; ok {
+		conv.lastAccess = time.Now()
+		return conv, nil
+	}
+
+	return r.add(newConversation(loaded)), nil
+}
+
+// lockMessage returns the conversation of an existing message with r.mu locked.
+func (r *Repository) lockMessage(ctx context.Context, messageID models.MessageID) (*conversation, error) {
+	r.mu.Lock()
+	key, ok := r.messages[messageID]
+	r.mu.Unlock()
+
+	if !ok {
+		var err error
+		key, err = r.store.ConversationOf(ctx, messageID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find conversation of message")
+		}
+	}
+
+	conv, err := r.lockConversation(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := conv.get(messageID); !ok {
+		r.mu.Unlock()
+		return nil, models.ErrMessageNotFound
+	}
+
+	return conv, nil
+}
+
+func (r *Repository) add(conv *conversation) *conversation {
+	r.conversations[conv.key] = conv
+	for _, message := range conv.messages {
+		r.messages[message.ID] = conv.key
+	}
+
+	return conv
+}
+
+// append logs op and applies it to conv, r.mu must be held.
+func (r *Repository) append(conv *conversation, op Op) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal op")
+	}
+
+	lsn, err := r.wal.Append(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to append op to wal")
+	}
+
+	r.applyPending(conv, pendingOp{LSN: lsn, Op: op})
+
+	return nil
+}
+
+func (r *Repository) applyPending(conv *conversation, op pendingOp) {
+	conv.apply(op.Op)
+	conv.pending++
+	r.pending = append(r.pending, op)
+	r.Stat.PendingOps.Gauge(context.Background()).Add(1)
+
+	if op.Op.Type == OpSend {
+		r.messages[op.Op.Message.ID] = conv.key
+		if op.Op.Message.ID >= r.nextID {
+			r.nextID = op.Op.Message.ID + 1
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package memory_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/dialog/repository/memory"
+	dialog_repo "github.com/antonpriyma/otus-highload/internal/app/dialog/repository/mysql"
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/antonpriyma/otus-highload/pkg/wal"
+	"github.com/stretchr/testify/require"
+)
+
+// benchDSNEnv points the MySQL benchmarks to a migrated database with the
+// users of benchUsers, they are skipped otherwise.
+const benchDSNEnv = "DIALOGS_BENCH_DSN"
+
+var benchUsers = [2]models.UserID{
+	"00000000-0000-0000-0000-000000000001",
+	"00000000-0000-0000-0000-000000000002",
+}
+
+// fakeStore is a store without history, which records flushed ops.
+type fakeStore struct {
+	mu      sync.Mutex
+	flushed []memory.Op
+}
+
+func (s *fakeStore) LoadConversation(_ context.Context, key memory.ConversationKey) (memory.Conversation, error) {
+	return memory.Conversation{Key: key}, nil
+}
+
+func (s *fakeStore) ConversationOf(context.Context, models.MessageID) (memory.ConversationKey, error) {
+	return memory.ConversationKey{}, models.ErrMessageNotFound
+}
+
+func (s *fakeStore) MaxMessageID(context.Context) (models.MessageID, error) {
+	return 100, nil
+}
+
+func (s *fakeStore) Flush(_ context.Context, ops []memory.Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushed = append(s.flushed, ops...)
+	return nil
+}
+
+// rejectingStore fails every batch with the rejected message, like a
+// transaction failing on a foreign key.
+type rejectingStore struct {
+	fakeStore
+
+	rejected models.MessageID
+}
+
+func (s *rejectingStore) Flush(ctx context.Context, ops []memory.Op) error {
+	for _, op := range ops {
+		if op.Target() == s.rejected {
+			return errors.Transform(models.ErrGroupNotFound, memory.ErrOpRejected)
+		}
+	}
+
+	return s.fakeStore.Flush(ctx, ops)
+}
+
+func newMemoryRepository(t testing.TB, dir string, store memory.Store, groups models.DialogRepository) *memory.Repository {
+	repo, err := memory.NewRepository(
+		context.Background(),
+		memory.Config{
+			WAL:              wal.Config{Dir: dir, SyncInterval: 10 * time.Millisecond},
+			SnapshotInterval: time.Hour,
+			FlushInterval:    time.Hour,
+		},
+		groups,
+		store,
+		stub.NewStubRegistry(),
+		log.Null,
+	)
+	require.NoError(t, err)
+
+	return repo
+}
+
+func TestRepositoryRecovers(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := &fakeStore{}
+
+	repo := newMemoryRepository(t, dir, store, nil)
+	first, err := repo.SendMessage(ctx, models.Message{From: benchUsers[0], To: benchUsers[1], Text: "hi", ClientMessageID: "c1"})
+	require.NoError(t, err)
+	require.Equal(t, models.MessageID(101), first)
+
+	// a retry is deduplicated
+	retried, err := repo.SendMessage(ctx, models.Message{From: benchUsers[0], To: benchUsers[1], Text: "hi", ClientMessageID: "c1"})
+	require.NoError(t, err)
+	require.Equal(t, first, retried)
+
+	// another message with the same client message id is a conflict
+	_, err = repo.SendMessage(ctx, models.Message{From: benchUsers[0], To: benchUsers[1], Text: "bye", ClientMessageID: "c1"})
+	require.ErrorIs(t, err, models.ErrClientMessageIDConflict)
+
+	second, err := repo.SendMessage(ctx, models.Message{From: benchUsers[1], To: benchUsers[0], Text: "hello"})
+	require.NoError(t, err)
+	require.NoError(t, repo.EditMessage(ctx, first, "hi!"))
+	require.NoError(t, repo.HideMessage(ctx, second, benchUsers[0]))
+
+	// Close flushes and takes a snapshot
+	require.NoError(t, repo.Close())
+	require.Len(t, store.flushed, 4)
+
+	repo = newMemoryRepository(t, dir, store, nil)
+	third, err := repo.SendMessage(ctx, models.Message{From: benchUsers[0], To: benchUsers[1], Text: "again"})
+	require.NoError(t, err)
+	require.Equal(t, models.MessageID(103), third)
+
+	require.NoError(t, repo.DeleteMessage(ctx, third))
+
+	dialog, err := repo.GetDialog(ctx, benchUsers[0], benchUsers[1])
+	require.NoError(t, err)
+	require.Len(t, dialog, 2)
+	require.Equal(t, "hi!", dialog[0].Text)
+	require.True(t, dialog[0].Edited())
+	require.True(t, dialog[1].Deleted)
+
+	dialog, err = repo.GetDialog(ctx, benchUsers[1], benchUsers[0])
+	require.NoError(t, err)
+	require.Len(t, dialog, 3)
+	require.NoError(t, repo.Close())
+}
+
+func TestRepositoryReplaysWAL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := &fakeStore{}
+
+	repo := newMemoryRepository(t, dir, store, nil)
+	id, err := repo.SendMessage(ctx, models.Message{From: benchUsers[0], To: benchUsers[1], Text: "hi"})
+	require.NoError(t, err)
+
+	// a second process opening the same dir sees what a crash would leave
+	crashed := newMemoryRepository(t, copyDir(t, dir), store, nil)
+	message, err := crashed.GetMessage(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "hi", message.Text)
+
+	next, err := crashed.SendMessage(ctx, models.Message{From: benchUsers[1], To: benchUsers[0], Text: "hello"})
+	require.NoError(t, err)
+	require.Equal(t, id+1, next)
+
+	require.NoError(t, crashed.Close())
+	require.NoError(t, repo.Close())
+}
+
+func TestRepositoryDropsRejectedOps(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := &rejectingStore{rejected: 102}
+
+	repo := newMemoryRepository(t, dir, store, nil)
+	for _, text := range []string{"first", "rejected", "third"} {
+		_, err := repo.SendMessage(ctx, models.Message{From: benchUsers[0], To: benchUsers[1], Text: text})
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.EditMessage(ctx, 102, "edited"))
+
+	// the rejected message and its edit are dropped, the rest of the batch is flushed
+	require.NoError(t, repo.Close())
+	require.Len(t, store.flushed, 2)
+	require.Equal(t, models.MessageID(101), store.flushed[0].Target())
+	require.Equal(t, models.MessageID(103), store.flushed[1].Target())
+
+	// nothing is left to flush after a restart
+	repo = newMemoryRepository(t, dir, store, nil)
+	require.NoError(t, repo.Close())
+	require.Len(t, store.flushed, 2)
+}
+
+func copyDir(t testing.TB, dir string) string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	res := t.TempDir()
+	for _, entry := range entries {
+		data, err := os.ReadFile(dir + "/" + entry.Name())
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(res+"/"+entry.Name(), data, 0o644))
+	}
+
+	return res
+}
+
+func benchmarkSend(b *testing.B, repo models.DialogRepository) {
+	ctx := context.Background()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			_, err := repo.SendMessage(ctx, models.Message{From: benchUsers[i%2], To: benchUsers[(i+1)%2], Text: "benchmark " + strconv.Itoa(i)})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func benchmarkGetDialog(b *testing.B, repo models.DialogRepository) {
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		_, err := repo.SendMessage(ctx, models.Message{From: benchUsers[i%2], To: benchUsers[(i+1)%2], Text: "history " + strconv.Itoa(i)})
+		require.NoError(b, err)
+	}
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := repo.GetDialog(ctx, benchUsers[0], benchUsers[1]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func mysqlProvider(b *testing.B) *mysql_client.Provider {
+	dsn := os.Getenv(benchDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s is not set", benchDSNEnv)
+	}
+
+	db, err := mysql_client.NewProvider(mysql_client.Config{Primary: dsn}, stub.NewStubRegistry(), log.Null)
+	require.NoError(b, err)
+	b.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func BenchmarkSendMessage(b *testing.B) {
+	b.Run("memory", func(b *testing.B) {
+		repo := newMemoryRepository(b, b.TempDir(), &fakeStore{}, nil)
+		defer repo.Close()
+		benchmarkSend(b, repo)
+	})
+
+	b.Run("memory_mysql_store", func(b *testing.B) {
+		db := mysqlProvider(b)
+		repo := newMemoryRepository(b, b.TempDir(), dialog_repo.NewMemoryStore(db, log.Null), dialog_repo.NewRepository(db, log.Null))
+		defer repo.Close()
+		benchmarkSend(b, repo)
+	})
+
+	b.Run("mysql", func(b *testing.B) {
+		benchmarkSend(b, dialog_repo.NewRepository(mysqlProvider(b), log.Null))
+	})
+}
+
+func BenchmarkGetDialog(b *testing.B) {
+	b.Run("memory", func(b *testing.B) {
+		repo := newMemoryRepository(b, b.TempDir(), &fakeStore{}, nil)
+		defer repo.Close()
+		benchmarkGetDialog(b, repo)
+	})
+
+	b.Run("mysql", func(b *testing.B) {
+		benchmarkGetDialog(b, dialog_repo.NewRepository(mysqlProvider(b), log.Null))
+	})
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+// ErrOpRejected is returned by stores for ops that can never be applied, e.g.
+// messages of a deleted group. Rejected ops are dropped instead of retried.
+var ErrOpRejected = errors.Typed("op_rejected", "op rejected by the store")
+
+// ConversationKey is a 1:1 dialog with User1 < User2 or a group.
+type ConversationKey struct {
+	User1 models.UserID  `json:"user1,omitempty"`
+	User2 models.UserID  `json:"user2,omitempty"`
+	Group models.GroupID `json:"group,omitempty"`
+}
+
+func DialogKey(userID models.UserID, friendID models.UserID) ConversationKey {
+	if friendID < userID {
+		userID, friendID = friendID, userID
+	}
+
+	return ConversationKey{User1: userID, User2: friendID}
+}
+
+func GroupKey(groupID models.GroupID) ConversationKey {
+	return ConversationKey{Group: groupID}
+}
+
+func keyOf(message models.Message) ConversationKey {
+	if message.GroupID != models.EmptyGroupID {
+		return GroupKey(message.GroupID)
+	}
+
+	return DialogKey(message.From, message.To)
+}
+
+type OpType string
+
+const (
+	OpSend   OpType = "send"
+	OpEdit   OpType = "edit"
+	OpDelete OpType = "delete"
+	OpHide   OpType = "hide"
+)
+
+// Op is a change of a conversation, the unit of the WAL and of flushes.
+type Op struct {
+	Type         OpType          `json:"type"`
+	Conversation ConversationKey `json:"conversation"`
+	// Message is the sent message.
+	Message   models.Message   `json:"message,omitempty"`
+	MessageID models.MessageID `json:"message_id,omitempty"`
+	Text      string           `json:"text,omitempty"`
+	// UserID hides the message.
+	UserID models.UserID `json:"user_id,omitempty"`
+	At     time.Time     `json:"at,omitempty"`
+}
+
+// Target is the id of the sent or changed message.
+func (o Op) Target() models.MessageID {
+	if o.Type == OpSend {
+		return o.Message.ID
+	}
+
+	return o.MessageID
+}
+
+// Conversation is a full history, Hidden lists who hid each message.
+type Conversation struct {
+	Key      ConversationKey                      `json:"key"`
+	Messages []models.Message                     `json:"messages"`
+	Hidden   map[models.MessageID][]models.UserID `json:"hidden,omitempty"`
+}
+
+// Store is the durable storage behind the memory, MySQL in production.
+type Store interface {
+	// LoadConversation returns messages ordered by id.
+	LoadConversation(ctx context.Context, key ConversationKey) (Conversation, error)
+	// ConversationOf returns models.ErrMessageNotFound for unknown messages.
+	ConversationOf(ctx context.Context, messageID models.MessageID) (ConversationKey, error)
+	MaxMessageID(ctx context.Context) (models.MessageID, error)
+	// Flush applies ops in one transaction. Ops are flushed again after a
+	// crash, so applying them twice must be harmless. ErrOpRejected fails the
+	// whole batch, the ops are then flushed one by one.
+	Flush(ctx context.Context, ops []Op) error
+}
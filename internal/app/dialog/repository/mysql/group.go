@@ -0,0 +1,157 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	notification_repo "github.com/antonpriyma/otus-highload/internal/app/notification/repository/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+func (r repository) CreateGroup(ctx context.Context, model models.Group, members []models.GroupMember) (models.GroupID, error) {
+	group := convertModelToGroup(model)
+
+	var id int64
+	err := r.db.InTx(ctx, func(ctx context.Context) error {
+		tx := r.db.Writer(ctx)
+
+		res, err := tx.ExecContext(ctx, "INSERT INTO chat_groups (name, owner_uuid) VALUES (?, UUID_TO_BIN(?))", group.Name, group.OwnerUUID)
+		if err != nil {
+			return errors.Wrap(sqlErrors.Translate(err), "failed to insert into chat_groups")
+		}
+
+		id, err = res.LastInsertId()
+		if err != nil {
+			return errors.Wrap(err, "failed to get group id")
+		}
+
+		for _, model := range members {
+			member := convertModelToGroupMember(model)
+			_, err = tx.ExecContext(ctx, "INSERT INTO chat_group_members (group_id, user_uuid, role) VALUES (?, UUID_TO_BIN(?), ?)", id, member.UserUUID, member.Role)
+			if err != nil {
+				return errors.Wrap(sqlErrors.Translate(err), "failed to insert into chat_group_members")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.EmptyGroupID, err
+	}
+	r.db.Wrote(models.GroupKey(models.GroupID(id)))
+
+	return models.GroupID(id), nil
+}
+
+func (r repository) GetGroupMember(ctx context.Context, groupID models.GroupID, userID models.UserID) (models.GroupMember, error) {
+	var member GroupMember
+	err := r.db.Reader(ctx, models.GroupKey(groupID)).GetContext(ctx, &member, "SELECT group_id, BIN_TO_UUID(user_uuid) as user_uuid, role FROM chat_group_members WHERE group_id = ? AND user_uuid = UUID_TO_BIN(?)", groupID, userID)
+	if err != nil {
+		return models.GroupMember{}, errors.Wrap(sqlErrors.WithNotFound(models.ErrGroupMemberNotFound).Translate(err), "failed to get group member")
+	}
+
+	return convertGroupMemberToModel(member), nil
+}
+
+func (r repository) GetGroupMembers(ctx context.Context, groupID models.GroupID) ([]models.GroupMember, error) {
+	var members []GroupMember
+	err := r.db.Reader(ctx, models.GroupKey(groupID)).SelectContext(ctx, &members, "SELECT group_id, BIN_TO_UUID(user_uuid) as user_uuid, role FROM chat_group_members WHERE group_id = ?", groupID)
+	if err != nil {
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get group members")
+	}
+
+	return convertGroupMembersToModels(members), nil
+}
+
+func (r repository) AddGroupMember(ctx context.Context, model models.GroupMember) error {
+	member := convertModelToGroupMember(model)
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "INSERT INTO chat_group_members (group_id, user_uuid, role) VALUES (?, UUID_TO_BIN(?), ?)", member.GroupID, member.UserUUID, member.Role)
+	if err != nil {
+		return errors.Wrap(sqlErrors.Translate(err), "failed to insert into chat_group_members")
+	}
+	r.db.Wrote(models.GroupKey(model.GroupID))
+
+	return nil
+}
+
+func (r repository) RemoveGroupMember(ctx context.Context, groupID models.GroupID, userID models.UserID) error {
+	res, err := r.db.Writer(ctx).ExecContext(ctx, "DELETE FROM chat_group_members WHERE group_id = ? AND user_uuid = UUID_TO_BIN(?)", groupID, userID)
+	if err != nil {
+		return errors.Wrap(sqlErrors.Translate(err), "failed to delete from chat_group_members")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get affected rows")
+	}
+
+	if affected == 0 {
+		return models.ErrGroupMemberNotFound
+	}
+	r.db.Wrote(models.GroupKey(groupID))
+
+	return nil
+}
+
+// SendGroupMessage stores a group message and the notifications for every
+// member but the sender in one transaction, like SendMessage.
+func (r repository) SendGroupMessage(ctx context.Context, message models.Message) (models.MessageID, error) {
+	message.To = models.EmptyUserID
+
+	var id models.MessageID
+	err := r.db.InTx(ctx, func(ctx context.Context) error {
+		tx := r.db.Writer(ctx)
+
+		var (
+			inserted bool
+			err      error
+		)
+		id, inserted, err = r.insertMessage(ctx, tx, convertModelToMessage(message))
+		if err != nil || !inserted {
+			return err
+		}
+
+		var members []models.UserID
+		err = tx.SelectContext(ctx, &members, "SELECT BIN_TO_UUID(user_uuid) FROM chat_group_members WHERE group_id = ? AND user_uuid <> UUID_TO_BIN(?)", message.GroupID, message.From)
+		if err != nil {
+			return errors.Wrap(sqlErrors.Translate(err), "failed to get group members")
+		}
+
+		notifications := make([]models.Notification, 0, len(members))
+		for _, member := range members {
+			notification, err := models.NewNotification(models.NotificationMessageReceived, message.From, member, models.MessageReceivedPayload{
+				MessageID: id,
+				GroupID:   message.GroupID,
+				Text:      message.Text,
+			})
+			if err != nil {
+				return err
+			}
+			notifications = append(notifications, notification)
+		}
+
+		return notification_repo.WriteOutbox(ctx, tx, notifications)
+	})
+	if err != nil {
+		return models.EmptyMessageID, err
+	}
+	r.db.Wrote(models.GroupKey(message.GroupID), models.MessageKey(id))
+
+	return id, nil
+}
+
+func (r repository) GetGroupMessages(ctx context.Context, groupID models.GroupID, userID models.UserID) ([]models.Message, error) {
+	var messages []Message
+	err := r.db.Reader(ctx, models.GroupKey(groupID)).SelectContext(
+		ctx,
+		&messages,
+		"SELECT "+messageColumns+" FROM messages WHERE group_id = ? "+
+			"AND id NOT IN (SELECT message_id FROM hidden_messages WHERE user_uuid = UUID_TO_BIN(?)) ORDER BY id",
+		groupID, userID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get group messages")
+	}
+
+	return convertMessagesToModels(messages), nil
+}
@@ -0,0 +1,198 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/antonpriyma/otus-highload/internal/app/dialog/repository/memory"
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	notification_repo "github.com/antonpriyma/otus-highload/internal/app/notification/repository/mysql"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+// memoryStore persists the memory repository. It reads from the primary, a
+// lagging replica would miss flushed changes.
+type memoryStore struct {
+	db     *mysql_client.Provider
+	logger log.Logger
+}
+
+func NewMemoryStore(db *mysql_client.Provider, logger log.Logger) memory.Store {
+	return memoryStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func conversationCondition(key memory.ConversationKey) (string, []interface{}) {
+	if key.Group != models.EmptyGroupID {
+		return "group_id = ?", []interface{}{key.Group}
+	}
+
+	return "((sender_uuid = UUID_TO_BIN(?) AND receiver_uuid = UUID_TO_BIN(?)) OR (sender_uuid = UUID_TO_BIN(?) AND receiver_uuid = UUID_TO_BIN(?)))",
+		[]interface{}{key.User1, key.User2, key.User2, key.User1}
+}
+
+func (s memoryStore) LoadConversation(ctx context.Context, key memory.ConversationKey) (memory.Conversation, error) {
+	cond, args := conversationCondition(key)
+	db := s.db.Writer(ctx)
+
+	var messages []Message
+	err := db.SelectContext(ctx, &messages, "SELECT "+messageColumns+" FROM messages WHERE "+cond+" ORDER BY id", args...)
+	if err != nil {
+		return memory.Conversation{}, errors.Wrap(sqlErrors.Translate(err), "failed to select conversation")
+	}
+
+	var hidden []struct {
+		MessageID int64  `db:"message_id"`
+		UserUUID  string `db:"user_uuid"`
+	}
+	err = db.SelectContext(
+		ctx,
+		&hidden,
+		"SELECT message_id, BIN_TO_UUID(user_uuid) as user_uuid FROM hidden_messages WHERE message_id IN (SELECT id FROM messages WHERE "+cond+")",
+		args...,
+	)
+	if err != nil {
+		return memory.Conversation{}, errors.Wrap(sqlErrors.Translate(err), "failed to select hidden messages")
+	}
+
+	res := memory.Conversation{
+		Key:      key,
+		Messages: convertMessagesToModels(messages),
+		Hidden:   make(map[models.MessageID][]models.UserID, len(hidden)),
+	}
+	for _, h := range hidden {
+		id := models.MessageID(h.MessageID)
+		res.Hidden[id] = append(res.Hidden[id], models.UserID(h.UserUUID))
+	}
+
+	return res, nil
+}
+
+func (s memoryStore) ConversationOf(ctx context.Context, messageID models.MessageID) (memory.ConversationKey, error) {
+	var message Message
+	err := s.db.Writer(ctx).GetContext(
+		ctx,
+		&message,
+		"SELECT id, BIN_TO_UUID(sender_uuid) as sender_uuid, BIN_TO_UUID(receiver_uuid) as receiver_uuid, group_id FROM messages WHERE id = ?",
+		messageID,
+	)
+	if err != nil {
+		return memory.ConversationKey{}, errors.Wrap(sqlErrors.WithNotFound(models.ErrMessageNotFound).Translate(err), "failed to get message")
+	}
+
+	if message.GroupID.Valid {
+		return memory.GroupKey(models.GroupID(message.GroupID.Int64)), nil
+	}
+
+	return memory.DialogKey(models.UserID(message.SenderUUID), models.UserID(message.ReceiverUUID.String)), nil
+}
+
+func (s memoryStore) MaxMessageID(ctx context.Context) (models.MessageID, error) {
+	var id sql.NullInt64
+	err := s.db.Writer(ctx).GetContext(ctx, &id, "SELECT MAX(id) FROM messages")
+	if err != nil {
+		return models.EmptyMessageID, errors.Wrap(sqlErrors.Translate(err), "failed to get max message id")
+	}
+
+	return models.MessageID(id.Int64), nil
+}
+
+// Flush inserts messages with the ids given by the memory. Repeated inserts
+// are ignored and edits set the same values, so ops may be flushed twice.
+// Ops referencing removed users, groups or messages and messages whose client
+// message id is taken by another one are rejected.
+func (s memoryStore) Flush(ctx context.Context, ops []memory.Op) error {
+	var written []string
+	err := s.db.InTx(ctx, func(ctx context.Context) error {
+		written = written[:0]
+		tx := s.db.Writer(ctx)
+
+		for _, op := range ops {
+			var err error
+			switch op.Type {
+			case memory.OpSend:
+				err = s.insert(ctx, tx, op.Message)
+				written = append(written, models.MessageKey(op.Message.ID))
+				if op.Message.GroupID != models.EmptyGroupID {
+					written = append(written, models.GroupKey(op.Message.GroupID))
+				} else {
+					written = append(written, models.DialogKey(op.Message.From, op.Message.To))
+				}
+			case memory.OpEdit:
+				_, err = tx.ExecContext(ctx, "UPDATE messages SET text = ?, edited_at = FROM_UNIXTIME(?) WHERE id = ? AND deleted_at IS NULL", op.Text, op.At.Unix(), op.MessageID)
+				written = append(written, models.MessageKey(op.MessageID))
+			case memory.OpDelete:
+				_, err = tx.ExecContext(ctx, "UPDATE messages SET text = '', deleted_at = FROM_UNIXTIME(?) WHERE id = ? AND deleted_at IS NULL", op.At.Unix(), op.MessageID)
+				written = append(written, models.MessageKey(op.MessageID))
+			case memory.OpHide:
+				_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO hidden_messages (message_id, user_uuid) VALUES (?, UUID_TO_BIN(?))", op.MessageID, op.UserID)
+				written = append(written, models.MessageKey(op.MessageID))
+			default:
+				err = errors.Errorf("unknown op %q", op.Type)
+			}
+			if err != nil {
+				err = sqlErrors.Translate(err)
+				// removed parents and taken client message ids never come back, retries are pointless
+				if errors.Is(err, models.ErrUserNotFound, models.ErrGroupNotFound, models.ErrMessageNotFound, models.ErrClientMessageIDConflict) {
+					err = errors.Transform(err, memory.ErrOpRejected)
+				}
+				return errors.Wrapf(err, "failed to flush %s of message %d", op.Type, op.Target())
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.db.Wrote(written...)
+
+	return nil
+}
+
+// insert notifies the receiver of a direct message the first time it is stored.
+func (s memoryStore) insert(ctx context.Context, tx mysql_client.Querier, message models.Message) error {
+	msg := convertModelToMessage(message)
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO messages (id, sender_uuid, receiver_uuid, group_id, text, client_msg_id, created_at) VALUES (?, UUID_TO_BIN(?), UUID_TO_BIN(?), (?), (?), (?), FROM_UNIXTIME(?)) ON DUPLICATE KEY UPDATE id = id",
+		msg.ID, msg.SenderUUID, msg.ReceiverUUID, msg.GroupID, msg.Text, msg.ClientMessageID, message.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		// the duplicate is either this message flushed before or another one with its client message id
+		var stored int
+		err := tx.GetContext(ctx, &stored, "SELECT COUNT(*) FROM messages WHERE id = ?", msg.ID)
+		if err != nil {
+			return err
+		}
+		if stored == 0 {
+			return models.ErrClientMessageIDConflict
+		}
+		return nil
+	}
+	if message.GroupID != models.EmptyGroupID {
+		return nil
+	}
+
+	notification, err := models.NewNotification(models.NotificationMessageReceived, message.From, message.To, models.MessageReceivedPayload{
+		MessageID: message.ID,
+		Text:      message.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	return notification_repo.WriteOutbox(ctx, tx, []models.Notification{notification})
+}
@@ -1,27 +1,61 @@
 package mysql
 
-import "github.com/antonpriyma/otus-highload/internal/app/models"
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+)
 
 type Message struct {
-	SenderUUID   string `db:"sender_uuid"`
-	ReceiverUUID string `db:"receiver_uuid"`
-	Text         string `db:"text"`
+	ID              int64          `db:"id"`
+	SenderUUID      string         `db:"sender_uuid"`
+	ReceiverUUID    sql.NullString `db:"receiver_uuid"`
+	GroupID         sql.NullInt64  `db:"group_id"`
+	Text            string         `db:"text"`
+	ClientMessageID sql.NullString `db:"client_msg_id"`
+	CreatedAt       int64          `db:"created_at"`
+	EditedAt        sql.NullInt64  `db:"edited_at"`
+	DeletedAt       sql.NullInt64  `db:"deleted_at"`
 }
 
 func convertModelToMessage(model models.Message) Message {
 	return Message{
-		SenderUUID:   string(model.From),
-		ReceiverUUID: string(model.To),
-		Text:         model.Text,
+		ID:         int64(model.ID),
+		SenderUUID: string(model.From),
+		ReceiverUUID: sql.NullString{
+			String: string(model.To),
+			Valid:  model.To != models.EmptyUserID,
+		},
+		GroupID: sql.NullInt64{
+			Int64: int64(model.GroupID),
+			Valid: model.GroupID != models.EmptyGroupID,
+		},
+		Text: model.Text,
+		ClientMessageID: sql.NullString{
+			String: model.ClientMessageID,
+			Valid:  model.ClientMessageID != "",
+		},
 	}
 }
 
 func convertMessageToModel(message Message) models.Message {
-	return models.Message{
-		From: models.UserID(message.SenderUUID),
-		To:   models.UserID(message.ReceiverUUID),
-		Text: message.Text,
+	model := models.Message{
+		ID:              models.MessageID(message.ID),
+		From:            models.UserID(message.SenderUUID),
+		To:              models.UserID(message.ReceiverUUID.String),
+		GroupID:         models.GroupID(message.GroupID.Int64),
+		Text:            message.Text,
+		ClientMessageID: message.ClientMessageID.String,
+		CreatedAt:       time.Unix(message.CreatedAt, 0),
+		Deleted:         message.DeletedAt.Valid,
+	}
+
+	if message.EditedAt.Valid {
+		model.EditedAt = time.Unix(message.EditedAt.Int64, 0)
 	}
+
+	return model
 }
 
 func convertMessagesToModels(messages []Message) []models.Message {
@@ -32,3 +66,48 @@ func convertMessagesToModels(messages []Message) []models.Message {
 
 	return res
 }
+
+type Group struct {
+	ID        int64  `db:"id"`
+	Name      string `db:"name"`
+	OwnerUUID string `db:"owner_uuid"`
+}
+
+func convertModelToGroup(model models.Group) Group {
+	return Group{
+		ID:        int64(model.ID),
+		Name:      model.Name,
+		OwnerUUID: string(model.Owner),
+	}
+}
+
+type GroupMember struct {
+	GroupID  int64  `db:"group_id"`
+	UserUUID string `db:"user_uuid"`
+	Role     string `db:"role"`
+}
+
+func convertModelToGroupMember(model models.GroupMember) GroupMember {
+	return GroupMember{
+		GroupID:  int64(model.GroupID),
+		UserUUID: string(model.UserID),
+		Role:     string(model.Role),
+	}
+}
+
+func convertGroupMemberToModel(member GroupMember) models.GroupMember {
+	return models.GroupMember{
+		GroupID: models.GroupID(member.GroupID),
+		UserID:  models.UserID(member.UserUUID),
+		Role:    models.GroupRole(member.Role),
+	}
+}
+
+func convertGroupMembersToModels(members []GroupMember) []models.GroupMember {
+	res := make([]models.GroupMember, 0, len(members))
+	for _, member := range members {
+		res = append(res, convertGroupMemberToModel(member))
+	}
+
+	return res
+}
@@ -2,51 +2,206 @@ package mysql
 
 import (
 	"context"
+
 	"github.com/antonpriyma/otus-highload/internal/app/models"
+	notification_repo "github.com/antonpriyma/otus-highload/internal/app/notification/repository/mysql"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
 	"github.com/antonpriyma/otus-highload/pkg/log"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/jmoiron/sqlx"
 )
 
-type Config struct {
-	DataSourceName string `mapstructure:"data_source_name"`
-}
+// messageColumns selects timestamps as unix seconds, so the DSN does not need parseTime.
+const messageColumns = "id, BIN_TO_UUID(sender_uuid) as sender_uuid, BIN_TO_UUID(receiver_uuid) as receiver_uuid, group_id, text, client_msg_id, " +
+	"UNIX_TIMESTAMP(created_at) as created_at, UNIX_TIMESTAMP(edited_at) as edited_at, UNIX_TIMESTAMP(deleted_at) as deleted_at"
+
 type repository struct {
 	logger log.Logger
-	db     *sqlx.DB
+	db     *mysql_client.Provider
 }
 
-func convertSQLError(err error) error {
-	return err
+// sqlErrors leave sql.ErrNoRows as is, queries look up different entities.
+// Duplicates are told apart by key, messages and group members share none.
+var sqlErrors = mysql_client.Errors{
+	Duplicates: map[string]error{
+		"chat_group_members.PRIMARY":      models.ErrGroupMemberAlreadyExists,
+		"messages.uniq_sender_client_msg": models.ErrClientMessageIDConflict,
+	},
+	ForeignKeys: map[string]error{
+		"users":       models.ErrUserNotFound,
+		"chat_groups": models.ErrGroupNotFound,
+		"messages":    models.ErrMessageNotFound,
+	},
 }
 
-func (r repository) SendMessage(ctx context.Context, message models.Message) error {
-	msg := convertModelToMessage(message)
-	_, err := r.db.ExecContext(ctx, "INSERT INTO messages (sender_uuid, receiver_uuid, text) VALUES (UUID_TO_BIN(?), UUID_TO_BIN(?), (?))", msg.SenderUUID, msg.ReceiverUUID, msg.Text)
+// SendMessage stores a direct message and the notification for its receiver
+// in one transaction. Retries deduplicated by client message id notify nobody.
+func (r repository) SendMessage(ctx context.Context, message models.Message) (models.MessageID, error) {
+	var id models.MessageID
+	err := r.db.InTx(ctx, func(ctx context.Context) error {
+		tx := r.db.Writer(ctx)
+
+		var (
+			inserted bool
+			err      error
+		)
+		id, inserted, err = r.insertMessage(ctx, tx, convertModelToMessage(message))
+		if err != nil || !inserted {
+			return err
+		}
+
+		notification, err := models.NewNotification(models.NotificationMessageReceived, message.From, message.To, models.MessageReceivedPayload{
+			MessageID: id,
+			Text:      message.Text,
+		})
+		if err != nil {
+			return err
+		}
+
+		return notification_repo.WriteOutbox(ctx, tx, []models.Notification{notification})
+	})
 	if err != nil {
-		return convertSQLError(err)
+		return models.EmptyMessageID, err
 	}
+	r.db.Wrote(models.DialogKey(message.From, message.To), models.MessageKey(id))
 
-	return nil
+	return id, nil
+}
+
+// insertMessage reports whether a new row was inserted. A repeated client
+// message id returns the stored message, or ErrClientMessageIDConflict if the
+// stored message differs.
+func (r repository) insertMessage(ctx context.Context, db mysql_client.Querier, msg Message) (models.MessageID, bool, error) {
+	// On a repeated (sender_uuid, client_msg_id) pair LAST_INSERT_ID(id) makes
+	// the driver report the id of the already stored message.
+	res, err := db.ExecContext(
+		ctx,
+		"INSERT INTO messages (sender_uuid, receiver_uuid, group_id, text, client_msg_id) VALUES (UUID_TO_BIN(?), UUID_TO_BIN(?), (?), (?), (?)) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)",
+		msg.SenderUUID, msg.ReceiverUUID, msg.GroupID, msg.Text, msg.ClientMessageID,
+	)
+	if err != nil {
+		return models.EmptyMessageID, false, sqlErrors.Translate(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.EmptyMessageID, false, sqlErrors.Translate(err)
+	}
+
+	// a duplicate leaves the row unchanged, which is reported as 0 affected rows
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return models.EmptyMessageID, false, sqlErrors.Translate(err)
+	}
+	if affected == 1 {
+		return models.MessageID(id), true, nil
+	}
+
+	var stored Message
+	err = db.GetContext(ctx, &stored, "SELECT "+messageColumns+" FROM messages WHERE id = ?", id)
+	if err != nil {
+		return models.EmptyMessageID, false, sqlErrors.WithNotFound(models.ErrMessageNotFound).Translate(err)
+	}
+	if !sameMessage(stored, msg) {
+		return models.EmptyMessageID, false, models.ErrClientMessageIDConflict
+	}
+
+	return models.MessageID(id), false, nil
+}
+
+// sameMessage reports whether msg is a retry of the stored message. Text of
+// an edited or deleted message has changed since, so it is not compared.
+func sameMessage(stored Message, msg Message) bool {
+	if stored.ReceiverUUID != msg.ReceiverUUID || stored.GroupID != msg.GroupID {
+		return false
+	}
+	if stored.EditedAt.Valid || stored.DeletedAt.Valid {
+		return true
+	}
+
+	return stored.Text == msg.Text
 }
 
 func (r repository) GetDialog(ctx context.Context, userID models.UserID, friendID models.UserID) ([]models.Message, error) {
 	var messages []Message
-	err := r.db.SelectContext(ctx, &messages, "SELECT BIN_TO_UUID(sender_uuid) as sender_uuid, BIN_TO_UUID(receiver_uuid) as receiver_uuid, text FROM messages WHERE (sender_uuid = UUID_TO_BIN(?) AND receiver_uuid = UUID_TO_BIN(?)) OR (sender_uuid = UUID_TO_BIN(?) AND receiver_uuid = UUID_TO_BIN(?))", userID, friendID, friendID, userID)
+	err := r.db.Reader(ctx, models.DialogKey(userID, friendID)).SelectContext(
+		ctx,
+		&messages,
+		"SELECT "+messageColumns+" FROM messages WHERE ((sender_uuid = UUID_TO_BIN(?) AND receiver_uuid = UUID_TO_BIN(?)) OR (sender_uuid = UUID_TO_BIN(?) AND receiver_uuid = UUID_TO_BIN(?))) "+
+			"AND id NOT IN (SELECT message_id FROM hidden_messages WHERE user_uuid = UUID_TO_BIN(?)) ORDER BY id",
+		userID, friendID, friendID, userID, userID,
+	)
 	if err != nil {
-		return nil, convertSQLError(err)
+		return nil, sqlErrors.Translate(err)
 	}
 
 	return convertMessagesToModels(messages), nil
 }
 
-func NewRepository(cfg Config, logger log.Logger) (models.DialogRepository, error) {
-	db, err := sqlx.Connect("mysql", cfg.DataSourceName)
+func (r repository) GetMessage(ctx context.Context, messageID models.MessageID) (models.Message, error) {
+	var message Message
+	err := r.db.Reader(ctx, models.MessageKey(messageID)).GetContext(ctx, &message, "SELECT "+messageColumns+" FROM messages WHERE id = ?", messageID)
 	if err != nil {
-		return nil, err
+		return models.Message{}, sqlErrors.WithNotFound(models.ErrMessageNotFound).Translate(err)
 	}
+
+	return convertMessageToModel(message), nil
+}
+
+func (r repository) EditMessage(ctx context.Context, messageID models.MessageID, text string) error {
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "UPDATE messages SET text = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", text, messageID)
+	if err != nil {
+		return sqlErrors.Translate(err)
+	}
+
+	r.db.Wrote(models.MessageKey(messageID))
+
+	return nil
+}
+
+func (r repository) DeleteMessage(ctx context.Context, messageID models.MessageID) error {
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "UPDATE messages SET text = '', deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", messageID)
+	if err != nil {
+		return sqlErrors.Translate(err)
+	}
+
+	r.db.Wrote(models.MessageKey(messageID))
+
+	return nil
+}
+
+func (r repository) HideMessage(ctx context.Context, messageID models.MessageID, userID models.UserID) error {
+	_, err := r.db.Writer(ctx).ExecContext(ctx, "INSERT IGNORE INTO hidden_messages (message_id, user_uuid) VALUES (?, UUID_TO_BIN(?))", messageID, userID)
+	if err != nil {
+		return sqlErrors.Translate(err)
+	}
+
+	r.db.Wrote(models.MessageKey(messageID))
+
+	return nil
+}
+
+func (r repository) AreFriends(ctx context.Context, userID models.UserID, friendID models.UserID) (bool, error) {
+	var exists bool
+	err := r.db.Reader(ctx, models.FriendsKey(userID), models.FriendsKey(friendID)).GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM friends WHERE (user1 = UUID_TO_BIN(?) AND user2 = UUID_TO_BIN(?)) OR (user1 = UUID_TO_BIN(?) AND user2 = UUID_TO_BIN(?)))", userID, friendID, friendID, userID)
+	if err != nil {
+		return false, sqlErrors.Translate(err)
+	}
+
+	return exists, nil
+}
+
+func (r repository) IsBlocked(ctx context.Context, userID models.UserID, blockedID models.UserID) (bool, error) {
+	var exists bool
+	err := r.db.Reader(ctx, models.BlocksKey(userID)).GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM blocked_users WHERE user_uuid = UUID_TO_BIN(?) AND blocked_uuid = UUID_TO_BIN(?))", userID, blockedID)
+	if err != nil {
+		return false, sqlErrors.Translate(err)
+	}
+
+	return exists, nil
+}
+
+func NewRepository(db *mysql_client.Provider, logger log.Logger) models.DialogRepository {
 	return repository{
 		logger: logger,
 		db:     db,
-	}, nil
+	}
 }
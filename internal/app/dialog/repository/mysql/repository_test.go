@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		errors mysql_client.Errors
+		err    error
+		want   error
+	}{
+		{
+			name:   "duplicate member",
+			errors: sqlErrors,
+			err:    &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-\x01' for key 'chat_group_members.PRIMARY'"},
+			want:   models.ErrGroupMemberAlreadyExists,
+		},
+		{
+			name:   "duplicate client message id",
+			errors: sqlErrors,
+			err:    &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '\x01-c1' for key 'messages.uniq_sender_client_msg'"},
+			want:   models.ErrClientMessageIDConflict,
+		},
+		{
+			name:   "missing group",
+			errors: sqlErrors,
+			err: &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+				"(`otus`.`chat_group_members`, CONSTRAINT `chat_group_members_ibfk_1` FOREIGN KEY (`group_id`) REFERENCES `chat_groups` (`id`))"},
+			want: models.ErrGroupNotFound,
+		},
+		{
+			name:   "missing message",
+			errors: sqlErrors.WithNotFound(models.ErrMessageNotFound),
+			err:    sql.ErrNoRows,
+			want:   models.ErrMessageNotFound,
+		},
+		{
+			name:   "missing member",
+			errors: sqlErrors.WithNotFound(models.ErrGroupMemberNotFound),
+			err:    sql.ErrNoRows,
+			want:   models.ErrGroupMemberNotFound,
+		},
+		{
+			name:   "no rows of a list",
+			errors: sqlErrors,
+			err:    sql.ErrNoRows,
+			want:   sql.ErrNoRows,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.errors.Translate(tc.err)
+			require.True(t, errors.Is(err, tc.want), err)
+			if tc.want != models.ErrGroupMemberNotFound && tc.want != models.ErrGroupMemberAlreadyExists {
+				require.False(t, errors.Is(err, models.ErrGroupMemberNotFound, models.ErrGroupMemberAlreadyExists), err)
+			}
+		})
+	}
+}
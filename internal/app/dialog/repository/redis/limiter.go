@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	redis_client "github.com/antonpriyma/otus-highload/pkg/clients/redis"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+type Config struct {
+	Redis redis_client.Config `mapstructure:"redis"`
+}
+
+const limiterPrefix = "dialog_events:"
+
+type eventRateLimiter struct {
+	redis  redis.UniversalClient
+	logger log.Logger
+}
+
+// NewEventRateLimiter limits dialog events across notifier instances.
+func NewEventRateLimiter(cfg Config, logger log.Logger) (models.DialogEventRateLimiter, error) {
+	client, err := redis_client.NewClient(cfg.Redis)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create redis client")
+	}
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to redis")
+	}
+
+	return eventRateLimiter{
+		redis:  client,
+		logger: logger,
+	}, nil
+}
+
+func (l eventRateLimiter) Allow(ctx context.Context, key string, interval time.Duration) (bool, error) {
+	// the key lives for interval, so the first event of every interval creates it
+	ok, err := l.redis.SetNX(ctx, limiterPrefix+key, 1, interval).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to set rate limit key")
+	}
+
+	return ok, nil
+}
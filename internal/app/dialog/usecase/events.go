@@ -0,0 +1,157 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type EventsConfig struct {
+	// TypingTTL is how long clients show a typing indicator without a refresh.
+	TypingTTL time.Duration `mapstructure:"typing_ttl"`
+	// SeenTTL drops seen events which could not be delivered in time.
+	SeenTTL time.Duration `mapstructure:"seen_ttl"`
+	// TypingInterval and SeenInterval are the minimal intervals between events
+	// of one sender in one dialog.
+	TypingInterval time.Duration `mapstructure:"typing_interval"`
+	SeenInterval   time.Duration `mapstructure:"seen_interval"`
+}
+
+func (c EventsConfig) withDefaults() EventsConfig {
+	if c.TypingTTL <= 0 {
+		c.TypingTTL = 6 * time.Second
+	}
+	if c.SeenTTL <= 0 {
+		c.SeenTTL = 30 * time.Second
+	}
+	if c.TypingInterval <= 0 {
+		c.TypingInterval = 2 * time.Second
+	}
+	if c.SeenInterval <= 0 {
+		c.SeenInterval = time.Second
+	}
+
+	return c
+}
+
+type eventsUsecase struct {
+	usecase
+
+	eventsCfg EventsConfig
+	limiter   models.DialogEventRateLimiter
+}
+
+// NewEventsUsecase delivers dialog events through notifier as ephemeral
+// notifications: they expire after their ttl and are neither stored nor retried.
+func NewEventsUsecase(
+	cfg EventsConfig,
+	dialogs models.DialogRepository,
+	limiter models.DialogEventRateLimiter,
+	preferences models.NotificationPreferencesRepository,
+	notifier models.Notifier,
+	logger log.Logger,
+) models.DialogEventUsecase {
+	return eventsUsecase{
+		usecase: usecase{
+			logger:      logger,
+			dialogs:     dialogs,
+			preferences: preferences,
+			notifier:    notifier,
+		},
+		eventsCfg: cfg.withDefaults(),
+		limiter:   limiter,
+	}
+}
+
+func (e eventsUsecase) SendDialogEvent(ctx context.Context, event models.DialogEvent) error {
+	var (
+		recipients []models.UserID
+		typ        models.NotificationType
+		payload    interface{}
+		ttl        time.Duration
+		interval   time.Duration
+		err        error
+	)
+	switch event.Type {
+	case models.DialogEventTyping:
+		recipients, err = e.typingRecipients(ctx, event)
+		typ, ttl, interval = models.NotificationTyping, e.eventsCfg.TypingTTL, e.eventsCfg.TypingInterval
+		payload = models.TypingPayload{GroupID: event.GroupID}
+	case models.DialogEventSeen:
+		var message models.Message
+		message, recipients, err = e.seenRecipients(ctx, event)
+		typ, ttl, interval = models.NotificationMessageSeen, e.eventsCfg.SeenTTL, e.eventsCfg.SeenInterval
+		payload = models.MessageSeenPayload{MessageID: message.ID, GroupID: message.GroupID}
+		event.GroupID, event.To = message.GroupID, message.From
+	default:
+		return models.ErrUnknownDialogEvent
+	}
+	if err != nil {
+		return err
+	}
+
+	allowed, err := e.limiter.Allow(ctx, eventKey(event), interval)
+	if err != nil {
+		return errors.Wrap(err, "failed to check dialog event rate")
+	}
+	if !allowed {
+		return models.ErrDialogEventRateLimited
+	}
+
+	expiresAt := time.Now().Add(ttl).UTC()
+
+	return e.notify(ctx, typ, event.From, recipients, payload, &expiresAt)
+}
+
+// typingRecipients allows typing to friends who have not blocked the sender and to groups of the sender.
+func (e eventsUsecase) typingRecipients(ctx context.Context, event models.DialogEvent) ([]models.UserID, error) {
+	if event.GroupID == models.EmptyGroupID {
+		if err := e.checkRecipient(ctx, event.From, event.To); err != nil {
+			return nil, err
+		}
+
+		return []models.UserID{event.To}, nil
+	}
+
+	if _, err := e.dialogs.GetGroupMember(ctx, event.GroupID, event.From); err != nil {
+		return nil, errors.Wrap(err, "failed to get group member")
+	}
+
+	return e.groupRecipients(ctx, event.GroupID, event.From)
+}
+
+// seenRecipients allows seen events for messages addressed to the sender
+// and for messages of groups of the sender.
+func (e eventsUsecase) seenRecipients(ctx context.Context, event models.DialogEvent) (models.Message, []models.UserID, error) {
+	message, err := e.getMessage(ctx, event.MessageID)
+	if err != nil {
+		return models.Message{}, nil, err
+	}
+
+	if err := e.checkParticipant(ctx, event.From, message); err != nil {
+		return models.Message{}, nil, err
+	}
+
+	if message.GroupID != models.EmptyGroupID {
+		recipients, err := e.groupRecipients(ctx, message.GroupID, event.From)
+		return message, recipients, err
+	}
+
+	if message.To != event.From {
+		return models.Message{}, nil, models.ErrMessageNotFound
+	}
+
+	return message, []models.UserID{message.From}, nil
+}
+
+func eventKey(event models.DialogEvent) string {
+	if event.GroupID != models.EmptyGroupID {
+		return fmt.Sprintf("%s:%s:group:%d", event.Type, event.From, event.GroupID)
+	}
+
+	return fmt.Sprintf("%s:%s:user:%s", event.Type, event.From, event.To)
+}
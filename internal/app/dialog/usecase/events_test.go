@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/app/notification/notifer"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLimiter allows every key once.
+type fakeLimiter struct {
+	intervals map[string]time.Duration
+}
+
+func (f fakeLimiter) Allow(_ context.Context, key string, interval time.Duration) (bool, error) {
+	_, seen := f.intervals[key]
+	f.intervals[key] = interval
+
+	return !seen, nil
+}
+
+func TestSendDialogEvent(t *testing.T) {
+	ctx := context.Background()
+	dialogs := newFakeDialogs()
+	dialogs.befriend(alice, bob)
+	dialogs.befriend(alice, carol)
+	dialogs.blocked[[2]models.UserID{carol, alice}] = true
+	dialogs.messages[1] = models.Message{ID: 1, From: alice, To: bob, Text: "hi"}
+	dialogs.messages[2] = models.Message{ID: 2, From: bob, To: carol, Text: "hey"}
+	dialogs.messages[3] = models.Message{ID: 3, From: alice, GroupID: 7, Text: "all"}
+	dialogs.members[7] = []models.GroupMember{
+		{GroupID: 7, UserID: alice, Role: models.GroupRoleOwner},
+		{GroupID: 7, UserID: bob, Role: models.GroupRoleMember},
+	}
+
+	notifier := notifer.NewMemoryNotifier(0)
+	aliceSub, bobSub := subscribe(t, notifier, alice), subscribe(t, notifier, bob)
+
+	limiter := fakeLimiter{intervals: make(map[string]time.Duration)}
+	u := NewEventsUsecase(EventsConfig{
+		TypingTTL:      6 * time.Second,
+		TypingInterval: 2 * time.Second,
+		SeenInterval:   time.Second,
+	}, dialogs, limiter, fakePreferences{}, notifier, log.Null)
+
+	for _, tc := range []struct {
+		name  string
+		event models.DialogEvent
+		err   error
+	}{
+		{
+			name:  "typing to a non-friend",
+			event: models.DialogEvent{Type: models.DialogEventTyping, From: bob, To: carol},
+			err:   models.ErrRecipientNotFriend,
+		},
+		{
+			name:  "typing to a friend who blocked the sender",
+			event: models.DialogEvent{Type: models.DialogEventTyping, From: alice, To: carol},
+			err:   models.ErrSenderBlocked,
+		},
+		{
+			name:  "typing to a foreign group",
+			event: models.DialogEvent{Type: models.DialogEventTyping, From: carol, GroupID: 7},
+			err:   models.ErrGroupMemberNotFound,
+		},
+		{
+			name:  "seen of a foreign message",
+			event: models.DialogEvent{Type: models.DialogEventSeen, From: alice, MessageID: 2},
+			err:   models.ErrMessageNotFound,
+		},
+		{
+			name:  "seen of an own message",
+			event: models.DialogEvent{Type: models.DialogEventSeen, From: alice, MessageID: 1},
+			err:   models.ErrMessageNotFound,
+		},
+		{
+			name:  "seen of a message of a foreign group",
+			event: models.DialogEvent{Type: models.DialogEventSeen, From: carol, MessageID: 3},
+			err:   models.ErrMessageNotFound,
+		},
+		{
+			name:  "unknown event",
+			event: models.DialogEvent{Type: "dancing", From: alice, To: bob},
+			err:   models.ErrUnknownDialogEvent,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.ErrorIs(t, u.SendDialogEvent(ctx, tc.event), tc.err)
+		})
+	}
+	// rejected events are not counted by the limiter
+	require.Empty(t, limiter.intervals)
+	require.Empty(t, received(aliceSub))
+	require.Empty(t, received(bobSub))
+
+	typing := models.DialogEvent{Type: models.DialogEventTyping, From: alice, To: bob}
+	require.NoError(t, u.SendDialogEvent(ctx, typing))
+	require.ErrorIs(t, u.SendDialogEvent(ctx, typing), models.ErrDialogEventRateLimited)
+	require.Equal(t, 2*time.Second, limiter.intervals["typing:"+string(alice)+":user:"+string(bob)])
+
+	notifications := received(bobSub)
+	require.Len(t, notifications, 1)
+	require.Equal(t, models.NotificationTyping, notifications[0].Type)
+	require.NotNil(t, notifications[0].ExpiresAt)
+	require.WithinDuration(t, time.Now().Add(6*time.Second), *notifications[0].ExpiresAt, time.Second)
+
+	// seen events go to the sender of the message, group ones to the other members
+	require.NoError(t, u.SendDialogEvent(ctx, models.DialogEvent{Type: models.DialogEventSeen, From: bob, MessageID: 1}))
+	require.NoError(t, u.SendDialogEvent(ctx, models.DialogEvent{Type: models.DialogEventSeen, From: bob, MessageID: 3}))
+	require.Len(t, received(aliceSub), 2)
+	require.Empty(t, received(bobSub))
+	require.Equal(t, time.Second, limiter.intervals["seen:"+string(bob)+":group:7"])
+}
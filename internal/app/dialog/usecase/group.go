@@ -0,0 +1,166 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type groupUsecase struct {
+	logger log.Logger
+	groups models.GroupRepository
+	// recipients checks new members like recipients of direct messages,
+	// otherwise groups would let anyone message strangers
+	recipients usecase
+}
+
+func (u groupUsecase) CreateGroup(ctx context.Context, group models.Group, members []models.UserID) (models.GroupID, error) {
+	groupMembers := make([]models.GroupMember, 0, len(members)+1)
+	groupMembers = append(groupMembers, models.GroupMember{
+		UserID: group.Owner,
+		Role:   models.GroupRoleOwner,
+	})
+
+	seen := map[models.UserID]bool{group.Owner: true}
+	for _, member := range members {
+		if seen[member] {
+			continue
+		}
+		seen[member] = true
+
+		if err := u.recipients.checkRecipient(ctx, group.Owner, member); err != nil {
+			return models.EmptyGroupID, err
+		}
+
+		groupMembers = append(groupMembers, models.GroupMember{
+			UserID: member,
+			Role:   models.GroupRoleMember,
+		})
+	}
+
+	groupID, err := u.groups.CreateGroup(ctx, group, groupMembers)
+	if err != nil {
+		return models.EmptyGroupID, errors.Wrap(err, "failed to create group")
+	}
+
+	return groupID, nil
+}
+
+func (u groupUsecase) AddGroupMember(ctx context.Context, actor models.UserID, member models.GroupMember) error {
+	if member.Role == "" {
+		member.Role = models.GroupRoleMember
+	}
+
+	actorMember, err := u.getMember(ctx, member.GroupID, actor)
+	if err != nil {
+		return err
+	}
+
+	if !actorMember.Role.CanManage(member.Role) {
+		return models.ErrGroupPermissionDenied
+	}
+
+	if err := u.recipients.checkRecipient(ctx, actor, member.UserID); err != nil {
+		return err
+	}
+
+	err = u.groups.AddGroupMember(ctx, member)
+	if err != nil {
+		return errors.Wrap(err, "failed to add group member")
+	}
+
+	return nil
+}
+
+func (u groupUsecase) RemoveGroupMember(ctx context.Context, actor models.UserID, groupID models.GroupID, userID models.UserID) error {
+	actorMember, err := u.getMember(ctx, groupID, actor)
+	if err != nil {
+		return err
+	}
+
+	// everyone except the owner may leave the group
+	if actor == userID {
+		if actorMember.Role == models.GroupRoleOwner {
+			return models.ErrGroupPermissionDenied
+		}
+	} else {
+		member, err := u.groups.GetGroupMember(ctx, groupID, userID)
+		if err != nil {
+			return errors.Wrap(err, "failed to get group member")
+		}
+
+		if !actorMember.Role.CanManage(member.Role) {
+			return models.ErrGroupPermissionDenied
+		}
+	}
+
+	err = u.groups.RemoveGroupMember(ctx, groupID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to remove group member")
+	}
+
+	return nil
+}
+
+func (u groupUsecase) GetGroupMembers(ctx context.Context, actor models.UserID, groupID models.GroupID) ([]models.GroupMember, error) {
+	if _, err := u.getMember(ctx, groupID, actor); err != nil {
+		return nil, err
+	}
+
+	members, err := u.groups.GetGroupMembers(ctx, groupID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get group members")
+	}
+
+	return members, nil
+}
+
+func (u groupUsecase) SendGroupMessage(ctx context.Context, message models.Message) (models.MessageID, error) {
+	if _, err := u.getMember(ctx, message.GroupID, message.From); err != nil {
+		return models.EmptyMessageID, err
+	}
+
+	messageID, err := u.groups.SendGroupMessage(ctx, message)
+	if err != nil {
+		return models.EmptyMessageID, errors.Wrap(err, "failed to save group message to repository")
+	}
+
+	return messageID, nil
+}
+
+func (u groupUsecase) GetGroupMessages(ctx context.Context, actor models.UserID, groupID models.GroupID) ([]models.Message, error) {
+	if _, err := u.getMember(ctx, groupID, actor); err != nil {
+		return nil, err
+	}
+
+	messages, err := u.groups.GetGroupMessages(ctx, groupID, actor)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get group messages from repository")
+	}
+
+	return messages, nil
+}
+
+// getMember returns membership of userID in the group.
+// Non-members get ErrGroupNotFound, so existence of foreign groups is not disclosed.
+func (u groupUsecase) getMember(ctx context.Context, groupID models.GroupID, userID models.UserID) (models.GroupMember, error) {
+	member, err := u.groups.GetGroupMember(ctx, groupID, userID)
+	if errors.Is(err, models.ErrGroupMemberNotFound) {
+		return models.GroupMember{}, errors.Transform(err, models.ErrGroupNotFound)
+	}
+	if err != nil {
+		return models.GroupMember{}, errors.Wrap(err, "failed to get group member")
+	}
+
+	return member, nil
+}
+
+func NewGroupUsecase(dialogs models.DialogRepository, logger log.Logger) models.GroupUsecase {
+	return groupUsecase{
+		logger:     logger,
+		groups:     dialogs,
+		recipients: usecase{dialogs: dialogs, logger: logger},
+	}
+}
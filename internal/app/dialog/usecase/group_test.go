@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+func (f *fakeDialogs) CreateGroup(_ context.Context, _ models.Group, members []models.GroupMember) (models.GroupID, error) {
+	groupID := models.GroupID(len(f.members) + 1)
+	for _, member := range members {
+		member.GroupID = groupID
+		f.members[groupID] = append(f.members[groupID], member)
+	}
+
+	return groupID, nil
+}
+
+func (f *fakeDialogs) AddGroupMember(_ context.Context, member models.GroupMember) error {
+	f.members[member.GroupID] = append(f.members[member.GroupID], member)
+
+	return nil
+}
+
+func TestGroupMembersAreRecipients(t *testing.T) {
+	ctx := context.Background()
+	dialogs := newFakeDialogs()
+	dialogs.befriend(alice, bob)
+	dialogs.befriend(alice, carol)
+	// carol has blocked alice
+	dialogs.blocked[[2]models.UserID{carol, alice}] = true
+
+	u := NewGroupUsecase(dialogs, log.Null)
+
+	_, err := u.CreateGroup(ctx, models.Group{Owner: bob}, []models.UserID{alice, carol})
+	require.ErrorIs(t, err, models.ErrRecipientNotFriend)
+
+	_, err = u.CreateGroup(ctx, models.Group{Owner: alice}, []models.UserID{bob, carol})
+	require.ErrorIs(t, err, models.ErrSenderBlocked)
+	require.Empty(t, dialogs.members)
+
+	groupID, err := u.CreateGroup(ctx, models.Group{Owner: alice}, []models.UserID{bob})
+	require.NoError(t, err)
+
+	// the owner may add her friends only
+	err = u.AddGroupMember(ctx, alice, models.GroupMember{GroupID: groupID, UserID: carol})
+	require.ErrorIs(t, err, models.ErrSenderBlocked)
+
+	dialogs.blocked[[2]models.UserID{carol, alice}] = false
+	require.NoError(t, u.AddGroupMember(ctx, alice, models.GroupMember{GroupID: groupID, UserID: carol}))
+	require.Len(t, dialogs.members[groupID], 3)
+
+	err = u.AddGroupMember(ctx, alice, models.GroupMember{GroupID: groupID, UserID: "stranger"})
+	require.ErrorIs(t, err, models.ErrRecipientNotFriend)
+}
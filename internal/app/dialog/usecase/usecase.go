@@ -2,23 +2,38 @@ package usecase
 
 import (
 	"context"
+	"time"
+
 	"github.com/antonpriyma/otus-highload/internal/app/models"
 	"github.com/antonpriyma/otus-highload/pkg/errors"
 	"github.com/antonpriyma/otus-highload/pkg/log"
 )
 
+type Config struct {
+	// EditWindow limits how long after sending a message may be edited.
+	// Zero disables the limit.
+	EditWindow time.Duration `mapstructure:"edit_window"`
+}
+
 type usecase struct {
-	logger  log.Logger
-	dialogs models.DialogRepository
+	cfg         Config
+	logger      log.Logger
+	dialogs     models.DialogRepository
+	preferences models.NotificationPreferencesRepository
+	notifier    models.Notifier
 }
 
-func (u usecase) SendMessage(ctx context.Context, message models.Message) error {
-	err := u.dialogs.SendMessage(ctx, message)
+func (u usecase) SendMessage(ctx context.Context, message models.Message) (models.MessageID, error) {
+	if err := u.checkRecipient(ctx, message.From, message.To); err != nil {
+		return models.EmptyMessageID, err
+	}
+
+	messageID, err := u.dialogs.SendMessage(ctx, message)
 	if err != nil {
-		return errors.Wrap(err, "failed to save message to repository")
+		return models.EmptyMessageID, errors.Wrap(err, "failed to save message to repository")
 	}
 
-	return nil
+	return messageID, nil
 }
 
 func (u usecase) GetDialog(ctx context.Context, userID models.UserID, friendID models.UserID) ([]models.Message, error) {
@@ -30,9 +45,227 @@ func (u usecase) GetDialog(ctx context.Context, userID models.UserID, friendID m
 	return dialog, nil
 }
 
-func NewUsecase(dialogs models.DialogRepository, logger log.Logger) models.DialogUsecase {
+func (u usecase) EditMessage(ctx context.Context, actor models.UserID, messageID models.MessageID, text string) (models.Message, error) {
+	message, err := u.getSenderMessage(ctx, actor, messageID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	if u.cfg.EditWindow > 0 && time.Since(message.CreatedAt) > u.cfg.EditWindow {
+		return models.Message{}, models.ErrMessageEditWindowExpired
+	}
+
+	err = u.dialogs.EditMessage(ctx, messageID, text)
+	if err != nil {
+		return models.Message{}, errors.Wrap(err, "failed to edit message in repository")
+	}
+
+	message, err = u.getMessage(ctx, messageID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	u.notifyChanged(ctx, actor, message, models.NotificationMessageEdited, models.MessageEditedPayload{
+		MessageID: message.ID,
+		GroupID:   message.GroupID,
+		Text:      message.Text,
+		EditedAt:  message.EditedAt.UTC(),
+	})
+
+	return message, nil
+}
+
+func (u usecase) DeleteMessage(ctx context.Context, actor models.UserID, messageID models.MessageID) (models.Message, error) {
+	_, err := u.getSenderMessage(ctx, actor, messageID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	err = u.dialogs.DeleteMessage(ctx, messageID)
+	if err != nil {
+		return models.Message{}, errors.Wrap(err, "failed to delete message in repository")
+	}
+
+	message, err := u.getMessage(ctx, messageID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	u.notifyChanged(ctx, actor, message, models.NotificationMessageDeleted, models.MessageDeletedPayload{
+		MessageID: message.ID,
+		GroupID:   message.GroupID,
+	})
+
+	return message, nil
+}
+
+func (u usecase) HideMessage(ctx context.Context, actor models.UserID, messageID models.MessageID) error {
+	message, err := u.getMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.checkParticipant(ctx, actor, message); err != nil {
+		return err
+	}
+
+	err = u.dialogs.HideMessage(ctx, messageID, actor)
+	if err != nil {
+		return errors.Wrap(err, "failed to hide message in repository")
+	}
+
+	return nil
+}
+
+// checkRecipient allows messages to friends who have not blocked the sender.
+func (u usecase) checkRecipient(ctx context.Context, sender models.UserID, recipient models.UserID) error {
+	friends, err := u.dialogs.AreFriends(ctx, sender, recipient)
+	if err != nil {
+		return errors.Wrap(err, "failed to check friendship")
+	}
+	if !friends {
+		return models.ErrRecipientNotFriend
+	}
+
+	blocked, err := u.dialogs.IsBlocked(ctx, recipient, sender)
+	if err != nil {
+		return errors.Wrap(err, "failed to check block list")
+	}
+	if blocked {
+		return models.ErrSenderBlocked
+	}
+
+	return nil
+}
+
+// getSenderMessage returns the message if actor may change it.
+func (u usecase) getSenderMessage(ctx context.Context, actor models.UserID, messageID models.MessageID) (models.Message, error) {
+	message, err := u.getMessage(ctx, messageID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	if err := u.checkParticipant(ctx, actor, message); err != nil {
+		return models.Message{}, err
+	}
+
+	if message.From != actor {
+		return models.Message{}, models.ErrMessageNotSender
+	}
+
+	if message.Deleted {
+		return models.Message{}, models.ErrMessageDeleted
+	}
+
+	return message, nil
+}
+
+func (u usecase) getMessage(ctx context.Context, messageID models.MessageID) (models.Message, error) {
+	message, err := u.dialogs.GetMessage(ctx, messageID)
+	if err != nil {
+		return models.Message{}, errors.Wrap(err, "failed to get message from repository")
+	}
+
+	return message, nil
+}
+
+// checkParticipant hides messages of foreign dialogs and groups behind ErrMessageNotFound.
+func (u usecase) checkParticipant(ctx context.Context, actor models.UserID, message models.Message) error {
+	if message.GroupID == models.EmptyGroupID {
+		if !message.HasParticipant(actor) {
+			return models.ErrMessageNotFound
+		}
+
+		return nil
+	}
+
+	_, err := u.dialogs.GetGroupMember(ctx, message.GroupID, actor)
+	if errors.Is(err, models.ErrGroupMemberNotFound) {
+		return errors.Transform(err, models.ErrMessageNotFound)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to get group member")
+	}
+
+	return nil
+}
+
+// notifyChanged pushes a change of a message to the other participants live.
+// The change is stored at this point, so a failed push is only logged: the
+// history has it anyway.
+func (u usecase) notifyChanged(ctx context.Context, actor models.UserID, message models.Message, typ models.NotificationType, payload interface{}) {
+	recipients := []models.UserID{message.To}
+	if message.GroupID != models.EmptyGroupID {
+		var err error
+		recipients, err = u.groupRecipients(ctx, message.GroupID, actor)
+		if err != nil {
+			u.logger.ForCtx(ctx).WithError(err).Warnf("failed to notify about %s", typ)
+			return
+		}
+	}
+
+	if err := u.notify(ctx, typ, actor, recipients, payload, nil); err != nil {
+		u.logger.ForCtx(ctx).WithError(err).Warnf("failed to notify about %s", typ)
+	}
+}
+
+// notify delivers a notification of typ to every recipient who has not
+// disabled it. Notifications with expiresAt are dropped once stale.
+func (u usecase) notify(ctx context.Context, typ models.NotificationType, actor models.UserID, recipients []models.UserID, payload interface{}, expiresAt *time.Time) error {
+	notifications := make([]models.Notification, 0, len(recipients))
+	for _, recipient := range recipients {
+		notification, err := models.NewNotification(typ, actor, recipient, payload)
+		if err != nil {
+			return err
+		}
+		notification.ExpiresAt = expiresAt
+		notifications = append(notifications, notification)
+	}
+
+	notifications, err := u.preferences.FilterDisabled(ctx, notifications)
+	if err != nil {
+		return errors.Wrap(err, "failed to filter disabled notifications")
+	}
+
+	var lastErr error
+	for _, notification := range notifications {
+		if err := u.notifier.Notify(ctx, notification); err != nil {
+			lastErr = errors.Wrapf(err, "failed to notify %s", notification.Target)
+		}
+	}
+
+	return lastErr
+}
+
+func (u usecase) groupRecipients(ctx context.Context, groupID models.GroupID, sender models.UserID) ([]models.UserID, error) {
+	members, err := u.dialogs.GetGroupMembers(ctx, groupID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get group members")
+	}
+
+	recipients := make([]models.UserID, 0, len(members))
+	for _, member := range members {
+		if member.UserID != sender {
+			recipients = append(recipients, member.UserID)
+		}
+	}
+
+	return recipients, nil
+}
+
+// NewUsecase pushes edits and deletions through notifier, see notifyChanged.
+func NewUsecase(
+	cfg Config,
+	dialogs models.DialogRepository,
+	preferences models.NotificationPreferencesRepository,
+	notifier models.Notifier,
+	logger log.Logger,
+) models.DialogUsecase {
 	return usecase{
-		logger:  logger,
-		dialogs: dialogs,
+		cfg:         cfg,
+		logger:      logger,
+		dialogs:     dialogs,
+		preferences: preferences,
+		notifier:    notifier,
 	}
 }
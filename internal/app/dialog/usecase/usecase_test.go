@@ -0,0 +1,183 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/app/notification/notifer"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	alice models.UserID = "00000000-0000-0000-0000-00000000000a"
+	bob   models.UserID = "00000000-0000-0000-0000-00000000000b"
+	carol models.UserID = "00000000-0000-0000-0000-00000000000c"
+)
+
+// fakeDialogs keeps messages and groups in maps, methods the tests do not
+// need panic on the nil DialogRepository.
+type fakeDialogs struct {
+	models.DialogRepository
+
+	messages map[models.MessageID]models.Message
+	members  map[models.GroupID][]models.GroupMember
+	friends  map[[2]models.UserID]bool
+	// blocked by user
+	blocked map[[2]models.UserID]bool
+}
+
+func newFakeDialogs() *fakeDialogs {
+	return &fakeDialogs{
+		messages: make(map[models.MessageID]models.Message),
+		members:  make(map[models.GroupID][]models.GroupMember),
+		friends:  make(map[[2]models.UserID]bool),
+		blocked:  make(map[[2]models.UserID]bool),
+	}
+}
+
+func (f *fakeDialogs) befriend(a, b models.UserID) {
+	f.friends[[2]models.UserID{a, b}] = true
+	f.friends[[2]models.UserID{b, a}] = true
+}
+
+func (f *fakeDialogs) GetMessage(_ context.Context, messageID models.MessageID) (models.Message, error) {
+	message, ok := f.messages[messageID]
+	if !ok {
+		return models.Message{}, models.ErrMessageNotFound
+	}
+
+	return message, nil
+}
+
+func (f *fakeDialogs) EditMessage(_ context.Context, messageID models.MessageID, text string) error {
+	message := f.messages[messageID]
+	message.Text = text
+	message.EditedAt = time.Now().Truncate(time.Second)
+	f.messages[messageID] = message
+
+	return nil
+}
+
+func (f *fakeDialogs) DeleteMessage(_ context.Context, messageID models.MessageID) error {
+	message := f.messages[messageID]
+	message.Text = ""
+	message.Deleted = true
+	f.messages[messageID] = message
+
+	return nil
+}
+
+func (f *fakeDialogs) AreFriends(_ context.Context, userID models.UserID, friendID models.UserID) (bool, error) {
+	return f.friends[[2]models.UserID{userID, friendID}], nil
+}
+
+func (f *fakeDialogs) IsBlocked(_ context.Context, userID models.UserID, blockedID models.UserID) (bool, error) {
+	return f.blocked[[2]models.UserID{userID, blockedID}], nil
+}
+
+func (f *fakeDialogs) GetGroupMember(_ context.Context, groupID models.GroupID, userID models.UserID) (models.GroupMember, error) {
+	for _, member := range f.members[groupID] {
+		if member.UserID == userID {
+			return member, nil
+		}
+	}
+
+	return models.GroupMember{}, models.ErrGroupMemberNotFound
+}
+
+func (f *fakeDialogs) GetGroupMembers(_ context.Context, groupID models.GroupID) ([]models.GroupMember, error) {
+	return f.members[groupID], nil
+}
+
+// fakePreferences has every type enabled except disabled ones.
+type fakePreferences struct {
+	models.NotificationPreferencesRepository
+
+	disabled map[models.UserID]models.NotificationType
+}
+
+func (f fakePreferences) FilterDisabled(_ context.Context, notifications []models.Notification) ([]models.Notification, error) {
+	var res []models.Notification
+	for _, notification := range notifications {
+		if f.disabled[notification.Target] != notification.Type {
+			res = append(res, notification)
+		}
+	}
+
+	return res, nil
+}
+
+func subscribe(t *testing.T, notifier *notifer.MemoryNotifier, userID models.UserID) notifer.Subscription {
+	sub, err := notifier.Subscribe(context.Background(), userID)
+	require.NoError(t, err)
+	t.Cleanup(sub.Close)
+
+	return sub
+}
+
+// received returns notifications already delivered to sub, MemoryNotifier
+// delivers synchronously.
+func received(sub notifer.Subscription) []models.Notification {
+	var res []models.Notification
+	for {
+		select {
+		case notification := <-sub.Notifications():
+			res = append(res, notification)
+		default:
+			return res
+		}
+	}
+}
+
+func TestEditAndDeleteAreNotified(t *testing.T) {
+	ctx := context.Background()
+	dialogs := newFakeDialogs()
+	dialogs.messages[1] = models.Message{ID: 1, From: alice, To: bob, Text: "hi", CreatedAt: time.Now()}
+	dialogs.messages[2] = models.Message{ID: 2, From: alice, GroupID: 7, Text: "all", CreatedAt: time.Now()}
+	dialogs.members[7] = []models.GroupMember{
+		{GroupID: 7, UserID: alice, Role: models.GroupRoleOwner},
+		{GroupID: 7, UserID: bob, Role: models.GroupRoleMember},
+		{GroupID: 7, UserID: carol, Role: models.GroupRoleMember},
+	}
+
+	notifier := notifer.NewMemoryNotifier(0)
+	aliceSub, bobSub, carolSub := subscribe(t, notifier, alice), subscribe(t, notifier, bob), subscribe(t, notifier, carol)
+
+	u := NewUsecase(Config{EditWindow: time.Minute}, dialogs, fakePreferences{
+		disabled: map[models.UserID]models.NotificationType{carol: models.NotificationMessageDeleted},
+	}, notifier, log.Null)
+
+	edited, err := u.EditMessage(ctx, alice, 1, "hi!")
+	require.NoError(t, err)
+
+	notifications := received(bobSub)
+	require.Len(t, notifications, 1)
+	require.Equal(t, models.NotificationMessageEdited, notifications[0].Type)
+	require.Equal(t, alice, notifications[0].Actor)
+
+	var payload models.MessageEditedPayload
+	require.NoError(t, json.Unmarshal(notifications[0].Payload, &payload))
+	require.Equal(t, models.MessageID(1), payload.MessageID)
+	require.Equal(t, "hi!", payload.Text)
+	require.True(t, payload.EditedAt.Equal(edited.EditedAt))
+
+	// only the sender may change a message, nothing is pushed then
+	_, err = u.DeleteMessage(ctx, bob, 1)
+	require.ErrorIs(t, err, models.ErrMessageNotSender)
+	require.Empty(t, received(aliceSub))
+
+	// group members except the actor, carol has disabled deletions
+	_, err = u.DeleteMessage(ctx, alice, 2)
+	require.NoError(t, err)
+	require.Empty(t, received(aliceSub))
+	require.Empty(t, received(carolSub))
+
+	notifications = received(bobSub)
+	require.Len(t, notifications, 1)
+	require.Equal(t, models.NotificationMessageDeleted, notifications[0].Type)
+	require.JSONEq(t, `{"message_id":2,"group_id":7}`, string(notifications[0].Payload))
+}
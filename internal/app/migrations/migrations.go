@@ -0,0 +1,57 @@
+// Package migrations embeds the schema of the otus database.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/migrate"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Config is embedded by services that depend on the schema.
+type Config struct {
+	migrate.Config `mapstructure:",squash"`
+	// Check makes the service refuse to start unless the schema is at the
+	// version of the build.
+	Check bool `mapstructure:"check"`
+}
+
+func Migrations() ([]migrate.Migration, error) {
+	sub, err := fs.Sub(files, "sql")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open embedded migrations")
+	}
+
+	return migrate.Load(sub)
+}
+
+func NewMigrator(cfg migrate.Config, db *sqlx.DB, logger log.Logger) (*migrate.Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(cfg, db, migrations, logger), nil
+}
+
+// Check returns migrate.ErrVersionMismatch when enabled and the schema is
+// behind or ahead of the build.
+func Check(ctx context.Context, cfg Config, db *sqlx.DB, logger log.Logger) error {
+	if !cfg.Check {
+		return nil
+	}
+
+	migrator, err := NewMigrator(cfg.Config, db, logger)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Check(ctx)
+}
@@ -0,0 +1,3 @@
+DROP TABLE post;
+DROP TABLE friends;
+DROP TABLE users;
@@ -0,0 +1,34 @@
+CREATE TABLE users
+(
+    uuid        BINARY(16) PRIMARY KEY,
+    username    VARCHAR(50) UNIQUE NOT NULL,
+    first_name  VARCHAR(50)        NOT NULL,
+    second_name VARCHAR(50)        NOT NULL,
+    age         INT                NOT NULL,
+    sex         VARCHAR(1)         NOT NULL,
+    biography   TEXT               NOT NULL,
+    city        VARCHAR(50)        NOT NULL,
+    password    VARCHAR(255)       NOT NULL
+);
+
+CREATE TABLE friends
+(
+    user1 BINARY(16) NOT NULL,
+    user2 BINARY(16) NOT NULL,
+
+    PRIMARY KEY (user1, user2),
+    KEY idx_user2 (user2),
+    FOREIGN KEY (user1) REFERENCES users (uuid),
+    FOREIGN KEY (user2) REFERENCES users (uuid)
+);
+
+CREATE TABLE post
+(
+    uuid       BINARY(16) PRIMARY KEY,
+    user_id    BINARY(16) NOT NULL,
+    text       TEXT       NOT NULL,
+    created_at TIMESTAMP  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    KEY idx_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users (uuid)
+);
@@ -0,0 +1,5 @@
+DROP TABLE hidden_messages;
+DROP TABLE messages;
+DROP TABLE chat_group_members;
+DROP TABLE chat_groups;
+DROP TABLE blocked_users;
@@ -0,0 +1,58 @@
+CREATE TABLE blocked_users
+(
+    user_uuid    BINARY(16) NOT NULL,
+    blocked_uuid BINARY(16) NOT NULL,
+
+    PRIMARY KEY (user_uuid, blocked_uuid),
+    FOREIGN KEY (user_uuid) REFERENCES users (uuid),
+    FOREIGN KEY (blocked_uuid) REFERENCES users (uuid)
+);
+
+CREATE TABLE chat_groups
+(
+    id         BIGINT PRIMARY KEY AUTO_INCREMENT,
+    name       VARCHAR(255) NOT NULL,
+    owner_uuid BINARY(16)   NOT NULL,
+
+    FOREIGN KEY (owner_uuid) REFERENCES users (uuid)
+);
+
+CREATE TABLE chat_group_members
+(
+    group_id  BIGINT      NOT NULL,
+    user_uuid BINARY(16)  NOT NULL,
+    role      VARCHAR(16) NOT NULL,
+
+    PRIMARY KEY (group_id, user_uuid),
+    FOREIGN KEY (group_id) REFERENCES chat_groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_uuid) REFERENCES users (uuid)
+);
+
+CREATE TABLE messages
+(
+    ID            INT PRIMARY KEY AUTO_INCREMENT,
+    sender_uuid   BINARY(16),
+    receiver_uuid BINARY(16),
+    group_id      BIGINT NULL,
+    text          TEXT NOT NULL,
+    client_msg_id VARCHAR(64) NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    edited_at     TIMESTAMP NULL,
+    deleted_at    TIMESTAMP NULL,
+
+    UNIQUE KEY uniq_sender_client_msg (sender_uuid, client_msg_id),
+    KEY idx_group_id (group_id),
+    FOREIGN KEY (sender_uuid) REFERENCES users (uuid),
+    FOREIGN KEY (receiver_uuid) REFERENCES users (uuid),
+    FOREIGN KEY (group_id) REFERENCES chat_groups (id)
+);
+
+CREATE TABLE hidden_messages
+(
+    message_id INT        NOT NULL,
+    user_uuid  BINARY(16) NOT NULL,
+
+    PRIMARY KEY (message_id, user_uuid),
+    FOREIGN KEY (message_id) REFERENCES messages (ID) ON DELETE CASCADE,
+    FOREIGN KEY (user_uuid) REFERENCES users (uuid)
+);
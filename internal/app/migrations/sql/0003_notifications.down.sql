@@ -0,0 +1,4 @@
+DROP TABLE notification_digests;
+DROP TABLE notifications;
+DROP TABLE notification_opt_outs;
+DROP TABLE notification_outbox;
@@ -0,0 +1,50 @@
+CREATE TABLE notification_outbox
+(
+    id            BIGINT PRIMARY KEY AUTO_INCREMENT,
+    recipient     BINARY(16)   NOT NULL,
+    type          VARCHAR(32)  NOT NULL,
+    payload       JSON         NOT NULL,
+    attempts      INT          NOT NULL DEFAULT 0,
+    created_at    TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    claimed_until TIMESTAMP(6) NULL,
+    sent_at       TIMESTAMP    NULL,
+
+    KEY idx_pending (sent_at, id)
+);
+
+CREATE TABLE notification_opt_outs
+(
+    user_uuid BINARY(16)  NOT NULL,
+    type      VARCHAR(32) NOT NULL,
+
+    PRIMARY KEY (user_uuid, type),
+    FOREIGN KEY (user_uuid) REFERENCES users (uuid) ON DELETE CASCADE
+);
+
+CREATE TABLE notifications
+(
+    id              BIGINT PRIMARY KEY AUTO_INCREMENT,
+    notification_id BINARY(16)  NOT NULL,
+    user_uuid       BINARY(16)  NOT NULL,
+    type            VARCHAR(32) NOT NULL,
+    payload         JSON        NOT NULL,
+    created_at      TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at         TIMESTAMP   NULL,
+
+    UNIQUE KEY uniq_user_notification (user_uuid, notification_id),
+    KEY idx_user_id (user_uuid, id),
+    FOREIGN KEY (user_uuid) REFERENCES users (uuid) ON DELETE CASCADE
+);
+
+CREATE TABLE notification_digests
+(
+    user_uuid            BINARY(16)   PRIMARY KEY,
+    email                VARCHAR(255) NOT NULL,
+    frequency            VARCHAR(16)  NOT NULL,
+    next_run_at          TIMESTAMP    NULL,
+    claimed_until        TIMESTAMP(6) NULL,
+    last_notification_id BINARY(16)   NULL,
+
+    KEY idx_due (next_run_at),
+    FOREIGN KEY (user_uuid) REFERENCES users (uuid) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+DROP TABLE binlog_checkpoints;
@@ -0,0 +1,6 @@
+CREATE TABLE binlog_checkpoints
+(
+    consumer   VARCHAR(64) PRIMARY KEY,
+    gtid_set   TEXT        NOT NULL,
+    updated_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+ALTER TABLE messages
+    DROP KEY idx_deleted_at;
+
+ALTER TABLE post
+    DROP KEY idx_deleted_at,
+    DROP COLUMN deleted_at;
+
+ALTER TABLE users
+    DROP KEY idx_deleted_at,
+    DROP COLUMN deleted_at;
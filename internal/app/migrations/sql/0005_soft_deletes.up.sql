@@ -0,0 +1,10 @@
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMP NULL,
+    ADD KEY idx_deleted_at (deleted_at);
+
+ALTER TABLE post
+    ADD COLUMN deleted_at TIMESTAMP NULL,
+    ADD KEY idx_deleted_at (deleted_at);
+
+ALTER TABLE messages
+    ADD KEY idx_deleted_at (deleted_at);
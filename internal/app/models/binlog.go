@@ -0,0 +1,22 @@
+package models
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+var ErrCheckpointNotFound = errors.Typed("checkpoint_not_found", "binlog checkpoint not found")
+
+// BinlogCheckpointRepository keeps the positions of binlog consumers as GTID
+// sets in the format of @@gtid_executed.
+type BinlogCheckpointRepository interface {
+	// GetCheckpoint returns ErrCheckpointNotFound for a new consumer.
+	GetCheckpoint(ctx context.Context, consumer string) (string, error)
+	SaveCheckpoint(ctx context.Context, consumer string, gtidSet string) error
+	// GetExecutedGTIDs is the current position of the primary.
+	GetExecutedGTIDs(ctx context.Context) (string, error)
+	// GetColumns names the columns of a table in order, binlogs written
+	// without binlog_row_metadata=FULL do not name them.
+	GetColumns(ctx context.Context, schema string, table string) ([]string, error)
+}
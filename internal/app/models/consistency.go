@@ -0,0 +1,35 @@
+package models
+
+import "strconv"
+
+// Consistency keys name data which reads must see right after it is written
+// by the same instance, see mysql.Provider.Reader.
+
+func UserKey(userID UserID) string {
+	return "user:" + string(userID)
+}
+
+func FriendsKey(userID UserID) string {
+	return "friends:" + string(userID)
+}
+
+func BlocksKey(userID UserID) string {
+	return "blocks:" + string(userID)
+}
+
+func MessageKey(messageID MessageID) string {
+	return "message:" + strconv.FormatInt(int64(messageID), 10)
+}
+
+// DialogKey is the same for both participants.
+func DialogKey(userID UserID, friendID UserID) string {
+	if friendID < userID {
+		userID, friendID = friendID, userID
+	}
+
+	return "dialog:" + string(userID) + ":" + string(friendID)
+}
+
+func GroupKey(groupID GroupID) string {
+	return "group:" + strconv.FormatInt(int64(groupID), 10)
+}
@@ -1,24 +1,115 @@
 package models
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+var (
+	ErrMessageNotFound          = errors.Typed("message_not_found", "message not found")
+	ErrClientMessageIDConflict  = errors.Typed("client_message_id_conflict", "client message id is used by another message")
+	ErrMessageNotSender         = errors.Typed("message_not_sender", "only sender can change the message")
+	ErrMessageEditWindowExpired = errors.Typed("message_edit_window_expired", "message can not be edited anymore")
+	ErrMessageDeleted           = errors.Typed("message_deleted", "message is deleted")
+	ErrRecipientNotFriend       = errors.Typed("recipient_not_friend", "messages can be sent to friends only")
+	ErrSenderBlocked            = errors.Typed("sender_blocked", "sender is blocked by recipient")
+	ErrDialogEventRateLimited   = errors.Typed("dialog_event_rate_limited", "dialog events are sent too often")
+	ErrUnknownDialogEvent       = errors.Typed("unknown_dialog_event", "unknown dialog event")
+)
+
+type MessageID int64
+
+const (
+	EmptyMessageID MessageID = 0
+)
 
 type Message struct {
+	ID   MessageID
 	From UserID
 	To   UserID
-	Text string
+	// GroupID is set for group messages, To is empty then.
+	GroupID GroupID
+	Text    string
+	// ClientMessageID is an idempotency key generated by the sender.
+	// Messages with the same sender and ClientMessageID are stored once, a
+	// different message with a used ClientMessageID is ErrClientMessageIDConflict.
+	ClientMessageID string
+
+	CreatedAt time.Time
+	// EditedAt is zero for messages which were never edited.
+	EditedAt time.Time
+	// Deleted messages are kept in history as tombstones with empty Text.
+	Deleted bool
+}
+
+func (m Message) Edited() bool {
+	return !m.EditedAt.IsZero()
+}
+
+// HasParticipant reports whether userID takes part in the 1:1 dialog of the message.
+// Group membership is not checked.
+func (m Message) HasParticipant(userID UserID) bool {
+	return m.From == userID || m.To == userID
 }
 
 type DialogDelivery interface {
-	SendMessage(ctx context.Context, message Message) error
+	SendMessage(ctx context.Context, message Message) (MessageID, error)
 	GetDialog(ctx context.Context, userID UserID, friendID UserID) ([]Message, error)
 }
 
 type DialogUsecase interface {
-	SendMessage(ctx context.Context, message Message) error
+	SendMessage(ctx context.Context, message Message) (MessageID, error)
 	GetDialog(ctx context.Context, userID UserID, friendID UserID) ([]Message, error)
+	EditMessage(ctx context.Context, actor UserID, messageID MessageID, text string) (Message, error)
+	DeleteMessage(ctx context.Context, actor UserID, messageID MessageID) (Message, error)
+	// HideMessage removes the message from the actor's view only.
+	HideMessage(ctx context.Context, actor UserID, messageID MessageID) error
 }
 
 type DialogRepository interface {
-	SendMessage(ctx context.Context, message Message) error
+	SendMessage(ctx context.Context, message Message) (MessageID, error)
 	GetDialog(ctx context.Context, userID UserID, friendID UserID) ([]Message, error)
+	GetMessage(ctx context.Context, messageID MessageID) (Message, error)
+	EditMessage(ctx context.Context, messageID MessageID, text string) error
+	DeleteMessage(ctx context.Context, messageID MessageID) error
+	HideMessage(ctx context.Context, messageID MessageID, userID UserID) error
+	AreFriends(ctx context.Context, userID UserID, friendID UserID) (bool, error)
+	// IsBlocked reports whether userID has blocked blockedID.
+	IsBlocked(ctx context.Context, userID UserID, blockedID UserID) (bool, error)
+
+	GroupRepository
+}
+
+type DialogEventType string
+
+const (
+	DialogEventTyping DialogEventType = "typing"
+	DialogEventSeen   DialogEventType = "seen"
+)
+
+// DialogEvent is an ephemeral event between dialog participants, it is never stored.
+type DialogEvent struct {
+	Type DialogEventType
+	From UserID
+	// To is the peer of a 1:1 dialog. Seen events take it from the message.
+	To      UserID
+	GroupID GroupID
+	// MessageID is the last seen message of seen events.
+	MessageID MessageID
+}
+
+type DialogEventDelivery interface {
+	SendDialogEvent(ctx context.Context, event DialogEvent) error
+}
+
+type DialogEventUsecase interface {
+	// SendDialogEvent delivers event to the other participants of the dialog live.
+	SendDialogEvent(ctx context.Context, event DialogEvent) error
+}
+
+type DialogEventRateLimiter interface {
+	// Allow reports whether no event with key was allowed during the last interval.
+	Allow(ctx context.Context, key string, interval time.Duration) (bool, error)
 }
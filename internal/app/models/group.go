@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+var (
+	ErrGroupNotFound            = errors.Typed("group_not_found", "group not found")
+	ErrGroupMemberNotFound      = errors.Typed("group_member_not_found", "user is not a member of the group")
+	ErrGroupMemberAlreadyExists = errors.Typed("group_member_already_exists", "user is already a member of the group")
+	ErrGroupPermissionDenied    = errors.Typed("group_permission_denied", "not enough rights in the group")
+)
+
+type GroupID int64
+
+const (
+	EmptyGroupID GroupID = 0
+)
+
+type GroupRole string
+
+const (
+	GroupRoleOwner  GroupRole = "owner"
+	GroupRoleAdmin  GroupRole = "admin"
+	GroupRoleMember GroupRole = "member"
+)
+
+// CanManage reports whether a member with role r may add or remove a member with role target.
+// Owners manage everyone, admins manage plain members only.
+func (r GroupRole) CanManage(target GroupRole) bool {
+	switch r {
+	case GroupRoleOwner:
+		return target != GroupRoleOwner
+	case GroupRoleAdmin:
+		return target == GroupRoleMember
+	default:
+		return false
+	}
+}
+
+type Group struct {
+	ID    GroupID
+	Name  string
+	Owner UserID
+}
+
+type GroupMember struct {
+	GroupID GroupID
+	UserID  UserID
+	Role    GroupRole
+}
+
+type GroupUsecase interface {
+	CreateGroup(ctx context.Context, group Group, members []UserID) (GroupID, error)
+	AddGroupMember(ctx context.Context, actor UserID, member GroupMember) error
+	RemoveGroupMember(ctx context.Context, actor UserID, groupID GroupID, userID UserID) error
+	GetGroupMembers(ctx context.Context, actor UserID, groupID GroupID) ([]GroupMember, error)
+	SendGroupMessage(ctx context.Context, message Message) (MessageID, error)
+	GetGroupMessages(ctx context.Context, actor UserID, groupID GroupID) ([]Message, error)
+}
+
+type GroupRepository interface {
+	CreateGroup(ctx context.Context, group Group, members []GroupMember) (GroupID, error)
+	GetGroupMember(ctx context.Context, groupID GroupID, userID UserID) (GroupMember, error)
+	GetGroupMembers(ctx context.Context, groupID GroupID) ([]GroupMember, error)
+	AddGroupMember(ctx context.Context, member GroupMember) error
+	RemoveGroupMember(ctx context.Context, groupID GroupID, userID UserID) error
+	SendGroupMessage(ctx context.Context, message Message) (MessageID, error)
+	// GetGroupMessages returns group history as seen by userID.
+	GetGroupMessages(ctx context.Context, groupID GroupID, userID UserID) ([]Message, error)
+}
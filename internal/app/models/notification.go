@@ -0,0 +1,301 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownNotificationType = errors.Typed("unknown_notification_type", "unknown notification type")
+	ErrNotificationNotFound    = errors.Typed("notification_not_found", "notification not found")
+	ErrInvalidDigestSettings   = errors.Typed("invalid_digest_settings", "invalid digest settings")
+)
+
+// NotificationSchemaVersion is bumped on incompatible changes of Notification
+// or its payloads, see api/notification.
+const NotificationSchemaVersion = 1
+
+type NotificationType string
+
+const (
+	NotificationPostCreated        NotificationType = "post_created"
+	NotificationFriendRequest      NotificationType = "friend_request"
+	NotificationFriendshipAccepted NotificationType = "friendship_accepted"
+	NotificationMessageReceived    NotificationType = "message_received"
+	NotificationCommentCreated     NotificationType = "comment_created"
+	NotificationReactionAdded      NotificationType = "reaction_added"
+	// NotificationPresenceChanged, NotificationTyping, NotificationMessageSeen,
+	// NotificationMessageEdited and NotificationMessageDeleted are delivered
+	// live only, they are not kept in inboxes.
+	NotificationPresenceChanged NotificationType = "presence_changed"
+	NotificationTyping          NotificationType = "typing"
+	NotificationMessageSeen     NotificationType = "message_seen"
+	NotificationMessageEdited   NotificationType = "message_edited"
+	NotificationMessageDeleted  NotificationType = "message_deleted"
+)
+
+var notificationTypes = map[NotificationType]struct{}{
+	NotificationPostCreated:        {},
+	NotificationFriendRequest:      {},
+	NotificationFriendshipAccepted: {},
+	NotificationMessageReceived:    {},
+	NotificationCommentCreated:     {},
+	NotificationReactionAdded:      {},
+	NotificationPresenceChanged:    {},
+	NotificationTyping:             {},
+	NotificationMessageSeen:        {},
+	NotificationMessageEdited:      {},
+	NotificationMessageDeleted:     {},
+}
+
+func (t NotificationType) Valid() bool {
+	_, ok := notificationTypes[t]
+	return ok
+}
+
+// Live reports whether notifications of the type are delivered live only,
+// so their ids can't be used as inbox cursors.
+func (t NotificationType) Live() bool {
+	switch t {
+	case NotificationPresenceChanged, NotificationTyping, NotificationMessageSeen, NotificationMessageEdited, NotificationMessageDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+type NotificationID string
+
+// Notification is the envelope delivered to Target. Payload depends on Type.
+type Notification struct {
+	Version   int              `json:"version"`
+	ID        NotificationID   `json:"id"`
+	Type      NotificationType `json:"type"`
+	Actor     UserID           `json:"actor"`
+	Target    UserID           `json:"target"`
+	Payload   json.RawMessage  `json:"payload"`
+	CreatedAt time.Time        `json:"created_at"`
+	// ExpiresAt is set for ephemeral notifications which are dropped instead of delivered late.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (n Notification) Expired(now time.Time) bool {
+	return n.ExpiresAt != nil && !now.Before(*n.ExpiresAt)
+}
+
+func NewNotification(typ NotificationType, actor UserID, target UserID, payload interface{}) (Notification, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Notification{}, errors.Wrap(err, "failed to marshal notification payload")
+	}
+
+	return Notification{
+		Version:   NotificationSchemaVersion,
+		ID:        NotificationID(uuid.New().String()),
+		Type:      typ,
+		Actor:     actor,
+		Target:    target,
+		Payload:   raw,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+type PostCreatedPayload struct {
+	Post Post `json:"post"`
+}
+
+type FriendRequestPayload struct{}
+
+type FriendshipAcceptedPayload struct{}
+
+type MessageReceivedPayload struct {
+	MessageID MessageID `json:"message_id"`
+	GroupID   GroupID   `json:"group_id,omitempty"`
+	Text      string    `json:"text"`
+}
+
+type CommentCreatedPayload struct {
+	PostID    PostID `json:"post_id"`
+	CommentID string `json:"comment_id"`
+	Text      string `json:"text"`
+}
+
+type ReactionAddedPayload struct {
+	PostID   PostID `json:"post_id"`
+	Reaction string `json:"reaction"`
+}
+
+type TypingPayload struct {
+	// GroupID is set for group dialogs, Actor is typing to Target otherwise.
+	GroupID GroupID `json:"group_id,omitempty"`
+}
+
+type MessageSeenPayload struct {
+	MessageID MessageID `json:"message_id"`
+	GroupID   GroupID   `json:"group_id,omitempty"`
+}
+
+type MessageEditedPayload struct {
+	MessageID MessageID `json:"message_id"`
+	GroupID   GroupID   `json:"group_id,omitempty"`
+	Text      string    `json:"text"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+type MessageDeletedPayload struct {
+	MessageID MessageID `json:"message_id"`
+	GroupID   GroupID   `json:"group_id,omitempty"`
+}
+
+type PresenceChangedPayload struct {
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// Notifier delivers a notification to its Target.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+type OutboxMessageID int64
+
+// OutboxMessage is a notification stored in the same transaction as the change
+// it describes and published by the outbox relay afterwards.
+type OutboxMessage struct {
+	ID           OutboxMessageID
+	Notification Notification
+	// Attempts counts claims, including the current one.
+	Attempts  int
+	CreatedAt time.Time
+}
+
+type OutboxRepository interface {
+	// ClaimPending locks up to limit unsent messages for lease, so that concurrent
+	// relays never claim the same message. Expired claims are handed out again.
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkSent(ctx context.Context, id OutboxMessageID) error
+	// Write stores notifications with the change made in the transaction of ctx,
+	// so that they are published only if it commits.
+	Write(ctx context.Context, notifications []Notification) error
+}
+
+// InboxNotification is a notification kept in the target inbox.
+type InboxNotification struct {
+	Notification
+	Read bool `json:"read"`
+}
+
+type NotificationPage struct {
+	Notifications []InboxNotification `json:"notifications"`
+	Unread        int                 `json:"unread"`
+}
+
+type NotificationInboxDelivery interface {
+	GetNotifications(ctx context.Context, before NotificationID, limit int) (NotificationPage, error)
+	MarkNotificationsRead(ctx context.Context, ids []NotificationID) error
+	MarkAllNotificationsRead(ctx context.Context) error
+}
+
+type NotificationInboxUsecase interface {
+	// GetNotifications returns the newest notifications older than before,
+	// or the newest ones if before is empty.
+	GetNotifications(ctx context.Context, before NotificationID, limit int) (NotificationPage, error)
+	// ReplayNotifications returns notifications newer than after, oldest first.
+	// Nothing is returned for empty or unknown after.
+	ReplayNotifications(ctx context.Context, after NotificationID) ([]Notification, error)
+	MarkNotificationsRead(ctx context.Context, ids []NotificationID) error
+	MarkAllNotificationsRead(ctx context.Context) error
+}
+
+// NotificationInboxRepository reads inboxes; notifications are added to them
+// together with the outbox.
+type NotificationInboxRepository interface {
+	GetNotifications(ctx context.Context, userID UserID, before NotificationID, limit int) ([]InboxNotification, error)
+	// GetNotificationsAfter returns up to limit oldest notifications newer than after,
+	// oldest first. Empty after means the whole inbox, unknown one means nothing.
+	GetNotificationsAfter(ctx context.Context, userID UserID, after NotificationID, limit int) ([]Notification, error)
+	CountUnread(ctx context.Context, userID UserID) (int, error)
+	MarkRead(ctx context.Context, userID UserID, ids []NotificationID) error
+	MarkAllRead(ctx context.Context, userID UserID) error
+	// GetUnreadAfter returns up to limit newest unread notifications newer than after,
+	// oldest first. Empty or unknown after means the whole inbox.
+	GetUnreadAfter(ctx context.Context, userID UserID, after NotificationID, limit int) ([]Notification, error)
+	// Trim removes all but keep newest notifications of userID.
+	Trim(ctx context.Context, userID UserID, keep int) error
+}
+
+type NotificationPreferencesDelivery interface {
+	GetDisabledNotifications(ctx context.Context) ([]NotificationType, error)
+	SetNotificationEnabled(ctx context.Context, typ NotificationType, enabled bool) error
+	GetDigestSettings(ctx context.Context) (DigestSettings, error)
+	SetDigestSettings(ctx context.Context, settings DigestSettings) error
+}
+
+type NotificationPreferencesUsecase interface {
+	GetDisabledNotifications(ctx context.Context) ([]NotificationType, error)
+	SetNotificationEnabled(ctx context.Context, typ NotificationType, enabled bool) error
+	GetDigestSettings(ctx context.Context) (DigestSettings, error)
+	SetDigestSettings(ctx context.Context, settings DigestSettings) error
+}
+
+// NotificationPreferencesRepository stores per user opt-outs. Types are enabled unless disabled.
+type NotificationPreferencesRepository interface {
+	GetDisabledNotifications(ctx context.Context, userID UserID) ([]NotificationType, error)
+	SetNotificationEnabled(ctx context.Context, userID UserID, typ NotificationType, enabled bool) error
+	// FilterDisabled drops notifications whose targets disabled their type.
+	FilterDisabled(ctx context.Context, notifications []Notification) ([]Notification, error)
+	// GetDigestSettings returns DigestNever frequency for users without settings.
+	GetDigestSettings(ctx context.Context, userID UserID) (DigestSettings, error)
+	SetDigestSettings(ctx context.Context, userID UserID, settings DigestSettings) error
+}
+
+type DigestFrequency string
+
+const (
+	DigestNever  DigestFrequency = "never"
+	DigestHourly DigestFrequency = "hourly"
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+var digestPeriods = map[DigestFrequency]time.Duration{
+	DigestNever:  0,
+	DigestHourly: time.Hour,
+	DigestDaily:  24 * time.Hour,
+	DigestWeekly: 7 * 24 * time.Hour,
+}
+
+func (f DigestFrequency) Valid() bool {
+	_, ok := digestPeriods[f]
+	return ok
+}
+
+// Period is the time between digests, zero for DigestNever.
+func (f DigestFrequency) Period() time.Duration {
+	return digestPeriods[f]
+}
+
+// DigestSettings configures email digests of unread notifications.
+type DigestSettings struct {
+	Email     string          `json:"email"`
+	Frequency DigestFrequency `json:"frequency"`
+}
+
+// DigestSubscription is a user whose digest is due.
+type DigestSubscription struct {
+	UserID UserID
+	DigestSettings
+	// LastNotificationID is the newest notification of the previous digest.
+	LastNotificationID NotificationID
+}
+
+type NotificationDigestRepository interface {
+	// ClaimDue locks up to limit subscriptions whose digest is due for lease.
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]DigestSubscription, error)
+	// MarkDigestSent schedules the next digest. Empty last keeps the previous cursor.
+	MarkDigestSent(ctx context.Context, userID UserID, last NotificationID, next time.Time) error
+}
@@ -8,18 +8,34 @@ import (
 type PostDelivery interface {
 	GetFeed(ctx context.Context, userID UserID) ([]Post, error)
 	CreatePost(ctx context.Context, post Post) (PostID, error)
+	DeletePost(ctx context.Context, postID PostID) error
 }
 
 type PostUsecase interface {
 	GetFeed(ctx context.Context, userID UserID, limit int, offset int) ([]Post, error)
 	CreatePost(ctx context.Context, post Post) (PostID, error)
+	// DeletePost deletes a post of the user of the session.
+	DeletePost(ctx context.Context, postID PostID) error
 }
 
 type PostRepository interface {
 	GetFeed(ctx context.Context, userID string, limit int, offset int) ([]Post, error)
-	CreatePost(ctx context.Context, post Post) (PostID, error)
+	// CreatePost stores post together with outbox notifications atomically.
+	CreatePost(ctx context.Context, post Post, notifications []Notification) (PostID, error)
+	// DeletePost marks a post of userID deleted, deleted posts and posts of
+	// deleted users are left out of feeds.
+	DeletePost(ctx context.Context, postID PostID, userID UserID) error
 	GenerateCache(ctx context.Context, userID string) error
+	// AddToCache puts post at the head of the cached feed of userID. Adding
+	// the same post again does not repeat it.
 	AddToCache(ctx context.Context, userID string, post Post) error
+	// UpdateInCache and RemoveFromCache change a post in the cached feed of
+	// userID, feeds without the post are left as is.
+	UpdateInCache(ctx context.Context, userID string, post Post) error
+	RemoveFromCache(ctx context.Context, userID string, postID PostID) error
+	// RebuildCache replaces the cached feed of userID with the latest posts
+	// of the friends.
+	RebuildCache(ctx context.Context, userID string) error
 }
 
 type PostID string
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+var ErrTooManyPresenceIDs = errors.Typed("too_many_presence_ids", "too many presence ids")
+
+// ConnectionID identifies one open stream of a user, so that every device
+// holding a socket keeps the user online on its own.
+type ConnectionID string
+
+type Presence struct {
+	UserID UserID `json:"user_id"`
+	Online bool   `json:"online"`
+	// Devices is the number of open connections.
+	Devices int `json:"devices"`
+	// LastSeenAt is set for offline users who have been online before.
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+type PresenceDelivery interface {
+	GetPresence(ctx context.Context, ids []UserID) ([]Presence, error)
+}
+
+type PresenceUsecase interface {
+	// GetPresence returns presence of the current user and their friends among ids, others are skipped.
+	GetPresence(ctx context.Context, ids []UserID) ([]Presence, error)
+	// Connect and Heartbeat keep conn online for the presence ttl. Friends are
+	// notified when the first connection of a user appears.
+	Connect(ctx context.Context, userID UserID, conn ConnectionID) error
+	Heartbeat(ctx context.Context, userID UserID, conn ConnectionID) error
+	// Disconnect removes conn. Friends are notified when the last connection is gone.
+	Disconnect(ctx context.Context, userID UserID, conn ConnectionID) error
+	// NotifyExpired notifies friends of users whose last connection expired
+	// without a disconnect, e.g. because the instance holding it crashed.
+	NotifyExpired(ctx context.Context) error
+}
+
+type PresenceRepository interface {
+	// Touch keeps conn until expiresAt and reports whether the user had no live connections before.
+	Touch(ctx context.Context, userID UserID, conn ConnectionID, expiresAt time.Time) (cameOnline bool, err error)
+	// Remove drops conn and reports whether it was the last live connection.
+	Remove(ctx context.Context, userID UserID, conn ConnectionID) (wentOffline bool, err error)
+	// PopExpired returns up to limit users whose last connection expired by now
+	// without a Remove. Every such user is returned once.
+	PopExpired(ctx context.Context, now time.Time, limit int) ([]Presence, error)
+	GetPresence(ctx context.Context, ids []UserID) ([]Presence, error)
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// RetentionRepository hard-deletes rows soft-deleted before the given time.
+// Every call removes at most limit of them, so that locks are held briefly,
+// and returns how many were removed.
+type RetentionRepository interface {
+	PurgeMessages(ctx context.Context, before time.Time, limit int) (int64, error)
+	PurgePosts(ctx context.Context, before time.Time, limit int) (int64, error)
+	// PurgeUsers removes the rows referencing the users before them. Users
+	// owning groups are kept, the groups hold messages of other members.
+	PurgeUsers(ctx context.Context, before time.Time, limit int) (int64, error)
+}
@@ -0,0 +1,9 @@
+package models
+
+import "context"
+
+// TxManager runs fn in a transaction; repositories called with the ctx passed
+// to fn join it. Nested calls are savepoints. fn may be rerun on a deadlock.
+type TxManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -8,10 +8,11 @@ import (
 )
 
 var (
-	ErrUserAlreadyExists = errors.Typed("user_already_exists", "user already exists")
-	ErrUserNotFound      = errors.Typed("user_not_found", "user not found")
-	ErrWrongPassword     = errors.Typed("wrong_password", "wrong password")
-	ErrUnauthorized      = errors.Typed("unauthorized", "unauthorized")
+	ErrUserAlreadyExists       = errors.Typed("user_already_exists", "user already exists")
+	ErrUserNotFound            = errors.Typed("user_not_found", "user not found")
+	ErrWrongPassword           = errors.Typed("wrong_password", "wrong password")
+	ErrUnauthorized            = errors.Typed("unauthorized", "unauthorized")
+	ErrFriendshipAlreadyExists = errors.Typed("friendship_already_exists", "users are already friends")
 
 	ErrPostAlreadyExists = errors.Typed("post_already_exists", "post already exists")
 	ErrPostNotFound      = errors.Typed("post_not_found", "post not found")
@@ -61,6 +62,9 @@ type UserDelivery interface {
 	Login(ctx context.Context, userID UserID, password string) (SessionToken, error)
 	SearchUser(ctx context.Context, firstName string, secondName string) ([]User, error)
 	CreateFriend(ctx context.Context, userID UserID) error
+	BlockUser(ctx context.Context, userID UserID) error
+	UnblockUser(ctx context.Context, userID UserID) error
+	DeleteUser(ctx context.Context) error
 }
 
 type UserUsecase interface {
@@ -69,6 +73,10 @@ type UserUsecase interface {
 	CreateSession(ctx context.Context, userID UserID, password string) (SessionToken, error)
 	SearchUser(ctx context.Context, firstName string, secondName string) ([]User, error)
 	CreateFriend(ctx context.Context, userID UserID) error
+	BlockUser(ctx context.Context, userID UserID) error
+	UnblockUser(ctx context.Context, userID UserID) error
+	// DeleteUser deletes the user of the session.
+	DeleteUser(ctx context.Context) error
 }
 
 type UserRepository interface {
@@ -77,8 +85,24 @@ type UserRepository interface {
 	GetRandomUsers(ctx context.Context, n int) ([]User, error)
 	GetFriends(ctx context.Context, userID UserID) ([]UserID, error)
 	GetUser(ctx context.Context, userID UserID) (User, error)
+	// GetUsers returns the users of ids which exist, in the order of ids.
+	GetUsers(ctx context.Context, ids []UserID) ([]User, error)
 	SearchUser(ctx context.Context, firstName string, secondName string) ([]User, error)
 	CreateFriendship(ctx context.Context, userID1 UserID, userID2 UserID) error
+	BlockUser(ctx context.Context, userID UserID, blockedID UserID) error
+	UnblockUser(ctx context.Context, userID UserID, blockedID UserID) error
+	// DeleteUser marks the user deleted, deleted users are not returned by
+	// the repository. The rows are removed by the retention purge.
+	DeleteUser(ctx context.Context, userID UserID) error
+}
+
+// UserSearchIndex finds users by case-insensitive prefixes of their names.
+// cmd/feed-cdc keeps it from the binlog, changes may be applied twice.
+type UserSearchIndex interface {
+	// IndexUser adds the user or replaces its names.
+	IndexUser(ctx context.Context, userID UserID, firstName string, secondName string) error
+	RemoveUser(ctx context.Context, userID UserID) error
+	SearchUsers(ctx context.Context, firstName string, secondName string) ([]UserID, error)
 }
 
 type SessionRepository interface {
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoerrors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type preferencesDelivery struct {
+	usecase models.NotificationPreferencesUsecase
+	logger  log.Logger
+}
+
+func NewPreferencesDelivery(usecase models.NotificationPreferencesUsecase, logger log.Logger) models.NotificationPreferencesDelivery {
+	return preferencesDelivery{
+		usecase: usecase,
+		logger:  logger,
+	}
+}
+
+func (p preferencesDelivery) GetDisabledNotifications(ctx context.Context) ([]models.NotificationType, error) {
+	types, err := p.usecase.GetDisabledNotifications(ctx)
+	if err != nil {
+		return nil, errors.Wrap(convertNotificationError(err), "failed to get disabled notifications")
+	}
+
+	return types, nil
+}
+
+func (p preferencesDelivery) SetNotificationEnabled(ctx context.Context, typ models.NotificationType, enabled bool) error {
+	err := p.usecase.SetNotificationEnabled(ctx, typ, enabled)
+	if err != nil {
+		return errors.Wrap(convertNotificationError(err), "failed to set notification preference")
+	}
+
+	return nil
+}
+
+func (p preferencesDelivery) GetDigestSettings(ctx context.Context) (models.DigestSettings, error) {
+	settings, err := p.usecase.GetDigestSettings(ctx)
+	if err != nil {
+		return models.DigestSettings{}, errors.Wrap(convertNotificationError(err), "failed to get digest settings")
+	}
+
+	return settings, nil
+}
+
+func (p preferencesDelivery) SetDigestSettings(ctx context.Context, settings models.DigestSettings) error {
+	err := p.usecase.SetDigestSettings(ctx, settings)
+	if err != nil {
+		return errors.Wrap(convertNotificationError(err), "failed to set digest settings")
+	}
+
+	return nil
+}
+
+type inboxDelivery struct {
+	usecase models.NotificationInboxUsecase
+	logger  log.Logger
+}
+
+func NewInboxDelivery(usecase models.NotificationInboxUsecase, logger log.Logger) models.NotificationInboxDelivery {
+	return inboxDelivery{
+		usecase: usecase,
+		logger:  logger,
+	}
+}
+
+func (i inboxDelivery) GetNotifications(ctx context.Context, before models.NotificationID, limit int) (models.NotificationPage, error) {
+	page, err := i.usecase.GetNotifications(ctx, before, limit)
+	if err != nil {
+		return models.NotificationPage{}, errors.Wrap(convertNotificationError(err), "failed to get notifications")
+	}
+
+	return page, nil
+}
+
+func (i inboxDelivery) MarkNotificationsRead(ctx context.Context, ids []models.NotificationID) error {
+	err := i.usecase.MarkNotificationsRead(ctx, ids)
+	if err != nil {
+		return errors.Wrap(convertNotificationError(err), "failed to mark notifications read")
+	}
+
+	return nil
+}
+
+func (i inboxDelivery) MarkAllNotificationsRead(ctx context.Context) error {
+	err := i.usecase.MarkAllNotificationsRead(ctx)
+	if err != nil {
+		return errors.Wrap(convertNotificationError(err), "failed to mark notifications read")
+	}
+
+	return nil
+}
+
+func convertNotificationError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotificationNotFound):
+		return echoerrors.NotFoundError(err, "notification")
+	case errors.Is(err, models.ErrUnknownNotificationType):
+		return echoerrors.ValidationError(err, "unknown notification type", echoerrors.ValidationErrorFields{"type": echoerrors.FieldInvalid})
+	case errors.Is(err, models.ErrInvalidDigestSettings):
+		return echoerrors.ValidationError(err, "invalid digest settings", echoerrors.ValidationErrorFields{"digest": echoerrors.FieldInvalid})
+	case errors.Is(err, models.ErrUnauthorized):
+		return echoerrors.UnauthorizedError(err, echoerrors.ReasonAuthError, "unauthorized")
+	case errors.Is(err, errors.ErrUnavailable):
+		return echoerrors.ServiceUnavailableError(err)
+	default:
+		return echoerrors.InternalError(err)
+	}
+}
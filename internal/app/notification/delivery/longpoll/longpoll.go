@@ -0,0 +1,85 @@
+package longpoll
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+)
+
+type Config struct {
+	// Timeout is how long a poll waits for the first notification.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Linger collects notifications arriving right after the first one into the same response.
+	Linger time.Duration `mapstructure:"linger"`
+	// MaxBatch bounds notifications returned by one poll.
+	MaxBatch int `mapstructure:"max_batch"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 25 * time.Second
+	}
+	if c.Linger <= 0 {
+		c.Linger = 50 * time.Millisecond
+	}
+	if c.MaxBatch <= 0 {
+		c.MaxBatch = 100
+	}
+
+	return c
+}
+
+type Response struct {
+	Notifications []models.Notification `json:"notifications"`
+}
+
+// Poll returns backlog right away if it is not empty, otherwise it waits for
+// live notifications until the timeout or ctx is done. Clients pass the id of
+// the last returned inbox notification, skipping live-only ones, to the next
+// poll, and notifications published between polls are replayed from the inbox.
+func Poll(ctx context.Context, cfg Config, backlog []models.Notification, notifications <-chan models.Notification) Response {
+	cfg = cfg.withDefaults()
+
+	if len(backlog) > 0 {
+		if len(backlog) > cfg.MaxBatch {
+			backlog = backlog[:cfg.MaxBatch]
+		}
+		return Response{Notifications: backlog}
+	}
+
+	timeout := time.NewTimer(cfg.Timeout)
+	defer timeout.Stop()
+
+	res := Response{Notifications: []models.Notification{}}
+	select {
+	case <-ctx.Done():
+		return res
+	case <-timeout.C:
+		return res
+	case notification, ok := <-notifications:
+		if !ok {
+			return res
+		}
+		res.Notifications = append(res.Notifications, notification)
+	}
+
+	linger := time.NewTimer(cfg.Linger)
+	defer linger.Stop()
+
+	for len(res.Notifications) < cfg.MaxBatch {
+		select {
+		case <-ctx.Done():
+			return res
+		case <-linger.C:
+			return res
+		case notification, ok := <-notifications:
+			if !ok {
+				return res
+			}
+			res.Notifications = append(res.Notifications, notification)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,136 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+// LastEventIDHeader is sent by browsers when an EventSource reconnects.
+const LastEventIDHeader = "Last-Event-ID"
+
+// LastEventID returns the notification to resume after. EventSource sends
+// Last-Event-ID on reconnect; the last_event_id query param covers the first connect.
+func LastEventID(r *http.Request) models.NotificationID {
+	if id := r.Header.Get(LastEventIDHeader); id != "" {
+		return models.NotificationID(id)
+	}
+
+	return models.NotificationID(r.URL.Query().Get("last_event_id"))
+}
+
+type Config struct {
+	// HeartbeatInterval keeps proxies from closing idle streams.
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// Retry is the reconnect delay suggested to clients.
+	Retry time.Duration `mapstructure:"retry"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.HeartbeatInterval <= 0 {
+		c.HeartbeatInterval = 15 * time.Second
+	}
+	if c.Retry <= 0 {
+		c.Retry = 3 * time.Second
+	}
+
+	return c
+}
+
+// Stream writes notifications as text/event-stream. Event ids are ids of inbox
+// notifications, so Last-Event-ID resumes from the inbox. Live-only
+// notifications are written without an id and EventSource keeps the last one.
+type Stream struct {
+	cfg     Config
+	w       http.ResponseWriter
+	flusher http.Flusher
+	logger  log.Logger
+}
+
+func NewStream(cfg Config, w http.ResponseWriter, logger log.Logger) (Stream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return Stream{}, errors.New("response writer does not support flushing")
+	}
+
+	return Stream{
+		cfg:     cfg.withDefaults(),
+		w:       w,
+		flusher: flusher,
+		logger:  logger,
+	}, nil
+}
+
+// Serve writes backlog and then live notifications, skipping live ones already
+// replayed. It returns when ctx is done (the client went away or the server
+// shuts down), notifications is closed or a write fails.
+func (s Stream) Serve(ctx context.Context, backlog []models.Notification, notifications <-chan models.Notification) error {
+	header := s.w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// disables response buffering in nginx
+	header.Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(s.w, "retry: %d\n\n", s.cfg.Retry.Milliseconds()); err != nil {
+		return errors.Wrap(err, "failed to write retry")
+	}
+
+	replayed := make(map[models.NotificationID]struct{}, len(backlog))
+	for _, notification := range backlog {
+		if err := s.write(notification); err != nil {
+			return errors.Wrap(err, "failed to replay notification")
+		}
+		replayed[notification.ID] = struct{}{}
+	}
+	s.flusher.Flush()
+
+	ticker := time.NewTicker(s.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+			if _, ok := replayed[notification.ID]; ok {
+				continue
+			}
+
+			if err := s.write(notification); err != nil {
+				return errors.Wrap(err, "failed to write notification")
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+				return errors.Wrap(err, "failed to write heartbeat")
+			}
+		}
+		s.flusher.Flush()
+	}
+}
+
+func (s Stream) write(notification models.Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	if !notification.Type.Live() {
+		if _, err := fmt.Fprintf(s.w, "id: %s\n", notification.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", notification.Type, data)
+	return err
+}
@@ -0,0 +1,111 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+// events returns ids of the events in an event stream.
+func events(t *testing.T, resp *http.Response) []models.NotificationID {
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var ids []models.NotificationID
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "id: ") {
+			ids = append(ids, models.NotificationID(strings.TrimPrefix(line, "id: ")))
+		}
+	}
+	require.NoError(t, scanner.Err())
+
+	return ids
+}
+
+// inboxServer streams the part of inbox after the cursor followed by *live.
+// The stream ends once live notifications are written.
+func inboxServer(t *testing.T, inbox []models.Notification, live *[]models.Notification) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var backlog []models.Notification
+		if after := LastEventID(r); after != "" {
+			for i, notification := range inbox {
+				if notification.ID == after {
+					backlog = inbox[i+1:]
+				}
+			}
+		}
+
+		notifications := make(chan models.Notification, len(*live))
+		for _, notification := range *live {
+			notifications <- notification
+		}
+		close(notifications)
+
+		stream, err := NewStream(Config{}, w, log.Null)
+		require.NoError(t, err)
+		require.NoError(t, stream.Serve(context.Background(), backlog, notifications))
+	}))
+}
+
+func reconnect(t *testing.T, url string, lastEventID models.NotificationID) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set(LastEventIDHeader, string(lastEventID))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	return resp
+}
+
+func TestResumeFromLastEventID(t *testing.T) {
+	inbox := []models.Notification{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	var live []models.Notification
+	server := inboxServer(t, inbox, &live)
+	defer server.Close()
+
+	live = inbox[:1]
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	require.Equal(t, []models.NotificationID{"1"}, events(t, resp))
+
+	// the reconnect replays what was missed, the live copy of a replayed notification is skipped
+	live = []models.Notification{{ID: "3"}, {ID: "4"}}
+	require.Equal(t, []models.NotificationID{"2", "3", "4"}, events(t, reconnect(t, server.URL, "1")))
+
+	// the first connect passes the cursor as a query param
+	live = nil
+	resp, err = http.Get(server.URL + "?last_event_id=2")
+	require.NoError(t, err)
+	require.Equal(t, []models.NotificationID{"3"}, events(t, resp))
+}
+
+func TestLiveNotificationsKeepLastEventID(t *testing.T) {
+	inbox := []models.Notification{
+		{ID: "1", Type: models.NotificationMessageReceived},
+		{ID: "2", Type: models.NotificationMessageReceived},
+	}
+
+	var live []models.Notification
+	server := inboxServer(t, inbox, &live)
+	defer server.Close()
+
+	// typing is not in the inbox, EventSource keeps "1" as the last event id
+	live = []models.Notification{inbox[0], {ID: "typing", Type: models.NotificationTyping}}
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	ids := events(t, resp)
+	require.Equal(t, []models.NotificationID{"1"}, ids)
+
+	live = nil
+	require.Equal(t, []models.NotificationID{"2"}, events(t, reconnect(t, server.URL, ids[len(ids)-1])))
+}
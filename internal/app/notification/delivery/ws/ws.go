@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/gorilla/websocket"
+)
+
+type Config struct {
+	WriteWait      time.Duration `mapstructure:"write_wait"`
+	PongWait       time.Duration `mapstructure:"pong_wait"`
+	PingPeriod     time.Duration `mapstructure:"ping_period"`
+	MaxMessageSize int64         `mapstructure:"max_message_size"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.WriteWait <= 0 {
+		c.WriteWait = 10 * time.Second
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = 60 * time.Second
+	}
+	if c.PingPeriod <= 0 || c.PingPeriod >= c.PongWait {
+		c.PingPeriod = c.PongWait * 9 / 10
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = 512
+	}
+
+	return c
+}
+
+// Handler processes a text or binary message sent by the client. It runs on
+// the read loop, so a slow handler delays pongs; it must not write to the socket.
+type Handler func(ctx context.Context, msg []byte)
+
+// Session pumps notifications (api/notification/v1 schema) into a websocket until either side goes away.
+type Session struct {
+	cfg     Config
+	conn    *websocket.Conn
+	handler Handler
+	logger  log.Logger
+}
+
+func NewSession(cfg Config, conn *websocket.Conn, logger log.Logger) Session {
+	return Session{
+		cfg:    cfg.withDefaults(),
+		conn:   conn,
+		logger: logger,
+	}
+}
+
+// WithHandler makes the session pass client messages to handler instead of discarding them.
+func (s Session) WithHandler(handler Handler) Session {
+	s.handler = handler
+	return s
+}
+
+// Serve writes backlog first and then live notifications. Live notifications
+// already present in backlog are skipped, so subscribing before loading the
+// backlog loses nothing and duplicates nothing.
+// Serve blocks until the client disconnects, stops answering pings, a write
+// fails, notifications is closed or ctx is done. The socket is closed on return.
+func (s Session) Serve(ctx context.Context, backlog []models.Notification, notifications <-chan models.Notification) error {
+	defer s.conn.Close()
+
+	gone := make(chan struct{})
+	go s.readLoop(ctx, gone)
+
+	replayed := make(map[models.NotificationID]struct{}, len(backlog))
+	for _, notification := range backlog {
+		if err := s.write(notification); err != nil {
+			return errors.Wrap(err, "failed to replay notification")
+		}
+		replayed[notification.ID] = struct{}{}
+	}
+
+	ticker := time.NewTicker(s.cfg.PingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.writeClose(websocket.CloseGoingAway)
+			return nil
+		case <-gone:
+			return nil
+		case notification, ok := <-notifications:
+			if !ok {
+				s.writeClose(websocket.CloseTryAgainLater)
+				return nil
+			}
+
+			if _, ok := replayed[notification.ID]; ok {
+				continue
+			}
+
+			if err := s.write(notification); err != nil {
+				return errors.Wrap(err, "failed to write notification")
+			}
+		case <-ticker.C:
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.cfg.WriteWait))
+			if err != nil {
+				return errors.Wrap(err, "failed to write ping")
+			}
+		}
+	}
+}
+
+// readLoop drains client frames so that control frames (pong, close) are
+// processed, and reports when the peer is gone.
+func (s Session) readLoop(ctx context.Context, gone chan<- struct{}) {
+	defer close(gone)
+
+	s.conn.SetReadLimit(s.cfg.MaxMessageSize)
+	_ = s.conn.SetReadDeadline(time.Now().Add(s.cfg.PongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(s.cfg.PongWait))
+	})
+
+	for {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				s.logger.WithError(err).Debug("websocket closed unexpectedly")
+			}
+			return
+		}
+
+		if s.handler != nil {
+			s.handler(ctx, msg)
+		}
+	}
+}
+
+func (s Session) write(notification models.Notification) error {
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteWait))
+
+	return s.conn.WriteJSON(notification)
+}
+
+func (s Session) writeClose(code int) {
+	msg := websocket.FormatCloseMessage(code, "")
+	_ = s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(s.cfg.WriteWait))
+}
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a session for every connection and returns the client side.
+func serve(t *testing.T, backlog []models.Notification, notifications <-chan models.Notification, handler Handler) *websocket.Conn {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+
+		_ = NewSession(Config{}, conn, log.Null).WithHandler(handler).Serve(context.Background(), backlog, notifications)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	return conn
+}
+
+func TestSessionReplaysBacklogFirst(t *testing.T) {
+	backlog := []models.Notification{{ID: "1"}, {ID: "2"}}
+	notifications := make(chan models.Notification, 3)
+	// the second notification was published between subscribing and loading the backlog
+	notifications <- models.Notification{ID: "2"}
+	notifications <- models.Notification{ID: "3"}
+	close(notifications)
+
+	conn := serve(t, backlog, notifications, nil)
+
+	for _, want := range []models.NotificationID{"1", "2", "3"} {
+		var notification models.Notification
+		require.NoError(t, conn.ReadJSON(&notification))
+		require.Equal(t, want, notification.ID)
+	}
+
+	// a closed subscription asks the client to reconnect
+	_, _, err := conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), err)
+}
+
+func TestSessionPassesClientMessages(t *testing.T) {
+	received := make(chan string, 1)
+	conn := serve(t, nil, make(chan models.Notification), func(_ context.Context, msg []byte) {
+		received <- string(msg)
+	})
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"typing"}`)))
+
+	select {
+	case msg := <-received:
+		require.Equal(t, `{"type":"typing"}`, msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not handled")
+	}
+}
@@ -0,0 +1,182 @@
+package digest
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/email"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor/batchgetter"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+)
+
+const taskType = "notification_digest"
+
+type Config struct {
+	BatchSize int `mapstructure:"batch_size"`
+	// Lease is how long a claimed digest is hidden from other workers.
+	// It must exceed the pool task timeout, otherwise digests are sent twice.
+	Lease time.Duration `mapstructure:"lease"`
+	// MaxNotifications bounds notifications listed in one email.
+	MaxNotifications int `mapstructure:"max_notifications"`
+
+	EmailFrom string `mapstructure:"email_from"`
+	NameFrom  string `mapstructure:"name_from"`
+	Subject   string `mapstructure:"subject"`
+}
+
+type digestStat struct {
+	Sent    stat.CounterCtor `labels:"status,frequency"`
+	Skipped stat.CounterCtor
+}
+
+// Scheduler turns due digest subscriptions into processor tasks. Each task
+// emails unread notifications received since the previous digest.
+type Scheduler struct {
+	cfg     Config
+	digests models.NotificationDigestRepository
+	inbox   models.NotificationInboxRepository
+	sender  email.Sender
+	logger  log.Logger
+	Stat    digestStat
+}
+
+func NewScheduler(
+	cfg Config,
+	digests models.NotificationDigestRepository,
+	inbox models.NotificationInboxRepository,
+	sender email.Sender,
+	registry stat.Registry,
+	logger log.Logger,
+) processor.TaskGetter {
+	return batchgetter.New(newScheduler(cfg, digests, inbox, sender, registry, logger))
+}
+
+func newScheduler(
+	cfg Config,
+	digests models.NotificationDigestRepository,
+	inbox models.NotificationInboxRepository,
+	sender email.Sender,
+	registry stat.Registry,
+	logger log.Logger,
+) *Scheduler {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Minute
+	}
+	if cfg.MaxNotifications <= 0 {
+		cfg.MaxNotifications = 20
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = "Your unread notifications"
+	}
+
+	s := &Scheduler{
+		cfg:     cfg,
+		digests: digests,
+		inbox:   inbox,
+		sender:  sender,
+		logger:  logger,
+	}
+	stat.NewRegistrar(registry.ForSubsystem("notification_digest")).MustRegister(&s.Stat)
+
+	return s
+}
+
+func (s *Scheduler) GetBatch(ctx context.Context) ([]processor.Task, error) {
+	subscriptions, err := s.digests.ClaimDue(ctx, s.cfg.BatchSize, s.cfg.Lease)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim due digests")
+	}
+
+	tasks := make([]processor.Task, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		tasks = append(tasks, &task{scheduler: s, subscription: subscription})
+	}
+
+	return tasks, nil
+}
+
+type task struct {
+	scheduler    *Scheduler
+	subscription models.DigestSubscription
+
+	// last is the newest notification sent, empty if nothing was sent
+	last models.NotificationID
+}
+
+func (t *task) Process(ctx context.Context) (err error) {
+	sub := t.subscription
+
+	notifications, err := t.scheduler.inbox.GetUnreadAfter(ctx, sub.UserID, sub.LastNotificationID, t.scheduler.cfg.MaxNotifications)
+	if err != nil {
+		return errors.Wrap(err, "failed to get unread notifications")
+	}
+	if len(notifications) == 0 {
+		t.scheduler.Stat.Skipped.Counter(ctx).Add(1)
+		return nil
+	}
+
+	defer func() {
+		t.scheduler.Stat.Sent.Counter(ctx).WithLabels(stat.Labels{
+			"status":    stat.TypedErrorLabel(ctx, err),
+			"frequency": string(sub.Frequency),
+		}).Add(1)
+	}()
+
+	unread, err := t.scheduler.inbox.CountUnread(ctx, sub.UserID)
+	if err != nil {
+		return errors.Wrap(err, "failed to count unread notifications")
+	}
+
+	body, err := render(sub.Frequency, notifications, unread)
+	if err != nil {
+		return err
+	}
+
+	err = t.scheduler.sender.Send(ctx, []string{sub.Email}, t.scheduler.cfg.Subject, body, email.SendOpts{
+		EmailFrom: t.scheduler.cfg.EmailFrom,
+		NameFrom:  t.scheduler.cfg.NameFrom,
+	})
+	if err != nil {
+		// the claim expires and the digest is retried by the next batch
+		return errors.Wrap(err, "failed to send digest")
+	}
+
+	t.last = notifications[len(notifications)-1].ID
+
+	return nil
+}
+
+func (t *task) Ack(ctx context.Context) error {
+	period := t.subscription.Frequency.Period()
+	if period <= 0 {
+		period = models.DigestDaily.Period()
+	}
+
+	return t.scheduler.digests.MarkDigestSent(ctx, t.subscription.UserID, t.last, time.Now().Add(period))
+}
+
+// Delete is never requested: failed digests stay due until sent.
+func (t *task) Delete(_ context.Context) error {
+	return nil
+}
+
+func (t *task) Defer(_ context.Context) {}
+
+func (t *task) Key() string {
+	return string(t.subscription.UserID)
+}
+
+func (t *task) Type() string {
+	return taskType
+}
+
+func (t *task) UserID() string {
+	return string(t.subscription.UserID)
+}
@@ -0,0 +1,162 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/email/smtp"
+	"github.com/antonpriyma/otus-highload/pkg/email/smtp/smtptest"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/emersion/go-message"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDigests hands out every subscription once and records sent digests.
+type fakeDigests struct {
+	models.NotificationDigestRepository
+
+	due  []models.DigestSubscription
+	sent map[models.UserID]models.NotificationID
+}
+
+func (f *fakeDigests) ClaimDue(_ context.Context, limit int, _ time.Duration) ([]models.DigestSubscription, error) {
+	if len(f.due) < limit {
+		limit = len(f.due)
+	}
+
+	claimed := f.due[:limit]
+	f.due = f.due[limit:]
+
+	return claimed, nil
+}
+
+func (f *fakeDigests) MarkDigestSent(_ context.Context, userID models.UserID, last models.NotificationID, _ time.Time) error {
+	f.sent[userID] = last
+
+	return nil
+}
+
+// fakeInbox keeps unread notifications of every user oldest first.
+type fakeInbox struct {
+	models.NotificationInboxRepository
+
+	unread map[models.UserID][]models.Notification
+}
+
+func (f *fakeInbox) GetUnreadAfter(_ context.Context, userID models.UserID, after models.NotificationID, limit int) ([]models.Notification, error) {
+	notifications := f.unread[userID]
+	for i, notification := range notifications {
+		if notification.ID == after {
+			notifications = notifications[i+1:]
+			break
+		}
+	}
+	if len(notifications) > limit {
+		notifications = notifications[len(notifications)-limit:]
+	}
+
+	return notifications, nil
+}
+
+func (f *fakeInbox) CountUnread(_ context.Context, userID models.UserID) (int, error) {
+	return len(f.unread[userID]), nil
+}
+
+func messageReceived(t *testing.T, id int) models.Notification {
+	notification, err := models.NewNotification(models.NotificationMessageReceived, "bob", "alice", models.MessageReceivedPayload{
+		Text: fmt.Sprintf("message %d", id),
+	})
+	require.NoError(t, err)
+	notification.ID = models.NotificationID(fmt.Sprint(id))
+
+	return notification
+}
+
+// parts returns the content types and decoded bodies of a multipart message.
+func parts(t *testing.T, data string) map[string]string {
+	entity, err := message.Read(strings.NewReader(data))
+	require.NoError(t, err)
+
+	contentType, _, err := entity.Header.ContentType()
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", contentType)
+
+	res := make(map[string]string)
+	reader := entity.MultipartReader()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return res
+		}
+		require.NoError(t, err)
+
+		contentType, _, err := part.Header.ContentType()
+		require.NoError(t, err)
+		body, err := io.ReadAll(part.Body)
+		require.NoError(t, err)
+		res[contentType] = string(body)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	server, err := smtptest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	sender := smtp.NewSender(smtp.Config{Host: server.Host(), Port: server.Port(), SkipTLS: true}, nil, log.Null, stub.NewStubRegistry())
+
+	inbox := &fakeInbox{unread: map[models.UserID][]models.Notification{
+		"alice": {messageReceived(t, 1), messageReceived(t, 2), messageReceived(t, 3), messageReceived(t, 4)},
+		"bob":   {messageReceived(t, 5)},
+	}}
+	digests := &fakeDigests{
+		due: []models.DigestSubscription{
+			{UserID: "alice", DigestSettings: models.DigestSettings{Email: "alice@example.com", Frequency: models.DigestDaily}, LastNotificationID: "1"},
+			// bob has seen everything in the previous digest
+			{UserID: "bob", DigestSettings: models.DigestSettings{Email: "bob@example.com", Frequency: models.DigestHourly}, LastNotificationID: "5"},
+		},
+		sent: make(map[models.UserID]models.NotificationID),
+	}
+
+	s := newScheduler(Config{MaxNotifications: 2, EmailFrom: "digest@example.com"}, digests, inbox, sender, stub.NewStubRegistry(), log.Null)
+
+	tasks, err := s.GetBatch(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+	for _, task := range tasks {
+		require.NoError(t, task.Process(ctx))
+		require.NoError(t, task.Ack(ctx))
+	}
+
+	messages := server.Messages()
+	require.Len(t, messages, 1, "bob has nothing unread since the previous digest")
+	require.Equal(t, []string{"alice@example.com"}, messages[0].To)
+	require.Equal(t, "digest@example.com", messages[0].From)
+
+	body := parts(t, messages[0].Data)
+	require.Len(t, body, 2)
+	for _, contentType := range []string{"text/plain", "text/html"} {
+		// the newest notifications are listed, the rest are counted
+		require.Contains(t, body[contentType], "You have 4 unread notifications")
+		require.Contains(t, body[contentType], "message 4")
+		require.Contains(t, body[contentType], "message 3")
+		require.NotContains(t, body[contentType], "message 2")
+		require.Contains(t, body[contentType], "And 2 more")
+	}
+	require.Contains(t, body["text/html"], "<li><b>New message</b>")
+
+	// the cursor moves to the newest sent notification, a skipped digest keeps it
+	require.Equal(t, map[models.UserID]models.NotificationID{"alice": "4", "bob": ""}, digests.sent)
+
+	tasks, err = s.GetBatch(ctx)
+	require.NoError(t, err)
+	require.Empty(t, tasks)
+}
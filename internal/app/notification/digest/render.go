@@ -0,0 +1,114 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/email"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+// maxTextLength trims post and message texts quoted in digests.
+const maxTextLength = 140
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt"))
+)
+
+type view struct {
+	Unread    int
+	Frequency models.DigestFrequency
+	Items     []item
+	// More is the number of unread notifications left out of the digest.
+	More int
+}
+
+type item struct {
+	Title     string
+	Text      string
+	CreatedAt time.Time
+}
+
+// render builds a multipart/alternative body with text and html versions.
+func render(frequency models.DigestFrequency, notifications []models.Notification, unread int) (email.Part, error) {
+	v := view{
+		Unread:    unread,
+		Frequency: frequency,
+		Items:     make([]item, 0, len(notifications)),
+	}
+	if unread > len(notifications) {
+		v.More = unread - len(notifications)
+	}
+
+	// newest first, as in the inbox
+	for i := len(notifications) - 1; i >= 0; i-- {
+		v.Items = append(v.Items, renderItem(notifications[i]))
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, v); err != nil {
+		return nil, errors.Wrap(err, "failed to render text digest")
+	}
+	if err := htmlTemplate.Execute(&html, v); err != nil {
+		return nil, errors.Wrap(err, "failed to render html digest")
+	}
+
+	return email.Multipart(
+		email.Header{email.HeaderContentType: {email.ContentTypeAlternative}},
+		email.SimplePart(email.Header{email.HeaderContentType: {email.ContentTypePlain + "; charset=utf-8"}}, text.Bytes()),
+		email.SimplePart(email.Header{email.HeaderContentType: {email.ContentTypeHTML + "; charset=utf-8"}}, html.Bytes()),
+	), nil
+}
+
+func renderItem(notification models.Notification) item {
+	res := item{CreatedAt: notification.CreatedAt}
+
+	// payloads of unknown versions still produce a title
+	switch notification.Type {
+	case models.NotificationPostCreated:
+		res.Title = "New post from a friend"
+		var payload models.PostCreatedPayload
+		if json.Unmarshal(notification.Payload, &payload) == nil {
+			res.Text = payload.Post.Text
+		}
+	case models.NotificationFriendRequest:
+		res.Title = "New friend request"
+	case models.NotificationFriendshipAccepted:
+		res.Title = "Friend request accepted"
+	case models.NotificationMessageReceived:
+		res.Title = "New message"
+		var payload models.MessageReceivedPayload
+		if json.Unmarshal(notification.Payload, &payload) == nil {
+			res.Text = payload.Text
+		}
+	case models.NotificationCommentCreated:
+		res.Title = "New comment on your post"
+		var payload models.CommentCreatedPayload
+		if json.Unmarshal(notification.Payload, &payload) == nil {
+			res.Text = payload.Text
+		}
+	case models.NotificationReactionAdded:
+		res.Title = "New reaction to your post"
+		var payload models.ReactionAddedPayload
+		if json.Unmarshal(notification.Payload, &payload) == nil {
+			res.Text = payload.Reaction
+		}
+	default:
+		res.Title = string(notification.Type)
+	}
+
+	if runes := []rune(res.Text); len(runes) > maxTextLength {
+		res.Text = string(runes[:maxTextLength]) + "…"
+	}
+
+	return res
+}
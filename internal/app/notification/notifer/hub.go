@@ -0,0 +1,227 @@
+package notifer
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/rabbitmq"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type HubConfig struct {
+	BufferSize int           `mapstructure:"buffer_size"`
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+}
+
+// Hub hands out per-user subscriptions to notifications.
+// Every subscription owns its AMQP channel and exclusive queue, so closing
+// one socket never affects the others.
+type Hub struct {
+	cfg    HubConfig
+	conn   *rabbitmq.Connection
+	logger log.Logger
+}
+
+func NewHub(cfg HubConfig, conn *rabbitmq.Connection, logger log.Logger) *Hub {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 16
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+
+	return &Hub{
+		cfg:    cfg,
+		conn:   conn,
+		logger: logger,
+	}
+}
+
+// Subscription delivers notifications addressed to a single user.
+type Subscription interface {
+	// Notifications is closed once the subscription is torn down.
+	Notifications() <-chan models.Notification
+	Close()
+}
+
+// Subscriber is implemented by Hub and Router.
+type Subscriber interface {
+	Subscribe(ctx context.Context, userID models.UserID) (Subscription, error)
+}
+
+type queueSubscription struct {
+	hub           *Hub
+	userID        models.UserID
+	tag           string
+	notifications chan models.Notification
+
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Subscribe starts consuming notifications for userID. The first consumer is
+// set up synchronously so that broker errors are reported to the caller;
+// later failures are retried in background until Close is called.
+func (h *Hub) Subscribe(ctx context.Context, userID models.UserID) (Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	sub := &queueSubscription{
+		hub:           h,
+		userID:        userID,
+		tag:           "ws-" + uuid.New().String(),
+		notifications: make(chan models.Notification, h.cfg.BufferSize),
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+
+	ch, deliveries, err := sub.consume()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go sub.run(ctx, ch, deliveries)
+
+	return sub, nil
+}
+
+func (s *queueSubscription) Notifications() <-chan models.Notification {
+	return s.notifications
+}
+
+// Close cancels the consumer and waits until its channel is released.
+func (s *queueSubscription) Close() {
+	s.closeOnce.Do(s.cancel)
+	<-s.done
+}
+
+func (s *queueSubscription) consume() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := s.hub.conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q, err := ch.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, errors.Wrap(err, "failed to declare queue")
+	}
+
+	err = ch.QueueBind(
+		q.Name,           // queue name
+		string(s.userID), // routing key
+		ExchangeName,     // exchange
+		false,
+		nil,
+	)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, errors.Wrap(err, "failed to bind queue")
+	}
+
+	deliveries, err := ch.Consume(
+		q.Name, // queue
+		s.tag,  // consumer
+		true,   // auto-ack
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, errors.Wrap(err, "failed to consume")
+	}
+
+	return ch, deliveries, nil
+}
+
+func (s *queueSubscription) run(ctx context.Context, ch *amqp.Channel, deliveries <-chan amqp.Delivery) {
+	defer close(s.done)
+	defer close(s.notifications)
+
+	logger := s.hub.logger.ForCtx(ctx).WithField("consumer", s.tag)
+
+	for {
+		if !s.forward(ctx, deliveries) {
+			// cancelling the consumer lets the broker drop the exclusive queue right away
+			_ = ch.Cancel(s.tag, false)
+			_ = ch.Close()
+			return
+		}
+		_ = ch.Close()
+
+		logger.Warn("notifications consumer lost, resubscribing")
+
+		var ok bool
+		ch, deliveries, ok = s.resubscribe(ctx, logger)
+		if !ok {
+			return
+		}
+	}
+}
+
+// forward pumps deliveries into notifications. It returns true if deliveries were
+// closed by the broker and false if the subscription was cancelled.
+func (s *queueSubscription) forward(ctx context.Context, deliveries <-chan amqp.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case msg, ok := <-deliveries:
+			if !ok {
+				return true
+			}
+
+			var notification models.Notification
+			if err := json.Unmarshal(msg.Body, &notification); err != nil {
+				s.hub.logger.ForCtx(ctx).WithError(err).Error("failed to decode notification")
+				continue
+			}
+			if notification.Expired(time.Now()) {
+				continue
+			}
+
+			select {
+			case s.notifications <- notification:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+}
+
+func (s *queueSubscription) resubscribe(ctx context.Context, logger log.Logger) (*amqp.Channel, <-chan amqp.Delivery, bool) {
+	for {
+		reconnected := s.hub.conn.Reconnected()
+
+		ch, deliveries, err := s.consume()
+		if err == nil {
+			return ch, deliveries, true
+		}
+		logger.WithError(err).Warn("failed to resubscribe")
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, false
+		case <-s.hub.conn.Done():
+			return nil, nil, false
+		case <-reconnected:
+		case <-time.After(s.hub.cfg.RetryDelay):
+		}
+	}
+}
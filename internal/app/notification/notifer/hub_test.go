@@ -0,0 +1,47 @@
+package notifer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func delivery(t *testing.T, notification models.Notification) amqp.Delivery {
+	body, err := json.Marshal(notification)
+	require.NoError(t, err)
+
+	return amqp.Delivery{
+		Headers: amqp.Table{UserIDHeader: string(notification.Target)},
+		Body:    body,
+	}
+}
+
+func TestSubscriptionForward(t *testing.T) {
+	sub := &queueSubscription{
+		hub:           NewHub(HubConfig{}, nil, log.Null),
+		userID:        "alice",
+		notifications: make(chan models.Notification, 16),
+	}
+
+	expired := time.Now().Add(-time.Second)
+	deliveries := make(chan amqp.Delivery, 4)
+	deliveries <- amqp.Delivery{Body: []byte("{")}
+	deliveries <- delivery(t, models.Notification{ID: "stale", Target: "alice", ExpiresAt: &expired})
+	deliveries <- delivery(t, models.Notification{ID: "1", Target: "alice"})
+	close(deliveries)
+
+	// closed deliveries mean a lost consumer, which is resubscribed
+	require.True(t, sub.forward(context.Background(), deliveries))
+	require.Len(t, sub.notifications, 1)
+	require.Equal(t, models.NotificationID("1"), (<-sub.notifications).ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, sub.forward(ctx, make(chan amqp.Delivery)))
+}
@@ -0,0 +1,143 @@
+package notifer
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/rabbitmq"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+// localIndex maps users to subscriptions served by this process.
+type localIndex struct {
+	bufferSize int
+
+	mu     sync.RWMutex
+	subs   map[models.UserID]map[*localSubscription]struct{}
+	closed bool
+}
+
+func newLocalIndex(bufferSize int) *localIndex {
+	return &localIndex{
+		bufferSize: bufferSize,
+		subs:       make(map[models.UserID]map[*localSubscription]struct{}),
+	}
+}
+
+type localSubscription struct {
+	index         *localIndex
+	userID        models.UserID
+	notifications chan models.Notification
+	once          sync.Once
+}
+
+func (s *localSubscription) Notifications() <-chan models.Notification {
+	return s.notifications
+}
+
+func (s *localSubscription) Close() {
+	s.index.remove(s)
+}
+
+func (i *localIndex) subscribe(userID models.UserID) (Subscription, error) {
+	sub := &localSubscription{
+		index:         i,
+		userID:        userID,
+		notifications: make(chan models.Notification, i.bufferSize),
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return nil, rabbitmq.ErrClosed
+	}
+
+	subs, ok := i.subs[userID]
+	if !ok {
+		subs = make(map[*localSubscription]struct{})
+		i.subs[userID] = subs
+	}
+	subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+func (i *localIndex) has(userID models.UserID) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.subs[userID]) > 0
+}
+
+// dispatch never blocks: one slow socket must not stall the others.
+// It returns the number of subscriptions the notification was dropped for.
+func (i *localIndex) dispatch(notification models.Notification) int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	dropped := 0
+	for sub := range i.subs[notification.Target] {
+		select {
+		case sub.notifications <- notification:
+		default:
+			dropped++
+		}
+	}
+
+	return dropped
+}
+
+// deliver decodes a broker message addressed to userID and dispatches it.
+// Messages of users without local subscriptions are not decoded at all.
+func (i *localIndex) deliver(logger log.Logger, userID models.UserID, body []byte) {
+	if userID == "" {
+		logger.Error("notification without recipient header")
+		return
+	}
+
+	if !i.has(userID) {
+		return
+	}
+
+	var notification models.Notification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		logger.WithError(err).Error("failed to decode notification")
+		return
+	}
+	if notification.Expired(time.Now()) {
+		return
+	}
+
+	if dropped := i.dispatch(notification); dropped > 0 {
+		logger.WithField("user_id", userID).Warnf("subscription buffer is full, dropped notification for %d sockets", dropped)
+	}
+}
+
+func (i *localIndex) remove(sub *localSubscription) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if subs, ok := i.subs[sub.userID]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(i.subs, sub.userID)
+		}
+	}
+	sub.once.Do(func() { close(sub.notifications) })
+}
+
+func (i *localIndex) closeAll() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.closed = true
+	for userID, subs := range i.subs {
+		for sub := range subs {
+			sub.once.Do(func() { close(sub.notifications) })
+		}
+		delete(i.subs, userID)
+	}
+}
@@ -0,0 +1,88 @@
+package notifer
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/segmentio/kafka-go"
+)
+
+var ErrSendKafka = errors.Typed("notifier_kafka_send_fail", "failed to send notification to kafka")
+
+type KafkaConfig struct {
+	Brokers         []string      `mapstructure:"brokers"`
+	Topic           string        `mapstructure:"topic"`
+	MaxSendAttempts int           `mapstructure:"max_send_attempts"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	BatchSize       int           `mapstructure:"batch_size"`
+	BatchTimeout    time.Duration `mapstructure:"batch_timeout"`
+}
+
+type kafkaStat struct {
+	SendDuration stat.TimerCtor `labels:"status"`
+}
+
+// kafkaNotifier writes notifications keyed by recipient, so that notifications
+// of one user stay ordered within a partition. Writes are synchronous and
+// acknowledged by all in-sync replicas.
+type kafkaNotifier struct {
+	Writer *kafka.Writer
+	Stat   kafkaStat
+}
+
+func NewKafkaNotifier(cfg KafkaConfig, registry stat.Registry, logger log.Logger) Transport {
+	logger = logger.WithField("lib", "notifier")
+
+	n := &kafkaNotifier{
+		Writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      cfg.Brokers,
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			MaxAttempts:  cfg.MaxSendAttempts,
+			BatchSize:    cfg.BatchSize,
+			BatchTimeout: cfg.BatchTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			RequiredAcks: int(kafka.RequireAll),
+			Logger:       logger,
+			ErrorLogger:  logger,
+		}),
+	}
+	stat.NewRegistrar(registry.ForSubsystem("notifier_kafka")).MustRegister(&n.Stat)
+
+	return n
+}
+
+func (k *kafkaNotifier) Notify(ctx context.Context, notification models.Notification) (err error) {
+	tm := k.Stat.SendDuration.Timer(ctx).Start()
+	defer func() {
+		tm.WithLabels(stat.Labels{"status": stat.TypedErrorLabel(ctx, err)}).Stop()
+	}()
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	err = k.Writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(notification.Target),
+		Value:   body,
+		Headers: []kafka.Header{{Key: UserIDHeader, Value: []byte(notification.Target)}},
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return errors.Transform(err, ErrSendKafka)
+	}
+
+	return nil
+}
+
+func (k *kafkaNotifier) Close() error {
+	return k.Writer.Close()
+}
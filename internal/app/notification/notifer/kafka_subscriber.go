@@ -0,0 +1,93 @@
+package notifer
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+const kafkaGroupPrefix = "post-notifier-"
+
+// KafkaSubscriber reads the whole notification topic and dispatches
+// notifications to local subscriptions through an in-memory index.
+// Every instance joins a consumer group of its own starting at the newest
+// offset, so instances never split partitions between them; notifications
+// missed while offline are replayed from the inbox.
+type KafkaSubscriber struct {
+	cfg    HubConfig
+	reader *kafka.Reader
+	logger log.Logger
+	index  *localIndex
+}
+
+var _ Subscriber = &KafkaSubscriber{}
+
+func NewKafkaSubscriber(cfg HubConfig, kafkaCfg KafkaConfig, logger log.Logger) *KafkaSubscriber {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 16
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+
+	logger = logger.WithField("lib", "notifier")
+
+	return &KafkaSubscriber{
+		cfg: cfg,
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     kafkaCfg.Brokers,
+			Topic:       kafkaCfg.Topic,
+			GroupID:     kafkaGroupPrefix + uuid.New().String(),
+			StartOffset: kafka.LastOffset,
+			Logger:      logger,
+			ErrorLogger: logger,
+		}),
+		logger: logger,
+		index:  newLocalIndex(cfg.BufferSize),
+	}
+}
+
+func (k *KafkaSubscriber) Subscribe(_ context.Context, userID models.UserID) (Subscription, error) {
+	return k.index.subscribe(userID)
+}
+
+// Run reads the topic until ctx is done. All subscriptions are closed on return.
+func (k *KafkaSubscriber) Run(ctx context.Context) error {
+	defer k.index.closeAll()
+	defer k.reader.Close()
+
+	for {
+		// offsets are never committed: the group lives as long as the instance
+		msg, err := k.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			k.logger.ForCtx(ctx).WithError(err).Warn("failed to read notifications")
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(k.cfg.RetryDelay):
+			}
+			continue
+		}
+
+		k.dispatch(ctx, msg)
+	}
+}
+
+func (k *KafkaSubscriber) dispatch(ctx context.Context, msg kafka.Message) {
+	var userID models.UserID
+	for _, header := range msg.Headers {
+		if header.Key == UserIDHeader {
+			userID = models.UserID(header.Value)
+		}
+	}
+
+	k.index.deliver(k.logger.ForCtx(ctx), userID, msg.Value)
+}
@@ -0,0 +1,40 @@
+package notifer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaSubscriberDispatch(t *testing.T) {
+	k := &KafkaSubscriber{logger: log.Null, index: newLocalIndex(4)}
+
+	sub, err := k.Subscribe(context.Background(), "alice")
+	require.NoError(t, err)
+	defer sub.Close()
+
+	message := func(notification models.Notification) kafka.Message {
+		body, err := json.Marshal(notification)
+		require.NoError(t, err)
+
+		// the same message the kafka notifier writes
+		return kafka.Message{
+			Key:     []byte(notification.Target),
+			Value:   body,
+			Headers: []kafka.Header{{Key: UserIDHeader, Value: []byte(notification.Target)}},
+		}
+	}
+
+	ctx := context.Background()
+	k.dispatch(ctx, kafka.Message{Value: []byte(`{"id":"no header"}`)})
+	k.dispatch(ctx, message(models.Notification{ID: "1", Target: "bob"}))
+	k.dispatch(ctx, message(models.Notification{ID: "2", Target: "alice"}))
+
+	require.Len(t, sub.Notifications(), 1)
+	require.Equal(t, models.NotificationID("2"), (<-sub.Notifications()).ID)
+}
@@ -0,0 +1,51 @@
+package notifer
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+)
+
+// MemoryNotifier delivers notifications to subscriptions of the same process.
+// It is meant for tests: notifications are published by dialogs and the outbox
+// relay and consumed by post-notifier, so services need a broker between them.
+// Notifications for users without subscriptions are dropped, like unroutable
+// broker messages.
+type MemoryNotifier struct {
+	index *localIndex
+}
+
+var (
+	_ models.Notifier = &MemoryNotifier{}
+	_ Subscriber      = &MemoryNotifier{}
+)
+
+func NewMemoryNotifier(bufferSize int) *MemoryNotifier {
+	if bufferSize <= 0 {
+		bufferSize = 16
+	}
+
+	return &MemoryNotifier{index: newLocalIndex(bufferSize)}
+}
+
+func (m *MemoryNotifier) Notify(_ context.Context, notification models.Notification) error {
+	if notification.Expired(time.Now()) {
+		return nil
+	}
+
+	m.index.dispatch(notification)
+
+	return nil
+}
+
+func (m *MemoryNotifier) Subscribe(_ context.Context, userID models.UserID) (Subscription, error) {
+	return m.index.subscribe(userID)
+}
+
+// Close closes all subscriptions.
+func (m *MemoryNotifier) Close() error {
+	m.index.closeAll()
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package notifer
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ExchangeName is the direct exchange notifications are routed through, keyed by recipient user id.
+const ExchangeName = "post-notifications"
+
+// UserIDHeader carries the recipient, since sharded routing keys do not identify it.
+const UserIDHeader = "x-user-id"
+
+// DeclareTopology declares the exchanges shared by publishers and consumers.
+func DeclareTopology(ch *amqp.Channel) error {
+	for _, name := range []string{ExchangeName, ShardedExchangeName} {
+		err := ch.ExchangeDeclare(
+			name,     // name
+			"direct", // type
+			true,     // durable
+			false,    // auto-deleted
+			false,    // internal
+			false,    // no-wait
+			nil,      // arguments
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rabbitNotifier publishes with publisher confirms, so a nil error means the broker
+// has accepted the notification. Topology is declared by the connection.
+type rabbitNotifier struct {
+	publisher *rabbitmq.Publisher
+	sharding  ShardingConfig
+}
+
+func NewRabbitNotifier(publisher *rabbitmq.Publisher, sharding ShardingConfig) models.Notifier {
+	return rabbitNotifier{
+		publisher: publisher,
+		sharding:  sharding,
+	}
+}
+
+func (n rabbitNotifier) route(userID models.UserID) (exchange, key string) {
+	if n.sharding.Enabled() {
+		return ShardedExchangeName, ShardRoutingKey(ShardOf(userID, n.sharding.Shards))
+	}
+
+	return ExchangeName, string(userID)
+}
+
+func (n rabbitNotifier) Notify(ctx context.Context, notification models.Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    string(notification.ID),
+		Type:         string(notification.Type),
+		Timestamp:    notification.CreatedAt,
+		Headers:      amqp.Table{UserIDHeader: string(notification.Target)},
+		Body:         body,
+	}
+	if notification.ExpiresAt != nil {
+		ttl := time.Until(*notification.ExpiresAt).Milliseconds()
+		if ttl <= 0 {
+			return nil
+		}
+
+		// ephemeral notifications are not worth a disk write and are dropped by the broker once stale
+		msg.DeliveryMode = amqp.Transient
+		msg.Expiration = strconv.FormatInt(ttl, 10)
+	}
+
+	exchange, key := n.route(notification.Target)
+	err = n.publisher.Publish(ctx, exchange, key, msg)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
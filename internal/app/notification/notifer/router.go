@@ -0,0 +1,171 @@
+package notifer
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/rabbitmq"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrShardNotOwned = errors.Typed("shard_not_owned", "user shard is served by another instance")
+
+// Router consumes a single queue bound to the shards owned by this instance
+// and dispatches notifications to local subscriptions through an in-memory index.
+type Router struct {
+	cfg     HubConfig
+	cluster Cluster
+	conn    *rabbitmq.Connection
+	logger  log.Logger
+	index   *localIndex
+}
+
+func NewRouter(cfg HubConfig, cluster Cluster, conn *rabbitmq.Connection, logger log.Logger) *Router {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 16
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+
+	return &Router{
+		cfg:     cfg,
+		cluster: cluster,
+		conn:    conn,
+		logger:  logger,
+		index:   newLocalIndex(cfg.BufferSize),
+	}
+}
+
+// Subscribe registers a local subscription. It fails with ErrShardNotOwned
+// if the user has to be served by another instance.
+func (r *Router) Subscribe(_ context.Context, userID models.UserID) (Subscription, error) {
+	if _, local := r.cluster.Owner(userID); !local {
+		return nil, ErrShardNotOwned
+	}
+
+	return r.index.subscribe(userID)
+}
+
+// Run consumes the instance queue until ctx is done, resubscribing after broker failures.
+// All subscriptions are closed on return.
+func (r *Router) Run(ctx context.Context) error {
+	defer r.index.closeAll()
+
+	ch, deliveries, err := r.consume()
+	if err != nil {
+		return err
+	}
+
+	for {
+		if !r.forward(ctx, deliveries) {
+			_ = ch.Close()
+			return nil
+		}
+		_ = ch.Close()
+
+		r.logger.ForCtx(ctx).Warn("router consumer lost, resubscribing")
+
+		ch, deliveries, err = r.resubscribe(ctx)
+		if err != nil {
+			return err
+		}
+		if ch == nil {
+			return nil
+		}
+	}
+}
+
+func (r *Router) consume() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q, err := ch.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, errors.Wrap(err, "failed to declare queue")
+	}
+
+	for _, shard := range r.cluster.LocalShards() {
+		err = ch.QueueBind(
+			q.Name,                 // queue name
+			ShardRoutingKey(shard), // routing key
+			ShardedExchangeName,    // exchange
+			false,
+			nil,
+		)
+		if err != nil {
+			_ = ch.Close()
+			return nil, nil, errors.Wrapf(err, "failed to bind shard %d", shard)
+		}
+	}
+
+	deliveries, err := ch.Consume(
+		q.Name, // queue
+		"",     // consumer
+		true,   // auto-ack
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, errors.Wrap(err, "failed to consume")
+	}
+
+	return ch, deliveries, nil
+}
+
+func (r *Router) forward(ctx context.Context, deliveries <-chan amqp.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case msg, ok := <-deliveries:
+			if !ok {
+				return true
+			}
+
+			r.dispatch(ctx, msg)
+		}
+	}
+}
+
+func (r *Router) dispatch(ctx context.Context, msg amqp.Delivery) {
+	userID, _ := msg.Headers[UserIDHeader].(string)
+	r.index.deliver(r.logger.ForCtx(ctx), models.UserID(userID), msg.Body)
+}
+
+func (r *Router) resubscribe(ctx context.Context) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	for {
+		reconnected := r.conn.Reconnected()
+
+		ch, deliveries, err := r.consume()
+		if err == nil {
+			return ch, deliveries, nil
+		}
+		r.logger.ForCtx(ctx).WithError(err).Warn("failed to resubscribe router")
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, nil
+		case <-r.conn.Done():
+			return nil, nil, rabbitmq.ErrClosed
+		case <-reconnected:
+		case <-time.After(r.cfg.RetryDelay):
+		}
+	}
+}
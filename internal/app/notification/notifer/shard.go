@@ -0,0 +1,102 @@
+package notifer
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+// ShardedExchangeName routes notifications by user shard instead of user id,
+// so that a notifier instance needs one binding per owned shard rather than per socket.
+const ShardedExchangeName = "post-notifications.sharded"
+
+// ShardingConfig must be the same for publishers and notifier instances.
+// Zero Shards disables sharded publishing.
+type ShardingConfig struct {
+	Shards int `mapstructure:"shards"`
+}
+
+func (c ShardingConfig) Enabled() bool {
+	return c.Shards > 0
+}
+
+// ShardOf maps user to one of shards. The mapping is stable, so moving a shard
+// between instances never moves users of other shards.
+func ShardOf(userID models.UserID, shards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+
+	return int(h.Sum32() % uint32(shards))
+}
+
+func ShardRoutingKey(shard int) string {
+	return "shard." + strconv.Itoa(shard)
+}
+
+type NodeConfig struct {
+	// Addr is the public base url clients are redirected to, e.g. "http://notifier-1:8082".
+	Addr   string `mapstructure:"addr"`
+	Shards []int  `mapstructure:"shards"`
+}
+
+type ClusterConfig struct {
+	ShardingConfig `mapstructure:",squash"`
+	// Self is the Addr of this instance in Nodes.
+	Self  string       `mapstructure:"self"`
+	Nodes []NodeConfig `mapstructure:"nodes"`
+}
+
+// Cluster knows which instance owns which shard.
+type Cluster struct {
+	cfg    ClusterConfig
+	owners map[int]string
+}
+
+func NewCluster(cfg ClusterConfig) (Cluster, error) {
+	if !cfg.Enabled() {
+		return Cluster{}, errors.New("sharding is disabled")
+	}
+
+	owners := make(map[int]string, cfg.Shards)
+	for _, node := range cfg.Nodes {
+		for _, shard := range node.Shards {
+			if shard < 0 || shard >= cfg.Shards {
+				return Cluster{}, errors.Errorf("node %s: shard %d out of range", node.Addr, shard)
+			}
+			if owner, ok := owners[shard]; ok {
+				return Cluster{}, errors.Errorf("shard %d owned by both %s and %s", shard, owner, node.Addr)
+			}
+			owners[shard] = node.Addr
+		}
+	}
+
+	if len(owners) != cfg.Shards {
+		return Cluster{}, errors.Errorf("only %d of %d shards have an owner", len(owners), cfg.Shards)
+	}
+
+	return Cluster{
+		cfg:    cfg,
+		owners: owners,
+	}, nil
+}
+
+// Owner returns the address of the instance serving userID and whether it is this instance.
+func (c Cluster) Owner(userID models.UserID) (string, bool) {
+	owner := c.owners[ShardOf(userID, c.cfg.Shards)]
+
+	return owner, owner == c.cfg.Self
+}
+
+// LocalShards returns shards owned by this instance.
+func (c Cluster) LocalShards() []int {
+	var shards []int
+	for shard := 0; shard < c.cfg.Shards; shard++ {
+		if c.owners[shard] == c.cfg.Self {
+			shards = append(shards, shard)
+		}
+	}
+
+	return shards
+}
@@ -0,0 +1,154 @@
+package notifer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardOf(t *testing.T) {
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		userID := models.UserID(fmt.Sprintf("user-%d", i))
+
+		shard := ShardOf(userID, 16)
+		require.GreaterOrEqual(t, shard, 0)
+		require.Less(t, shard, 16)
+		require.Equal(t, shard, ShardOf(userID, 16), "the mapping must be stable")
+		counts[shard]++
+	}
+
+	// every shard gets some users
+	require.Len(t, counts, 16)
+}
+
+func TestNewCluster(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		nodes []NodeConfig
+		err   string
+	}{
+		{
+			name:  "shard out of range",
+			nodes: []NodeConfig{{Addr: "a", Shards: []int{0, 1, 2, 3, 4}}},
+			err:   "node a: shard 4 out of range",
+		},
+		{
+			name:  "shard owned twice",
+			nodes: []NodeConfig{{Addr: "a", Shards: []int{0, 1}}, {Addr: "b", Shards: []int{1, 2, 3}}},
+			err:   "shard 1 owned by both a and b",
+		},
+		{
+			name:  "shard without owner",
+			nodes: []NodeConfig{{Addr: "a", Shards: []int{0, 1, 2}}},
+			err:   "only 3 of 4 shards have an owner",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewCluster(ClusterConfig{ShardingConfig: ShardingConfig{Shards: 4}, Self: "a", Nodes: tc.nodes})
+			require.EqualError(t, err, tc.err)
+		})
+	}
+
+	_, err := NewCluster(ClusterConfig{Self: "a"})
+	require.Error(t, err, "sharding must be enabled")
+}
+
+func twoNodeCluster(t *testing.T, self string) Cluster {
+	cluster, err := NewCluster(ClusterConfig{
+		ShardingConfig: ShardingConfig{Shards: 4},
+		Self:           self,
+		Nodes: []NodeConfig{
+			{Addr: "http://a", Shards: []int{0, 2}},
+			{Addr: "http://b", Shards: []int{1, 3}},
+		},
+	})
+	require.NoError(t, err)
+
+	return cluster
+}
+
+// usersOfShards returns a user of every shard.
+func usersOfShards(shards int) []models.UserID {
+	users := make([]models.UserID, shards)
+	for i, found := 0, 0; found < shards; i++ {
+		userID := models.UserID(fmt.Sprintf("user-%d", i))
+		if shard := ShardOf(userID, shards); users[shard] == "" {
+			users[shard] = userID
+			found++
+		}
+	}
+
+	return users
+}
+
+func TestClusterOwner(t *testing.T) {
+	a, b := twoNodeCluster(t, "http://a"), twoNodeCluster(t, "http://b")
+	require.Equal(t, []int{0, 2}, a.LocalShards())
+	require.Equal(t, []int{1, 3}, b.LocalShards())
+
+	for shard, userID := range usersOfShards(4) {
+		want := "http://a"
+		if shard%2 == 1 {
+			want = "http://b"
+		}
+
+		owner, local := a.Owner(userID)
+		require.Equal(t, want, owner)
+		require.Equal(t, want == "http://a", local)
+
+		// exactly one instance serves every user
+		_, localB := b.Owner(userID)
+		require.NotEqual(t, local, localB)
+	}
+}
+
+func TestRabbitNotifierRoute(t *testing.T) {
+	userID := usersOfShards(4)[3]
+
+	exchange, key := rabbitNotifier{}.route(userID)
+	require.Equal(t, ExchangeName, exchange)
+	require.Equal(t, string(userID), key)
+
+	exchange, key = rabbitNotifier{sharding: ShardingConfig{Shards: 4}}.route(userID)
+	require.Equal(t, ShardedExchangeName, exchange)
+	require.Equal(t, "shard.3", key)
+}
+
+func TestRouterDispatch(t *testing.T) {
+	users := usersOfShards(4)
+	router := NewRouter(HubConfig{BufferSize: 1}, twoNodeCluster(t, "http://a"), nil, log.Null)
+
+	_, err := router.Subscribe(context.Background(), users[1])
+	require.ErrorIs(t, err, ErrShardNotOwned)
+
+	sub, err := router.Subscribe(context.Background(), users[0])
+	require.NoError(t, err)
+	other, err := router.Subscribe(context.Background(), users[2])
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	router.dispatch(ctx, amqp.Delivery{Body: []byte(`{"id":"no header"}`)})
+	router.dispatch(ctx, delivery(t, models.Notification{ID: "1", Target: users[0]}))
+	// the buffer of one is full, the notification is dropped rather than blocking others
+	router.dispatch(ctx, delivery(t, models.Notification{ID: "2", Target: users[0]}))
+	router.dispatch(ctx, delivery(t, models.Notification{ID: "3", Target: users[2]}))
+
+	require.Equal(t, models.NotificationID("1"), (<-sub.Notifications()).ID)
+	require.Equal(t, models.NotificationID("3"), (<-other.Notifications()).ID)
+	require.Empty(t, sub.Notifications())
+
+	sub.Close()
+	_, ok := <-sub.Notifications()
+	require.False(t, ok)
+	require.False(t, router.index.has(users[0]))
+
+	router.index.closeAll()
+	_, ok = <-other.Notifications()
+	require.False(t, ok)
+}
@@ -0,0 +1,66 @@
+package notifer
+
+import (
+	"context"
+	"io"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/rabbitmq"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+)
+
+const (
+	TransportRabbitMQ = "rabbitmq"
+	TransportKafka    = "kafka"
+)
+
+type Config struct {
+	// Transport is either rabbitmq or kafka. Defaults to rabbitmq.
+	Transport string          `mapstructure:"transport"`
+	Sharding  ShardingConfig  `mapstructure:"sharding"`
+	Rabbit    rabbitmq.Config `mapstructure:"rabbit"`
+	Kafka     KafkaConfig     `mapstructure:"kafka"`
+}
+
+// Transport is a Notifier owning its broker connections.
+type Transport interface {
+	models.Notifier
+	io.Closer
+}
+
+// New builds the notifier selected by cfg.Transport.
+func New(ctx context.Context, cfg Config, registry stat.Registry, logger log.Logger) (Transport, error) {
+	switch cfg.Transport {
+	case TransportRabbitMQ, "":
+		conn, err := rabbitmq.Dial(ctx, cfg.Rabbit, DeclareTopology, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		publisher := rabbitmq.NewPublisher(conn, registry)
+
+		return rabbitTransport{
+			Notifier:  NewRabbitNotifier(publisher, cfg.Sharding),
+			conn:      conn,
+			publisher: publisher,
+		}, nil
+	case TransportKafka:
+		return NewKafkaNotifier(cfg.Kafka, registry, logger), nil
+	default:
+		return nil, errors.Errorf("unknown notifier transport %q", cfg.Transport)
+	}
+}
+
+type rabbitTransport struct {
+	models.Notifier
+	conn      *rabbitmq.Connection
+	publisher *rabbitmq.Publisher
+}
+
+func (t rabbitTransport) Close() error {
+	_ = t.publisher.Close()
+
+	return t.conn.Close()
+}
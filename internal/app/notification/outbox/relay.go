@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor/batchgetter"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+)
+
+const taskType = "notification_outbox"
+
+type Config struct {
+	BatchSize int `mapstructure:"batch_size"`
+	// Lease is how long a claimed message is hidden from other relays.
+	// It must exceed the pool task timeout, otherwise messages are published twice.
+	Lease time.Duration `mapstructure:"lease"`
+	// InboxSize is how many notifications are kept per user, older ones are
+	// trimmed once a newer notification is published.
+	InboxSize int `mapstructure:"inbox_size"`
+}
+
+type relayStat struct {
+	Published   stat.CounterCtor `labels:"status,type"`
+	Redelivered stat.CounterCtor
+	// DeliveryLag is seconds from the notification creation to the broker confirm.
+	DeliveryLag stat.HistogramCtor `buckets:"0.01,0.05,0.1,0.5,1,5,10,30,60,300,900"`
+}
+
+// Relay turns pending outbox messages into processor tasks. Messages are
+// marked sent only after the broker confirms them, so delivery is at-least-once.
+type Relay struct {
+	cfg      Config
+	outbox   models.OutboxRepository
+	inbox    models.NotificationInboxRepository
+	notifier models.Notifier
+	logger   log.Logger
+	Stat     relayStat
+}
+
+func NewRelay(
+	cfg Config,
+	outbox models.OutboxRepository,
+	inbox models.NotificationInboxRepository,
+	notifier models.Notifier,
+	registry stat.Registry,
+	logger log.Logger,
+) processor.TaskGetter {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Minute
+	}
+	if cfg.InboxSize <= 0 {
+		cfg.InboxSize = 1000
+	}
+
+	r := &Relay{
+		cfg:      cfg,
+		outbox:   outbox,
+		inbox:    inbox,
+		notifier: notifier,
+		logger:   logger,
+	}
+	stat.NewRegistrar(registry.ForSubsystem("notification_outbox")).MustRegister(&r.Stat)
+
+	return batchgetter.New(r)
+}
+
+func (r *Relay) GetBatch(ctx context.Context) ([]processor.Task, error) {
+	messages, err := r.outbox.ClaimPending(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox messages")
+	}
+
+	tasks := make([]processor.Task, 0, len(messages))
+	for _, msg := range messages {
+		tasks = append(tasks, &task{relay: r, msg: msg})
+	}
+
+	return tasks, nil
+}
+
+type task struct {
+	relay *Relay
+	msg   models.OutboxMessage
+}
+
+func (t *task) Process(ctx context.Context) (err error) {
+	defer func() {
+		t.relay.Stat.Published.Counter(ctx).WithLabels(stat.Labels{
+			"status": stat.TypedErrorLabel(ctx, err),
+			"type":   string(t.msg.Notification.Type),
+		}).Add(1)
+	}()
+
+	if t.msg.Attempts > 1 {
+		t.relay.Stat.Redelivered.Counter(ctx).Add(1)
+	}
+
+	err = t.relay.notifier.Notify(ctx, t.msg.Notification)
+	if err != nil {
+		// the claim expires and the message is retried by the next batch
+		return errors.Wrap(err, "failed to publish notification")
+	}
+
+	return nil
+}
+
+func (t *task) Ack(ctx context.Context) error {
+	t.relay.Stat.DeliveryLag.Histogram(ctx).Observe(time.Since(t.msg.CreatedAt).Seconds())
+
+	err := t.relay.outbox.MarkSent(ctx, t.msg.ID)
+	if err != nil {
+		return err
+	}
+
+	// trimming is best effort, the next notification trims again
+	err = t.relay.inbox.Trim(ctx, t.msg.Notification.Target, t.relay.cfg.InboxSize)
+	if err != nil {
+		t.relay.logger.ForCtx(ctx).WithError(err).Warn("failed to trim notification inbox")
+	}
+
+	return nil
+}
+
+// Delete is never requested: failed messages stay pending until published.
+func (t *task) Delete(_ context.Context) error {
+	return nil
+}
+
+func (t *task) Defer(_ context.Context) {}
+
+func (t *task) Key() string {
+	return strconv.FormatInt(int64(t.msg.ID), 10)
+}
+
+func (t *task) Type() string {
+	return taskType
+}
+
+func (t *task) UserID() string {
+	return string(t.msg.Notification.Target)
+}
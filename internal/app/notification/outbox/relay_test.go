@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/app/notification/notifer"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOutbox hands out unsent messages whose claim has expired.
+type fakeOutbox struct {
+	models.OutboxRepository
+
+	now      time.Time
+	messages []models.OutboxMessage
+	claimed  map[models.OutboxMessageID]time.Time
+	sent     map[models.OutboxMessageID]bool
+}
+
+func newFakeOutbox(messages ...models.OutboxMessage) *fakeOutbox {
+	return &fakeOutbox{
+		now:      time.Now(),
+		messages: messages,
+		claimed:  make(map[models.OutboxMessageID]time.Time),
+		sent:     make(map[models.OutboxMessageID]bool),
+	}
+}
+
+func (f *fakeOutbox) ClaimPending(_ context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	var res []models.OutboxMessage
+	for i, msg := range f.messages {
+		if len(res) == limit {
+			break
+		}
+		if f.sent[msg.ID] || f.claimed[msg.ID].After(f.now) {
+			continue
+		}
+
+		f.claimed[msg.ID] = f.now.Add(lease)
+		f.messages[i].Attempts++
+		res = append(res, f.messages[i])
+	}
+
+	return res, nil
+}
+
+func (f *fakeOutbox) MarkSent(_ context.Context, id models.OutboxMessageID) error {
+	f.sent[id] = true
+
+	return nil
+}
+
+type fakeInbox struct {
+	models.NotificationInboxRepository
+
+	trimmed map[models.UserID]int
+}
+
+func (f *fakeInbox) Trim(_ context.Context, userID models.UserID, keep int) error {
+	f.trimmed[userID] = keep
+
+	return nil
+}
+
+// failingNotifier fails the first notifications.
+type failingNotifier struct {
+	models.Notifier
+
+	failures int
+}
+
+func (f *failingNotifier) Notify(ctx context.Context, notification models.Notification) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("broker is down")
+	}
+
+	return f.Notifier.Notify(ctx, notification)
+}
+
+func message(id models.OutboxMessageID, target models.UserID) models.OutboxMessage {
+	return models.OutboxMessage{
+		ID:           id,
+		Notification: models.Notification{ID: models.NotificationID(strconv.FormatInt(int64(id), 10)), Target: target},
+		CreatedAt:    time.Now(),
+	}
+}
+
+// drain processes tasks until the relay has none, like the processor pool does.
+func drain(t *testing.T, relay processor.TaskGetter) {
+	ctx := context.Background()
+	for {
+		task, err := relay.Get(ctx)
+		if errors.Is(err, processor.ErrTaskNotFound) {
+			return
+		}
+		require.NoError(t, err)
+
+		if task.Process(ctx) == nil {
+			require.NoError(t, task.Ack(ctx))
+		}
+		task.Defer(ctx)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	outbox := newFakeOutbox(message(1, "alice"), message(2, "bob"), message(3, "alice"))
+	inbox := &fakeInbox{trimmed: make(map[models.UserID]int)}
+	memory := notifer.NewMemoryNotifier(0)
+	notifier := &failingNotifier{Notifier: memory, failures: 1}
+
+	alice, err := memory.Subscribe(context.Background(), "alice")
+	require.NoError(t, err)
+	defer alice.Close()
+
+	relay := NewRelay(Config{BatchSize: 2, Lease: time.Minute, InboxSize: 10}, outbox, inbox, notifier, stub.NewStubRegistry(), log.Null)
+	drain(t, relay)
+
+	// the first message failed and stays claimed until the lease expires
+	require.Equal(t, map[models.OutboxMessageID]bool{2: true, 3: true}, outbox.sent)
+	require.Equal(t, map[models.UserID]int{"alice": 10, "bob": 10}, inbox.trimmed)
+	require.Len(t, alice.Notifications(), 1)
+	require.Equal(t, models.NotificationID("3"), (<-alice.Notifications()).ID)
+
+	outbox.now = outbox.now.Add(time.Minute)
+	drain(t, relay)
+
+	require.True(t, outbox.sent[1])
+	require.Equal(t, 2, outbox.messages[0].Attempts)
+	require.Equal(t, models.NotificationID("1"), (<-alice.Notifications()).ID)
+}
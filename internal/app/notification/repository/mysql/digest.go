@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type digestRepository struct {
+	db     *mysql_client.Provider
+	logger log.Logger
+}
+
+func NewDigestRepository(db *mysql_client.Provider, logger log.Logger) models.NotificationDigestRepository {
+	return digestRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (d digestRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.DigestSubscription, error) {
+	var rows []DigestSubscription
+	err := d.db.InTx(ctx, func(ctx context.Context) error {
+		tx := d.db.Writer(ctx)
+
+		rows = nil
+		err := tx.SelectContext(
+			ctx,
+			&rows,
+			// deleted users keep their settings until the purge, they get no digests meanwhile
+			`SELECT `+digestColumns+`
+			FROM notification_digests d
+			JOIN users u ON u.uuid = d.user_uuid AND u.deleted_at IS NULL
+			WHERE d.next_run_at <= NOW() AND (d.claimed_until IS NULL OR d.claimed_until < NOW())
+			ORDER BY d.next_run_at
+			LIMIT ?
+			FOR UPDATE OF d SKIP LOCKED`,
+			limit,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to select due digests")
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		ids := make([][]byte, 0, len(rows))
+		for _, row := range rows {
+			id, err := uuid.Parse(row.UserUUID)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse user uuid %s", row.UserUUID)
+			}
+			ids = append(ids, id[:])
+		}
+
+		query, args, err := sqlx.In(
+			"UPDATE notification_digests SET claimed_until = NOW() + INTERVAL ? MICROSECOND WHERE user_uuid IN (?)",
+			lease.Microseconds(), ids,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to build claim query")
+		}
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		return errors.Wrap(err, "failed to claim digests")
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	res := make([]models.DigestSubscription, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, convertDigestSubscriptionToModel(row))
+	}
+
+	return res, nil
+}
+
+func (d digestRepository) MarkDigestSent(ctx context.Context, userID models.UserID, last models.NotificationID, next time.Time) error {
+	var lastID interface{}
+	if last != "" {
+		lastID = last
+	}
+
+	// settings changed while the digest was sent have already rescheduled it
+	_, err := d.db.Writer(ctx).ExecContext(
+		ctx,
+		`UPDATE notification_digests
+		SET last_notification_id = COALESCE(UUID_TO_BIN(?), last_notification_id),
+			next_run_at = IF(claimed_until IS NULL, next_run_at, ?),
+			claimed_until = NULL
+		WHERE user_uuid = UUID_TO_BIN(?)`,
+		lastID, next.UTC(), userID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark digest sent")
+	}
+
+	return nil
+}
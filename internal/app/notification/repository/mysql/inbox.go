@@ -0,0 +1,201 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const inboxColumns = "id, BIN_TO_UUID(notification_id) AS notification_id, BIN_TO_UUID(user_uuid) AS user_uuid, type, payload, UNIX_TIMESTAMP(read_at) AS read_at"
+
+// cursorQuery resolves a notification id into the inbox row id it was stored under.
+const cursorQuery = "SELECT id FROM notifications WHERE user_uuid = UUID_TO_BIN(?) AND notification_id = UUID_TO_BIN(?)"
+
+type inboxRepository struct {
+	db     *mysql_client.Provider
+	logger log.Logger
+}
+
+func NewInboxRepository(db *mysql_client.Provider, logger log.Logger) models.NotificationInboxRepository {
+	return inboxRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (i inboxRepository) GetNotifications(ctx context.Context, userID models.UserID, before models.NotificationID, limit int) ([]models.InboxNotification, error) {
+	var (
+		rows []InboxNotification
+		err  error
+	)
+	if before == "" {
+		err = i.db.Writer(ctx).SelectContext(ctx, &rows, "SELECT "+inboxColumns+" FROM notifications WHERE user_uuid = UUID_TO_BIN(?) ORDER BY id DESC LIMIT ?", userID, limit)
+	} else {
+		var cursor int64
+		cursor, err = i.cursor(ctx, userID, before)
+		if err != nil {
+			return nil, err
+		}
+
+		err = i.db.Writer(ctx).SelectContext(ctx, &rows, "SELECT "+inboxColumns+" FROM notifications WHERE user_uuid = UUID_TO_BIN(?) AND id < ? ORDER BY id DESC LIMIT ?", userID, cursor, limit)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select notifications")
+	}
+
+	return convertInboxToModels(rows)
+}
+
+func (i inboxRepository) GetNotificationsAfter(ctx context.Context, userID models.UserID, after models.NotificationID, limit int) ([]models.Notification, error) {
+	var cursor int64
+	if after != "" {
+		var err error
+		cursor, err = i.cursor(ctx, userID, after)
+		// replaying the whole inbox would repeat everything the client has already seen
+		if errors.Is(err, models.ErrNotificationNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// oldest limit rows after cursor, so that the next page continues from the last one
+	return i.notificationsAfter(ctx, userID, cursor, limit,
+		"SELECT "+inboxColumns+" FROM notifications WHERE user_uuid = UUID_TO_BIN(?) AND id > ? ORDER BY id LIMIT ?",
+	)
+}
+
+func (i inboxRepository) GetUnreadAfter(ctx context.Context, userID models.UserID, after models.NotificationID, limit int) ([]models.Notification, error) {
+	var cursor int64
+	if after != "" {
+		var err error
+		// the digest cursor may have been trimmed, everything unread is newer then
+		cursor, err = i.cursor(ctx, userID, after)
+		if err != nil && !errors.Is(err, models.ErrNotificationNotFound) {
+			return nil, err
+		}
+	}
+
+	// newest limit rows after cursor, returned oldest first
+	return i.notificationsAfter(ctx, userID, cursor, limit,
+		"SELECT * FROM (SELECT "+inboxColumns+" FROM notifications WHERE user_uuid = UUID_TO_BIN(?) AND id > ? AND read_at IS NULL ORDER BY id DESC LIMIT ?) t ORDER BY id",
+	)
+}
+
+// notificationsAfter runs query with the user, the row id cursor and limit.
+func (i inboxRepository) notificationsAfter(ctx context.Context, userID models.UserID, cursor int64, limit int, query string) ([]models.Notification, error) {
+	var rows []InboxNotification
+	err := i.db.Writer(ctx).SelectContext(ctx, &rows, query, userID, cursor, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select notifications")
+	}
+
+	inbox, err := convertInboxToModels(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]models.Notification, 0, len(inbox))
+	for _, notification := range inbox {
+		res = append(res, notification.Notification)
+	}
+
+	return res, nil
+}
+
+func (i inboxRepository) CountUnread(ctx context.Context, userID models.UserID) (int, error) {
+	var count int
+	err := i.db.Writer(ctx).GetContext(ctx, &count, "SELECT COUNT(*) FROM notifications WHERE user_uuid = UUID_TO_BIN(?) AND read_at IS NULL", userID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count unread notifications")
+	}
+
+	return count, nil
+}
+
+func (i inboxRepository) MarkRead(ctx context.Context, userID models.UserID, ids []models.NotificationID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	binIDs, err := uuidsToBin(ids)
+	if err != nil {
+		return models.ErrNotificationNotFound
+	}
+
+	query, args, err := sqlx.In(
+		"UPDATE notifications SET read_at = NOW() WHERE user_uuid = UUID_TO_BIN(?) AND notification_id IN (?) AND read_at IS NULL",
+		userID, binIDs,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to build query")
+	}
+
+	_, err = i.db.Writer(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark notifications read")
+	}
+
+	return nil
+}
+
+func (i inboxRepository) MarkAllRead(ctx context.Context, userID models.UserID) error {
+	_, err := i.db.Writer(ctx).ExecContext(ctx, "UPDATE notifications SET read_at = NOW() WHERE user_uuid = UUID_TO_BIN(?) AND read_at IS NULL", userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark notifications read")
+	}
+
+	return nil
+}
+
+func (i inboxRepository) Trim(ctx context.Context, userID models.UserID, keep int) error {
+	// the derived table is materialized, which lets mysql delete from the table it selects from
+	_, err := i.db.Writer(ctx).ExecContext(
+		ctx,
+		"DELETE FROM notifications WHERE user_uuid = UUID_TO_BIN(?) AND id <= "+
+			"(SELECT id FROM (SELECT id FROM notifications WHERE user_uuid = UUID_TO_BIN(?) ORDER BY id DESC LIMIT 1 OFFSET ?) t)",
+		userID, userID, keep,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to trim notifications")
+	}
+
+	return nil
+}
+
+func (i inboxRepository) cursor(ctx context.Context, userID models.UserID, id models.NotificationID) (int64, error) {
+	if _, err := uuid.Parse(string(id)); err != nil {
+		return 0, models.ErrNotificationNotFound
+	}
+
+	var cursor int64
+	err := i.db.Writer(ctx).GetContext(ctx, &cursor, cursorQuery, userID, id)
+	if err == sql.ErrNoRows {
+		return 0, models.ErrNotificationNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to resolve notification cursor")
+	}
+
+	return cursor, nil
+}
+
+func uuidsToBin(ids []models.NotificationID) ([][]byte, error) {
+	res := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		parsed, err := uuid.Parse(string(id))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, parsed[:])
+	}
+
+	return res, nil
+}
@@ -0,0 +1,121 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+type OutboxMessage struct {
+	ID        int64  `db:"id"`
+	Recipient string `db:"recipient"`
+	Type      string `db:"type"`
+	Payload   []byte `db:"payload"`
+	Attempts  int    `db:"attempts"`
+}
+
+func convertModelToOutboxMessage(model models.Notification) (OutboxMessage, error) {
+	payload, err := json.Marshal(model)
+	if err != nil {
+		return OutboxMessage{}, errors.Wrap(err, "failed to marshal notification")
+	}
+
+	return OutboxMessage{
+		Recipient: string(model.Target),
+		Type:      string(model.Type),
+		Payload:   payload,
+	}, nil
+}
+
+func convertOutboxToModels(rows []OutboxMessage) ([]models.OutboxMessage, error) {
+	res := make([]models.OutboxMessage, 0, len(rows))
+	for _, row := range rows {
+		var notification models.Notification
+		if err := json.Unmarshal(row.Payload, &notification); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode outbox message %d", row.ID)
+		}
+
+		res = append(res, models.OutboxMessage{
+			ID:           models.OutboxMessageID(row.ID),
+			Notification: notification,
+			Attempts:     row.Attempts,
+			CreatedAt:    notification.CreatedAt,
+		})
+	}
+
+	return res, nil
+}
+
+// InboxNotification keeps the whole envelope in payload, so that replay
+// returns notifications exactly as they were published.
+type InboxNotification struct {
+	ID             int64         `db:"id"`
+	NotificationID string        `db:"notification_id"`
+	UserUUID       string        `db:"user_uuid"`
+	Type           string        `db:"type"`
+	Payload        []byte        `db:"payload"`
+	ReadAt         sql.NullInt64 `db:"read_at"`
+}
+
+func convertOutboxMessageToInbox(model models.Notification, row OutboxMessage) InboxNotification {
+	return InboxNotification{
+		NotificationID: string(model.ID),
+		UserUUID:       row.Recipient,
+		Type:           row.Type,
+		Payload:        row.Payload,
+	}
+}
+
+func convertInboxToModels(rows []InboxNotification) ([]models.InboxNotification, error) {
+	res := make([]models.InboxNotification, 0, len(rows))
+	for _, row := range rows {
+		var notification models.Notification
+		if err := json.Unmarshal(row.Payload, &notification); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode inbox notification %d", row.ID)
+		}
+
+		res = append(res, models.InboxNotification{
+			Notification: notification,
+			Read:         row.ReadAt.Valid,
+		})
+	}
+
+	return res, nil
+}
+
+type OptOut struct {
+	UserUUID string `db:"user_uuid"`
+	Type     string `db:"type"`
+}
+
+func convertOptOutsToModels(optOuts []OptOut) []models.NotificationType {
+	res := make([]models.NotificationType, 0, len(optOuts))
+	for _, optOut := range optOuts {
+		res = append(res, models.NotificationType(optOut.Type))
+	}
+
+	return res
+}
+
+// digestColumns select from notification_digests aliased d.
+const digestColumns = "BIN_TO_UUID(d.user_uuid) AS user_uuid, d.email, d.frequency, BIN_TO_UUID(d.last_notification_id) AS last_notification_id"
+
+type DigestSubscription struct {
+	UserUUID           string         `db:"user_uuid"`
+	Email              string         `db:"email"`
+	Frequency          string         `db:"frequency"`
+	LastNotificationID sql.NullString `db:"last_notification_id"`
+}
+
+func convertDigestSubscriptionToModel(row DigestSubscription) models.DigestSubscription {
+	return models.DigestSubscription{
+		UserID: models.UserID(row.UserUUID),
+		DigestSettings: models.DigestSettings{
+			Email:     row.Email,
+			Frequency: models.DigestFrequency(row.Frequency),
+		},
+		LastNotificationID: models.NotificationID(row.LastNotificationID.String),
+	}
+}
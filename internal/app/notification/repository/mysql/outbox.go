@@ -0,0 +1,166 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type outboxRepository struct {
+	db     *mysql_client.Provider
+	logger log.Logger
+}
+
+func NewOutboxRepository(db *mysql_client.Provider, logger log.Logger) models.OutboxRepository {
+	return outboxRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (o outboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	var rows []OutboxMessage
+	err := o.db.InTx(ctx, func(ctx context.Context) error {
+		tx := o.db.Writer(ctx)
+
+		rows = nil
+		err := tx.SelectContext(
+			ctx,
+			&rows,
+			`SELECT id, BIN_TO_UUID(recipient) AS recipient, type, payload, attempts
+			FROM notification_outbox
+			WHERE sent_at IS NULL AND (claimed_until IS NULL OR claimed_until < NOW())
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED`,
+			limit,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to select outbox")
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, 0, len(rows))
+		for i := range rows {
+			ids = append(ids, rows[i].ID)
+			rows[i].Attempts++
+		}
+
+		query, args, err := sqlx.In(
+			"UPDATE notification_outbox SET attempts = attempts + 1, claimed_until = NOW() + INTERVAL ? MICROSECOND WHERE id IN (?)",
+			lease.Microseconds(), ids,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to build claim query")
+		}
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		return errors.Wrap(err, "failed to claim outbox")
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	return convertOutboxToModels(rows)
+}
+
+func (o outboxRepository) Write(ctx context.Context, notifications []models.Notification) error {
+	return WriteOutbox(ctx, o.db.Writer(ctx), notifications)
+}
+
+// WriteOutbox stores notifications with q, which must be the Writer of the
+// InTx that makes the change they describe, so that they are published only
+// if it is committed. Every notification is also added to the target inbox.
+// Notifications disabled by their targets are skipped.
+func WriteOutbox(ctx context.Context, tx mysql_client.Querier, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	disabled, err := loadOptOuts(ctx, tx, notifications)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]OutboxMessage, 0, len(notifications))
+	inbox := make([]InboxNotification, 0, len(notifications))
+	for _, notification := range notifications {
+		if _, ok := disabled[optOut{notification.Target, notification.Type}]; ok {
+			continue
+		}
+
+		row, err := convertModelToOutboxMessage(notification)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+		inbox = append(inbox, convertOutboxMessageToInbox(notification, row))
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	_, err = tx.NamedExecContext(ctx, "INSERT INTO notification_outbox (recipient, type, payload) VALUES (UUID_TO_BIN(:recipient), :type, :payload)", rows)
+	if err != nil {
+		return errors.Wrap(err, "failed to write outbox")
+	}
+
+	_, err = tx.NamedExecContext(ctx, "INSERT INTO notifications (notification_id, user_uuid, type, payload) VALUES (UUID_TO_BIN(:notification_id), UUID_TO_BIN(:user_uuid), :type, :payload)", inbox)
+	if err != nil {
+		return errors.Wrap(err, "failed to write inbox")
+	}
+
+	return nil
+}
+
+type optOut struct {
+	userID models.UserID
+	typ    models.NotificationType
+}
+
+func loadOptOuts(ctx context.Context, q sqlx.QueryerContext, notifications []models.Notification) (map[optOut]struct{}, error) {
+	// UUID_TO_BIN without swap flag is the plain uuid bytes, so targets can be
+	// passed to IN as binary values and the primary key is used.
+	targets := make([][]byte, 0, len(notifications))
+	for _, notification := range notifications {
+		target, err := uuid.Parse(string(notification.Target))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid notification target %q", notification.Target)
+		}
+		targets = append(targets, target[:])
+	}
+
+	query, args, err := sqlx.In("SELECT BIN_TO_UUID(user_uuid) AS user_uuid, type FROM notification_opt_outs WHERE user_uuid IN (?)", targets)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build opt-outs query")
+	}
+
+	var rows []OptOut
+	if err := sqlx.SelectContext(ctx, q, &rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to select opt-outs")
+	}
+
+	res := make(map[optOut]struct{}, len(rows))
+	for _, row := range rows {
+		res[optOut{models.UserID(row.UserUUID), models.NotificationType(row.Type)}] = struct{}{}
+	}
+
+	return res, nil
+}
+
+func (o outboxRepository) MarkSent(ctx context.Context, id models.OutboxMessageID) error {
+	_, err := o.db.Writer(ctx).ExecContext(ctx, "UPDATE notification_outbox SET sent_at = NOW(), claimed_until = NULL WHERE id = ?", id)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark outbox message sent")
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type preferencesRepository struct {
+	db     *mysql_client.Provider
+	logger log.Logger
+}
+
+func NewPreferencesRepository(db *mysql_client.Provider, logger log.Logger) models.NotificationPreferencesRepository {
+	return preferencesRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (p preferencesRepository) GetDisabledNotifications(ctx context.Context, userID models.UserID) ([]models.NotificationType, error) {
+	var optOuts []OptOut
+	err := p.db.Writer(ctx).SelectContext(ctx, &optOuts, "SELECT BIN_TO_UUID(user_uuid) AS user_uuid, type FROM notification_opt_outs WHERE user_uuid = UUID_TO_BIN(?) ORDER BY type", userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select opt-outs")
+	}
+
+	return convertOptOutsToModels(optOuts), nil
+}
+
+func (p preferencesRepository) SetNotificationEnabled(ctx context.Context, userID models.UserID, typ models.NotificationType, enabled bool) error {
+	query := "INSERT IGNORE INTO notification_opt_outs (user_uuid, type) VALUES (UUID_TO_BIN(?), ?)"
+	if enabled {
+		query = "DELETE FROM notification_opt_outs WHERE user_uuid = UUID_TO_BIN(?) AND type = ?"
+	}
+
+	_, err := p.db.Writer(ctx).ExecContext(ctx, query, userID, typ)
+	if err != nil {
+		return errors.Wrap(err, "failed to update opt-outs")
+	}
+
+	return nil
+}
+
+func (p preferencesRepository) FilterDisabled(ctx context.Context, notifications []models.Notification) ([]models.Notification, error) {
+	if len(notifications) == 0 {
+		return nil, nil
+	}
+
+	disabled, err := loadOptOuts(ctx, p.db.Writer(ctx), notifications)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]models.Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		if _, ok := disabled[optOut{notification.Target, notification.Type}]; !ok {
+			res = append(res, notification)
+		}
+	}
+
+	return res, nil
+}
+
+func (p preferencesRepository) GetDigestSettings(ctx context.Context, userID models.UserID) (models.DigestSettings, error) {
+	var row DigestSubscription
+	err := p.db.Writer(ctx).GetContext(ctx, &row, "SELECT "+digestColumns+" FROM notification_digests d WHERE d.user_uuid = UUID_TO_BIN(?)", userID)
+	if err == sql.ErrNoRows {
+		return models.DigestSettings{Frequency: models.DigestNever}, nil
+	}
+	if err != nil {
+		return models.DigestSettings{}, errors.Wrap(err, "failed to select digest settings")
+	}
+
+	return convertDigestSubscriptionToModel(row).DigestSettings, nil
+}
+
+func (p preferencesRepository) SetDigestSettings(ctx context.Context, userID models.UserID, settings models.DigestSettings) error {
+	// the first digest after a change is sent one period later, never disables it.
+	// Releasing the claim keeps a digest in progress from rescheduling over the change.
+	var nextRunAt interface{}
+	if period := settings.Frequency.Period(); period > 0 {
+		nextRunAt = time.Now().Add(period).UTC()
+	}
+
+	_, err := p.db.Writer(ctx).ExecContext(
+		ctx,
+		`INSERT INTO notification_digests (user_uuid, email, frequency, next_run_at)
+		VALUES (UUID_TO_BIN(?), ?, ?, ?)
+		ON DUPLICATE KEY UPDATE email = VALUES(email), frequency = VALUES(frequency), next_run_at = VALUES(next_run_at), claimed_until = NULL`,
+		userID, settings.Email, settings.Frequency, nextRunAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to save digest settings")
+	}
+
+	return nil
+}
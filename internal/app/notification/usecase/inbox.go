@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type InboxConfig struct {
+	DefaultPageSize int `mapstructure:"default_page_size"`
+	MaxPageSize     int `mapstructure:"max_page_size"`
+	// ReplayPageSize is how many notifications a replay reads at once, the
+	// replay continues until the whole kept history after the cursor is read.
+	ReplayPageSize int `mapstructure:"replay_page_size"`
+}
+
+type inboxUsecase struct {
+	cfg    InboxConfig
+	inbox  models.NotificationInboxRepository
+	logger log.Logger
+}
+
+func NewInboxUsecase(cfg InboxConfig, inbox models.NotificationInboxRepository, logger log.Logger) models.NotificationInboxUsecase {
+	if cfg.DefaultPageSize <= 0 {
+		cfg.DefaultPageSize = 20
+	}
+	if cfg.MaxPageSize < cfg.DefaultPageSize {
+		cfg.MaxPageSize = cfg.DefaultPageSize
+	}
+	if cfg.ReplayPageSize <= 0 {
+		cfg.ReplayPageSize = 100
+	}
+
+	return inboxUsecase{
+		cfg:    cfg,
+		inbox:  inbox,
+		logger: logger,
+	}
+}
+
+func (i inboxUsecase) GetNotifications(ctx context.Context, before models.NotificationID, limit int) (models.NotificationPage, error) {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.NotificationPage{}, models.ErrUnauthorized
+	}
+
+	if limit <= 0 {
+		limit = i.cfg.DefaultPageSize
+	}
+	if limit > i.cfg.MaxPageSize {
+		limit = i.cfg.MaxPageSize
+	}
+
+	notifications, err := i.inbox.GetNotifications(ctx, userID, before, limit)
+	if err != nil {
+		return models.NotificationPage{}, errors.Wrap(err, "failed to get notifications")
+	}
+
+	unread, err := i.inbox.CountUnread(ctx, userID)
+	if err != nil {
+		return models.NotificationPage{}, errors.Wrap(err, "failed to count unread notifications")
+	}
+
+	return models.NotificationPage{
+		Notifications: notifications,
+		Unread:        unread,
+	}, nil
+}
+
+func (i inboxUsecase) ReplayNotifications(ctx context.Context, after models.NotificationID) ([]models.Notification, error) {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return nil, models.ErrUnauthorized
+	}
+
+	// a client without a cursor has seen nothing to continue from
+	if after == "" {
+		return nil, nil
+	}
+
+	// the inbox is trimmed by the relay, so the replay is bounded by its size
+	var notifications []models.Notification
+	for {
+		page, err := i.inbox.GetNotificationsAfter(ctx, userID, after, i.cfg.ReplayPageSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to replay notifications")
+		}
+		notifications = append(notifications, page...)
+
+		if len(page) < i.cfg.ReplayPageSize {
+			return notifications, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+func (i inboxUsecase) MarkNotificationsRead(ctx context.Context, ids []models.NotificationID) error {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	err := i.inbox.MarkRead(ctx, userID, ids)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark notifications read")
+	}
+
+	return nil
+}
+
+func (i inboxUsecase) MarkAllNotificationsRead(ctx context.Context) error {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	err := i.inbox.MarkAllRead(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark notifications read")
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInbox keeps notifications of a single user oldest first.
+type fakeInbox struct {
+	models.NotificationInboxRepository
+
+	notifications []models.Notification
+	reads         int
+}
+
+func (f *fakeInbox) GetNotificationsAfter(_ context.Context, _ models.UserID, after models.NotificationID, limit int) ([]models.Notification, error) {
+	f.reads++
+
+	start := -1
+	for i, notification := range f.notifications {
+		if notification.ID == after {
+			start = i + 1
+		}
+	}
+	if start == -1 {
+		return nil, nil
+	}
+
+	end := start + limit
+	if end > len(f.notifications) {
+		end = len(f.notifications)
+	}
+
+	return f.notifications[start:end], nil
+}
+
+func TestReplayNotifications(t *testing.T) {
+	inbox := &fakeInbox{}
+	for i := 0; i < 25; i++ {
+		inbox.notifications = append(inbox.notifications, models.Notification{ID: models.NotificationID(fmt.Sprint(i))})
+	}
+
+	u := NewInboxUsecase(InboxConfig{ReplayPageSize: 10}, inbox, log.Null)
+	ctx := contextlib.WithUserID(context.Background(), "alice")
+
+	// everything after the cursor is replayed in order, not only the newest page
+	replayed, err := u.ReplayNotifications(ctx, "2")
+	require.NoError(t, err)
+	require.Equal(t, inbox.notifications[3:], replayed)
+	require.Equal(t, 3, inbox.reads)
+
+	replayed, err = u.ReplayNotifications(ctx, "")
+	require.NoError(t, err)
+	require.Empty(t, replayed)
+
+	// an unknown cursor must not replay the whole inbox
+	replayed, err = u.ReplayNotifications(ctx, "typing")
+	require.NoError(t, err)
+	require.Empty(t, replayed)
+
+	_, err = u.ReplayNotifications(context.Background(), "2")
+	require.ErrorIs(t, err, models.ErrUnauthorized)
+}
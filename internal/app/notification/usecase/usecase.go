@@ -0,0 +1,92 @@
+package usecase
+
+import (
+	"context"
+	"net/mail"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type preferencesUsecase struct {
+	preferences models.NotificationPreferencesRepository
+	logger      log.Logger
+}
+
+func NewPreferencesUsecase(preferences models.NotificationPreferencesRepository, logger log.Logger) models.NotificationPreferencesUsecase {
+	return preferencesUsecase{
+		preferences: preferences,
+		logger:      logger,
+	}
+}
+
+func (p preferencesUsecase) GetDisabledNotifications(ctx context.Context) ([]models.NotificationType, error) {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return nil, models.ErrUnauthorized
+	}
+
+	types, err := p.preferences.GetDisabledNotifications(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get disabled notifications")
+	}
+
+	return types, nil
+}
+
+func (p preferencesUsecase) SetNotificationEnabled(ctx context.Context, typ models.NotificationType, enabled bool) error {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	if !typ.Valid() {
+		return models.ErrUnknownNotificationType
+	}
+
+	err := p.preferences.SetNotificationEnabled(ctx, userID, typ, enabled)
+	if err != nil {
+		return errors.Wrap(err, "failed to set notification preference")
+	}
+
+	return nil
+}
+
+func (p preferencesUsecase) GetDigestSettings(ctx context.Context) (models.DigestSettings, error) {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.DigestSettings{}, models.ErrUnauthorized
+	}
+
+	settings, err := p.preferences.GetDigestSettings(ctx, userID)
+	if err != nil {
+		return models.DigestSettings{}, errors.Wrap(err, "failed to get digest settings")
+	}
+
+	return settings, nil
+}
+
+func (p preferencesUsecase) SetDigestSettings(ctx context.Context, settings models.DigestSettings) error {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	if !settings.Frequency.Valid() {
+		return errors.Transform(errors.Errorf("unknown frequency %q", settings.Frequency), models.ErrInvalidDigestSettings)
+	}
+	if settings.Frequency != models.DigestNever {
+		if _, err := mail.ParseAddress(settings.Email); err != nil {
+			return errors.Transform(errors.Wrap(err, "failed to parse email"), models.ErrInvalidDigestSettings)
+		}
+	}
+
+	err := p.preferences.SetDigestSettings(ctx, userID, settings)
+	if err != nil {
+		return errors.Wrap(err, "failed to set digest settings")
+	}
+
+	return nil
+}
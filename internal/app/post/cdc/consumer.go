@@ -0,0 +1,436 @@
+// Package cdc applies changes captured from the MySQL binlog to derived data
+// such as feed caches and the user search index.
+package cdc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/mysql/binlog"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/go-sql-driver/mysql"
+)
+
+const taskType = "binlog_transaction"
+
+var errRetry = errors.New("retrying failed binlog transaction")
+
+// Change is a row change with values by column name, Before is nil for
+// inserts and After for deletes.
+type Change struct {
+	Table  string
+	Action binlog.Action
+	Before map[string]interface{}
+	After  map[string]interface{}
+}
+
+// Handler applies changes of its tables. Changes come in commit order, one
+// at a time, and may be repeated after a crash or a failure of another
+// handler of the same table.
+type Handler interface {
+	Tables() []string
+	Handle(ctx context.Context, change Change) error
+}
+
+type Config struct {
+	// Binlog.DSN selects the database of the handled tables, Binlog.Tables is
+	// set from the handlers.
+	Binlog binlog.Config `mapstructure:"binlog"`
+	// Consumer names the checkpoint, consumers of one primary need different
+	// names.
+	Consumer string `mapstructure:"consumer"`
+	// CheckpointInterval bounds how often the position is saved past
+	// transactions without handled changes. Handled transactions are
+	// checkpointed right after they are applied.
+	CheckpointInterval time.Duration `mapstructure:"checkpoint_interval"`
+	// PollTimeout is how long Get waits for a transaction, it bounds the
+	// graceful shutdown of an idle pool.
+	PollTimeout       time.Duration `mapstructure:"poll_timeout"`
+	ReconnectDelay    time.Duration `mapstructure:"reconnect_delay"`
+	MaxReconnectDelay time.Duration `mapstructure:"max_reconnect_delay"`
+	// Buffer is how many transactions are read ahead of the applied one.
+	Buffer int `mapstructure:"buffer"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Consumer == "" {
+		c.Consumer = "feed"
+	}
+	if c.CheckpointInterval <= 0 {
+		c.CheckpointInterval = time.Second
+	}
+	if c.PollTimeout <= 0 {
+		c.PollTimeout = time.Second
+	}
+	if c.ReconnectDelay <= 0 {
+		c.ReconnectDelay = time.Second
+	}
+	if c.MaxReconnectDelay <= 0 {
+		c.MaxReconnectDelay = 30 * time.Second
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = 100
+	}
+
+	return c
+}
+
+type consumerStat struct {
+	Changes    stat.CounterCtor `labels:"table,action,status"`
+	Reconnects stat.CounterCtor
+	// Lag is seconds from the commit on the primary to the applied changes.
+	Lag stat.HistogramCtor `buckets:"0.01,0.05,0.1,0.5,1,5,10,30,60,300"`
+}
+
+// Consumer streams the binlog from the checkpoint and turns transactions
+// into processor tasks. Tasks are handed out one at a time, so that changes
+// are applied in commit order whatever the pool size. A failed transaction
+// is retried until it is applied, later ones wait for it.
+type Consumer struct {
+	cfg         Config
+	schema      string
+	checkpoints models.BinlogCheckpointRepository
+	handlers    map[string][]Handler
+	logger      log.Logger
+	Stat        consumerStat
+
+	txs  chan binlog.Transaction
+	stop chan struct{}
+	done chan struct{}
+
+	streamMu sync.Mutex
+	stream   *binlog.Stream
+
+	// the fields below are owned by the task in progress, Get waits for it
+	wg           sync.WaitGroup
+	applied      binlog.GTIDSet
+	checkpointed time.Time
+	failed       *task
+	backoff      bool
+	columns      map[string][]string
+}
+
+// NewConsumer starts streaming from the checkpoint of cfg.Consumer, a new
+// consumer starts from the current position of the primary.
+func NewConsumer(
+	ctx context.Context,
+	cfg Config,
+	checkpoints models.BinlogCheckpointRepository,
+	handlers []Handler,
+	registry stat.Registry,
+	logger log.Logger,
+) (*Consumer, error) {
+	cfg = cfg.withDefaults()
+
+	dsn, err := mysql.ParseDSN(cfg.Binlog.DSN)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binlog dsn")
+	}
+	if dsn.DBName == "" {
+		return nil, errors.New("binlog dsn has no database")
+	}
+
+	c := &Consumer{
+		cfg:         cfg,
+		schema:      dsn.DBName,
+		checkpoints: checkpoints,
+		handlers:    make(map[string][]Handler),
+		logger:      logger,
+		txs:         make(chan binlog.Transaction, cfg.Buffer),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		columns:     make(map[string][]string),
+	}
+	stat.NewRegistrar(registry.ForSubsystem("binlog_consumer")).MustRegister(&c.Stat)
+
+	c.cfg.Binlog.Tables = nil
+	for _, handler := range handlers {
+		for _, table := range handler.Tables() {
+			if _, ok := c.handlers[table]; !ok {
+				c.cfg.Binlog.Tables = append(c.cfg.Binlog.Tables, c.schema+"."+table)
+			}
+			c.handlers[table] = append(c.handlers[table], handler)
+		}
+	}
+
+	position, err := checkpoints.GetCheckpoint(ctx, cfg.Consumer)
+	if errors.Is(err, models.ErrCheckpointNotFound) {
+		position, err = checkpoints.GetExecutedGTIDs(ctx)
+		logger.Infof("no checkpoint of %s, starting from %s", cfg.Consumer, position)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get binlog position")
+	}
+
+	c.applied, err = binlog.ParseGTIDSet(position)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binlog position")
+	}
+
+	go c.run(c.applied.Clone())
+
+	return c, nil
+}
+
+// Close stops streaming, transactions read ahead are streamed again on the
+// next start.
+func (c *Consumer) Close() error {
+	close(c.stop)
+
+	c.streamMu.Lock()
+	if c.stream != nil {
+		_ = c.stream.Close()
+	}
+	c.streamMu.Unlock()
+
+	<-c.done
+
+	return nil
+}
+
+func (c *Consumer) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// run reads transactions missing in position, reconnecting with a backoff.
+func (c *Consumer) run(position binlog.GTIDSet) {
+	defer close(c.done)
+
+	delay := c.cfg.ReconnectDelay
+	for !c.stopped() {
+		stream, err := binlog.Open(c.cfg.Binlog, position)
+		if err != nil {
+			c.logger.WithError(err).Errorf("failed to open binlog stream, retrying in %s", delay)
+			c.Stat.Reconnects.Counter(context.Background()).Add(1)
+
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > c.cfg.MaxReconnectDelay {
+				delay = c.cfg.MaxReconnectDelay
+			}
+			continue
+		}
+		delay = c.cfg.ReconnectDelay
+
+		c.streamMu.Lock()
+		c.stream = stream
+		c.streamMu.Unlock()
+		if c.stopped() {
+			_ = stream.Close()
+			return
+		}
+
+		c.logger.Infof("streaming binlog after %s", position)
+		err = c.read(stream, position)
+		_ = stream.Close()
+		if err != nil && !c.stopped() {
+			c.logger.WithError(err).Warn("binlog stream broken, reconnecting")
+			c.Stat.Reconnects.Counter(context.Background()).Add(1)
+		}
+	}
+}
+
+func (c *Consumer) read(stream *binlog.Stream, position binlog.GTIDSet) error {
+	for {
+		tx, err := stream.Next()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case c.txs <- tx:
+			position.Add(tx.GTID)
+		case <-c.stop:
+			return nil
+		}
+	}
+}
+
+func (c *Consumer) Get(ctx context.Context) (processor.Task, error) {
+	c.wg.Wait()
+
+	if c.failed != nil {
+		// the pool sleeps on a get error, a failing transaction is retried
+		// with a pause
+		if c.backoff {
+			c.backoff = false
+			return nil, errors.Wrap(errRetry, c.failed.tx.GTID.String())
+		}
+
+		t := c.failed
+		c.failed = nil
+		c.wg.Add(1)
+
+		return t, nil
+	}
+
+	select {
+	case tx := <-c.txs:
+		c.wg.Add(1)
+		return &task{consumer: c, tx: tx}, nil
+	case <-time.After(c.cfg.PollTimeout):
+		c.checkpoint(ctx, false)
+		return nil, errors.Transform(errors.New("no binlog transactions"), processor.ErrTaskNotFound)
+	}
+}
+
+// checkpoint saves the applied position when forced or due.
+func (c *Consumer) checkpoint(ctx context.Context, force bool) {
+	if !force && time.Since(c.checkpointed) < c.cfg.CheckpointInterval {
+		return
+	}
+
+	err := c.checkpoints.SaveCheckpoint(ctx, c.cfg.Consumer, c.applied.String())
+	if err != nil {
+		// the transactions after the saved position are applied again
+		c.logger.ForCtx(ctx).WithError(err).Warn("failed to save binlog checkpoint")
+		return
+	}
+	c.checkpointed = time.Now()
+}
+
+// tableColumns takes column names from the binlog, from the schema when the
+// binlog does not have them.
+func (c *Consumer) tableColumns(ctx context.Context, table *binlog.Table, width int) ([]string, error) {
+	if len(table.Columns) == width {
+		return table.Columns, nil
+	}
+
+	columns, ok := c.columns[table.Name]
+	if ok && len(columns) == width {
+		return columns, nil
+	}
+
+	// the table was altered or not seen yet
+	columns, err := c.checkpoints.GetColumns(ctx, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != width {
+		return nil, errors.Errorf("%s has %d columns, the binlog has %d", table.FullName(), len(columns), width)
+	}
+	c.columns[table.Name] = columns
+
+	return columns, nil
+}
+
+type task struct {
+	consumer *Consumer
+	tx       binlog.Transaction
+	acked    bool
+}
+
+func (t *task) Process(ctx context.Context) error {
+	c := t.consumer
+
+	for _, rows := range t.tx.Rows {
+		handlers, ok := c.handlers[rows.Table.Name]
+		if !ok {
+			continue
+		}
+
+		for _, change := range rows.Changes {
+			err := t.handle(ctx, handlers, rows, change)
+			c.Stat.Changes.Counter(ctx).WithLabels(stat.Labels{
+				"table":  rows.Table.Name,
+				"action": string(rows.Action),
+				"status": stat.TypedErrorLabel(ctx, err),
+			}).Add(1)
+			if err != nil {
+				return errors.Wrapf(err, "failed to handle %s of %s", rows.Action, rows.Table.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *task) handle(ctx context.Context, handlers []Handler, rows binlog.RowsEvent, change binlog.Change) error {
+	width := len(change.After)
+	if change.Before != nil {
+		width = len(change.Before)
+	}
+
+	columns, err := t.consumer.tableColumns(ctx, rows.Table, width)
+	if err != nil {
+		return err
+	}
+
+	named := Change{
+		Table:  rows.Table.Name,
+		Action: rows.Action,
+		Before: byName(columns, change.Before),
+		After:  byName(columns, change.After),
+	}
+	for _, handler := range handlers {
+		if err := handler.Handle(ctx, named); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func byName(columns []string, row binlog.Row) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+
+	res := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		res[strings.ToLower(column)] = row[i]
+	}
+
+	return res
+}
+
+func (t *task) Ack(ctx context.Context) error {
+	c := t.consumer
+	t.acked = true
+
+	c.applied.Add(t.tx.GTID)
+	c.checkpoint(ctx, len(t.tx.Rows) > 0)
+	if len(t.tx.Rows) > 0 {
+		c.Stat.Lag.Histogram(ctx).Observe(time.Since(t.tx.Timestamp).Seconds())
+	}
+
+	return nil
+}
+
+// Delete skips a transaction which cannot be applied.
+func (t *task) Delete(ctx context.Context) error {
+	t.consumer.logger.ForCtx(ctx).Errorf("skipping binlog transaction %s", t.tx.GTID)
+	return t.Ack(ctx)
+}
+
+func (t *task) Defer(_ context.Context) {
+	c := t.consumer
+	if !t.acked {
+		c.failed = t
+		c.backoff = true
+	}
+
+	c.wg.Done()
+}
+
+func (t *task) Key() string {
+	return t.tx.GTID.String()
+}
+
+func (t *task) Type() string {
+	return taskType
+}
@@ -0,0 +1,244 @@
+package cdc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/mysql/binlog"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const testSID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+type fakeCheckpoints struct {
+	mu    sync.Mutex
+	saved []string
+	// columns of every table, id and text by default
+	columns []string
+}
+
+func (f *fakeCheckpoints) GetCheckpoint(context.Context, string) (string, error) {
+	return "", models.ErrCheckpointNotFound
+}
+
+func (f *fakeCheckpoints) SaveCheckpoint(_ context.Context, _ string, gtidSet string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.saved = append(f.saved, gtidSet)
+	return nil
+}
+
+func (f *fakeCheckpoints) GetExecutedGTIDs(context.Context) (string, error) {
+	return testSID + ":1-4", nil
+}
+
+func (f *fakeCheckpoints) GetColumns(context.Context, string, string) ([]string, error) {
+	if f.columns != nil {
+		return f.columns, nil
+	}
+
+	return []string{"id", "text"}, nil
+}
+
+func (f *fakeCheckpoints) last() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.saved[len(f.saved)-1]
+}
+
+// recordingHandler fails the first change of the text "fail".
+type recordingHandler struct {
+	failed  bool
+	handled []string
+}
+
+func (h *recordingHandler) Tables() []string {
+	return []string{"post"}
+}
+
+func (h *recordingHandler) Handle(_ context.Context, change Change) error {
+	text := string(change.After["text"].([]byte))
+	if text == "fail" && !h.failed {
+		h.failed = true
+		return errors.New("handler failed")
+	}
+
+	h.handled = append(h.handled, text)
+	return nil
+}
+
+func transaction(gno int64, texts ...string) binlog.Transaction {
+	table := &binlog.Table{Schema: "otus", Name: "post"}
+	rows := binlog.RowsEvent{Table: table, Action: binlog.ActionInsert}
+	for i, text := range texts {
+		rows.Changes = append(rows.Changes, binlog.Change{After: binlog.Row{int64(i), []byte(text)}})
+	}
+
+	tx := binlog.Transaction{GTID: binlog.GTID{SID: testSID, GNO: gno}, Timestamp: time.Now()}
+	if len(texts) > 0 {
+		tx.Rows = []binlog.RowsEvent{rows}
+	}
+
+	return tx
+}
+
+// process runs a task the way the pool does.
+func process(ctx context.Context, task processor.Task) {
+	defer task.Defer(ctx)
+
+	if err := task.Process(ctx); err != nil {
+		return
+	}
+	_ = task.Ack(ctx)
+}
+
+func TestConsumerAppliesInOrder(t *testing.T) {
+	ctx := context.Background()
+	checkpoints := &fakeCheckpoints{}
+	handler := &recordingHandler{}
+
+	consumer, err := NewConsumer(ctx, Config{
+		// nothing listens there, transactions are fed to the channel
+		Binlog:             binlog.Config{DSN: "otus:otus@tcp(127.0.0.1:1)/otus", DialTimeout: 10 * time.Millisecond},
+		CheckpointInterval: time.Hour,
+		PollTimeout:        10 * time.Millisecond,
+		ReconnectDelay:     time.Hour,
+	}, checkpoints, []Handler{handler}, stub.NewStubRegistry(), log.Null)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	require.Equal(t, []string{"otus.post"}, consumer.cfg.Binlog.Tables)
+
+	consumer.txs <- transaction(5, "a", "b")
+	consumer.txs <- transaction(6)
+	consumer.txs <- transaction(7, "fail")
+	consumer.txs <- transaction(8, "c")
+
+	for i := 0; i < 3; i++ {
+		task, err := consumer.Get(ctx)
+		require.NoError(t, err)
+		process(ctx, task)
+	}
+	// the transaction without changes is checkpointed when due only
+	require.Equal(t, []string{"a", "b"}, handler.handled)
+	require.Equal(t, testSID+":1-5", checkpoints.last())
+
+	// the failed transaction is retried after a pause, before the next one
+	_, err = consumer.Get(ctx)
+	require.ErrorIs(t, err, errRetry)
+
+	for i := 0; i < 2; i++ {
+		task, err := consumer.Get(ctx)
+		require.NoError(t, err)
+		process(ctx, task)
+	}
+	require.Equal(t, []string{"a", "b", "fail", "c"}, handler.handled)
+	require.Equal(t, testSID+":1-8", checkpoints.last())
+
+	_, err = consumer.Get(ctx)
+	require.ErrorIs(t, err, processor.ErrTaskNotFound)
+}
+
+// fakeFeeds keeps cached feeds as lists, newest first. AddToCache fails once
+// for the users in failing.
+type fakeFeeds struct {
+	models.PostRepository
+
+	failing map[string]bool
+	adds    map[string]int
+	caches  map[string][]models.PostID
+}
+
+func (f *fakeFeeds) AddToCache(_ context.Context, userID string, post models.Post) error {
+	if f.failing[userID] {
+		delete(f.failing, userID)
+		return errors.New("redis is down")
+	}
+	f.adds[userID]++
+
+	feed := []models.PostID{post.ID}
+	for _, id := range f.caches[userID] {
+		if id != post.ID {
+			feed = append(feed, id)
+		}
+	}
+	f.caches[userID] = feed
+
+	return nil
+}
+
+type fakeFriends struct {
+	models.UserRepository
+
+	friends map[models.UserID][]models.UserID
+}
+
+func (f fakeFriends) GetFriends(_ context.Context, userID models.UserID) ([]models.UserID, error) {
+	return f.friends[userID], nil
+}
+
+func TestConsumerRetriesFeedChanges(t *testing.T) {
+	ctx := context.Background()
+	checkpoints := &fakeCheckpoints{columns: []string{"uuid", "user_id", "text", "deleted_at"}}
+
+	alice, post := uuid.New(), uuid.New()
+	bob, carol := uuid.New().String(), uuid.New().String()
+	feeds := &fakeFeeds{
+		failing: map[string]bool{carol: true},
+		adds:    make(map[string]int),
+		caches:  make(map[string][]models.PostID),
+	}
+	users := fakeFriends{friends: map[models.UserID][]models.UserID{
+		models.UserID(alice.String()): {models.UserID(bob), models.UserID(carol)},
+	}}
+
+	consumer, err := NewConsumer(ctx, Config{
+		Binlog:             binlog.Config{DSN: "otus:otus@tcp(127.0.0.1:1)/otus", DialTimeout: 10 * time.Millisecond},
+		CheckpointInterval: time.Hour,
+		PollTimeout:        10 * time.Millisecond,
+		ReconnectDelay:     time.Hour,
+	}, checkpoints, []Handler{NewFeedHandler(feeds, users, log.Null)}, stub.NewStubRegistry(), log.Null)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	consumer.txs <- binlog.Transaction{
+		GTID:      binlog.GTID{SID: testSID, GNO: 5},
+		Timestamp: time.Now(),
+		Rows: []binlog.RowsEvent{{
+			Table:   &binlog.Table{Schema: "otus", Name: "post"},
+			Action:  binlog.ActionInsert,
+			Changes: []binlog.Change{{After: binlog.Row{post[:], alice[:], []byte("hello"), nil}}},
+		}},
+	}
+
+	// the feed of bob is updated before the one of carol fails
+	task, err := consumer.Get(ctx)
+	require.NoError(t, err)
+	process(ctx, task)
+	require.Equal(t, map[string][]models.PostID{bob: {models.PostID(post.String())}}, feeds.caches)
+
+	_, err = consumer.Get(ctx)
+	require.ErrorIs(t, err, errRetry)
+
+	task, err = consumer.Get(ctx)
+	require.NoError(t, err)
+	process(ctx, task)
+	require.Equal(t, testSID+":1-5", checkpoints.last())
+
+	// the retry adds the post to bob again without repeating it
+	require.Equal(t, 2, feeds.adds[bob])
+	require.Equal(t, map[string][]models.PostID{
+		bob:   {models.PostID(post.String())},
+		carol: {models.PostID(post.String())},
+	}, feeds.caches)
+}
@@ -0,0 +1,197 @@
+package cdc
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/clients/mysql/binlog"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/google/uuid"
+)
+
+// feedHandler keeps the feed caches of friends in line with post, friends
+// and users rows, instead of the app writing them on CreatePost.
+type feedHandler struct {
+	posts  models.PostRepository
+	users  models.UserRepository
+	logger log.Logger
+}
+
+func NewFeedHandler(posts models.PostRepository, users models.UserRepository, logger log.Logger) Handler {
+	return feedHandler{
+		posts:  posts,
+		users:  users,
+		logger: logger,
+	}
+}
+
+func (h feedHandler) Tables() []string {
+	return []string{"post", "friends", "users"}
+}
+
+func (h feedHandler) Handle(ctx context.Context, change Change) error {
+	// the change may not have reached the replicas yet
+	ctx = mysql_client.WithPrimary(ctx)
+
+	switch change.Table {
+	case "post":
+		return h.handlePost(ctx, change)
+	case "friends":
+		return h.handleFriends(ctx, change)
+	case "users":
+		return h.handleUser(ctx, change)
+	default:
+		return nil
+	}
+}
+
+func (h feedHandler) handlePost(ctx context.Context, change Change) error {
+	row := change.After
+	if change.Action == binlog.ActionDelete {
+		row = change.Before
+	}
+
+	post, err := postFromRow(row)
+	if err != nil {
+		return err
+	}
+
+	action := change.Action
+	switch {
+	case action == binlog.ActionInsert && deleted(change.After):
+		return nil
+	case action == binlog.ActionUpdate:
+		before, err := postFromRow(change.Before)
+		if err != nil {
+			return err
+		}
+		if before.UserID != post.UserID || before.ID != post.ID || (deleted(change.Before) && !deleted(change.After)) {
+			return h.rebuildFriendsOf(ctx, before.UserID, post.UserID)
+		}
+		if deleted(change.Before) {
+			return nil
+		}
+		if deleted(change.After) {
+			action = binlog.ActionDelete
+		}
+	}
+
+	friends, err := h.users.GetFriends(ctx, post.UserID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get friends")
+	}
+
+	for _, friend := range friends {
+		switch action {
+		case binlog.ActionInsert:
+			err = h.posts.AddToCache(ctx, string(friend), post)
+		case binlog.ActionUpdate:
+			err = h.posts.UpdateInCache(ctx, string(friend), post)
+		case binlog.ActionDelete:
+			err = h.posts.RemoveFromCache(ctx, string(friend), post.ID)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to update feed cache of %s", friend)
+		}
+	}
+
+	return nil
+}
+
+// handleFriends rebuilds the feeds of both users, the posts of the other
+// one appear in or vanish from them.
+func (h feedHandler) handleFriends(ctx context.Context, change Change) error {
+	users := map[models.UserID]struct{}{}
+	for _, row := range []map[string]interface{}{change.Before, change.After} {
+		if row == nil {
+			continue
+		}
+
+		for _, column := range []string{"user1", "user2"} {
+			userID, err := uuidColumn(row, column)
+			if err != nil {
+				return err
+			}
+			users[models.UserID(userID)] = struct{}{}
+		}
+	}
+
+	for userID := range users {
+		if err := h.posts.RebuildCache(ctx, string(userID)); err != nil {
+			return errors.Wrapf(err, "failed to rebuild feed cache of %s", userID)
+		}
+	}
+
+	return nil
+}
+
+// handleUser rebuilds the feeds of the friends of a user deleted or
+// restored, the posts of the user vanish from or appear in them. Purged
+// users need nothing, their friendships are removed before them.
+func (h feedHandler) handleUser(ctx context.Context, change Change) error {
+	if change.Action != binlog.ActionUpdate || deleted(change.Before) == deleted(change.After) {
+		return nil
+	}
+
+	userID, err := uuidColumn(change.After, "uuid")
+	if err != nil {
+		return err
+	}
+
+	return h.rebuildFriendsOf(ctx, models.UserID(userID))
+}
+
+func (h feedHandler) rebuildFriendsOf(ctx context.Context, userIDs ...models.UserID) error {
+	for _, userID := range userIDs {
+		friends, err := h.users.GetFriends(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "failed to get friends")
+		}
+
+		for _, friend := range friends {
+			if err := h.posts.RebuildCache(ctx, string(friend)); err != nil {
+				return errors.Wrapf(err, "failed to rebuild feed cache of %s", friend)
+			}
+		}
+	}
+
+	return nil
+}
+
+func postFromRow(row map[string]interface{}) (models.Post, error) {
+	id, err := uuidColumn(row, "uuid")
+	if err != nil {
+		return models.Post{}, err
+	}
+	userID, err := uuidColumn(row, "user_id")
+	if err != nil {
+		return models.Post{}, err
+	}
+	text, _ := row["text"].([]byte)
+
+	return models.Post{
+		ID:     models.PostID(id),
+		UserID: models.UserID(userID),
+		Text:   string(text),
+	}, nil
+}
+
+func deleted(row map[string]interface{}) bool {
+	return row["deleted_at"] != nil
+}
+
+// uuidColumn formats a BINARY(16) value, which the binlog logs without
+// trailing zero bytes.
+func uuidColumn(row map[string]interface{}, column string) (string, error) {
+	raw, ok := row[column].([]byte)
+	if !ok || len(raw) > 16 {
+		return "", errors.Errorf("column %s is not a binary uuid", column)
+	}
+
+	var id uuid.UUID
+	copy(id[:], raw)
+
+	return id.String(), nil
+}
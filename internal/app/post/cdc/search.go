@@ -0,0 +1,48 @@
+package cdc
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/mysql/binlog"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+// searchHandler keeps the user search index in line with users rows.
+type searchHandler struct {
+	index  models.UserSearchIndex
+	logger log.Logger
+}
+
+func NewSearchHandler(index models.UserSearchIndex, logger log.Logger) Handler {
+	return searchHandler{
+		index:  index,
+		logger: logger,
+	}
+}
+
+func (h searchHandler) Tables() []string {
+	return []string{"users"}
+}
+
+func (h searchHandler) Handle(ctx context.Context, change Change) error {
+	row := change.After
+	if change.Action == binlog.ActionDelete {
+		row = change.Before
+	}
+
+	userID, err := uuidColumn(row, "uuid")
+	if err != nil {
+		return err
+	}
+
+	// deleted users are not found, as with the LIKE query
+	if change.Action == binlog.ActionDelete || deleted(row) {
+		return h.index.RemoveUser(ctx, models.UserID(userID))
+	}
+
+	firstName, _ := row["first_name"].([]byte)
+	secondName, _ := row["second_name"].([]byte)
+
+	return h.index.IndexUser(ctx, models.UserID(userID), string(firstName), string(secondName))
+}
@@ -0,0 +1,67 @@
+package cdc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/clients/mysql/binlog"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIndex keeps names of indexed users.
+type fakeIndex struct {
+	models.UserSearchIndex
+
+	names map[models.UserID]string
+}
+
+func (f *fakeIndex) IndexUser(_ context.Context, userID models.UserID, firstName string, secondName string) error {
+	f.names[userID] = firstName + " " + secondName
+	return nil
+}
+
+func (f *fakeIndex) RemoveUser(_ context.Context, userID models.UserID) error {
+	delete(f.names, userID)
+	return nil
+}
+
+func userRow(id uuid.UUID, firstName string, secondName string, deletedAt interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"uuid":        id[:],
+		"first_name":  []byte(firstName),
+		"second_name": []byte(secondName),
+		"deleted_at":  deletedAt,
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	ctx := context.Background()
+	index := &fakeIndex{names: make(map[models.UserID]string)}
+	handler := NewSearchHandler(index, log.Null)
+
+	alice := uuid.New()
+	userID := models.UserID(alice.String())
+	inserted := userRow(alice, "Alice", "Smith", nil)
+	renamed := userRow(alice, "Alice", "Jones", nil)
+	deleted := userRow(alice, "Alice", "Jones", time.Now())
+
+	require.NoError(t, handler.Handle(ctx, Change{Table: "users", Action: binlog.ActionInsert, After: inserted}))
+	require.Equal(t, map[models.UserID]string{userID: "Alice Smith"}, index.names)
+
+	require.NoError(t, handler.Handle(ctx, Change{Table: "users", Action: binlog.ActionUpdate, Before: inserted, After: renamed}))
+	require.Equal(t, map[models.UserID]string{userID: "Alice Jones"}, index.names)
+
+	// soft deleted users are not found, restored ones are again
+	require.NoError(t, handler.Handle(ctx, Change{Table: "users", Action: binlog.ActionUpdate, Before: renamed, After: deleted}))
+	require.Empty(t, index.names)
+
+	require.NoError(t, handler.Handle(ctx, Change{Table: "users", Action: binlog.ActionUpdate, Before: deleted, After: renamed}))
+	require.Equal(t, map[models.UserID]string{userID: "Alice Jones"}, index.names)
+
+	require.NoError(t, handler.Handle(ctx, Change{Table: "users", Action: binlog.ActionDelete, Before: renamed}))
+	require.Empty(t, index.names)
+}
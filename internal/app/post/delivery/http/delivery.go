@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoerrors"
 	"github.com/antonpriyma/otus-highload/pkg/log"
 )
 
@@ -22,7 +24,7 @@ func NewPostDelivery(posts models.PostUsecase, log log.Logger) PostDelivery {
 func (p PostDelivery) GetFeed(ctx context.Context, userID models.UserID, limit int, offset int) ([]models.Post, error) {
 	posts, err := p.Posts.GetFeed(ctx, userID, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(convertPostError(err), "failed to get feed")
 	}
 
 	return posts, nil
@@ -31,8 +33,32 @@ func (p PostDelivery) GetFeed(ctx context.Context, userID models.UserID, limit i
 func (p PostDelivery) CreatePost(ctx context.Context, post models.Post) (models.PostID, error) {
 	postID, err := p.Posts.CreatePost(ctx, post)
 	if err != nil {
-		return "", err
+		return "", errors.Wrap(convertPostError(err), "failed to create post")
 	}
 
 	return postID, nil
 }
+
+func (p PostDelivery) DeletePost(ctx context.Context, postID models.PostID) error {
+	err := p.Posts.DeletePost(ctx, postID)
+	if err != nil {
+		return errors.Wrap(convertPostError(err), "failed to delete post")
+	}
+
+	return nil
+}
+
+func convertPostError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrPostAlreadyExists):
+		return echoerrors.AlreadyExistsError(err, "post")
+	case errors.Is(err, models.ErrPostNotFound):
+		return echoerrors.NotFoundError(err, "post")
+	case errors.Is(err, models.ErrUserNotFound):
+		return echoerrors.NotFoundError(err, "user")
+	case errors.Is(err, errors.ErrUnavailable):
+		return echoerrors.ServiceUnavailableError(err)
+	default:
+		return echoerrors.InternalError(err)
+	}
+}
@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+// checkpointRepository reads from the primary, the binlog is streamed from it.
+type checkpointRepository struct {
+	db     *mysql_client.Provider
+	logger log.Logger
+}
+
+func NewCheckpointRepository(db *mysql_client.Provider, logger log.Logger) models.BinlogCheckpointRepository {
+	return checkpointRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+var checkpointErrors = mysql_client.Errors{NotFound: models.ErrCheckpointNotFound}
+
+func (c checkpointRepository) GetCheckpoint(ctx context.Context, consumer string) (string, error) {
+	var gtidSet string
+	err := c.db.Writer(ctx).GetContext(ctx, &gtidSet, "SELECT gtid_set FROM binlog_checkpoints WHERE consumer = ?", consumer)
+	if err != nil {
+		return "", errors.Wrap(checkpointErrors.Translate(err), "failed to get checkpoint")
+	}
+
+	return gtidSet, nil
+}
+
+func (c checkpointRepository) SaveCheckpoint(ctx context.Context, consumer string, gtidSet string) error {
+	_, err := c.db.Writer(ctx).ExecContext(
+		ctx,
+		"INSERT INTO binlog_checkpoints (consumer, gtid_set) VALUES (?, ?) ON DUPLICATE KEY UPDATE gtid_set = VALUES(gtid_set)",
+		consumer, gtidSet,
+	)
+	if err != nil {
+		return errors.Wrap(checkpointErrors.Translate(err), "failed to save checkpoint")
+	}
+
+	return nil
+}
+
+func (c checkpointRepository) GetExecutedGTIDs(ctx context.Context) (string, error) {
+	var gtidSet string
+	err := c.db.Writer(ctx).GetContext(ctx, &gtidSet, "SELECT @@GLOBAL.gtid_executed")
+	if err != nil {
+		return "", errors.Wrap(checkpointErrors.Translate(err), "failed to get executed gtids")
+	}
+
+	return gtidSet, nil
+}
+
+func (c checkpointRepository) GetColumns(ctx context.Context, schema string, table string) ([]string, error) {
+	var columns []string
+	err := c.db.Writer(ctx).SelectContext(
+		ctx,
+		&columns,
+		"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		schema, table,
+	)
+	if err != nil {
+		return nil, errors.Wrap(checkpointErrors.Translate(err), "failed to get columns")
+	}
+
+	return columns, nil
+}
@@ -1,10 +1,8 @@
 package mysql
 
 import (
-	"database/sql"
-
 	"github.com/antonpriyma/otus-highload/internal/app/models"
-	"github.com/go-sql-driver/mysql"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
 )
 
 type Post struct {
@@ -38,17 +36,12 @@ func convertPostsToModels(posts []Post) []models.Post {
 	return res
 }
 
-func convertSQLError(err error) error {
-	if mysqlError, ok := err.(*mysql.MySQLError); ok {
-		if mysqlError.Number == 1062 {
-			return models.ErrUserAlreadyExists
-		}
-	}
-
-	switch {
-	case err == sql.ErrNoRows:
-		return models.ErrPostNotFound
-	}
-
-	return err
+var sqlErrors = mysql_client.Errors{
+	NotFound: models.ErrPostNotFound,
+	Duplicates: map[string]error{
+		"post.PRIMARY": models.ErrPostAlreadyExists,
+	},
+	ForeignKeys: map[string]error{
+		"users": models.ErrUserNotFound,
+	},
 }
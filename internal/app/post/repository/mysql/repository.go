@@ -2,107 +2,169 @@ package mysql
 
 import (
 	"context"
+	"time"
+
 	"github.com/antonpriyma/otus-highload/internal/app/models"
+	notification_repo "github.com/antonpriyma/otus-highload/internal/app/notification/repository/mysql"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	redis_client "github.com/antonpriyma/otus-highload/pkg/clients/redis"
 	"github.com/antonpriyma/otus-highload/pkg/errors"
 	"github.com/antonpriyma/otus-highload/pkg/log"
-	"github.com/jmoiron/sqlx"
 	"github.com/redis/go-redis/v9"
 )
 
+// feedCacheSize is how many latest posts are cached per feed.
+const feedCacheSize = 1000
+
+// feedQuery selects posts of the friends of a user, deleted posts and posts
+// of deleted users are left out.
+const feedQuery = "SELECT BIN_TO_UUID(p.uuid) as uuid, BIN_TO_UUID(p.user_id) as user_id, p.text FROM post p " +
+	"INNER JOIN friends f ON ((p.user_id = f.user2  and f.user1 = UUID_TO_BIN(?))) or (p.user_id = f.user1  and f.user2 = UUID_TO_BIN(?)) " +
+	"INNER JOIN users u ON u.uuid = p.user_id " +
+	"WHERE p.deleted_at IS NULL AND u.deleted_at IS NULL"
+
 type postRepository struct {
-	db     *sqlx.DB
-	redis  *redis.Client
+	db     *mysql_client.Provider
+	redis  redis.UniversalClient
 	logger log.Logger
 }
 
-func (p postRepository) CreatePost(ctx context.Context, model models.Post) (models.PostID, error) {
+func (p postRepository) CreatePost(ctx context.Context, model models.Post, notifications []models.Notification) (models.PostID, error) {
 	post := convertModelToPost(model)
-	_, err := p.db.ExecContext(ctx, "INSERT INTO post (uuid, user_id, text) VALUES (UUID_TO_BIN(?), UUID_TO_BIN(?), ?)", post.UUID, post.UserID, post.Text)
+
+	err := p.db.InTx(ctx, func(ctx context.Context) error {
+		tx := p.db.Writer(ctx)
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO post (uuid, user_id, text) VALUES (UUID_TO_BIN(?), UUID_TO_BIN(?), ?)", post.UUID, post.UserID, post.Text)
+		if err != nil {
+			return errors.Wrap(sqlErrors.Translate(err), "failed to create post")
+		}
+
+		return notification_repo.WriteOutbox(ctx, tx, notifications)
+	})
 	if err != nil {
-		return "", errors.Wrap(convertSQLError(err), "failed to create post")
+		return "", err
 	}
 
 	return model.ID, nil
 }
 
+func (p postRepository) DeletePost(ctx context.Context, postID models.PostID, userID models.UserID) error {
+	res, err := p.db.Writer(ctx).ExecContext(
+		ctx,
+		"UPDATE post SET deleted_at = CURRENT_TIMESTAMP WHERE uuid = UUID_TO_BIN(?) AND user_id = UUID_TO_BIN(?) AND deleted_at IS NULL",
+		postID, userID,
+	)
+	if err != nil {
+		return errors.Wrap(sqlErrors.Translate(err), "failed to delete post")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get affected rows")
+	}
+	if affected == 0 {
+		return models.ErrPostNotFound
+	}
+
+	return nil
+}
+
 type Config struct {
-	DataSourceName string `mapstructure:"data_source_name"`
-	RedisAddr      string `mapstructure:"redis_addr"`
+	Redis redis_client.Config `mapstructure:"redis"`
+	// StartupTimeout bounds the ping of the feed cache on start.
+	StartupTimeout time.Duration `mapstructure:"startup_timeout"`
 }
 
-func NewPostRepository(cfg Config, logger log.Logger) (models.PostRepository, error) {
-	db, err := sqlx.Connect("mysql", cfg.DataSourceName)
+// NewPostRepository starts without the feed cache when Redis is down, feeds
+// are read from MySQL until it comes back.
+func NewPostRepository(cfg Config, db *mysql_client.Provider, logger log.Logger) (models.PostRepository, error) {
+	client, err := redis_client.NewClient(cfg.Redis)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to connect to mysql")
+		return nil, errors.Wrap(err, "failed to create redis client")
 	}
 
-	redis := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
+	timeout := cfg.StartupTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	res := redis.Ping(context.Background())
-	if res.Err() != nil {
-		return nil, errors.Wrap(res.Err(), "failed to connect to redis")
+	if err := client.Ping(ctx).Err(); err != nil {
+		logger.WithError(err).Warn("feed cache is unavailable, feeds are read from mysql")
 	}
+
 	return postRepository{
-		redis:  redis,
+		redis:  client,
 		db:     db,
 		logger: logger,
 	}, nil
 }
 
 func (p postRepository) GetFeed(ctx context.Context, userID string, limit int, offset int) ([]models.Post, error) {
-	ok := p.redis.Exists(ctx, userID).Val()
-
-	if ok == 1 && limit+offset < 1000 {
-		var posts []models.Post
-		var err error
-		if limit != -1 && offset != -1 {
-			err = p.redis.LRange(ctx, userID, int64(offset), int64(limit+offset)).ScanSlice(&posts)
-		} else {
-			err = p.redis.LRange(ctx, userID, 0, -1).ScanSlice(&posts)
-		}
-
+	if limit+offset < 1000 {
+		posts, ok, err := p.getCachedFeed(ctx, userID, limit, offset)
 		if err != nil {
-			return nil, err
+			p.logger.ForCtx(ctx).WithError(err).Warn("failed to read feed cache, falling back to mysql")
+		}
+		if ok {
+			return posts, nil
 		}
-
-		return posts, nil
 	}
+
 	var posts []Post
 	var err error
 	if limit != -1 {
-		err = p.db.SelectContext(ctx, &posts, "SELECT BIN_TO_UUID(uuid) as uuid, BIN_TO_UUID(user_id) as user_id, text FROM POST p INNER JOIN FRIENDS f ON ((p.user_id = f.user2  and f.user1 = UUID_TO_BIN(?))) or (p.user_id = f.user1  and f.user2 = UUID_TO_BIN(?)) LIMIT (?), (?)", userID, userID, offset, limit)
+		err = p.db.Reader(ctx, models.FriendsKey(models.UserID(userID))).SelectContext(ctx, &posts, feedQuery+" LIMIT (?), (?)", userID, userID, offset, limit)
 	} else {
-		err = p.db.SelectContext(ctx, &posts, "SELECT BIN_TO_UUID(uuid) as uuid, BIN_TO_UUID(user_id) as user_id, text FROM POST p INNER JOIN FRIENDS f ON ((p.user_id = f.user2  and f.user1 = UUID_TO_BIN(?))) or (p.user_id = f.user1  and f.user2 = UUID_TO_BIN(?))", userID, userID)
+		err = p.db.Reader(ctx, models.FriendsKey(models.UserID(userID))).SelectContext(ctx, &posts, feedQuery, userID, userID)
 	}
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get feed")
 	}
 
 	return convertPostsToModels(posts), nil
 }
 
-func (p postRepository) AddToCache(ctx context.Context, userID string, post models.Post) error {
-	marshalled, err := post.MarshalBinary()
-	if err != nil {
-		return err
+// getCachedFeed reports whether the feed of userID is cached.
+func (p postRepository) getCachedFeed(ctx context.Context, userID string, limit int, offset int) ([]models.Post, bool, error) {
+	exists, err := p.redis.Exists(ctx, userID).Result()
+	if err != nil || exists != 1 {
+		return nil, false, err
+	}
+
+	var posts []models.Post
+	if limit != -1 && offset != -1 {
+		err = p.redis.LRange(ctx, userID, int64(offset), int64(limit+offset)).ScanSlice(&posts)
+	} else {
+		err = p.redis.LRange(ctx, userID, 0, -1).ScanSlice(&posts)
 	}
-	err = p.redis.LPush(ctx, userID, marshalled).Err()
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 
-	// TODO: make it configurable
-	// Like lru cache
-	err = p.redis.LTrim(ctx, userID, 0, 1000).Err()
+	return posts, true, nil
+}
+
+// AddToCache removes an earlier copy of post in the same transaction, the
+// CDC consumer applies changes at least once.
+func (p postRepository) AddToCache(ctx context.Context, userID string, post models.Post) error {
+	marshalled, err := post.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = p.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, userID, 0, marshalled)
+		pipe.LPush(ctx, userID, marshalled)
+		// TODO: make it configurable
+		// Like lru cache
+		pipe.LTrim(ctx, userID, 0, feedCacheSize)
+		return nil
+	})
+
+	return err
 }
 
 func (p postRepository) GenerateCache(ctx context.Context, userID string) error {
@@ -128,3 +190,77 @@ func (p postRepository) GenerateCache(ctx context.Context, userID string) error
 
 	return nil
 }
+
+// cachedIndex returns the position of postID in the cached feed of userID
+// with its cached value, -1 when it is not cached.
+func (p postRepository) cachedIndex(ctx context.Context, userID string, postID models.PostID) (int64, string, error) {
+	values, err := p.redis.LRange(ctx, userID, 0, -1).Result()
+	if err != nil {
+		return -1, "", err
+	}
+
+	for i, value := range values {
+		var post models.Post
+		if err := post.UnmarshalBinary([]byte(value)); err != nil {
+			return -1, "", err
+		}
+		if post.ID == postID {
+			return int64(i), value, nil
+		}
+	}
+
+	return -1, "", nil
+}
+
+func (p postRepository) UpdateInCache(ctx context.Context, userID string, post models.Post) error {
+	i, _, err := p.cachedIndex(ctx, userID, post.ID)
+	if err != nil || i < 0 {
+		return err
+	}
+
+	marshalled, err := post.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return p.redis.LSet(ctx, userID, i, marshalled).Err()
+}
+
+func (p postRepository) RemoveFromCache(ctx context.Context, userID string, postID models.PostID) error {
+	i, value, err := p.cachedIndex(ctx, userID, postID)
+	if err != nil || i < 0 {
+		return err
+	}
+
+	return p.redis.LRem(ctx, userID, 0, value).Err()
+}
+
+// RebuildCache reads from the primary, it follows changes of the binlog
+// which replicas may not have applied yet.
+func (p postRepository) RebuildCache(ctx context.Context, userID string) error {
+	var posts []Post
+	err := p.db.Writer(ctx).SelectContext(ctx, &posts, feedQuery+" ORDER BY p.created_at DESC LIMIT ?", userID, userID, feedCacheSize)
+	if err != nil {
+		return errors.Wrap(sqlErrors.Translate(err), "failed to get feed")
+	}
+
+	values := make([]interface{}, 0, len(posts))
+	for _, post := range convertPostsToModels(posts) {
+		marshalled, err := post.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		values = append(values, marshalled)
+	}
+
+	// the newest post is the head of the list, as with AddToCache
+	_, err = p.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, userID)
+		if len(values) > 0 {
+			pipe.RPush(ctx, userID, values...)
+		}
+		return nil
+	})
+
+	return err
+}
@@ -2,44 +2,109 @@ package usecase
 
 import (
 	"context"
-	"github.com/antonpriyma/otus-highload/internal/app/post/notifer"
 	"github.com/antonpriyma/otus-highload/pkg/errors"
 
 	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
 	"github.com/antonpriyma/otus-highload/pkg/log"
 )
 
+type FeedCacheUpdates string
+
+const (
+	// FeedCacheUpdatesApp pushes posts to the feed caches of friends on CreatePost.
+	FeedCacheUpdatesApp FeedCacheUpdates = "app"
+	// FeedCacheUpdatesCDC leaves the feed caches to cmd/feed-cdc, which
+	// follows the binlog.
+	FeedCacheUpdatesCDC FeedCacheUpdates = "cdc"
+)
+
+type Config struct {
+	FeedCacheUpdates FeedCacheUpdates `mapstructure:"feed_cache_updates"`
+}
+
 type postUsecase struct {
-	posts    models.PostRepository
-	users    models.UserRepository
-	Notifier notifer.Notifer
-	logger   log.Logger
+	cfg    Config
+	posts  models.PostRepository
+	users  models.UserRepository
+	tx     models.TxManager
+	logger log.Logger
 }
 
 func (p postUsecase) CreatePost(ctx context.Context, post models.Post) (models.PostID, error) {
-	postID, err := p.posts.CreatePost(ctx, post)
+	var (
+		friendsList []models.UserID
+		postID      models.PostID
+	)
+	// the friends list is read in the transaction of the post, the whole fan-out is one unit of work
+	err := p.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		friendsList, err = p.users.GetFriends(ctx, post.UserID)
+		if err != nil {
+			return errors.Wrap(err, "failed to get friends list")
+		}
+
+		notifications := make([]models.Notification, 0, len(friendsList))
+		for _, friend := range friendsList {
+			notification, err := models.NewNotification(models.NotificationPostCreated, post.UserID, friend, models.PostCreatedPayload{Post: post})
+			if err != nil {
+				return err
+			}
+			notifications = append(notifications, notification)
+		}
+
+		// notifications go to the outbox with the post and are published by the relay
+		postID, err = p.posts.CreatePost(ctx, post, notifications)
+		return errors.Wrap(err, "failed to create post")
+	})
 	if err != nil {
-		return "", errors.Wrap(err, "failed to create post")
+		return "", err
 	}
 
-	friendsList, err := p.users.GetFriends(ctx, post.UserID)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to get friends list")
+	if p.cfg.FeedCacheUpdates == FeedCacheUpdatesCDC {
+		return postID, nil
 	}
 
+	// the post is committed at this point, a stale feed cache must not fail the request
 	for _, friend := range friendsList {
 		err = p.posts.AddToCache(ctx, string(friend), post)
 		if err != nil {
-			return "", errors.Wrap(err, "failed to add to cache")
+			p.logger.ForCtx(ctx).WithError(err).WithField("user_id", friend).Warn("failed to add post to feed cache")
 		}
+	}
+
+	return postID, nil
+}
 
-		err = p.Notifier.Notify(ctx, post, friend)
+func (p postUsecase) DeletePost(ctx context.Context, postID models.PostID) error {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	err := p.posts.DeletePost(ctx, postID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete post")
+	}
+
+	if p.cfg.FeedCacheUpdates == FeedCacheUpdatesCDC {
+		return nil
+	}
+
+	friendsList, err := p.users.GetFriends(ctx, userID)
+	if err != nil {
+		p.logger.ForCtx(ctx).WithError(err).Warn("failed to get friends list, deleted post stays in feed caches")
+		return nil
+	}
+
+	for _, friend := range friendsList {
+		err = p.posts.RemoveFromCache(ctx, string(friend), postID)
 		if err != nil {
-			return "", errors.Wrap(err, "failed to notify")
+			p.logger.ForCtx(ctx).WithError(err).WithField("user_id", friend).Warn("failed to remove post from feed cache")
 		}
 	}
 
-	return postID, nil
+	return nil
 }
 
 func (p postUsecase) GetFeed(ctx context.Context, userID models.UserID, limit int, offset int) ([]models.Post, error) {
@@ -51,11 +116,20 @@ func (p postUsecase) GetFeed(ctx context.Context, userID models.UserID, limit in
 	return posts, nil
 }
 
-func NewPostUsecase(posts models.PostRepository, users models.UserRepository, notifier notifer.Notifer, logger log.Logger) models.PostUsecase {
-	return postUsecase{
-		posts:    posts,
-		logger:   logger,
-		users:    users,
-		Notifier: notifier,
+func NewPostUsecase(cfg Config, posts models.PostRepository, users models.UserRepository, tx models.TxManager, logger log.Logger) (models.PostUsecase, error) {
+	switch cfg.FeedCacheUpdates {
+	case "":
+		cfg.FeedCacheUpdates = FeedCacheUpdatesApp
+	case FeedCacheUpdatesApp, FeedCacheUpdatesCDC:
+	default:
+		return nil, errors.Errorf("unknown feed cache updates %q", cfg.FeedCacheUpdates)
 	}
+
+	return postUsecase{
+		cfg:    cfg,
+		posts:  posts,
+		logger: logger,
+		users:  users,
+		tx:     tx,
+	}, nil
 }
@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePosts keeps the outbox and feed caches in memory.
+type fakePosts struct {
+	models.PostRepository
+
+	outbox []models.Notification
+	caches map[string][]models.PostID
+}
+
+func (f *fakePosts) CreatePost(_ context.Context, post models.Post, notifications []models.Notification) (models.PostID, error) {
+	f.outbox = append(f.outbox, notifications...)
+
+	return post.ID, nil
+}
+
+func (f *fakePosts) AddToCache(_ context.Context, userID string, post models.Post) error {
+	f.caches[userID] = append(f.caches[userID], post.ID)
+
+	return nil
+}
+
+type fakeUsers struct {
+	models.UserRepository
+
+	friends map[models.UserID][]models.UserID
+}
+
+func (f fakeUsers) GetFriends(_ context.Context, userID models.UserID) ([]models.UserID, error) {
+	return f.friends[userID], nil
+}
+
+type noTx struct{}
+
+func (noTx) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestCreatePostNotifiesFriends(t *testing.T) {
+	ctx := context.Background()
+
+	for _, updates := range []FeedCacheUpdates{FeedCacheUpdatesApp, FeedCacheUpdatesCDC} {
+		t.Run(string(updates), func(t *testing.T) {
+			posts := &fakePosts{caches: make(map[string][]models.PostID)}
+			users := fakeUsers{friends: map[models.UserID][]models.UserID{"alice": {"bob", "carol"}}}
+
+			u, err := NewPostUsecase(Config{FeedCacheUpdates: updates}, posts, users, noTx{}, log.Null)
+			require.NoError(t, err)
+
+			post := models.Post{ID: "p1", UserID: "alice", Text: "hello"}
+			postID, err := u.CreatePost(ctx, post)
+			require.NoError(t, err)
+			require.Equal(t, post.ID, postID)
+
+			if updates == FeedCacheUpdatesApp {
+				require.Equal(t, map[string][]models.PostID{"bob": {"p1"}, "carol": {"p1"}}, posts.caches)
+			} else {
+				require.Empty(t, posts.caches)
+			}
+
+			// the post and its notifications are written together, one per friend
+			require.Len(t, posts.outbox, 2)
+			for i, target := range []models.UserID{"bob", "carol"} {
+				notification := posts.outbox[i]
+				require.Equal(t, target, notification.Target)
+				require.Equal(t, models.NotificationPostCreated, notification.Type)
+				require.Equal(t, models.UserID("alice"), notification.Actor)
+
+				var payload models.PostCreatedPayload
+				require.NoError(t, json.Unmarshal(notification.Payload, &payload))
+				require.Equal(t, post, payload.Post)
+			}
+		})
+	}
+}
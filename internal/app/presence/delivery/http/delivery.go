@@ -0,0 +1,44 @@
+package http
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/echo/echoerrors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type presenceDelivery struct {
+	usecase models.PresenceUsecase
+	logger  log.Logger
+}
+
+func NewPresenceDelivery(usecase models.PresenceUsecase, logger log.Logger) models.PresenceDelivery {
+	return presenceDelivery{
+		usecase: usecase,
+		logger:  logger,
+	}
+}
+
+func (p presenceDelivery) GetPresence(ctx context.Context, ids []models.UserID) ([]models.Presence, error) {
+	presence, err := p.usecase.GetPresence(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(convertPresenceError(err), "failed to get presence")
+	}
+
+	return presence, nil
+}
+
+func convertPresenceError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrTooManyPresenceIDs):
+		return echoerrors.ValidationError(err, "too many ids", echoerrors.ValidationErrorFields{"ids": echoerrors.FieldInvalid})
+	case errors.Is(err, models.ErrUnauthorized):
+		return echoerrors.UnauthorizedError(err, echoerrors.ReasonAuthError, "unauthorized")
+	case errors.Is(err, errors.ErrUnavailable):
+		return echoerrors.ServiceUnavailableError(err)
+	default:
+		return echoerrors.InternalError(err)
+	}
+}
@@ -0,0 +1,202 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	redis_client "github.com/antonpriyma/otus-highload/pkg/clients/redis"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+type Config struct {
+	Redis redis_client.Config `mapstructure:"redis"`
+	// KeyTTL is how long last seen time is kept.
+	KeyTTL time.Duration `mapstructure:"key_ttl"`
+}
+
+// Connections of a user are a sorted set scored by expiry in unix ms, so that
+// expired devices drop out on their own. Keys of one user share a hash
+// tag and stay in one cluster slot for the scripts.
+func connectionsKey(userID models.UserID) string {
+	return "presence:{" + string(userID) + "}"
+}
+
+func lastSeenKey(userID models.UserID) string {
+	return "presence:{" + string(userID) + "}:last_seen"
+}
+
+// expiryKey scores users by the expiry of their latest connection, so that
+// users whose connections expired without a disconnect can be found.
+const expiryKey = "presence:expiry"
+
+// KEYS: connections, last seen; ARGV: conn, now ms, expiry ms, connections ttl ms, last seen ttl ms.
+// Returns live connections before the touch. Last seen is kept up to date on
+// every heartbeat, so it is right for connections that expire without a disconnect.
+var touchScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local before = redis.call('ZCARD', KEYS[1])
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[5])
+return before
+`)
+
+// KEYS: expiry; ARGV: now ms, limit.
+// Pops users whose latest connection expired, so that every instance sweeping gets other users.
+var popExpiredScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #ids > 0 then
+	redis.call('ZREM', KEYS[1], unpack(ids))
+end
+return ids
+`)
+
+// KEYS: connections, last seen; ARGV: conn, now ms, key ttl ms.
+// Returns 1 if conn was the last live connection.
+var removeScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+redis.call('ZREM', KEYS[1], ARGV[1])
+if score and redis.call('ZCARD', KEYS[1]) == 0 then
+	redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0
+`)
+
+type presenceRepository struct {
+	cfg    Config
+	redis  redis.UniversalClient
+	logger log.Logger
+}
+
+func NewPresenceRepository(cfg Config, logger log.Logger) (models.PresenceRepository, error) {
+	if cfg.KeyTTL <= 0 {
+		cfg.KeyTTL = 30 * 24 * time.Hour
+	}
+
+	client, err := redis_client.NewClient(cfg.Redis)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create redis client")
+	}
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to redis")
+	}
+
+	return presenceRepository{
+		cfg:    cfg,
+		redis:  client,
+		logger: logger,
+	}, nil
+}
+
+func (p presenceRepository) Touch(ctx context.Context, userID models.UserID, conn models.ConnectionID, expiresAt time.Time) (bool, error) {
+	before, err := touchScript.Run(
+		ctx, p.redis,
+		[]string{connectionsKey(userID), lastSeenKey(userID)},
+		string(conn), time.Now().UnixMilli(), expiresAt.UnixMilli(), time.Until(expiresAt).Milliseconds(), p.cfg.KeyTTL.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to touch presence")
+	}
+
+	err = p.redis.ZAddArgs(ctx, expiryKey, redis.ZAddArgs{
+		GT:      true,
+		Members: []redis.Z{{Score: float64(expiresAt.UnixMilli()), Member: string(userID)}},
+	}).Err()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to track presence expiry")
+	}
+
+	return before == 0, nil
+}
+
+func (p presenceRepository) Remove(ctx context.Context, userID models.UserID, conn models.ConnectionID) (bool, error) {
+	last, err := removeScript.Run(
+		ctx, p.redis,
+		[]string{connectionsKey(userID), lastSeenKey(userID)},
+		string(conn), time.Now().UnixMilli(), p.cfg.KeyTTL.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to remove presence")
+	}
+
+	if last == 1 {
+		// friends are told now, the sweeper has nothing to report
+		if err := p.redis.ZRem(ctx, expiryKey, string(userID)).Err(); err != nil {
+			p.logger.ForCtx(ctx).WithError(err).Warn("failed to untrack presence expiry")
+		}
+	}
+
+	return last == 1, nil
+}
+
+func (p presenceRepository) PopExpired(ctx context.Context, now time.Time, limit int) ([]models.Presence, error) {
+	ids, err := popExpiredScript.Run(ctx, p.redis, []string{expiryKey}, now.UnixMilli(), limit).StringSlice()
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed to pop expired presence")
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	userIDs := make([]models.UserID, 0, len(ids))
+	for _, id := range ids {
+		userIDs = append(userIDs, models.UserID(id))
+	}
+
+	// a connection made after the expiry keeps the user online
+	presence, err := p.GetPresence(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := presence[:0]
+	for _, userPresence := range presence {
+		if !userPresence.Online {
+			res = append(res, userPresence)
+		}
+	}
+
+	return res, nil
+}
+
+func (p presenceRepository) GetPresence(ctx context.Context, ids []models.UserID) ([]models.Presence, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	devices := make([]*redis.IntCmd, 0, len(ids))
+	lastSeen := make([]*redis.StringCmd, 0, len(ids))
+	_, err := p.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			devices = append(devices, pipe.ZCount(ctx, connectionsKey(id), "("+now, "+inf"))
+			lastSeen = append(lastSeen, pipe.Get(ctx, lastSeenKey(id)))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed to get presence")
+	}
+
+	res := make([]models.Presence, 0, len(ids))
+	for i, id := range ids {
+		presence := models.Presence{
+			UserID:  id,
+			Devices: int(devices[i].Val()),
+		}
+		presence.Online = presence.Devices > 0
+
+		if ms, err := lastSeen[i].Int64(); err == nil && !presence.Online {
+			at := time.UnixMilli(ms).UTC()
+			presence.LastSeenAt = &at
+		}
+
+		res = append(res, presence)
+	}
+
+	return res, nil
+}
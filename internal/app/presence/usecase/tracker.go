@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+// disconnectTimeout bounds the disconnect made after the request context is gone.
+const disconnectTimeout = 5 * time.Second
+
+// Track connects conn and heartbeats it every interval until the returned
+// stop is called, which disconnects it. Presence errors are logged only:
+// they must not break notification delivery.
+func Track(
+	ctx context.Context,
+	presence models.PresenceUsecase,
+	cfg Config,
+	userID models.UserID,
+	conn models.ConnectionID,
+	logger log.Logger,
+) (stop func()) {
+	cfg = cfg.withDefaults()
+
+	if err := presence.Connect(ctx, userID, conn); err != nil {
+		logger.WithError(err).Warn("failed to connect presence")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(cfg.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := presence.Heartbeat(ctx, userID, conn); err != nil {
+					logger.WithError(err).Warn("failed to heartbeat presence")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+
+		ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+		defer cancel()
+
+		if err := presence.Disconnect(ctx, userID, conn); err != nil {
+			logger.WithError(err).Warn("failed to disconnect presence")
+		}
+	}
+}
+
+// Sweep calls NotifyExpired every cfg.SweepInterval until ctx is done.
+// Any number of instances may sweep, every expired user is notified once.
+func Sweep(ctx context.Context, presence models.PresenceUsecase, cfg Config, logger log.Logger) {
+	cfg = cfg.withDefaults()
+
+	ticker := time.NewTicker(cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := presence.NotifyExpired(ctx); err != nil {
+				logger.WithError(err).Warn("failed to notify expired presence")
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/pkg/contextlib"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+type Config struct {
+	// TTL is how long a connection stays online without heartbeats.
+	TTL time.Duration `mapstructure:"ttl"`
+	// HeartbeatInterval must be well below TTL.
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// MaxIDs bounds ids of one presence request.
+	MaxIDs int `mapstructure:"max_ids"`
+	// SweepInterval is how often connections expired without a disconnect are
+	// looked for, it bounds how late friends learn about them.
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`
+}
+
+// sweepBatch is how many expired users are notified at once.
+const sweepBatch = 100
+
+func (c Config) withDefaults() Config {
+	if c.TTL <= 0 {
+		c.TTL = time.Minute
+	}
+	if c.HeartbeatInterval <= 0 {
+		c.HeartbeatInterval = c.TTL / 3
+	}
+	if c.MaxIDs <= 0 {
+		c.MaxIDs = 100
+	}
+	if c.SweepInterval <= 0 {
+		c.SweepInterval = c.HeartbeatInterval
+	}
+
+	return c
+}
+
+type presenceUsecase struct {
+	cfg         Config
+	presence    models.PresenceRepository
+	users       models.UserRepository
+	preferences models.NotificationPreferencesRepository
+	notifier    models.Notifier
+	logger      log.Logger
+}
+
+// NewPresenceUsecase pushes presence changes to friends through notifier
+// directly: they are live only and are neither kept in inboxes nor retried.
+func NewPresenceUsecase(
+	cfg Config,
+	presence models.PresenceRepository,
+	users models.UserRepository,
+	preferences models.NotificationPreferencesRepository,
+	notifier models.Notifier,
+	logger log.Logger,
+) models.PresenceUsecase {
+	return presenceUsecase{
+		cfg:         cfg.withDefaults(),
+		presence:    presence,
+		users:       users,
+		preferences: preferences,
+		notifier:    notifier,
+		logger:      logger,
+	}
+}
+
+func (p presenceUsecase) GetPresence(ctx context.Context, ids []models.UserID) ([]models.Presence, error) {
+	userID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return nil, models.ErrUnauthorized
+	}
+
+	if len(ids) > p.cfg.MaxIDs {
+		return nil, models.ErrTooManyPresenceIDs
+	}
+
+	friends, err := p.users.GetFriends(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get friends")
+	}
+
+	visible := make(map[models.UserID]struct{}, len(friends)+1)
+	visible[userID] = struct{}{}
+	for _, friend := range friends {
+		visible[friend] = struct{}{}
+	}
+
+	allowed := make([]models.UserID, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := visible[id]; ok {
+			allowed = append(allowed, id)
+			// duplicates are answered once
+			delete(visible, id)
+		}
+	}
+	if len(allowed) == 0 {
+		return []models.Presence{}, nil
+	}
+
+	presence, err := p.presence.GetPresence(ctx, allowed)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get presence")
+	}
+
+	return presence, nil
+}
+
+func (p presenceUsecase) Connect(ctx context.Context, userID models.UserID, conn models.ConnectionID) error {
+	return p.touch(ctx, userID, conn)
+}
+
+func (p presenceUsecase) Heartbeat(ctx context.Context, userID models.UserID, conn models.ConnectionID) error {
+	// a heartbeat after all connections expired brings the user back online
+	return p.touch(ctx, userID, conn)
+}
+
+func (p presenceUsecase) Disconnect(ctx context.Context, userID models.UserID, conn models.ConnectionID) error {
+	wentOffline, err := p.presence.Remove(ctx, userID, conn)
+	if err != nil {
+		return errors.Wrap(err, "failed to remove connection")
+	}
+
+	if wentOffline {
+		now := time.Now().UTC()
+		return p.notifyFriends(ctx, userID, models.PresenceChangedPayload{Online: false, LastSeenAt: &now})
+	}
+
+	return nil
+}
+
+func (p presenceUsecase) NotifyExpired(ctx context.Context) error {
+	var lastErr error
+	for {
+		expired, err := p.presence.PopExpired(ctx, time.Now(), sweepBatch)
+		if err != nil {
+			return errors.Wrap(err, "failed to pop expired presence")
+		}
+
+		for _, presence := range expired {
+			err := p.notifyFriends(ctx, presence.UserID, models.PresenceChangedPayload{Online: false, LastSeenAt: presence.LastSeenAt})
+			if err != nil {
+				lastErr = err
+			}
+		}
+
+		if len(expired) < sweepBatch {
+			return lastErr
+		}
+	}
+}
+
+func (p presenceUsecase) touch(ctx context.Context, userID models.UserID, conn models.ConnectionID) error {
+	cameOnline, err := p.presence.Touch(ctx, userID, conn, time.Now().Add(p.cfg.TTL))
+	if err != nil {
+		return errors.Wrap(err, "failed to touch connection")
+	}
+
+	if cameOnline {
+		return p.notifyFriends(ctx, userID, models.PresenceChangedPayload{Online: true})
+	}
+
+	return nil
+}
+
+func (p presenceUsecase) notifyFriends(ctx context.Context, userID models.UserID, payload models.PresenceChangedPayload) error {
+	friends, err := p.users.GetFriends(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get friends")
+	}
+
+	notifications := make([]models.Notification, 0, len(friends))
+	for _, friend := range friends {
+		notification, err := models.NewNotification(models.NotificationPresenceChanged, userID, friend, payload)
+		if err != nil {
+			return err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	notifications, err = p.preferences.FilterDisabled(ctx, notifications)
+	if err != nil {
+		return errors.Wrap(err, "failed to filter disabled notifications")
+	}
+
+	var lastErr error
+	for _, notification := range notifications {
+		if err := p.notifier.Notify(ctx, notification); err != nil {
+			lastErr = errors.Wrapf(err, "failed to notify %s", notification.Target)
+		}
+	}
+
+	return lastErr
+}
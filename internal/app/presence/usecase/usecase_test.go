@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/internal/app/notification/notifer"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePresence keeps connection expiries, like the sorted sets of the redis repository.
+type fakePresence struct {
+	models.PresenceRepository
+
+	conns map[models.UserID]map[models.ConnectionID]time.Time
+}
+
+func (f *fakePresence) live(userID models.UserID, now time.Time) int {
+	n := 0
+	for _, expiresAt := range f.conns[userID] {
+		if expiresAt.After(now) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (f *fakePresence) Touch(_ context.Context, userID models.UserID, conn models.ConnectionID, expiresAt time.Time) (bool, error) {
+	before := f.live(userID, time.Now())
+	if f.conns[userID] == nil {
+		f.conns[userID] = make(map[models.ConnectionID]time.Time)
+	}
+	f.conns[userID][conn] = expiresAt
+
+	return before == 0, nil
+}
+
+func (f *fakePresence) Remove(_ context.Context, userID models.UserID, conn models.ConnectionID) (bool, error) {
+	_, ok := f.conns[userID][conn]
+	delete(f.conns[userID], conn)
+
+	last := ok && f.live(userID, time.Now()) == 0
+	if last {
+		delete(f.conns, userID)
+	}
+
+	return last, nil
+}
+
+func (f *fakePresence) PopExpired(_ context.Context, now time.Time, limit int) ([]models.Presence, error) {
+	var res []models.Presence
+	for userID := range f.conns {
+		if len(res) < limit && f.live(userID, now) == 0 {
+			lastSeen := now.UTC()
+			res = append(res, models.Presence{UserID: userID, LastSeenAt: &lastSeen})
+			delete(f.conns, userID)
+		}
+	}
+
+	return res, nil
+}
+
+// expire makes connections of userID expire without a disconnect.
+func (f *fakePresence) expire(userID models.UserID) {
+	for conn := range f.conns[userID] {
+		f.conns[userID][conn] = time.Now().Add(-time.Second)
+	}
+}
+
+type fakeUsers struct {
+	models.UserRepository
+
+	friends map[models.UserID][]models.UserID
+}
+
+func (f fakeUsers) GetFriends(_ context.Context, userID models.UserID) ([]models.UserID, error) {
+	return f.friends[userID], nil
+}
+
+type fakePreferences struct {
+	models.NotificationPreferencesRepository
+}
+
+func (fakePreferences) FilterDisabled(_ context.Context, notifications []models.Notification) ([]models.Notification, error) {
+	return notifications, nil
+}
+
+// changes returns presence changes already delivered to sub.
+func changes(t *testing.T, sub notifer.Subscription) []models.PresenceChangedPayload {
+	var res []models.PresenceChangedPayload
+	for {
+		select {
+		case notification := <-sub.Notifications():
+			require.Equal(t, models.NotificationPresenceChanged, notification.Type)
+			require.Equal(t, models.UserID("alice"), notification.Actor)
+
+			var payload models.PresenceChangedPayload
+			require.NoError(t, json.Unmarshal(notification.Payload, &payload))
+			res = append(res, payload)
+		default:
+			return res
+		}
+	}
+}
+
+func TestPresenceChanges(t *testing.T) {
+	ctx := context.Background()
+	presence := &fakePresence{conns: make(map[models.UserID]map[models.ConnectionID]time.Time)}
+	notifier := notifer.NewMemoryNotifier(0)
+
+	bob, err := notifier.Subscribe(ctx, "bob")
+	require.NoError(t, err)
+	defer bob.Close()
+
+	u := NewPresenceUsecase(Config{TTL: time.Minute}, presence, fakeUsers{
+		friends: map[models.UserID][]models.UserID{"alice": {"bob"}},
+	}, fakePreferences{}, notifier, log.Null)
+
+	// the first device brings alice online, the second one changes nothing
+	require.NoError(t, u.Connect(ctx, "alice", "phone"))
+	require.NoError(t, u.Connect(ctx, "alice", "laptop"))
+	require.Equal(t, []models.PresenceChangedPayload{{Online: true}}, changes(t, bob))
+
+	require.NoError(t, u.Disconnect(ctx, "alice", "laptop"))
+	require.NoError(t, u.NotifyExpired(ctx))
+	require.Empty(t, changes(t, bob))
+
+	// the phone is lost without a disconnect
+	presence.expire("alice")
+	require.NoError(t, u.NotifyExpired(ctx))
+
+	offline := changes(t, bob)
+	require.Len(t, offline, 1)
+	require.False(t, offline[0].Online)
+	require.NotNil(t, offline[0].LastSeenAt)
+
+	// a late disconnect and the next sweep do not repeat it
+	require.NoError(t, u.Disconnect(ctx, "alice", "phone"))
+	require.NoError(t, u.NotifyExpired(ctx))
+	require.Empty(t, changes(t, bob))
+}
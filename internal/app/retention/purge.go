@@ -0,0 +1,165 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor/batchgetter"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+)
+
+const taskType = "retention_purge"
+
+type Config struct {
+	// Days is how long soft-deleted rows are kept, zero keeps them forever.
+	Days Days `mapstructure:"days"`
+	// BatchSize bounds rows removed by one statement.
+	BatchSize int `mapstructure:"batch_size"`
+	// Interval is how long an entity with nothing left to purge is not
+	// looked at.
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+type Days struct {
+	Users    int `mapstructure:"users"`
+	Posts    int `mapstructure:"posts"`
+	Messages int `mapstructure:"messages"`
+}
+
+type purgeStat struct {
+	Purged stat.CounterCtor `labels:"entity"`
+	Failed stat.CounterCtor `labels:"entity,status"`
+}
+
+type entity struct {
+	name  string
+	days  int
+	purge func(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// Purger hard-deletes soft-deleted rows older than their retention. Each
+// task removes one batch of an entity, entities are purged batch by batch
+// until none is left and then rest for Interval.
+type Purger struct {
+	cfg      Config
+	entities []entity
+	logger   log.Logger
+	Stat     purgeStat
+
+	// now is replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	idleUntil map[string]time.Time
+}
+
+func NewPurger(cfg Config, retention models.RetentionRepository, registry stat.Registry, logger log.Logger) processor.TaskGetter {
+	return batchgetter.New(newPurger(cfg, retention, registry, logger))
+}
+
+func newPurger(cfg Config, retention models.RetentionRepository, registry stat.Registry, logger log.Logger) *Purger {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Minute
+	}
+
+	p := &Purger{
+		cfg: cfg,
+		entities: []entity{
+			{name: "messages", days: cfg.Days.Messages, purge: retention.PurgeMessages},
+			{name: "posts", days: cfg.Days.Posts, purge: retention.PurgePosts},
+			{name: "users", days: cfg.Days.Users, purge: retention.PurgeUsers},
+		},
+		logger:    logger,
+		now:       time.Now,
+		idleUntil: make(map[string]time.Time),
+	}
+	stat.NewRegistrar(registry.ForSubsystem("retention_purge")).MustRegister(&p.Stat)
+
+	return p
+}
+
+func (p *Purger) GetBatch(_ context.Context) ([]processor.Task, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+
+	var tasks []processor.Task
+	for _, e := range p.entities {
+		if e.days <= 0 || now.Before(p.idleUntil[e.name]) {
+			continue
+		}
+
+		tasks = append(tasks, &task{
+			purger: p,
+			entity: e,
+			before: now.Add(-time.Duration(e.days) * 24 * time.Hour),
+		})
+	}
+
+	return tasks, nil
+}
+
+func (p *Purger) rest(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.idleUntil[name] = p.now().Add(p.cfg.Interval)
+}
+
+type task struct {
+	purger *Purger
+	entity entity
+	before time.Time
+
+	purged int64
+}
+
+func (t *task) Process(ctx context.Context) error {
+	purged, err := t.entity.purge(ctx, t.before, t.purger.cfg.BatchSize)
+	if err != nil {
+		t.purger.Stat.Failed.Counter(ctx).WithLabels(stat.Labels{
+			"entity": t.entity.name,
+			"status": stat.TypedErrorLabel(ctx, err),
+		}).Add(1)
+		return errors.Wrapf(err, "failed to purge %s", t.entity.name)
+	}
+
+	t.purged = purged
+	t.purger.Stat.Purged.Counter(ctx).WithLabels(stat.Labels{"entity": t.entity.name}).Add(float64(purged))
+
+	return nil
+}
+
+func (t *task) Ack(_ context.Context) error {
+	return nil
+}
+
+// Delete is never requested: failed batches are retried after Interval.
+func (t *task) Delete(_ context.Context) error {
+	return nil
+}
+
+// Defer lets the entity rest once a batch came out short, failed ones
+// included, so that a broken database is not hammered.
+func (t *task) Defer(_ context.Context) {
+	if t.purged < int64(t.purger.cfg.BatchSize) {
+		t.purger.rest(t.entity.name)
+	}
+}
+
+func (t *task) Key() string {
+	return t.entity.name
+}
+
+func (t *task) Type() string {
+	return taskType
+}
@@ -0,0 +1,83 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/framework/processor"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRetention has messages rows to purge, posts fail.
+type fakeRetention struct {
+	messages int64
+	before   []time.Time
+}
+
+func (f *fakeRetention) PurgeMessages(_ context.Context, before time.Time, limit int) (int64, error) {
+	f.before = append(f.before, before)
+
+	n := f.messages
+	if n > int64(limit) {
+		n = int64(limit)
+	}
+	f.messages -= n
+
+	return n, nil
+}
+
+func (f *fakeRetention) PurgePosts(context.Context, time.Time, int) (int64, error) {
+	return 0, errors.New("purge failed")
+}
+
+func (f *fakeRetention) PurgeUsers(context.Context, time.Time, int) (int64, error) {
+	panic("users are kept forever")
+}
+
+func run(ctx context.Context, tasks []processor.Task) {
+	for _, task := range tasks {
+		if err := task.Process(ctx); err == nil {
+			_ = task.Ack(ctx)
+		}
+		task.Defer(ctx)
+	}
+}
+
+func TestPurgerBatches(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	retention := &fakeRetention{messages: 15}
+
+	p := newPurger(Config{
+		Days:      Days{Messages: 30, Posts: 7},
+		BatchSize: 10,
+		Interval:  time.Hour,
+	}, retention, stub.NewStubRegistry(), log.Null)
+	p.now = func() time.Time { return now }
+
+	tasks, err := p.GetBatch(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+	run(ctx, tasks)
+	require.Equal(t, []time.Time{now.Add(-30 * 24 * time.Hour)}, retention.before)
+
+	// the full batch of messages is followed by another, failed posts rest
+	tasks, err = p.GetBatch(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	run(ctx, tasks)
+	require.Zero(t, retention.messages)
+
+	tasks, err = p.GetBatch(ctx)
+	require.NoError(t, err)
+	require.Empty(t, tasks)
+
+	now = now.Add(time.Hour)
+	tasks, err = p.GetBatch(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+}
@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/jmoiron/sqlx"
+)
+
+// userReferences delete the rows referencing purged users, tables with ON
+// DELETE CASCADE are left to MySQL. Hidden messages go first, messages of
+// the users take the marks of others along.
+var userReferences = []string{
+	"DELETE FROM hidden_messages WHERE user_uuid IN (?) LIMIT ?",
+	"DELETE FROM messages WHERE sender_uuid IN (?) LIMIT ?",
+	"DELETE FROM messages WHERE receiver_uuid IN (?) LIMIT ?",
+	"DELETE FROM chat_group_members WHERE user_uuid IN (?) LIMIT ?",
+	"DELETE FROM blocked_users WHERE user_uuid IN (?) LIMIT ?",
+	"DELETE FROM blocked_users WHERE blocked_uuid IN (?) LIMIT ?",
+	"DELETE FROM friends WHERE user1 IN (?) LIMIT ?",
+	"DELETE FROM friends WHERE user2 IN (?) LIMIT ?",
+	"DELETE FROM post WHERE user_id IN (?) LIMIT ?",
+}
+
+// retentionRepository runs every statement on its own, so that no lock is
+// held longer than one batch. An interrupted purge is resumed by the next
+// call, which finds the same rows.
+type retentionRepository struct {
+	db     *mysql_client.Provider
+	logger log.Logger
+}
+
+func NewRetentionRepository(db *mysql_client.Provider, logger log.Logger) models.RetentionRepository {
+	return retentionRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r retentionRepository) PurgeMessages(ctx context.Context, before time.Time, limit int) (int64, error) {
+	n, err := r.exec(ctx, "DELETE FROM messages WHERE deleted_at < ? ORDER BY deleted_at LIMIT ?", before, limit)
+	return n, errors.Wrap(err, "failed to purge messages")
+}
+
+func (r retentionRepository) PurgePosts(ctx context.Context, before time.Time, limit int) (int64, error) {
+	n, err := r.exec(ctx, "DELETE FROM post WHERE deleted_at < ? ORDER BY deleted_at LIMIT ?", before, limit)
+	return n, errors.Wrap(err, "failed to purge posts")
+}
+
+func (r retentionRepository) PurgeUsers(ctx context.Context, before time.Time, limit int) (int64, error) {
+	var users [][]byte
+	err := r.db.Writer(ctx).SelectContext(
+		ctx,
+		&users,
+		"SELECT uuid FROM users u WHERE deleted_at < ? AND NOT EXISTS (SELECT 1 FROM chat_groups g WHERE g.owner_uuid = u.uuid) ORDER BY deleted_at LIMIT ?",
+		before, limit,
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to select users to purge")
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	for _, statement := range userReferences {
+		if err := r.execAll(ctx, statement, users, limit); err != nil {
+			return 0, errors.Wrap(err, "failed to purge rows of users")
+		}
+	}
+
+	n, err := r.execIn(ctx, "DELETE FROM users WHERE uuid IN (?) AND deleted_at < ?", users, before)
+	return n, errors.Wrap(err, "failed to purge users")
+}
+
+// execAll repeats statement until it removes less than limit rows.
+func (r retentionRepository) execAll(ctx context.Context, statement string, users [][]byte, limit int) error {
+	for {
+		n, err := r.execIn(ctx, statement, users, limit)
+		if err != nil {
+			return err
+		}
+		if n < int64(limit) {
+			return nil
+		}
+	}
+}
+
+func (r retentionRepository) execIn(ctx context.Context, statement string, args ...interface{}) (int64, error) {
+	query, args, err := sqlx.In(statement, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to build query")
+	}
+
+	return r.exec(ctx, query, args...)
+}
+
+func (r retentionRepository) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	res, err := r.db.Writer(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get affected rows")
+	}
+
+	return affected, nil
+}
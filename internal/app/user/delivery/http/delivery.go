@@ -22,6 +22,30 @@ func (u userDelivery) CreateFriend(ctx context.Context, userID models.UserID) er
 	return nil
 }
 
+func (u userDelivery) BlockUser(ctx context.Context, userID models.UserID) error {
+	err := u.usecase.BlockUser(ctx, userID)
+	if err != nil {
+		return errors.Wrap(convertUserError(err), "failed to block user")
+	}
+	return nil
+}
+
+func (u userDelivery) UnblockUser(ctx context.Context, userID models.UserID) error {
+	err := u.usecase.UnblockUser(ctx, userID)
+	if err != nil {
+		return errors.Wrap(convertUserError(err), "failed to unblock user")
+	}
+	return nil
+}
+
+func (u userDelivery) DeleteUser(ctx context.Context) error {
+	err := u.usecase.DeleteUser(ctx)
+	if err != nil {
+		return errors.Wrap(convertUserError(err), "failed to delete user")
+	}
+	return nil
+}
+
 func (u userDelivery) SearchUser(ctx context.Context, firstName string, secondName string) ([]models.User, error) {
 	users, err := u.usecase.SearchUser(ctx, firstName, secondName)
 	if err != nil {
@@ -69,10 +93,14 @@ func convertUserError(err error) error {
 	switch {
 	case errors.Is(err, models.ErrUserAlreadyExists):
 		return echoerrors.AlreadyExistsError(err, "username")
+	case errors.Is(err, models.ErrFriendshipAlreadyExists):
+		return echoerrors.AlreadyExistsError(err, "friend")
 	case errors.Is(err, models.ErrWrongPassword):
 		return echoerrors.UnauthorizedError(err, echoerrors.ReasonAuthError, "wrong password")
 	case errors.Is(err, models.ErrUserNotFound):
 		return echoerrors.NotFoundError(err, "user")
+	case errors.Is(err, errors.ErrUnavailable):
+		return echoerrors.ServiceUnavailableError(err)
 	default:
 		return echoerrors.InternalError(err)
 	}
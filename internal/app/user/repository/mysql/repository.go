@@ -2,25 +2,25 @@ package mysql
 
 import (
 	"context"
-	"database/sql"
 
 	"github.com/antonpriyma/otus-highload/internal/app/models"
+	mysql_client "github.com/antonpriyma/otus-highload/pkg/clients/mysql"
 	"github.com/antonpriyma/otus-highload/pkg/errors"
 	"github.com/antonpriyma/otus-highload/pkg/log"
-	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
 type userRepository struct {
-	db     *sqlx.DB
+	db     *mysql_client.Provider
 	logger log.Logger
 }
 
 func (u userRepository) GetAllUsersIDs(ctx context.Context) ([]string, error) {
 	var userIDs []string
-	err := u.db.SelectContext(ctx, &userIDs, "SELECT BIN_TO_UUID(uuid) as uuid FROM users")
+	err := u.db.Reader(ctx).SelectContext(ctx, &userIDs, "SELECT BIN_TO_UUID(uuid) as uuid FROM users WHERE deleted_at IS NULL")
 	if err != nil {
-		return nil, errors.Wrap(convertSQLError(err), "failed to get all users")
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get all users")
 	}
 
 	return userIDs, nil
@@ -28,9 +28,9 @@ func (u userRepository) GetAllUsersIDs(ctx context.Context) ([]string, error) {
 
 func (u userRepository) GetFriends(ctx context.Context, userID models.UserID) ([]models.UserID, error) {
 	var friends []Friendship
-	err := u.db.SelectContext(ctx, &friends, "SELECT BIN_TO_UUID(user1) as user1, BIN_TO_UUID(user2) as user2 from friends where user1 = UUID_TO_BIN((?)) or UUID_TO_BIN((?))", userID, userID)
+	err := u.db.Reader(ctx, models.FriendsKey(userID)).SelectContext(ctx, &friends, "SELECT BIN_TO_UUID(f.user1) as user1, BIN_TO_UUID(f.user2) as user2 FROM friends f INNER JOIN users u ON u.uuid = IF(f.user1 = UUID_TO_BIN(?), f.user2, f.user1) WHERE (f.user1 = UUID_TO_BIN(?) OR f.user2 = UUID_TO_BIN(?)) AND u.deleted_at IS NULL", userID, userID, userID)
 	if err != nil {
-		return nil, errors.Wrap(convertSQLError(err), "failed to get friends")
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get friends")
 	}
 
 	var res []models.UserID
@@ -38,7 +38,7 @@ func (u userRepository) GetFriends(ctx context.Context, userID models.UserID) ([
 		if friend.User1 == string(userID) {
 			res = append(res, models.UserID(friend.User2))
 		} else {
-			res = append(res, models.UserID(friend.User2))
+			res = append(res, models.UserID(friend.User1))
 		}
 	}
 
@@ -47,84 +47,151 @@ func (u userRepository) GetFriends(ctx context.Context, userID models.UserID) ([
 
 func (u userRepository) GetRandomUsers(ctx context.Context, n int) ([]models.User, error) {
 	var user []User
-	err := u.db.SelectContext(ctx, &user, "SELECT BIN_TO_UUID(uuid) as uuid, username, first_name, second_name, biography,age,sex,city,password FROM users ORDER BY RAND() LIMIT ?", n)
+	err := u.db.Reader(ctx).SelectContext(ctx, &user, "SELECT BIN_TO_UUID(uuid) as uuid, username, first_name, second_name, biography,age,sex,city,password FROM users WHERE deleted_at IS NULL ORDER BY RAND() LIMIT ?", n)
 	if err != nil {
-		return nil, errors.Wrap(convertSQLError(err), "failed to get user")
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get user")
 	}
 
 	return convertUsersToModels(user), nil
 }
 
 func (u userRepository) CreateFriendship(ctx context.Context, userID1 models.UserID, userID2 models.UserID) error {
-	_, err := u.db.ExecContext(ctx, "INSERT INTO friends (user1, user2) VALUES (UUID_TO_BIN(?), UUID_TO_BIN(?))", userID1, userID2)
+	_, err := u.db.Writer(ctx).ExecContext(ctx, "INSERT INTO friends (user1, user2) VALUES (UUID_TO_BIN(?), UUID_TO_BIN(?))", userID1, userID2)
 	if err != nil {
-		return errors.Wrap(convertSQLError(err), "failed to insert into friendships")
+		return errors.Wrap(sqlErrors.Translate(err), "failed to insert into friendships")
 	}
+	u.db.Wrote(models.FriendsKey(userID1), models.FriendsKey(userID2))
+
 	return nil
 }
 
-func (u userRepository) SearchUser(ctx context.Context, firstName string, secondName string) ([]models.User, error) {
-	var res []User
-	err := u.db.SelectContext(ctx, &res, "SELECT BIN_TO_UUID(uuid) as uuid, username, first_name, second_name, biography,age,sex,city,password FROM users WHERE first_name LIKE ? AND  second_name LIKE ?", firstName+"%", secondName+"%")
+func (u userRepository) BlockUser(ctx context.Context, userID models.UserID, blockedID models.UserID) error {
+	_, err := u.db.Writer(ctx).ExecContext(ctx, "INSERT IGNORE INTO blocked_users (user_uuid, blocked_uuid) VALUES (UUID_TO_BIN(?), UUID_TO_BIN(?))", userID, blockedID)
 	if err != nil {
-		return nil, errors.Wrap(convertSQLError(err), "failed to get users")
+		return errors.Wrap(sqlErrors.Translate(err), "failed to insert into blocked_users")
 	}
+	u.db.Wrote(models.BlocksKey(userID))
+	return nil
+}
 
-	return convertUsersToModels(res), nil
+func (u userRepository) UnblockUser(ctx context.Context, userID models.UserID, blockedID models.UserID) error {
+	_, err := u.db.Writer(ctx).ExecContext(ctx, "DELETE FROM blocked_users WHERE user_uuid = UUID_TO_BIN(?) AND blocked_uuid = UUID_TO_BIN(?)", userID, blockedID)
+	if err != nil {
+		return errors.Wrap(sqlErrors.Translate(err), "failed to delete from blocked_users")
+	}
+	u.db.Wrote(models.BlocksKey(userID))
+	return nil
 }
 
-type Config struct {
-	DataSourceName string `mapstructure:"data_source_name"`
+// DeleteUser keeps the username taken until the user is purged.
+func (u userRepository) DeleteUser(ctx context.Context, userID models.UserID) error {
+	res, err := u.db.Writer(ctx).ExecContext(ctx, "UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE uuid = UUID_TO_BIN(?) AND deleted_at IS NULL", userID)
+	if err != nil {
+		return errors.Wrap(sqlErrors.Translate(err), "failed to delete user")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get affected rows")
+	}
+	if affected == 0 {
+		return models.ErrUserNotFound
+	}
+	u.db.Wrote(models.UserKey(userID), models.FriendsKey(userID))
+
+	return nil
 }
 
-func NewUserRepository(cfg Config, logger log.Logger) (models.UserRepository, error) {
-	db, err := sqlx.Connect("mysql", cfg.DataSourceName)
+func (u userRepository) SearchUser(ctx context.Context, firstName string, secondName string) ([]models.User, error) {
+	var res []User
+	err := u.db.Reader(ctx).SelectContext(ctx, &res, "SELECT BIN_TO_UUID(uuid) as uuid, username, first_name, second_name, biography,age,sex,city,password FROM users WHERE first_name LIKE ? AND  second_name LIKE ? AND deleted_at IS NULL", firstName+"%", secondName+"%")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to connect to mysql")
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get users")
 	}
 
+	return convertUsersToModels(res), nil
+}
+
+func NewUserRepository(db *mysql_client.Provider, logger log.Logger) models.UserRepository {
 	return userRepository{
 		db:     db,
 		logger: logger,
-	}, nil
+	}
 }
 
 func (u userRepository) CreateUser(ctx context.Context, model models.User) error {
 	user := convertModelToUser(model)
-	_, err := u.db.ExecContext(
+	_, err := u.db.Writer(ctx).ExecContext(
 		ctx,
 		"INSERT INTO users (uuid, username, first_name, second_name, biography,age,sex,city,password) VALUES (UUID_TO_BIN(?),?,?,?,?,?,?,?,?)",
 		user.UUID, user.Username, user.FirstName, user.SecondName, user.Biography, user.Age, user.Sex, user.City, user.Password,
 	)
 
 	if err != nil {
-		return errors.Wrap(convertSQLError(err), "failed to insert into users")
+		return errors.Wrap(sqlErrors.Translate(err), "failed to insert into users")
 	}
+	u.db.Wrote(models.UserKey(model.ID))
 
 	return nil
 }
 
 func (u userRepository) GetUser(ctx context.Context, userID models.UserID) (models.User, error) {
 	res := User{}
-	err := u.db.GetContext(ctx, &res, "SELECT BIN_TO_UUID(uuid) as uuid, username, first_name, second_name, biography,age,sex,city,password FROM users WHERE uuid = UUID_TO_BIN(?)", userID)
+	err := u.db.Reader(ctx, models.UserKey(userID)).GetContext(ctx, &res, "SELECT BIN_TO_UUID(uuid) as uuid, username, first_name, second_name, biography,age,sex,city,password FROM users WHERE uuid = UUID_TO_BIN(?) AND deleted_at IS NULL", userID)
 	if err != nil {
-		return models.User{}, errors.Wrap(convertSQLError(err), "failed to get user")
+		return models.User{}, errors.Wrap(sqlErrors.Translate(err), "failed to get user")
 	}
 
 	return convertUserToModel(res), nil
 }
 
-func convertSQLError(err error) error {
-	if mysqlError, ok := err.(*mysql.MySQLError); ok {
-		if mysqlError.Number == 1062 {
-			return models.ErrUserAlreadyExists
+func (u userRepository) GetUsers(ctx context.Context, ids []models.UserID) ([]models.User, error) {
+	binIDs := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		// ids of unknown format match no user
+		if parsed, err := uuid.Parse(string(id)); err == nil {
+			binIDs = append(binIDs, parsed[:])
 		}
 	}
+	if len(binIDs) == 0 {
+		return nil, nil
+	}
 
-	switch {
-	case err == sql.ErrNoRows:
-		return models.ErrUserNotFound
+	query, args, err := sqlx.In("SELECT BIN_TO_UUID(uuid) as uuid, username, first_name, second_name, biography,age,sex,city,password FROM users WHERE uuid IN (?) AND deleted_at IS NULL", binIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
 	}
 
-	return err
+	var rows []User
+	err = u.db.Reader(ctx).SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(sqlErrors.Translate(err), "failed to get users")
+	}
+
+	byID := make(map[models.UserID]models.User, len(rows))
+	for _, user := range convertUsersToModels(rows) {
+		byID[user.ID] = user
+	}
+
+	res := make([]models.User, 0, len(byID))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			res = append(res, user)
+		}
+	}
+
+	return res, nil
+}
+
+// sqlErrors keep friendships from being reported as existing users.
+var sqlErrors = mysql_client.Errors{
+	NotFound: models.ErrUserNotFound,
+	Duplicates: map[string]error{
+		"users.PRIMARY":   models.ErrUserAlreadyExists,
+		"users.username":  models.ErrUserAlreadyExists,
+		"friends.PRIMARY": models.ErrFriendshipAlreadyExists,
+	},
+	ForeignKeys: map[string]error{
+		"users": models.ErrUserNotFound,
+	},
 }
@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/antonpriyma/otus-highload/internal/app/models"
+	redis_client "github.com/antonpriyma/otus-highload/pkg/clients/redis"
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+type Config struct {
+	// Enabled makes cmd/feed-cdc keep the index and the app search it instead
+	// of running a LIKE query. Existing users are added by cmd/script/search-index.
+	Enabled bool                `mapstructure:"enabled"`
+	Redis   redis_client.Config `mapstructure:"redis"`
+}
+
+// Users are entries "first name\x00second name\x00id" of a sorted set with
+// equal scores, which is ordered by the entries, so that a first name prefix
+// is a range. The entry of every user is kept in a hash to replace it. Both
+// keys share a hash tag and stay in one cluster slot for the script.
+const (
+	namesKey   = "users_search:{index}:names"
+	entriesKey = "users_search:{index}:entries"
+)
+
+// searchPageSize bounds entries read at once for a first name prefix.
+const searchPageSize = 1000
+
+// KEYS: names, entries; ARGV: user id, entry or empty to remove the user.
+var replaceScript = redis.NewScript(`
+local old = redis.call('HGET', KEYS[2], ARGV[1])
+if old then
+	redis.call('ZREM', KEYS[1], old)
+end
+if ARGV[2] == '' then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+	return 0
+end
+redis.call('ZADD', KEYS[1], 0, ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+return 1
+`)
+
+type searchIndex struct {
+	redis  redis.UniversalClient
+	logger log.Logger
+}
+
+func NewUserSearchIndex(cfg Config, logger log.Logger) (models.UserSearchIndex, error) {
+	client, err := redis_client.NewClient(cfg.Redis)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create redis client")
+	}
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to redis")
+	}
+
+	return searchIndex{
+		redis:  client,
+		logger: logger,
+	}, nil
+}
+
+func entry(userID models.UserID, firstName string, secondName string) string {
+	return strings.ToLower(firstName) + "\x00" + strings.ToLower(secondName) + "\x00" + string(userID)
+}
+
+func (s searchIndex) IndexUser(ctx context.Context, userID models.UserID, firstName string, secondName string) error {
+	err := replaceScript.Run(ctx, s.redis, []string{namesKey, entriesKey}, string(userID), entry(userID, firstName, secondName)).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to index user")
+	}
+
+	return nil
+}
+
+func (s searchIndex) RemoveUser(ctx context.Context, userID models.UserID) error {
+	err := replaceScript.Run(ctx, s.redis, []string{namesKey, entriesKey}, string(userID), "").Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to remove user from index")
+	}
+
+	return nil
+}
+
+// SearchUsers reads the range of the first name prefix and filters it by the
+// second name one.
+func (s searchIndex) SearchUsers(ctx context.Context, firstName string, secondName string) ([]models.UserID, error) {
+	first, second := strings.ToLower(firstName), strings.ToLower(secondName)
+
+	var ids []models.UserID
+	for offset := int64(0); ; offset += searchPageSize {
+		entries, err := s.redis.ZRangeByLex(ctx, namesKey, &redis.ZRangeBy{
+			Min: "[" + first,
+			// no byte of utf-8 text is 0xff
+			Max:    "[" + first + "\xff",
+			Offset: offset,
+			Count:  searchPageSize,
+		}).Result()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to search users")
+		}
+
+		for _, e := range entries {
+			fields := strings.SplitN(e, "\x00", 3)
+			if len(fields) == 3 && strings.HasPrefix(fields[1], second) {
+				ids = append(ids, models.UserID(fields[2]))
+			}
+		}
+
+		if len(entries) < searchPageSize {
+			return ids, nil
+		}
+	}
+}
@@ -14,7 +14,11 @@ import (
 
 type userUsecase struct {
 	users    models.UserRepository
+	posts    models.PostRepository
 	sessions models.SessionRepository
+	outbox   models.OutboxRepository
+	search   models.UserSearchIndex
+	tx       models.TxManager
 	logger   log.Logger
 }
 
@@ -24,26 +28,121 @@ func (u userUsecase) CreateFriend(ctx context.Context, userID models.UserID) err
 		return models.ErrUnauthorized
 	}
 
-	err := u.users.CreateFriendship(ctx, ctxUserID, userID)
+	// friendships are mutual right away, so the target is told it was accepted
+	notification, err := models.NewNotification(models.NotificationFriendshipAccepted, ctxUserID, userID, models.FriendshipAcceptedPayload{})
 	if err != nil {
-		return errors.Wrap(err, "failed to create friendship")
+		return err
+	}
+
+	// the notification is published only if the friendship is committed
+	err = u.tx.InTx(ctx, func(ctx context.Context) error {
+		err := u.users.CreateFriendship(ctx, ctxUserID, userID)
+		if err != nil {
+			return errors.Wrap(err, "failed to create friendship")
+		}
+
+		return errors.Wrap(u.outbox.Write(ctx, []models.Notification{notification}), "failed to write outbox")
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (u userUsecase) BlockUser(ctx context.Context, userID models.UserID) error {
+	ctxUserID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	err := u.users.BlockUser(ctx, ctxUserID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to block user")
+	}
+	return nil
+}
+
+func (u userUsecase) UnblockUser(ctx context.Context, userID models.UserID) error {
+	ctxUserID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	err := u.users.UnblockUser(ctx, ctxUserID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to unblock user")
 	}
 	return nil
 }
 
+func (u userUsecase) DeleteUser(ctx context.Context) error {
+	ctxUserID, ok := contextlib.GetUserID(ctx)
+	if !ok {
+		return models.ErrUnauthorized
+	}
+
+	friends, err := u.users.GetFriends(ctx, ctxUserID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get friends")
+	}
+
+	err = u.users.DeleteUser(ctx, ctxUserID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete user")
+	}
+
+	// posts of the user vanish from the feeds, a stale feed cache must not fail the request
+	for _, friend := range friends {
+		err = u.posts.RebuildCache(ctx, string(friend))
+		if err != nil {
+			u.logger.ForCtx(ctx).WithError(err).WithField("user_id", friend).Warn("failed to rebuild feed cache")
+		}
+	}
+
+	return nil
+}
+
 func (u userUsecase) SearchUser(ctx context.Context, firstName string, secondName string) ([]models.User, error) {
-	users, err := u.users.SearchUser(ctx, firstName, secondName)
+	if u.search == nil {
+		users, err := u.users.SearchUser(ctx, firstName, secondName)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to search user")
+		}
+
+		return users, nil
+	}
+
+	ids, err := u.search.SearchUsers(ctx, firstName, secondName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search user index")
+	}
+
+	// the index may lag behind, users deleted meanwhile are skipped
+	users, err := u.users.GetUsers(ctx, ids)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to search user")
+		return nil, errors.Wrap(err, "failed to get found users")
 	}
 
 	return users, nil
 }
 
-func NewUserUsecase(users models.UserRepository, sessions models.SessionRepository, logger log.Logger) models.UserUsecase {
+// NewUserUsecase searches users with a LIKE query when search is nil.
+func NewUserUsecase(
+	users models.UserRepository,
+	posts models.PostRepository,
+	sessions models.SessionRepository,
+	outbox models.OutboxRepository,
+	search models.UserSearchIndex,
+	tx models.TxManager,
+	logger log.Logger,
+) models.UserUsecase {
 	return &userUsecase{
 		users:    users,
+		posts:    posts,
 		sessions: sessions,
+		outbox:   outbox,
+		search:   search,
+		tx:       tx,
 		logger:   logger,
 	}
 }
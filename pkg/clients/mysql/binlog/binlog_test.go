@@ -0,0 +1,202 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func TestGTIDSet(t *testing.T) {
+	set, err := ParseGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11,\n" + "4e11fa47-71ca-11e1-9e33-c80aa9429562:7")
+	require.NoError(t, err)
+
+	set.Add(GTID{SID: testSID, GNO: 6})
+	set.Add(GTID{SID: testSID, GNO: 10})
+	set.Add(GTID{SID: "4e11fa47-71ca-11e1-9e33-c80aa9429562", GNO: 9})
+	require.Equal(t, testSID+":1-6:10-11,4e11fa47-71ca-11e1-9e33-c80aa9429562:7:9", set.String())
+	require.True(t, set.Contains(GTID{SID: testSID, GNO: 3}))
+	require.False(t, set.Contains(GTID{SID: testSID, GNO: 7}))
+
+	encoded := set.encode()
+	require.Equal(t, uint64(2), binary.LittleEndian.Uint64(encoded[0:8]))
+	// intervals of the first sid with exclusive ends
+	require.Equal(t, uint64(2), binary.LittleEndian.Uint64(encoded[24:32]))
+	require.Equal(t, uint64(1), binary.LittleEndian.Uint64(encoded[32:40]))
+	require.Equal(t, uint64(7), binary.LittleEndian.Uint64(encoded[40:48]))
+
+	_, err = ParseGTIDSet(testSID + ":5-1")
+	require.Error(t, err)
+	_, err = ParseGTIDSet("not-a-uuid:1")
+	require.Error(t, err)
+
+	empty, err := ParseGTIDSet("")
+	require.NoError(t, err)
+	require.Empty(t, empty.String())
+}
+
+// event frames body as a binlog event with a CRC32 trailer.
+func event(typ eventType, body []byte) []byte {
+	res := make([]byte, eventHeaderSize, eventHeaderSize+len(body)+4)
+	binary.LittleEndian.PutUint32(res[0:4], 1700000000)
+	res[4] = byte(typ)
+	binary.LittleEndian.PutUint32(res[9:13], uint32(eventHeaderSize+len(body)+4))
+	res = append(res, body...)
+
+	return binary.LittleEndian.AppendUint32(res, crc32.ChecksumIEEE(res))
+}
+
+func formatDescription() []byte {
+	body := binary.LittleEndian.AppendUint16(nil, 4)
+	version := make([]byte, 50)
+	copy(version, "8.0.32")
+	body = append(body, version...)
+	body = append(body, 0, 0, 0, 0, eventHeaderSize)
+	body = append(body, make([]byte, 40)...) // post header lengths
+	body = append(body, checksumCRC32)
+
+	return event(eventFormatDescription, body)
+}
+
+func gtidEvent(gno int64) []byte {
+	body := []byte{1}
+	body = append(body, 0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62)
+	body = binary.LittleEndian.AppendUint64(body, uint64(gno))
+
+	return event(eventGTID, body)
+}
+
+// tableMap describes post (uuid BINARY(16), user_id BINARY(16), text TEXT,
+// created_at TIMESTAMP, deleted_at TIMESTAMP(3) NULL).
+func tableMap() []byte {
+	body := []byte{42, 0, 0, 0, 0, 0, 1, 0}
+	body = append(append(body, 4), "otus\x00"...)
+	body = append(append(body, 4), "post\x00"...)
+	body = append(body, 5, typeString, typeString, typeBlob, typeTimestamp2, typeTimestamp2)
+	meta := []byte{typeString, 16, typeString, 16, 2, 0, 3}
+	body = append(append(body, byte(len(meta))), meta...)
+	body = append(body, 0x10) // nullable deleted_at
+
+	columns := []byte{}
+	for _, name := range []string{"uuid", "user_id", "text", "created_at", "deleted_at"} {
+		columns = append(append(columns, byte(len(name))), name...)
+	}
+	body = append(append(body, metadataColumnName, byte(len(columns))), columns...)
+
+	return event(eventTableMap, body)
+}
+
+func postRow(uuid, userID byte, text string, deletedAtMillis int) []byte {
+	var row []byte
+	if deletedAtMillis < 0 {
+		row = append(row, 0x10)
+	} else {
+		row = append(row, 0x00)
+	}
+	// trailing zero bytes of BINARY are not logged
+	row = append(row, 1, uuid)
+	row = append(row, 1, userID)
+	row = append(binary.LittleEndian.AppendUint16(row, uint16(len(text))), text...)
+	row = binary.BigEndian.AppendUint32(row, 1700000000)
+	if deletedAtMillis >= 0 {
+		row = binary.BigEndian.AppendUint32(row, 1700000001)
+		row = binary.BigEndian.AppendUint16(row, uint16(deletedAtMillis*10))
+	}
+
+	return row
+}
+
+func rowsEvent(typ eventType, rows ...[]byte) []byte {
+	body := []byte{42, 0, 0, 0, 0, 0, 1, 0}
+	body = binary.LittleEndian.AppendUint16(body, 2)
+	body = append(body, 5, 0x1f)
+	if typ == eventUpdateRowsV2 {
+		body = append(body, 0x1f)
+	}
+	for _, row := range rows {
+		body = append(body, row...)
+	}
+
+	return event(typ, body)
+}
+
+func xid() []byte {
+	return event(eventXID, binary.LittleEndian.AppendUint64(nil, 7))
+}
+
+func TestStreamTransactions(t *testing.T) {
+	s := &Stream{
+		tables: make(map[uint64]*Table),
+		filter: map[string]bool{"otus.post": true},
+	}
+
+	var txs []Transaction
+	for _, e := range [][]byte{
+		formatDescription(),
+		gtidEvent(5),
+		tableMap(),
+		rowsEvent(eventWriteRowsV2, postRow(1, 2, "hello", -1)),
+		xid(),
+		gtidEvent(6),
+		tableMap(),
+		rowsEvent(eventUpdateRowsV2, postRow(1, 2, "hello", -1), postRow(1, 2, "bye", 250)),
+		xid(),
+	} {
+		tx, done, err := s.handle(e)
+		require.NoError(t, err)
+		if done {
+			txs = append(txs, tx)
+		}
+	}
+
+	require.Len(t, txs, 2)
+	require.Equal(t, GTID{SID: testSID, GNO: 5}, txs[0].GTID)
+
+	inserted := txs[0].Rows[0]
+	require.Equal(t, ActionInsert, inserted.Action)
+	require.Equal(t, []string{"uuid", "user_id", "text", "created_at", "deleted_at"}, inserted.Table.Columns)
+	require.Nil(t, inserted.Changes[0].Before)
+	require.Equal(t, Row{[]byte{1}, []byte{2}, []byte("hello"), time.Unix(1700000000, 0).UTC(), nil}, inserted.Changes[0].After)
+
+	updated := txs[1].Rows[0]
+	require.Equal(t, ActionUpdate, updated.Action)
+	require.Equal(t, []byte("hello"), updated.Changes[0].Before[2])
+	require.Equal(t, []byte("bye"), updated.Changes[0].After[2])
+	require.Equal(t, time.Unix(1700000001, 250*int64(time.Millisecond)).UTC(), updated.Changes[0].After[4])
+}
+
+func TestStreamSkipsFilteredTables(t *testing.T) {
+	s := &Stream{
+		tables: make(map[uint64]*Table),
+		filter: map[string]bool{"otus.friends": true},
+	}
+
+	var txs []Transaction
+	for _, e := range [][]byte{formatDescription(), gtidEvent(5), tableMap(), rowsEvent(eventDeleteRowsV2, []byte{0xff}), xid()} {
+		tx, done, err := s.handle(e)
+		require.NoError(t, err)
+		if done {
+			txs = append(txs, tx)
+		}
+	}
+
+	// the transaction is still reported to move the position
+	require.Len(t, txs, 1)
+	require.Empty(t, txs[0].Rows)
+}
+
+func TestStreamChecksumMismatch(t *testing.T) {
+	s := &Stream{tables: make(map[uint64]*Table)}
+
+	_, _, err := s.handle(formatDescription())
+	require.NoError(t, err)
+
+	e := gtidEvent(5)
+	e[eventHeaderSize+1] ^= 0xff
+	_, _, err = s.handle(e)
+	require.ErrorIs(t, err, ErrCorrupted)
+}
@@ -0,0 +1,397 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+const (
+	maxPacketSize = 1<<24 - 1
+
+	packetOK   = 0x00
+	packetEOF  = 0xfe
+	packetErr  = 0xff
+	packetMore = 0x01
+
+	comQuery           = 0x03
+	comBinlogDumpGTID  = 0x1e
+	charsetUTF8MB4     = 45
+	clientCapabilities = clientLongPassword | clientLongFlag | clientConnectWithDB |
+		clientProtocol41 | clientTransactions | clientSecureConnection | clientPluginAuth
+
+	clientLongPassword     = 1 << 0
+	clientLongFlag         = 1 << 2
+	clientConnectWithDB    = 1 << 3
+	clientProtocol41       = 1 << 9
+	clientTransactions     = 1 << 13
+	clientSecureConnection = 1 << 15
+	clientPluginAuth       = 1 << 19
+
+	authNativePassword  = "mysql_native_password"
+	authCachingSHA2     = "caching_sha2_password"
+	cachingSHA2FastOK   = 3
+	cachingSHA2FullAuth = 4
+	cachingSHA2PubKey   = 2
+)
+
+// ServerError is an ERR packet of the server.
+type ServerError struct {
+	Code    uint16
+	Message string
+}
+
+func (e ServerError) Error() string {
+	return "mysql error " + strconv.Itoa(int(e.Code)) + ": " + e.Message
+}
+
+// conn speaks the client protocol without TLS, which is enough for the
+// replication user in the private network of the primary.
+type conn struct {
+	netConn net.Conn
+	r       *bufio.Reader
+	seq     uint8
+}
+
+func dial(addr string, timeout time.Duration) (*conn, error) {
+	netConn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to dial mysql")
+	}
+
+	return &conn{
+		netConn: netConn,
+		r:       bufio.NewReaderSize(netConn, 64<<10),
+	}, nil
+}
+
+func (c *conn) Close() error {
+	return c.netConn.Close()
+}
+
+func (c *conn) readPacket() ([]byte, error) {
+	var res []byte
+	header := make([]byte, 4)
+
+	for {
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			return nil, errors.Wrap(err, "failed to read packet header")
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(c.r, chunk); err != nil {
+			return nil, errors.Wrap(err, "failed to read packet")
+		}
+
+		// a packet of the max size is continued by the next one
+		if res == nil && length < maxPacketSize {
+			return chunk, nil
+		}
+		res = append(res, chunk...)
+		if length < maxPacketSize {
+			return res, nil
+		}
+	}
+}
+
+func (c *conn) writePacket(data []byte) error {
+	for {
+		length := len(data)
+		if length > maxPacketSize {
+			length = maxPacketSize
+		}
+
+		packet := make([]byte, 4, 4+length)
+		packet[0] = byte(length)
+		packet[1] = byte(length >> 8)
+		packet[2] = byte(length >> 16)
+		packet[3] = c.seq
+		packet = append(packet, data[:length]...)
+		c.seq++
+
+		if _, err := c.netConn.Write(packet); err != nil {
+			return errors.Wrap(err, "failed to write packet")
+		}
+
+		data = data[length:]
+		if length < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+func (c *conn) writeCommand(command byte, data []byte) error {
+	c.seq = 0
+	return c.writePacket(append([]byte{command}, data...))
+}
+
+func parseServerError(packet []byte) error {
+	if len(packet) < 3 {
+		return ServerError{Message: "malformed error packet"}
+	}
+
+	e := ServerError{Code: binary.LittleEndian.Uint16(packet[1:3])}
+	msg := packet[3:]
+	// protocol 41 puts '#' and the sql state before the message
+	if len(msg) > 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+
+	return e
+}
+
+// handshake authenticates with mysql_native_password or caching_sha2_password,
+// the full caching_sha2_password authentication encrypts the password with the
+// RSA key of the server.
+func (c *conn) handshake(user, password, db string) error {
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if packet[0] == packetErr {
+		return parseServerError(packet)
+	}
+	if packet[0] != 10 {
+		return errors.Errorf("unsupported protocol version %d", packet[0])
+	}
+
+	pos := bytes.IndexByte(packet[1:], 0) + 2 // server version
+	pos += 4                                  // connection id
+	if len(packet) < pos+8+1+2+1+2+2+1+10 {
+		return errors.New("malformed handshake packet")
+	}
+	scramble := append([]byte(nil), packet[pos:pos+8]...)
+	pos += 8 + 1
+	capabilities := uint32(binary.LittleEndian.Uint16(packet[pos : pos+2]))
+	pos += 2 + 1 + 2
+	capabilities |= uint32(binary.LittleEndian.Uint16(packet[pos:pos+2])) << 16
+	pos += 2
+	scrambleLen := int(packet[pos])
+	pos += 1 + 10
+
+	if capabilities&clientProtocol41 == 0 {
+		return errors.New("server does not support protocol 41")
+	}
+
+	plugin := authNativePassword
+	if capabilities&clientSecureConnection != 0 {
+		n := scrambleLen - 8
+		if n < 13 {
+			n = 13
+		}
+		if len(packet) < pos+n {
+			return errors.New("malformed handshake packet")
+		}
+		// the scramble is NUL terminated
+		scramble = append(scramble, packet[pos:pos+n-1]...)
+		pos += n
+	}
+	if capabilities&clientPluginAuth != 0 && pos < len(packet) {
+		name := packet[pos:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		plugin = string(name)
+	}
+
+	authData, err := scrambleFor(plugin, password, scramble)
+	if err != nil {
+		return err
+	}
+
+	flags := uint32(clientCapabilities)
+	if db == "" {
+		flags &^= clientConnectWithDB
+	}
+
+	resp := binary.LittleEndian.AppendUint32(nil, flags)
+	resp = binary.LittleEndian.AppendUint32(resp, maxPacketSize)
+	resp = append(resp, charsetUTF8MB4)
+	resp = append(resp, make([]byte, 23)...)
+	resp = append(append(resp, user...), 0)
+	resp = append(append(resp, byte(len(authData))), authData...)
+	if db != "" {
+		resp = append(append(resp, db...), 0)
+	}
+	resp = append(append(resp, plugin...), 0)
+
+	if err := c.writePacket(resp); err != nil {
+		return err
+	}
+
+	return c.authResult(plugin, password, scramble)
+}
+
+func (c *conn) authResult(plugin, password string, scramble []byte) error {
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+
+		switch packet[0] {
+		case packetOK:
+			return nil
+		case packetErr:
+			return parseServerError(packet)
+		case packetEOF:
+			// the server switches to another plugin with a new scramble
+			data := packet[1:]
+			i := bytes.IndexByte(data, 0)
+			if i < 0 {
+				return errors.New("malformed auth switch packet")
+			}
+			plugin = string(data[:i])
+			scramble = bytes.TrimRight(data[i+1:], "\x00")
+
+			authData, err := scrambleFor(plugin, password, scramble)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(authData); err != nil {
+				return err
+			}
+		case packetMore:
+			if plugin != authCachingSHA2 || len(packet) < 2 {
+				return errors.Errorf("unexpected auth data for %s", plugin)
+			}
+
+			switch packet[1] {
+			case cachingSHA2FastOK:
+				// OK follows
+			case cachingSHA2FullAuth:
+				if err := c.writePacket([]byte{cachingSHA2PubKey}); err != nil {
+					return err
+				}
+				keyPacket, err := c.readPacket()
+				if err != nil {
+					return err
+				}
+				if keyPacket[0] == packetErr {
+					return parseServerError(keyPacket)
+				}
+
+				encrypted, err := encryptPassword(password, scramble, keyPacket[1:])
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(encrypted); err != nil {
+					return err
+				}
+			default:
+				return errors.Errorf("unexpected caching_sha2_password state %d", packet[1])
+			}
+		default:
+			return errors.Errorf("unexpected auth packet 0x%x", packet[0])
+		}
+	}
+}
+
+func scrambleFor(plugin, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(scramble) < 20 {
+		return nil, errors.Errorf("short auth scramble of %d bytes", len(scramble))
+	}
+
+	switch plugin {
+	case authNativePassword:
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		stage1 := sha1.Sum([]byte(password)) // nolint:gosec
+		stage2 := sha1.Sum(stage1[:])        // nolint:gosec
+		h := sha1.New()                      // nolint:gosec
+		h.Write(scramble[:20])
+		h.Write(stage2[:])
+		res := h.Sum(nil)
+		for i := range res {
+			res[i] ^= stage1[i]
+		}
+		return res, nil
+	case authCachingSHA2:
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		stage1 := sha256.Sum256([]byte(password))
+		stage2 := sha256.Sum256(stage1[:])
+		h := sha256.New()
+		h.Write(stage2[:])
+		h.Write(scramble[:20])
+		res := h.Sum(nil)
+		for i := range res {
+			res[i] ^= stage1[i]
+		}
+		return res, nil
+	default:
+		return nil, errors.Errorf("unsupported auth plugin %s", plugin)
+	}
+}
+
+func encryptPassword(password string, scramble []byte, key []byte) ([]byte, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("malformed server public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse server public key")
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("server public key is not rsa")
+	}
+
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, plain, nil) // nolint:gosec
+}
+
+// exec runs a statement and discards its result set.
+func (c *conn) exec(query string) error {
+	if err := c.writeCommand(comQuery, []byte(query)); err != nil {
+		return err
+	}
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch packet[0] {
+	case packetOK:
+		return nil
+	case packetErr:
+		return parseServerError(packet)
+	}
+
+	// column definitions and rows, each terminated by EOF
+	for eofs := 0; eofs < 2; {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		switch {
+		case packet[0] == packetErr:
+			return parseServerError(packet)
+		case packet[0] == packetEOF && len(packet) < 9:
+			eofs++
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+const eventHeaderSize = 19
+
+type eventType byte
+
+const (
+	eventQuery             eventType = 2
+	eventRotate            eventType = 4
+	eventFormatDescription eventType = 15
+	eventXID               eventType = 16
+	eventTableMap          eventType = 19
+	eventWriteRowsV1       eventType = 23
+	eventUpdateRowsV1      eventType = 24
+	eventDeleteRowsV1      eventType = 25
+	eventHeartbeat         eventType = 27
+	eventWriteRowsV2       eventType = 30
+	eventUpdateRowsV2      eventType = 31
+	eventDeleteRowsV2      eventType = 32
+	eventGTID              eventType = 33
+	eventTransactionData   eventType = 40
+	eventHeartbeatV2       eventType = 41
+)
+
+const checksumCRC32 = 1
+
+var ErrCorrupted = errors.New("binlog event is corrupted")
+
+type eventHeader struct {
+	Timestamp uint32
+	Type      eventType
+	ServerID  uint32
+	Size      uint32
+	LogPos    uint32
+	Flags     uint16
+}
+
+func parseEventHeader(data []byte) (eventHeader, error) {
+	if len(data) < eventHeaderSize {
+		return eventHeader{}, errors.Wrapf(ErrCorrupted, "event of %d bytes", len(data))
+	}
+
+	return eventHeader{
+		Timestamp: binary.LittleEndian.Uint32(data[0:4]),
+		Type:      eventType(data[4]),
+		ServerID:  binary.LittleEndian.Uint32(data[5:9]),
+		Size:      binary.LittleEndian.Uint32(data[9:13]),
+		LogPos:    binary.LittleEndian.Uint32(data[13:17]),
+		Flags:     binary.LittleEndian.Uint16(data[17:19]),
+	}, nil
+}
+
+// parseChecksumAlgorithm reads the checksum algorithm of the stream from the
+// format description event, which MySQL 5.6.1+ puts before its own checksum.
+func parseChecksumAlgorithm(event []byte) (byte, error) {
+	if len(event) < eventHeaderSize+2+50+4+1+5 {
+		return 0, errors.Wrap(ErrCorrupted, "short format description event")
+	}
+
+	return event[len(event)-5], nil
+}
+
+// verifyChecksum strips the CRC32 trailer of event.
+func verifyChecksum(event []byte) ([]byte, error) {
+	if len(event) < eventHeaderSize+4 {
+		return nil, errors.Wrap(ErrCorrupted, "short event")
+	}
+
+	body := event[:len(event)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(event[len(event)-4:]) {
+		return nil, errors.Wrap(ErrCorrupted, "checksum mismatch")
+	}
+
+	return body, nil
+}
+
+func parseGTIDEvent(body []byte) (GTID, error) {
+	// flags, sid and gno, logical timestamps follow
+	if len(body) < 1+16+8 {
+		return GTID{}, errors.Wrap(ErrCorrupted, "short gtid event")
+	}
+
+	return GTID{
+		SID: formatSID(body[1:17]),
+		GNO: int64(binary.LittleEndian.Uint64(body[17:25])),
+	}, nil
+}
+
+// parseQueryEvent returns the statement of a query event.
+func parseQueryEvent(body []byte) (string, error) {
+	if len(body) < 13 {
+		return "", errors.Wrap(ErrCorrupted, "short query event")
+	}
+
+	schemaLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:13]))
+	pos := 13 + statusLen + schemaLen + 1
+	if len(body) < pos {
+		return "", errors.Wrap(ErrCorrupted, "short query event")
+	}
+
+	return string(body[pos:]), nil
+}
+
+// reader decodes the little endian encodings of the protocol.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) fail(what string) {
+	if r.err == nil {
+		r.err = errors.Wrapf(ErrCorrupted, "short %s at %d", what, r.pos)
+	}
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		r.fail("bytes")
+		return nil
+	}
+
+	res := r.data[r.pos : r.pos+n]
+	r.pos += n
+
+	return res
+}
+
+func (r *reader) uint(n int) uint64 {
+	b := r.bytes(n)
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+
+	return v
+}
+
+// lenenc reads a length encoded integer.
+func (r *reader) lenenc() uint64 {
+	first := r.uint(1)
+	switch {
+	case first < 0xfb:
+		return first
+	case first == 0xfc:
+		return r.uint(2)
+	case first == 0xfd:
+		return r.uint(3)
+	case first == 0xfe:
+		return r.uint(8)
+	default:
+		r.fail("length encoded integer")
+		return 0
+	}
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
@@ -0,0 +1,176 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+// GTID is the global transaction id of MySQL, the server uuid and the
+// sequence number of the transaction on that server.
+type GTID struct {
+	SID string
+	GNO int64
+}
+
+func (g GTID) String() string {
+	return g.SID + ":" + strconv.FormatInt(g.GNO, 10)
+}
+
+// interval holds the sequence numbers from start to stop inclusive.
+type interval struct {
+	start int64
+	stop  int64
+}
+
+// GTIDSet is a set of transactions in the format of @@gtid_executed, e.g.
+// "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:11".
+type GTIDSet map[string][]interval
+
+func ParseGTIDSet(s string) (GTIDSet, error) {
+	set := GTIDSet{}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, ":")
+		sid, err := normalizeSID(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 2 {
+			return nil, errors.Errorf("gtid set %q has no intervals", part)
+		}
+
+		for _, field := range fields[1:] {
+			bounds := strings.SplitN(field, "-", 2)
+			start, err := strconv.ParseInt(bounds[0], 10, 64)
+			if err != nil || start < 1 {
+				return nil, errors.Errorf("invalid gtid interval %q", field)
+			}
+			stop := start
+			if len(bounds) == 2 {
+				stop, err = strconv.ParseInt(bounds[1], 10, 64)
+				if err != nil || stop < start {
+					return nil, errors.Errorf("invalid gtid interval %q", field)
+				}
+			}
+
+			set.addInterval(sid, interval{start: start, stop: stop})
+		}
+	}
+
+	return set, nil
+}
+
+func normalizeSID(s string) (string, error) {
+	sid := strings.ToLower(strings.TrimSpace(s))
+	raw, err := hex.DecodeString(strings.ReplaceAll(sid, "-", ""))
+	if err != nil || len(raw) != 16 {
+		return "", errors.Errorf("invalid server uuid %q", s)
+	}
+
+	return formatSID(raw), nil
+}
+
+func formatSID(raw []byte) string {
+	h := hex.EncodeToString(raw)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// Add puts gtid into the set.
+func (s GTIDSet) Add(gtid GTID) {
+	s.addInterval(gtid.SID, interval{start: gtid.GNO, stop: gtid.GNO})
+}
+
+func (s GTIDSet) Contains(gtid GTID) bool {
+	for _, in := range s[gtid.SID] {
+		if gtid.GNO >= in.start && gtid.GNO <= in.stop {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s GTIDSet) Clone() GTIDSet {
+	res := make(GTIDSet, len(s))
+	for sid, intervals := range s {
+		res[sid] = append([]interval(nil), intervals...)
+	}
+
+	return res
+}
+
+// addInterval keeps intervals sorted and merges adjacent ones.
+func (s GTIDSet) addInterval(sid string, in interval) {
+	intervals := append(s[sid], in)
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start < intervals[j].start
+	})
+
+	merged := intervals[:1]
+	for _, next := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if next.start <= last.stop+1 {
+			if next.stop > last.stop {
+				last.stop = next.stop
+			}
+			continue
+		}
+		merged = append(merged, next)
+	}
+
+	s[sid] = merged
+}
+
+func (s GTIDSet) sids() []string {
+	sids := make([]string, 0, len(s))
+	for sid := range s {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+
+	return sids
+}
+
+func (s GTIDSet) String() string {
+	parts := make([]string, 0, len(s))
+	for _, sid := range s.sids() {
+		var b strings.Builder
+		b.WriteString(sid)
+		for _, in := range s[sid] {
+			b.WriteString(":" + strconv.FormatInt(in.start, 10))
+			if in.stop != in.start {
+				b.WriteString("-" + strconv.FormatInt(in.stop, 10))
+			}
+		}
+		parts = append(parts, b.String())
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// encode is the binary form of COM_BINLOG_DUMP_GTID, interval ends are
+// exclusive there.
+func (s GTIDSet) encode() []byte {
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(len(s)))
+	for _, sid := range s.sids() {
+		raw, _ := hex.DecodeString(strings.ReplaceAll(sid, "-", ""))
+		buf = append(buf, raw...)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(s[sid])))
+		for _, in := range s[sid] {
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(in.start))
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(in.stop+1))
+		}
+	}
+
+	return buf
+}
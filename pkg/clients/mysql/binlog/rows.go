@@ -0,0 +1,366 @@
+package binlog
+
+import (
+	"math"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+var ErrUnsupportedType = errors.New("unsupported column type")
+
+// column types of the binary protocol
+const (
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeYear       = 13
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDatetime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// optional metadata of the table map with binlog_row_metadata=FULL
+const metadataColumnName = 4
+
+// Table is described by the table map event preceding its rows.
+type Table struct {
+	ID     uint64
+	Schema string
+	Name   string
+	// Columns are the names of the columns, only known with
+	// binlog_row_metadata=FULL.
+	Columns []string
+
+	types []byte
+	meta  []uint16
+}
+
+func (t *Table) FullName() string {
+	return t.Schema + "." + t.Name
+}
+
+func parseTableMap(body []byte) (*Table, error) {
+	r := &reader{data: body}
+	t := &Table{ID: r.uint(6)}
+	r.uint(2) // flags
+
+	t.Schema = string(r.bytes(int(r.uint(1))))
+	r.uint(1)
+	t.Name = string(r.bytes(int(r.uint(1))))
+	r.uint(1)
+
+	n := int(r.lenenc())
+	t.types = r.bytes(n)
+	meta := &reader{data: r.bytes(int(r.lenenc()))}
+	r.bytes((n + 7) / 8) // nullability
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "failed to parse table map")
+	}
+
+	t.meta = make([]uint16, n)
+	for i, typ := range t.types {
+		switch typ {
+		case typeFloat, typeDouble, typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob,
+			typeGeometry, typeJSON, typeTimestamp2, typeDatetime2, typeTime2:
+			t.meta[i] = uint16(meta.uint(1))
+		case typeVarchar, typeVarString, typeBit:
+			t.meta[i] = uint16(meta.uint(2))
+		case typeString, typeEnum, typeSet:
+			// real type and length, big endian
+			t.meta[i] = uint16(meta.uint(1))<<8 | uint16(meta.uint(1))
+		case typeNewDecimal:
+			// precision and scale
+			t.meta[i] = uint16(meta.uint(2))
+		}
+	}
+	if meta.err != nil {
+		return nil, errors.Wrap(meta.err, "failed to parse column metadata")
+	}
+
+	for r.remaining() > 0 && r.err == nil {
+		typ := r.uint(1)
+		value := &reader{data: r.bytes(int(r.lenenc()))}
+		if typ != metadataColumnName {
+			continue
+		}
+		for value.remaining() > 0 && value.err == nil {
+			t.Columns = append(t.Columns, string(value.bytes(int(value.lenenc()))))
+		}
+	}
+	if len(t.Columns) != n {
+		t.Columns = nil
+	}
+
+	return t, nil
+}
+
+type Action string
+
+const (
+	ActionInsert Action = "insert"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Row holds the values of a row in the order of the table columns: nil for
+// NULL, int64, float64, []byte for strings and blobs and time.Time for dates
+// and timestamps. BINARY values come without the trailing zero bytes and JSON
+// values are in the binary format of MySQL.
+type Row []interface{}
+
+// Change is a row change, Before is nil for inserts and After for deletes.
+type Change struct {
+	Before Row
+	After  Row
+}
+
+type RowsEvent struct {
+	Table   *Table
+	Action  Action
+	Changes []Change
+}
+
+func rowsAction(typ eventType) Action {
+	switch typ {
+	case eventWriteRowsV1, eventWriteRowsV2:
+		return ActionInsert
+	case eventUpdateRowsV1, eventUpdateRowsV2:
+		return ActionUpdate
+	default:
+		return ActionDelete
+	}
+}
+
+// rowsTableID reads the table id, so that rows of other tables are skipped
+// without decoding.
+func rowsTableID(body []byte) uint64 {
+	r := &reader{data: body}
+	return r.uint(6)
+}
+
+func parseRows(typ eventType, body []byte, table *Table) (RowsEvent, error) {
+	r := &reader{data: body}
+	r.uint(6) // table id
+	r.uint(2) // flags
+	if typ >= eventWriteRowsV2 {
+		// the length includes itself
+		r.bytes(int(r.uint(2)) - 2)
+	}
+
+	n := int(r.lenenc())
+	if n != len(table.types) {
+		return RowsEvent{}, errors.Wrapf(ErrCorrupted, "%d columns in rows of %s with %d columns", n, table.FullName(), len(table.types))
+	}
+	present := r.bytes((n + 7) / 8)
+	presentAfter := present
+	action := rowsAction(typ)
+	if action == ActionUpdate {
+		presentAfter = r.bytes((n + 7) / 8)
+	}
+	if r.err != nil {
+		return RowsEvent{}, errors.Wrap(r.err, "failed to parse rows")
+	}
+
+	event := RowsEvent{Table: table, Action: action}
+	for r.remaining() > 0 {
+		row, err := parseRow(r, table, present)
+		if err != nil {
+			return RowsEvent{}, err
+		}
+
+		switch action {
+		case ActionInsert:
+			event.Changes = append(event.Changes, Change{After: row})
+		case ActionDelete:
+			event.Changes = append(event.Changes, Change{Before: row})
+		case ActionUpdate:
+			after, err := parseRow(r, table, presentAfter)
+			if err != nil {
+				return RowsEvent{}, err
+			}
+			event.Changes = append(event.Changes, Change{Before: row, After: after})
+		}
+	}
+
+	return event, nil
+}
+
+func bitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<(uint(i)%8)) != 0
+}
+
+// parseRow leaves columns missing in the image nil.
+func parseRow(r *reader, table *Table, present []byte) (Row, error) {
+	count := 0
+	for i := range table.types {
+		if bitSet(present, i) {
+			count++
+		}
+	}
+	nulls := r.bytes((count + 7) / 8)
+
+	row := make(Row, len(table.types))
+	nullIdx := 0
+	for i, typ := range table.types {
+		if !bitSet(present, i) {
+			continue
+		}
+		isNull := r.err == nil && bitSet(nulls, nullIdx)
+		nullIdx++
+		if isNull {
+			continue
+		}
+
+		value, err := decodeValue(r, typ, table.meta[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode column %d of %s", i, table.FullName())
+		}
+		row[i] = value
+	}
+	if r.err != nil {
+		return nil, errors.Wrapf(r.err, "failed to parse row of %s", table.FullName())
+	}
+
+	return row, nil
+}
+
+func decodeValue(r *reader, typ byte, meta uint16) (interface{}, error) {
+	switch typ {
+	case typeNull:
+		return nil, nil
+	case typeTiny:
+		return int64(int8(r.uint(1))), nil
+	case typeShort:
+		return int64(int16(r.uint(2))), nil
+	case typeInt24:
+		v := int64(r.uint(3))
+		if v&0x800000 != 0 {
+			v -= 1 << 24
+		}
+		return v, nil
+	case typeLong:
+		return int64(int32(r.uint(4))), nil
+	case typeLongLong:
+		return int64(r.uint(8)), nil
+	case typeFloat:
+		return float64(math.Float32frombits(uint32(r.uint(4)))), nil
+	case typeDouble:
+		return math.Float64frombits(r.uint(8)), nil
+	case typeYear:
+		v := int64(r.uint(1))
+		if v != 0 {
+			v += 1900
+		}
+		return v, nil
+	case typeVarchar, typeVarString:
+		if meta < 256 {
+			return r.bytes(int(r.uint(1))), nil
+		}
+		return r.bytes(int(r.uint(2))), nil
+	case typeString:
+		return decodeString(r, meta)
+	case typeEnum:
+		return int64(r.uint(int(meta & 0xff))), nil
+	case typeSet:
+		return int64(r.uint(int(meta & 0xff))), nil
+	case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeGeometry, typeJSON:
+		return r.bytes(int(r.uint(int(meta)))), nil
+	case typeBit:
+		bits := int(meta>>8)*8 + int(meta&0xff)
+		return int64(bigEndian(r.bytes((bits + 7) / 8))), nil
+	case typeTimestamp:
+		return time.Unix(int64(r.uint(4)), 0).UTC(), nil
+	case typeTimestamp2:
+		sec := int64(bigEndian(r.bytes(4)))
+		return time.Unix(sec, fraction(r, meta)*1000).UTC(), nil
+	case typeDatetime2:
+		return decodeDatetime2(r, meta), nil
+	case typeDate:
+		v := r.uint(3)
+		if v == 0 {
+			return time.Time{}, nil
+		}
+		return time.Date(int(v>>9), time.Month((v>>5)&15), int(v&31), 0, 0, 0, 0, time.UTC), nil
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedType, "type %d", typ)
+	}
+}
+
+func decodeString(r *reader, meta uint16) (interface{}, error) {
+	realType := byte(meta >> 8)
+	switch realType {
+	case typeEnum, typeSet:
+		return int64(r.uint(int(meta & 0xff))), nil
+	}
+
+	// lengths above 255 keep their high bits in the real type
+	maxLen := int((((meta >> 4) & 0x300) ^ 0x300) + (meta & 0xff))
+	if maxLen < 256 {
+		return r.bytes(int(r.uint(1))), nil
+	}
+
+	return r.bytes(int(r.uint(2))), nil
+}
+
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+
+	return v
+}
+
+// fraction reads the fractional seconds of fsp digits as microseconds.
+func fraction(r *reader, fsp uint16) int64 {
+	n := int(fsp+1) / 2
+	if n == 0 {
+		return 0
+	}
+
+	v := int64(bigEndian(r.bytes(n)))
+	for i := n * 2; i < 6; i++ {
+		v *= 10
+	}
+
+	return v
+}
+
+func decodeDatetime2(r *reader, fsp uint16) time.Time {
+	v := int64(bigEndian(r.bytes(5))) - 0x8000000000
+	micro := fraction(r, fsp)
+	if v == 0 {
+		return time.Time{}
+	}
+
+	ymd := v >> 17
+	ym := ymd >> 5
+	hms := v & (1<<17 - 1)
+
+	return time.Date(
+		int(ym/13), time.Month(ym%13), int(ymd&31),
+		int(hms>>12), int((hms>>6)&63), int(hms&63),
+		int(micro*1000), time.UTC,
+	)
+}
@@ -0,0 +1,256 @@
+// Package binlog is a replication client streaming the row-based binlog of a
+// MySQL primary with GTID mode enabled, as transactions of decoded rows.
+package binlog
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/go-sql-driver/mysql"
+)
+
+// binlogThroughGTID makes the primary read the GTID set of the dump command.
+const binlogThroughGTID = 0x04
+
+var ErrCompressed = errors.New("compressed binlog transactions are not supported")
+
+type Config struct {
+	// DSN of the primary in the format of go-sql-driver/mysql, the user needs
+	// REPLICATION SLAVE and REPLICATION CLIENT privileges.
+	DSN string `mapstructure:"dsn"`
+	// ServerID must differ from the ids of the primary and its replicas.
+	ServerID uint32 `mapstructure:"server_id"`
+	// Tables limits decoded rows to "schema.table" names, rows of other tables
+	// are skipped. All tables are decoded when empty.
+	Tables []string `mapstructure:"tables"`
+	// HeartbeatPeriod makes the primary send heartbeats on an idle stream, the
+	// stream fails after three periods without events.
+	HeartbeatPeriod time.Duration `mapstructure:"heartbeat_period"`
+	DialTimeout     time.Duration `mapstructure:"dial_timeout"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.HeartbeatPeriod <= 0 {
+		c.HeartbeatPeriod = 5 * time.Second
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 5 * time.Second
+	}
+
+	return c
+}
+
+// Transaction is a committed transaction, Rows only hold changes of the
+// configured tables.
+type Transaction struct {
+	GTID      GTID
+	Timestamp time.Time
+	Rows      []RowsEvent
+}
+
+// Stream is not safe for concurrent use, except Close unblocking Next.
+type Stream struct {
+	cfg    Config
+	conn   *conn
+	tables map[uint64]*Table
+	filter map[string]bool
+
+	checksum bool
+	current  *Transaction
+}
+
+// Open starts streaming the transactions missing in executed.
+func Open(cfg Config, executed GTIDSet) (*Stream, error) {
+	cfg = cfg.withDefaults()
+
+	dsn, err := mysql.ParseDSN(cfg.DSN)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid dsn")
+	}
+	if dsn.Net != "tcp" {
+		return nil, errors.Errorf("unsupported network %s", dsn.Net)
+	}
+
+	c, err := dial(dsn.Addr, cfg.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stream{
+		cfg:    cfg,
+		conn:   c,
+		tables: make(map[uint64]*Table),
+	}
+	if len(cfg.Tables) > 0 {
+		s.filter = make(map[string]bool, len(cfg.Tables))
+		for _, table := range cfg.Tables {
+			s.filter[table] = true
+		}
+	}
+
+	if err := s.start(dsn, executed); err != nil {
+		c.Close() // nolint:errcheck
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Stream) start(dsn *mysql.Config, executed GTIDSet) error {
+	_ = s.conn.netConn.SetDeadline(time.Now().Add(s.cfg.DialTimeout))
+
+	if err := s.conn.handshake(dsn.User, dsn.Passwd, ""); err != nil {
+		return errors.Wrap(err, "failed to authenticate")
+	}
+
+	period := strconv.FormatInt(s.cfg.HeartbeatPeriod.Nanoseconds(), 10)
+	for _, query := range []string{
+		// the primary checks the variable to checksum events, older versions
+		// read the master_ names
+		"SET @source_binlog_checksum = @@global.binlog_checksum",
+		"SET @master_binlog_checksum = @@global.binlog_checksum",
+		"SET @source_heartbeat_period = " + period,
+		"SET @master_heartbeat_period = " + period,
+	} {
+		if err := s.conn.exec(query); err != nil {
+			return errors.Wrapf(err, "failed to run %q", query)
+		}
+	}
+
+	gtids := executed.encode()
+	data := binary.LittleEndian.AppendUint16(nil, binlogThroughGTID)
+	data = binary.LittleEndian.AppendUint32(data, s.cfg.ServerID)
+	data = binary.LittleEndian.AppendUint32(data, 0) // binlog name
+	data = binary.LittleEndian.AppendUint64(data, 4) // position
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(gtids)))
+	data = append(data, gtids...)
+
+	if err := s.conn.writeCommand(comBinlogDumpGTID, data); err != nil {
+		return errors.Wrap(err, "failed to request binlog dump")
+	}
+
+	_ = s.conn.netConn.SetDeadline(time.Time{})
+
+	return nil
+}
+
+// Close interrupts a blocked Next.
+func (s *Stream) Close() error {
+	return s.conn.Close()
+}
+
+// Next blocks until the next transaction is committed. An error breaks the
+// stream, it must be opened again from the last handled transaction.
+func (s *Stream) Next() (Transaction, error) {
+	for {
+		_ = s.conn.netConn.SetReadDeadline(time.Now().Add(3 * s.cfg.HeartbeatPeriod))
+
+		packet, err := s.conn.readPacket()
+		if err != nil {
+			return Transaction{}, errors.Wrap(err, "failed to read binlog")
+		}
+
+		switch {
+		case packet[0] == packetErr:
+			return Transaction{}, parseServerError(packet)
+		case packet[0] == packetEOF && len(packet) < 9:
+			return Transaction{}, io.EOF
+		}
+
+		tx, done, err := s.handle(packet[1:])
+		if err != nil {
+			return Transaction{}, err
+		}
+		if done {
+			return tx, nil
+		}
+	}
+}
+
+// handle reports whether event completed a transaction.
+func (s *Stream) handle(event []byte) (Transaction, bool, error) {
+	header, err := parseEventHeader(event)
+	if err != nil {
+		return Transaction{}, false, err
+	}
+
+	if header.Type == eventFormatDescription {
+		alg, err := parseChecksumAlgorithm(event)
+		if err != nil {
+			return Transaction{}, false, err
+		}
+		s.checksum = alg == checksumCRC32
+	}
+	if s.checksum {
+		event, err = verifyChecksum(event)
+		if err != nil {
+			return Transaction{}, false, errors.Wrapf(err, "event %d at %d", header.Type, header.LogPos)
+		}
+	}
+	body := event[eventHeaderSize:]
+
+	switch header.Type {
+	case eventGTID:
+		gtid, err := parseGTIDEvent(body)
+		if err != nil {
+			return Transaction{}, false, err
+		}
+		s.current = &Transaction{
+			GTID:      gtid,
+			Timestamp: time.Unix(int64(header.Timestamp), 0),
+		}
+	case eventQuery:
+		query, err := parseQueryEvent(body)
+		if err != nil {
+			return Transaction{}, false, err
+		}
+		// DDL is a transaction of its own, others end with COMMIT or XID
+		if s.current != nil && !strings.EqualFold(query, "BEGIN") {
+			return s.commit()
+		}
+	case eventXID:
+		if s.current != nil {
+			return s.commit()
+		}
+	case eventTableMap:
+		table, err := parseTableMap(body)
+		if err != nil {
+			return Transaction{}, false, err
+		}
+		s.tables[table.ID] = table
+	case eventWriteRowsV1, eventUpdateRowsV1, eventDeleteRowsV1,
+		eventWriteRowsV2, eventUpdateRowsV2, eventDeleteRowsV2:
+		if s.current == nil {
+			return Transaction{}, false, nil
+		}
+
+		table, ok := s.tables[rowsTableID(body)]
+		if !ok {
+			return Transaction{}, false, errors.Wrapf(ErrCorrupted, "rows of unknown table %d", rowsTableID(body))
+		}
+		if s.filter != nil && !s.filter[table.FullName()] {
+			return Transaction{}, false, nil
+		}
+
+		rows, err := parseRows(header.Type, body, table)
+		if err != nil {
+			return Transaction{}, false, err
+		}
+		s.current.Rows = append(s.current.Rows, rows)
+	case eventTransactionData:
+		return Transaction{}, false, ErrCompressed
+	}
+
+	return Transaction{}, false, nil
+}
+
+func (s *Stream) commit() (Transaction, bool, error) {
+	tx := *s.current
+	s.current = nil
+
+	return tx, true, nil
+}
@@ -0,0 +1,186 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/jmoiron/sqlx"
+)
+
+type PoolConfig struct {
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+}
+
+func (c PoolConfig) withDefaults() PoolConfig {
+	if c.MaxOpenConns <= 0 {
+		c.MaxOpenConns = 50
+	}
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = 10
+	}
+	if c.MaxIdleConns > c.MaxOpenConns {
+		c.MaxIdleConns = c.MaxOpenConns
+	}
+	if c.ConnMaxLifetime <= 0 {
+		c.ConnMaxLifetime = 5 * time.Minute
+	}
+	if c.ConnMaxIdleTime <= 0 {
+		c.ConnMaxIdleTime = time.Minute
+	}
+
+	return c
+}
+
+func (c PoolConfig) apply(db *sqlx.DB) {
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
+
+type queryStat struct {
+	QueryDuration stat.TimerCtor   `labels:"db,op,status"`
+	SlowQueries   stat.CounterCtor `labels:"db,op"`
+}
+
+// instrument times queries, bounds them by a timeout and logs the slow ones.
+type instrument struct {
+	name          string
+	queryTimeout  time.Duration
+	slowThreshold time.Duration
+	stat          *queryStat
+	logger        log.Logger
+}
+
+func (i instrument) observe(ctx context.Context, op string, query string, timeout bool, run func(ctx context.Context) error) (err error) {
+	if timeout && i.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.queryTimeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	timer := i.stat.QueryDuration.Timer(ctx).Start()
+	defer func() {
+		statErr := err
+		if statErr == sql.ErrNoRows {
+			statErr = nil
+		}
+		status := stat.TypedErrorLabel(ctx, statErr)
+		timer.WithLabels(stat.Labels{"db": i.name, "op": op, "status": status}).Stop()
+
+		if elapsed := time.Since(started); i.slowThreshold > 0 && elapsed >= i.slowThreshold {
+			i.stat.SlowQueries.Counter(ctx).WithLabels(stat.Labels{"db": i.name, "op": op}).Add(1)
+			// arguments are not logged, they may hold user data
+			i.logger.WithFields(log.Fields{
+				"db":       i.name,
+				"op":       op,
+				"query":    query,
+				"duration": elapsed.String(),
+			}).Warn("slow query")
+		}
+	}()
+
+	return run(ctx)
+}
+
+// DB is a connection pool with instrumented Get, Select, Exec, NamedExec and Queryx.
+// Other sqlx methods are passed through as is.
+type DB struct {
+	*sqlx.DB
+	instrument
+}
+
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.observe(ctx, "get", query, true, func(ctx context.Context) error {
+		return db.DB.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.observe(ctx, "select", query, true, func(ctx context.Context) error {
+		return db.DB.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	err = db.observe(ctx, "exec", query, true, func(ctx context.Context) error {
+		res, err = db.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{}) (res sql.Result, err error) {
+	err = db.observe(ctx, "exec", query, true, func(ctx context.Context) error {
+		res, err = db.DB.NamedExecContext(ctx, query, arg)
+		return err
+	})
+	return res, err
+}
+
+// QueryxContext is timed until the first row, rows outlive the call so no timeout applies.
+func (db *DB) QueryxContext(ctx context.Context, query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+	err = db.observe(ctx, "query", query, false, func(ctx context.Context) error {
+		rows, err = db.DB.QueryxContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// BeginTxx starts a transaction whose statements are instrumented like the ones of db.
+func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, instrument: db.instrument}, nil
+}
+
+type Tx struct {
+	*sqlx.Tx
+	instrument
+}
+
+func (tx *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return tx.observe(ctx, "get", query, true, func(ctx context.Context) error {
+		return tx.Tx.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return tx.observe(ctx, "select", query, true, func(ctx context.Context) error {
+		return tx.Tx.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	err = tx.observe(ctx, "exec", query, true, func(ctx context.Context) error {
+		res, err = tx.Tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+func (tx *Tx) NamedExecContext(ctx context.Context, query string, arg interface{}) (res sql.Result, err error) {
+	err = tx.observe(ctx, "exec", query, true, func(ctx context.Context) error {
+		res, err = tx.Tx.NamedExecContext(ctx, query, arg)
+		return err
+	})
+	return res, err
+}
+
+func (tx *Tx) QueryxContext(ctx context.Context, query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+	err = tx.observe(ctx, "query", query, false, func(ctx context.Context) error {
+		rows, err = tx.Tx.QueryxContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
@@ -0,0 +1,51 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveQueryTimeout(t *testing.T) {
+	var s queryStat
+	stat.NewRegistrar(stub.NewStubRegistry()).MustRegister(&s)
+
+	i := instrument{name: "primary", queryTimeout: time.Second, stat: &s, logger: log.Null}
+
+	err := i.observe(context.Background(), "get", "SELECT 1", true, func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// a shorter deadline of the caller wins
+	short, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err = i.observe(short, "get", "SELECT 1", true, func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		shortDeadline, _ := short.Deadline()
+		require.Equal(t, shortDeadline, deadline)
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = i.observe(context.Background(), "query", "SELECT 1", false, func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		require.False(t, ok)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestPoolConfigDefaults(t *testing.T) {
+	cfg := PoolConfig{MaxOpenConns: 4, MaxIdleConns: 8}.withDefaults()
+	require.Equal(t, 4, cfg.MaxIdleConns)
+	require.Equal(t, 5*time.Minute, cfg.ConnMaxLifetime)
+}
@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	errTooManyConnections = 1040
+	errDuplicateEntry     = 1062
+	errLockWaitTimeout    = 1205
+	errDeadlock           = 1213
+	errRowIsReferenced    = 1451
+	errNoReferencedRow    = 1452
+)
+
+// Errors left untranslated by the rules of a repository. Deadlocks, lock wait
+// timeouts and exhausted connections also match errors.ErrUnavailable.
+var (
+	ErrDuplicate          = errors.Typed("mysql_duplicate", "duplicate key")
+	ErrForeignKey         = errors.Typed("mysql_foreign_key", "foreign key constraint fails")
+	ErrDeadlock           = errors.Typed("mysql_deadlock", "deadlock")
+	ErrLockTimeout        = errors.Typed("mysql_lock_timeout", "lock wait timeout exceeded")
+	ErrTooManyConnections = errors.Typed("mysql_too_many_connections", "too many connections")
+)
+
+var (
+	duplicateKeyRe = regexp.MustCompile(`for key '([^']+)'`)
+	constraintRe   = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+	referencesRe   = regexp.MustCompile("REFERENCES `([^`]+)`")
+)
+
+// Errors translates driver errors of a repository to errors of its entities.
+// The driver error stays in the chain, so IsDeadlock keeps working.
+type Errors struct {
+	// NotFound replaces sql.ErrNoRows.
+	NotFound error
+	// Duplicates by key name, "users.username" as MySQL 8 reports it or a
+	// bare "username".
+	Duplicates map[string]error
+	// ForeignKeys by constraint name or, for a missing parent row, by the
+	// referenced table.
+	ForeignKeys map[string]error
+}
+
+// WithNotFound returns a copy of e for a query that looks up another entity.
+func (e Errors) WithNotFound(notFound error) Errors {
+	e.NotFound = notFound
+	return e
+}
+
+func (e Errors) Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		if e.NotFound == nil {
+			return err
+		}
+		return errors.Transform(err, e.NotFound)
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return err
+	}
+
+	switch mysqlErr.Number {
+	case errDuplicateEntry:
+		return errors.Transform(err, e.duplicate(mysqlErr.Message))
+	case errRowIsReferenced, errNoReferencedRow:
+		return errors.Transform(err, e.foreignKey(mysqlErr))
+	case errDeadlock:
+		return errors.Transform(errors.Transform(err, errors.ErrUnavailable), ErrDeadlock)
+	case errLockWaitTimeout:
+		return errors.Transform(errors.Transform(err, errors.ErrUnavailable), ErrLockTimeout)
+	case errTooManyConnections:
+		return errors.Transform(errors.Transform(err, errors.ErrUnavailable), ErrTooManyConnections)
+	}
+
+	return err
+}
+
+func (e Errors) duplicate(message string) error {
+	match := duplicateKeyRe.FindStringSubmatch(message)
+	if match == nil {
+		return ErrDuplicate
+	}
+
+	key := match[1]
+	if target, ok := e.Duplicates[key]; ok {
+		return target
+	}
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		if target, ok := e.Duplicates[key[i+1:]]; ok {
+			return target
+		}
+	}
+
+	return ErrDuplicate
+}
+
+func (e Errors) foreignKey(mysqlErr *mysql.MySQLError) error {
+	if match := constraintRe.FindStringSubmatch(mysqlErr.Message); match != nil {
+		if target, ok := e.ForeignKeys[match[1]]; ok {
+			return target
+		}
+	}
+
+	// a missing parent means the referenced entity is not found, a referenced
+	// parent has no such meaning
+	if mysqlErr.Number == errNoReferencedRow {
+		if match := referencesRe.FindStringSubmatch(mysqlErr.Message); match != nil {
+			if target, ok := e.ForeignKeys[match[1]]; ok {
+				return target
+			}
+		}
+	}
+
+	return ErrForeignKey
+}
@@ -0,0 +1,116 @@
+package mysql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errUserExists       = errors.Typed("user_exists", "user exists")
+	errFriendshipExists = errors.Typed("friendship_exists", "friendship exists")
+	errUserNotFound     = errors.Typed("user_not_found", "user not found")
+	errPostNotFound     = errors.Typed("post_not_found", "post not found")
+)
+
+func TestErrorsTranslate(t *testing.T) {
+	rules := Errors{
+		NotFound: errUserNotFound,
+		Duplicates: map[string]error{
+			"users.username":  errUserExists,
+			"friends.PRIMARY": errFriendshipExists,
+			"email":           errUserExists,
+		},
+		ForeignKeys: map[string]error{
+			"users": errUserNotFound,
+		},
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "no rows",
+			err:  sql.ErrNoRows,
+			want: errUserNotFound,
+		},
+		{
+			name: "duplicate username",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'bob' for key 'users.username'"},
+			want: errUserExists,
+		},
+		{
+			name: "duplicate friendship",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '\x01-\x02' for key 'friends.PRIMARY'"},
+			want: errFriendshipExists,
+		},
+		{
+			name: "duplicate matched by bare key",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'bob@mail.ru' for key 'users.email'"},
+			want: errUserExists,
+		},
+		{
+			name: "unknown duplicate",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'posts.PRIMARY'"},
+			want: ErrDuplicate,
+		},
+		{
+			name: "missing parent",
+			err: &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+				"(`otus`.`friends`, CONSTRAINT `friends_ibfk_1` FOREIGN KEY (`user1`) REFERENCES `users` (`uuid`))"},
+			want: errUserNotFound,
+		},
+		{
+			name: "referenced parent",
+			err: &mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row: a foreign key constraint fails " +
+				"(`otus`.`friends`, CONSTRAINT `friends_ibfk_1` FOREIGN KEY (`user1`) REFERENCES `users` (`uuid`))"},
+			want: ErrForeignKey,
+		},
+		{
+			name: "deadlock",
+			err:  &mysql.MySQLError{Number: 1213, Message: "Deadlock found"},
+			want: ErrDeadlock,
+		},
+		{
+			name: "lock timeout",
+			err:  &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"},
+			want: ErrLockTimeout,
+		},
+		{
+			name: "too many connections",
+			err:  &mysql.MySQLError{Number: 1040, Message: "Too many connections"},
+			want: ErrTooManyConnections,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := rules.Translate(errors.Wrap(tc.err, "failed to query"))
+			require.ErrorIs(t, err, tc.want)
+			// the driver error is kept
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestErrorsTranslateUnavailable(t *testing.T) {
+	err := Errors{}.Translate(&mysql.MySQLError{Number: errDeadlock, Message: "Deadlock found"})
+	require.True(t, errors.Is(err, errors.ErrUnavailable))
+	require.True(t, IsDeadlock(err))
+	require.Equal(t, "mysql_deadlock", errors.Type(err))
+
+	err = Errors{}.Translate(&mysql.MySQLError{Number: errDuplicateEntry, Message: "Duplicate entry"})
+	require.False(t, errors.Is(err, errors.ErrUnavailable))
+}
+
+func TestErrorsWithNotFound(t *testing.T) {
+	rules := Errors{NotFound: errUserNotFound}
+
+	require.ErrorIs(t, rules.WithNotFound(errPostNotFound).Translate(sql.ErrNoRows), errPostNotFound)
+	require.ErrorIs(t, rules.Translate(sql.ErrNoRows), errUserNotFound)
+	require.Equal(t, sql.ErrNoRows, Errors{}.Translate(sql.ErrNoRows))
+	require.NoError(t, rules.Translate(nil))
+}
@@ -0,0 +1,430 @@
+// Package mysql provides shared, instrumented connection pools to a primary
+// and health-checked replicas with read-your-writes routing.
+package mysql
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+type Balancer string
+
+const (
+	BalancerRoundRobin   Balancer = "round_robin"
+	BalancerLeastLatency Balancer = "least_latency"
+)
+
+type Config struct {
+	Primary  string   `mapstructure:"primary"`
+	Replicas []string `mapstructure:"replicas"`
+	// Balancer picks among healthy replicas, round_robin by default.
+	Balancer Balancer `mapstructure:"balancer"`
+
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+	HealthCheckTimeout  time.Duration `mapstructure:"health_check_timeout"`
+	// MaxReplicaLag takes replicas lagging behind more than that out of rotation.
+	MaxReplicaLag time.Duration `mapstructure:"max_replica_lag"`
+	// ReadYourWritesWindow is how long reads of a written key go to the primary.
+	// It should exceed the usual replica lag.
+	ReadYourWritesWindow time.Duration `mapstructure:"read_your_writes_window"`
+
+	// Pool applies to the primary and to each replica.
+	Pool PoolConfig `mapstructure:"pool"`
+	// QueryTimeout bounds queries without a shorter context deadline, zero disables it.
+	QueryTimeout time.Duration `mapstructure:"query_timeout"`
+	// SlowQueryThreshold logs queries running longer, zero disables the log.
+	SlowQueryThreshold time.Duration `mapstructure:"slow_query_threshold"`
+
+	Tx TxConfig `mapstructure:"tx"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Balancer == "" {
+		c.Balancer = BalancerRoundRobin
+	}
+	if c.HealthCheckInterval <= 0 {
+		c.HealthCheckInterval = 5 * time.Second
+	}
+	if c.HealthCheckTimeout <= 0 {
+		c.HealthCheckTimeout = time.Second
+	}
+	if c.MaxReplicaLag <= 0 {
+		c.MaxReplicaLag = 10 * time.Second
+	}
+	if c.ReadYourWritesWindow <= 0 {
+		c.ReadYourWritesWindow = 5 * time.Second
+	}
+
+	c.Pool = c.Pool.withDefaults()
+	c.Tx = c.Tx.withDefaults()
+
+	return c
+}
+
+type providerStat struct {
+	// ReplicaLag is seconds behind the primary, -1 when unknown.
+	ReplicaLag     stat.GaugeCtor   `labels:"replica"`
+	ReplicaHealthy stat.GaugeCtor   `labels:"replica"`
+	Reads          stat.CounterCtor `labels:"target"`
+	TxRetries      stat.CounterCtor
+}
+
+type replica struct {
+	name string
+	db   *DB
+
+	healthy atomic.Bool
+	// latency is the smoothed health check round trip in nanoseconds.
+	latency atomic.Int64
+
+	// last reported gauge values, gauges only support deltas
+	reportedLag     float64
+	reportedHealthy float64
+}
+
+// Provider routes writes to the primary and reads to replicas. Reads of keys
+// written within ReadYourWritesWindow, reads under WithPrimary and reads
+// without healthy replicas go to the primary. Written keys are tracked in
+// process, so read-your-writes holds for requests served by the same instance.
+type Provider struct {
+	cfg      Config
+	primary  *DB
+	replicas []*replica
+	next     atomic.Uint64
+
+	writesMu sync.Mutex
+	writes   map[string]time.Time
+
+	logger    log.Logger
+	Stat      providerStat
+	QueryStat queryStat
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewProvider(cfg Config, registry stat.Registry, logger log.Logger) (*Provider, error) {
+	cfg = cfg.withDefaults()
+
+	switch cfg.Balancer {
+	case BalancerRoundRobin, BalancerLeastLatency:
+	default:
+		return nil, errors.Errorf("unknown balancer %q", cfg.Balancer)
+	}
+
+	primary, err := sqlx.Open("mysql", cfg.Primary)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid primary dsn")
+	}
+	cfg.Pool.apply(primary)
+
+	if err := primary.Ping(); err != nil {
+		_ = primary.Close()
+		return nil, errors.Wrap(err, "failed to connect to primary")
+	}
+
+	p := &Provider{
+		cfg:    cfg,
+		writes: make(map[string]time.Time),
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	registrar := stat.NewRegistrar(registry.ForSubsystem("mysql"))
+	registrar.MustRegister(&p.Stat)
+	registrar.MustRegister(&p.QueryStat)
+
+	p.primary = p.wrap("primary", primary)
+
+	for i, dsn := range cfg.Replicas {
+		// replicas may be down at start, they join the rotation after a successful check
+		db, err := sqlx.Open("mysql", dsn)
+		if err != nil {
+			_ = p.Close()
+			return nil, errors.Wrapf(err, "invalid replica %d dsn", i)
+		}
+
+		cfg.Pool.apply(db)
+
+		name := replicaName(i, dsn)
+		p.replicas = append(p.replicas, &replica{name: name, db: p.wrap(name, db)})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.checkReplicas(ctx)
+	go p.run(ctx)
+
+	return p, nil
+}
+
+func (p *Provider) wrap(name string, db *sqlx.DB) *DB {
+	return &DB{
+		DB: db,
+		instrument: instrument{
+			name:          name,
+			queryTimeout:  p.cfg.QueryTimeout,
+			slowThreshold: p.cfg.SlowQueryThreshold,
+			stat:          &p.QueryStat,
+			logger:        p.logger,
+		},
+	}
+}
+
+// Primary returns the primary pool, bypassing the transaction of ctx; use Writer in repositories.
+func (p *Provider) Primary() *DB {
+	return p.primary
+}
+
+// Reader returns a connection for reads of keys. Keys name what the read
+// depends on, e.g. "user:<id>"; any of them written recently routes it to the primary.
+// Reads under InTx use its transaction.
+func (p *Provider) Reader(ctx context.Context, keys ...string) Querier {
+	if scope := txFromContext(ctx); scope != nil {
+		return scope.tx
+	}
+
+	if primaryRequired(ctx) || p.recentlyWritten(keys) {
+		p.Stat.Reads.Counter(ctx).WithLabels(stat.Labels{"target": "primary"}).Add(1)
+		return p.primary
+	}
+
+	r := p.pick()
+	if r == nil {
+		p.Stat.Reads.Counter(ctx).WithLabels(stat.Labels{"target": "primary"}).Add(1)
+		return p.primary
+	}
+
+	p.Stat.Reads.Counter(ctx).WithLabels(stat.Labels{"target": r.name}).Add(1)
+	return r.db
+}
+
+// Wrote marks keys as written through the primary, call it after the write commits.
+func (p *Provider) Wrote(keys ...string) {
+	if len(p.replicas) == 0 {
+		return
+	}
+
+	until := time.Now().Add(p.cfg.ReadYourWritesWindow)
+
+	p.writesMu.Lock()
+	defer p.writesMu.Unlock()
+
+	for _, key := range keys {
+		p.writes[key] = until
+	}
+}
+
+func (p *Provider) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+		<-p.done
+	}
+
+	err := p.primary.Close()
+	for _, r := range p.replicas {
+		if rErr := r.db.Close(); rErr != nil {
+			err = rErr
+		}
+	}
+
+	return err
+}
+
+func (p *Provider) recentlyWritten(keys []string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+
+	now := time.Now()
+
+	p.writesMu.Lock()
+	defer p.writesMu.Unlock()
+
+	for _, key := range keys {
+		if until, ok := p.writes[key]; ok && now.Before(until) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Provider) pick() *replica {
+	switch p.cfg.Balancer {
+	case BalancerLeastLatency:
+		var best *replica
+		for _, r := range p.replicas {
+			if r.healthy.Load() && (best == nil || r.latency.Load() < best.latency.Load()) {
+				best = r
+			}
+		}
+		return best
+	default:
+		healthy := make([]*replica, 0, len(p.replicas))
+		for _, r := range p.replicas {
+			if r.healthy.Load() {
+				healthy = append(healthy, r)
+			}
+		}
+		if len(healthy) == 0 {
+			return nil
+		}
+
+		return healthy[p.next.Add(1)%uint64(len(healthy))]
+	}
+}
+
+func (p *Provider) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkReplicas(ctx)
+			p.expireWrites()
+		}
+	}
+}
+
+func (p *Provider) checkReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range p.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			p.checkReplica(ctx, r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (p *Provider) checkReplica(ctx context.Context, r *replica) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.HealthCheckTimeout)
+	defer cancel()
+
+	started := time.Now()
+	// health checks bypass the query stats
+	lag, err := replicaLag(ctx, r.db.DB)
+	elapsed := time.Since(started)
+
+	healthy := err == nil && lag >= 0 && lag <= p.cfg.MaxReplicaLag.Seconds()
+	if wasHealthy := r.healthy.Swap(healthy); wasHealthy != healthy {
+		logger := p.logger.WithField("replica", r.name).WithField("lag", lag)
+		if err != nil {
+			logger = logger.WithError(err)
+		}
+		logger.Warnf("replica healthy: %t", healthy)
+	}
+
+	if err == nil {
+		// exponential moving average keeps one slow check from flipping the choice
+		if prev := r.latency.Load(); prev == 0 {
+			r.latency.Store(int64(elapsed))
+		} else {
+			r.latency.Store((prev*4 + int64(elapsed)) / 5)
+		}
+	} else {
+		lag = -1
+	}
+
+	labels := stat.Labels{"replica": r.name}
+	p.Stat.ReplicaLag.Gauge(ctx).WithLabels(labels).Add(lag - r.reportedLag)
+	r.reportedLag = lag
+
+	healthyValue := 0.0
+	if healthy {
+		healthyValue = 1
+	}
+	p.Stat.ReplicaHealthy.Gauge(ctx).WithLabels(labels).Add(healthyValue - r.reportedHealthy)
+	r.reportedHealthy = healthyValue
+}
+
+func (p *Provider) expireWrites() {
+	now := time.Now()
+
+	p.writesMu.Lock()
+	defer p.writesMu.Unlock()
+
+	for key, until := range p.writes {
+		if !now.Before(until) {
+			delete(p.writes, key)
+		}
+	}
+}
+
+// replicaLag returns seconds behind the source, -1 if replication is stopped.
+func replicaLag(ctx context.Context, db *sqlx.DB) (float64, error) {
+	rows, err := db.QueryxContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		// before 8.0.22
+		rows, err = db.QueryxContext(ctx, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to query replica status")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return -1, errors.Wrap(err, "failed to read replica status")
+		}
+		return -1, errors.New("server is not a replica")
+	}
+
+	status := make(map[string]interface{})
+	if err := rows.MapScan(status); err != nil {
+		return -1, errors.Wrap(err, "failed to scan replica status")
+	}
+
+	for _, column := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+		value, ok := status[column]
+		if !ok {
+			continue
+		}
+
+		raw, ok := value.([]byte)
+		if !ok {
+			// NULL while the replication threads are not running
+			return -1, nil
+		}
+
+		return strconv.ParseFloat(string(raw), 64)
+	}
+
+	return -1, errors.New("replica status has no lag column")
+}
+
+// replicaName labels metrics and logs with the replica address, never the credentials.
+func replicaName(i int, dsn string) string {
+	if parsed, err := mysql.ParseDSN(dsn); err == nil && parsed.Addr != "" {
+		return parsed.Addr
+	}
+
+	return "replica-" + strconv.Itoa(i)
+}
+
+type primaryKey struct{}
+
+// WithPrimary makes all reads under ctx go to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func primaryRequired(ctx context.Context) bool {
+	required, _ := ctx.Value(primaryKey{}).(bool)
+	return required
+}
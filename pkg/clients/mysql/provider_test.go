@@ -0,0 +1,136 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func testProvider(t *testing.T, balancer Balancer, replicas int) *Provider {
+	open := func() *sqlx.DB {
+		// sqlx.Open does not connect
+		db, err := sqlx.Open("mysql", "user:password@tcp(127.0.0.1:1)/db")
+		require.NoError(t, err)
+		return db
+	}
+
+	p := &Provider{
+		cfg:    Config{Balancer: balancer}.withDefaults(),
+		writes: make(map[string]time.Time),
+		logger: log.Null,
+	}
+	registrar := stat.NewRegistrar(stub.NewStubRegistry())
+	registrar.MustRegister(&p.Stat)
+	registrar.MustRegister(&p.QueryStat)
+	p.primary = p.wrap("primary", open())
+
+	for i := 0; i < replicas; i++ {
+		name := replicaName(i, "")
+		r := &replica{name: name, db: p.wrap(name, open())}
+		r.healthy.Store(true)
+		p.replicas = append(p.replicas, r)
+	}
+
+	return p
+}
+
+func TestReaderRoundRobin(t *testing.T) {
+	p := testProvider(t, BalancerRoundRobin, 3)
+	ctx := context.Background()
+
+	p.replicas[1].healthy.Store(false)
+
+	seen := map[Querier]int{}
+	for i := 0; i < 10; i++ {
+		seen[p.Reader(ctx)]++
+	}
+
+	require.Len(t, seen, 2)
+	require.Equal(t, 5, seen[p.replicas[0].db])
+	require.Equal(t, 5, seen[p.replicas[2].db])
+}
+
+func TestReaderLeastLatency(t *testing.T) {
+	p := testProvider(t, BalancerLeastLatency, 3)
+	ctx := context.Background()
+
+	p.replicas[0].latency.Store(int64(3 * time.Millisecond))
+	p.replicas[1].latency.Store(int64(time.Millisecond))
+	p.replicas[2].latency.Store(int64(2 * time.Millisecond))
+	require.Same(t, p.replicas[1].db, p.Reader(ctx))
+
+	p.replicas[1].healthy.Store(false)
+	require.Same(t, p.replicas[2].db, p.Reader(ctx))
+}
+
+func TestReaderFallsBackToPrimary(t *testing.T) {
+	p := testProvider(t, BalancerRoundRobin, 2)
+	ctx := context.Background()
+
+	p.replicas[0].healthy.Store(false)
+	p.replicas[1].healthy.Store(false)
+	require.Same(t, p.primary, p.Reader(ctx))
+
+	noReplicas := testProvider(t, BalancerRoundRobin, 0)
+	require.Same(t, noReplicas.primary, noReplicas.Reader(ctx))
+}
+
+func TestReaderReadYourWrites(t *testing.T) {
+	p := testProvider(t, BalancerRoundRobin, 2)
+	ctx := context.Background()
+
+	p.Wrote("user:1")
+	require.Same(t, p.primary, p.Reader(ctx, "user:1"))
+	require.Same(t, p.primary, p.Reader(ctx, "user:2", "user:1"))
+	require.NotSame(t, p.primary, p.Reader(ctx, "user:2"))
+
+	require.Same(t, p.primary, p.Reader(WithPrimary(ctx), "user:2"))
+
+	p.writes["user:1"] = time.Now().Add(-time.Second)
+	require.NotSame(t, p.primary, p.Reader(ctx, "user:1"))
+
+	p.expireWrites()
+	require.Empty(t, p.writes)
+}
+
+// statusDriver answers every query with no rows, like SHOW REPLICA STATUS on a primary.
+type statusDriver struct{}
+
+func (statusDriver) Open(string) (driver.Conn, error) { return statusConn{}, nil }
+
+type statusConn struct{ driver.Conn }
+
+func (statusConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return noRows{}, nil
+}
+
+func (statusConn) Close() error { return nil }
+
+type noRows struct{}
+
+func (noRows) Columns() []string         { return []string{"Seconds_Behind_Source"} }
+func (noRows) Close() error              { return nil }
+func (noRows) Next([]driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("replica-status", statusDriver{})
+}
+
+func TestReplicaLagOnPrimary(t *testing.T) {
+	db, err := sqlx.Open("replica-status", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	lag, err := replicaLag(context.Background(), db)
+	require.EqualError(t, err, "server is not a replica")
+	require.Equal(t, float64(-1), lag)
+}
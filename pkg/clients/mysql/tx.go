@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Querier is implemented by *DB and *Tx, so repositories do not care whether
+// they run inside a transaction.
+type Querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+}
+
+type TxConfig struct {
+	// DeadlockRetries is how many times a transaction failed with a deadlock
+	// is rerun, -1 disables retries.
+	DeadlockRetries int           `mapstructure:"deadlock_retries"`
+	RetryDelay      time.Duration `mapstructure:"retry_delay"`
+}
+
+func (c TxConfig) withDefaults() TxConfig {
+	if c.DeadlockRetries == 0 {
+		c.DeadlockRetries = 3
+	}
+	if c.DeadlockRetries < 0 {
+		c.DeadlockRetries = 0
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = 20 * time.Millisecond
+	}
+
+	return c
+}
+
+type txKey struct{}
+
+type txScope struct {
+	tx *Tx
+	// depth of nested InTx calls, names their savepoints
+	depth int
+}
+
+func txFromContext(ctx context.Context) *txScope {
+	scope, _ := ctx.Value(txKey{}).(*txScope)
+	return scope
+}
+
+// InTx runs fn in a transaction on the primary. Repositories called with the
+// ctx passed to fn use that transaction. A nested InTx runs within a savepoint,
+// so its failure rolls back only its own changes. The whole transaction is
+// rerun on a deadlock, fn must be safe to repeat.
+func (p *Provider) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if scope := txFromContext(ctx); scope != nil {
+		return p.inSavepoint(ctx, scope, fn)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = p.runTx(ctx, fn)
+		if !IsDeadlock(err) || attempt >= p.cfg.Tx.DeadlockRetries {
+			return err
+		}
+
+		p.Stat.TxRetries.Counter(ctx).Add(1)
+		p.logger.ForCtx(ctx).WithError(err).Warnf("deadlock, retrying transaction, attempt %d", attempt+1)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(p.cfg.Tx.RetryDelay * time.Duration(attempt+1)):
+		}
+	}
+}
+
+func (p *Provider) runTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := p.primary.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	if err := fn(context.WithValue(ctx, txKey{}, &txScope{tx: tx})); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+func (p *Provider) inSavepoint(ctx context.Context, scope *txScope, fn func(ctx context.Context) error) error {
+	nested := &txScope{tx: scope.tx, depth: scope.depth + 1}
+	savepoint := "sp_" + strconv.Itoa(nested.depth)
+
+	if _, err := scope.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return errors.Wrap(err, "failed to create savepoint")
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, nested)); err != nil {
+		// a deadlock has already rolled back the whole transaction
+		if !IsDeadlock(err) {
+			if _, rbErr := scope.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rbErr != nil {
+				return errors.Wrap(rbErr, "failed to roll back to savepoint")
+			}
+		}
+		return err
+	}
+
+	if _, err := scope.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return errors.Wrap(err, "failed to release savepoint")
+	}
+
+	return nil
+}
+
+// Writer returns the transaction of ctx, the primary otherwise.
+func (p *Provider) Writer(ctx context.Context) Querier {
+	if scope := txFromContext(ctx); scope != nil {
+		return scope.tx
+	}
+
+	return p.primary
+}
+
+// IsDeadlock reports whether err is the MySQL deadlock error 1213.
+func IsDeadlock(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errDeadlock
+}
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a driver logging statements, failing the ones listed in errs once.
+type recorder struct {
+	mu         sync.Mutex
+	statements []string
+	errs       map[string]error
+}
+
+func (r *recorder) record(query string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statements = append(r.statements, query)
+	if err, ok := r.errs[query]; ok {
+		delete(r.errs, query)
+		return err
+	}
+
+	return nil
+}
+
+func (r *recorder) Open(string) (driver.Conn, error) { return recorderConn{r}, nil }
+
+type recorderConn struct{ r *recorder }
+
+func (c recorderConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c recorderConn) Close() error { return nil }
+func (c recorderConn) Begin() (driver.Tx, error) {
+	return recorderTx(c), c.r.record("BEGIN")
+}
+func (c recorderConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), c.r.record(query)
+}
+
+type recorderTx recorderConn
+
+func (t recorderTx) Commit() error   { return t.r.record("COMMIT") }
+func (t recorderTx) Rollback() error { return t.r.record("ROLLBACK") }
+
+func testTxProvider(t *testing.T, errs map[string]error) (*Provider, *recorder) {
+	r := &recorder{errs: errs}
+	db := sqlx.NewDb(sql.OpenDB(connector{r}), "mysql")
+
+	p := &Provider{
+		cfg:    Config{Tx: TxConfig{RetryDelay: time.Millisecond}}.withDefaults(),
+		writes: make(map[string]time.Time),
+		logger: log.Null,
+	}
+	registrar := stat.NewRegistrar(stub.NewStubRegistry())
+	registrar.MustRegister(&p.Stat)
+	registrar.MustRegister(&p.QueryStat)
+	p.primary = p.wrap("primary", db)
+
+	return p, r
+}
+
+type connector struct{ r *recorder }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.r.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.r }
+
+func TestInTxSavepoints(t *testing.T) {
+	p, r := testTxProvider(t, nil)
+	ctx := context.Background()
+	errInner := errors.New("inner")
+
+	err := p.InTx(ctx, func(ctx context.Context) error {
+		_, err := p.Writer(ctx).ExecContext(ctx, "INSERT a")
+		require.NoError(t, err)
+
+		err = p.InTx(ctx, func(ctx context.Context) error {
+			_, err := p.Writer(ctx).ExecContext(ctx, "INSERT b")
+			require.NoError(t, err)
+			return errInner
+		})
+		require.ErrorIs(t, err, errInner)
+
+		return p.InTx(ctx, func(ctx context.Context) error {
+			_, err := p.Reader(ctx).ExecContext(ctx, "INSERT c")
+			return err
+		})
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"BEGIN",
+		"INSERT a",
+		"SAVEPOINT sp_1",
+		"INSERT b",
+		"ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"INSERT c",
+		"RELEASE SAVEPOINT sp_1",
+		"COMMIT",
+	}, r.statements)
+}
+
+func TestInTxRetriesDeadlock(t *testing.T) {
+	p, r := testTxProvider(t, map[string]error{
+		"INSERT a": &mysql.MySQLError{Number: errDeadlock, Message: "Deadlock found"},
+	})
+
+	calls := 0
+	err := p.InTx(context.Background(), func(ctx context.Context) error {
+		calls++
+		_, err := p.Writer(ctx).ExecContext(ctx, "INSERT a")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, []string{"BEGIN", "INSERT a", "ROLLBACK", "BEGIN", "INSERT a", "COMMIT"}, r.statements)
+}
+
+func TestInTxDoesNotRetryOtherErrors(t *testing.T) {
+	p, r := testTxProvider(t, map[string]error{
+		"INSERT a": &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"},
+	})
+
+	err := p.InTx(context.Background(), func(ctx context.Context) error {
+		_, err := p.Writer(ctx).ExecContext(ctx, "INSERT a")
+		return err
+	})
+	require.Error(t, err)
+	require.False(t, IsDeadlock(err))
+	require.Equal(t, []string{"BEGIN", "INSERT a", "ROLLBACK"}, r.statements)
+}
@@ -0,0 +1,122 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/stat"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	ErrPublishNacked = errors.Typed("rabbitmq_publish_nacked", "broker did not confirm message")
+	ErrPublish       = errors.Typed("rabbitmq_publish_fail", "failed to publish message")
+)
+
+type publisherStat struct {
+	PublishDuration stat.TimerCtor   `labels:"exchange,status"`
+	Returned        stat.CounterCtor `labels:"exchange"`
+}
+
+// Publisher publishes in confirm mode: Publish returns only after the broker
+// has taken responsibility for the message. The channel is reopened lazily
+// after connection or channel failures.
+type Publisher struct {
+	conn *Connection
+	Stat publisherStat
+
+	mu sync.Mutex
+	ch *amqp.Channel
+}
+
+func NewPublisher(conn *Connection, registry stat.Registry) *Publisher {
+	p := &Publisher{conn: conn}
+	stat.NewRegistrar(registry.ForSubsystem("rabbitmq_publisher")).MustRegister(&p.Stat)
+
+	return p
+}
+
+// Publish sends msg with the mandatory flag and waits for the broker confirm.
+// Unroutable messages are confirmed too and only counted as returned.
+func (p *Publisher) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (err error) {
+	tm := p.Stat.PublishDuration.Timer(ctx).Start()
+	defer func() {
+		tm.WithLabels(stat.Labels{"exchange": exchange, "status": stat.TypedErrorLabel(ctx, err)}).Stop()
+	}()
+
+	ch, err := p.channel()
+	if err != nil {
+		return errors.Transform(err, ErrPublish)
+	}
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, true, false, msg)
+	if err != nil {
+		p.reset(ch)
+		return errors.Transform(err, ErrPublish)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return errors.Transform(err, ErrPublish)
+	}
+	if !acked {
+		return ErrPublishNacked
+	}
+
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ch == nil {
+		return nil
+	}
+
+	err := p.ch.Close()
+	p.ch = nil
+
+	return err
+}
+
+func (p *Publisher) channel() (*amqp.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ch != nil && !p.ch.IsClosed() {
+		return p.ch, nil
+	}
+
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, errors.Wrap(err, "failed to enable confirm mode")
+	}
+
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+	go func() {
+		for r := range returns {
+			p.Stat.Returned.Counter(context.Background()).WithLabels(stat.Labels{"exchange": r.Exchange}).Add(1)
+		}
+	}()
+
+	p.ch = ch
+
+	return ch, nil
+}
+
+func (p *Publisher) reset(ch *amqp.Channel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ch == ch {
+		_ = ch.Close()
+		p.ch = nil
+	}
+}
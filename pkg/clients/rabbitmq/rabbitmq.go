@@ -0,0 +1,188 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrClosed = errors.Typed("rabbitmq_closed", "connection is closed")
+
+type Config struct {
+	URL               string        `mapstructure:"url"`
+	ReconnectDelay    time.Duration `mapstructure:"reconnect_delay"`
+	MaxReconnectDelay time.Duration `mapstructure:"max_reconnect_delay"`
+}
+
+// Topology declares exchanges, queues and bindings shared by all users of the connection.
+// It is called after every (re)connect.
+type Topology func(ch *amqp.Channel) error
+
+// Connection is an AMQP connection which reconnects on broker failures
+// and re-declares topology after each reconnect.
+type Connection struct {
+	cfg      Config
+	logger   log.Logger
+	topology Topology
+
+	mu          sync.RWMutex
+	conn        *amqp.Connection
+	reconnected chan struct{}
+	closed      bool
+	done        chan struct{}
+}
+
+func Dial(ctx context.Context, cfg Config, topology Topology, logger log.Logger) (*Connection, error) {
+	if cfg.ReconnectDelay <= 0 {
+		cfg.ReconnectDelay = time.Second
+	}
+	if cfg.MaxReconnectDelay < cfg.ReconnectDelay {
+		cfg.MaxReconnectDelay = 30 * cfg.ReconnectDelay
+	}
+	if topology == nil {
+		topology = func(*amqp.Channel) error { return nil }
+	}
+
+	c := &Connection{
+		cfg:         cfg,
+		logger:      logger,
+		topology:    topology,
+		reconnected: make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	conn, closed, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+
+	go c.watch(ctx, closed)
+
+	return c, nil
+}
+
+// Channel opens a new channel on the current connection.
+// Callers own the channel and must close it.
+func (c *Connection) Channel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open channel")
+	}
+
+	return ch, nil
+}
+
+// Reconnected returns a channel which is closed after the next successful reconnect.
+func (c *Connection) Reconnected() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.reconnected
+}
+
+// Done is closed when the connection is closed by Close.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+
+	return c.conn.Close()
+}
+
+func (c *Connection) connect() (*amqp.Connection, <-chan *amqp.Error, error) {
+	conn, err := amqp.Dial(c.cfg.URL)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to connect to rabbitmq")
+	}
+	// subscribe before anything else, otherwise an early close is missed
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, errors.Wrap(err, "failed to open topology channel")
+	}
+	defer ch.Close()
+
+	if err := c.topology(ch); err != nil {
+		_ = conn.Close()
+		return nil, nil, errors.Wrap(err, "failed to declare topology")
+	}
+
+	return conn, closed, nil
+}
+
+func (c *Connection) watch(ctx context.Context, closed <-chan *amqp.Error) {
+	for {
+		closeErr, ok := <-closed
+		if !ok || closeErr == nil {
+			// graceful close by Close
+			return
+		}
+
+		c.logger.ForCtx(ctx).WithError(closeErr).Warn("rabbitmq connection lost, reconnecting")
+
+		closed = c.reconnect(ctx)
+		if closed == nil {
+			return
+		}
+	}
+}
+
+func (c *Connection) reconnect(ctx context.Context) <-chan *amqp.Error {
+	delay := c.cfg.ReconnectDelay
+	for {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(delay):
+		}
+
+		conn, closed, err := c.connect()
+		if err != nil {
+			c.logger.ForCtx(ctx).WithError(err).Warn("failed to reconnect to rabbitmq")
+
+			delay *= 2
+			if delay > c.cfg.MaxReconnectDelay {
+				delay = c.cfg.MaxReconnectDelay
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		c.conn = conn
+		close(c.reconnected)
+		c.reconnected = make(chan struct{})
+		c.mu.Unlock()
+
+		c.logger.ForCtx(ctx).Info("rabbitmq connection restored")
+
+		return closed
+	}
+}
@@ -0,0 +1,157 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+type Mode string
+
+const (
+	ModeSingle   Mode = "single"
+	ModeSentinel Mode = "sentinel"
+	ModeCluster  Mode = "cluster"
+)
+
+type TLSConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	ServerName string `mapstructure:"server_name"`
+	// CAFile verifies servers with a private CA, system roots are used otherwise.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile are a client certificate for mutual TLS.
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+type Config struct {
+	// Mode defaults to sentinel when MasterName is set, to cluster for
+	// several Addrs and to single otherwise.
+	Mode Mode `mapstructure:"mode"`
+	// Addrs of the server, the sentinels or the cluster seed nodes.
+	Addrs      []string `mapstructure:"addrs"`
+	MasterName string   `mapstructure:"master_name"`
+	// DB is ignored by clusters.
+	DB int `mapstructure:"db"`
+
+	Username         string `mapstructure:"username"`
+	Password         string `mapstructure:"password"`
+	SentinelUsername string `mapstructure:"sentinel_username"`
+	SentinelPassword string `mapstructure:"sentinel_password"`
+
+	TLS TLSConfig `mapstructure:"tls"`
+
+	PoolSize        int           `mapstructure:"pool_size"`
+	MinIdleConns    int           `mapstructure:"min_idle_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	PoolTimeout     time.Duration `mapstructure:"pool_timeout"`
+	DialTimeout     time.Duration `mapstructure:"dial_timeout"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	MaxRetries      int           `mapstructure:"max_retries"`
+
+	// ReadOnly sends cluster reads to replicas.
+	ReadOnly bool `mapstructure:"read_only"`
+}
+
+func (c Config) mode() Mode {
+	switch {
+	case c.Mode != "":
+		return c.Mode
+	case c.MasterName != "":
+		return ModeSentinel
+	case len(c.Addrs) > 1:
+		return ModeCluster
+	default:
+		return ModeSingle
+	}
+}
+
+// NewClient does not connect, go-redis dials lazily and redials on failures.
+func NewClient(cfg Config) (redis.UniversalClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("no redis addrs")
+	}
+
+	tlsConfig, err := cfg.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		DB:               cfg.DB,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		TLSConfig:        tlsConfig,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		MaxIdleConns:     cfg.MaxIdleConns,
+		ConnMaxIdleTime:  cfg.ConnMaxIdleTime,
+		PoolTimeout:      cfg.PoolTimeout,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+		MaxRetries:       cfg.MaxRetries,
+		ReadOnly:         cfg.ReadOnly,
+	}
+
+	// the mode is chosen explicitly, redis.NewUniversalClient takes a single
+	// seed node for a standalone server
+	switch cfg.mode() {
+	case ModeSingle:
+		return redis.NewClient(opts.Simple()), nil
+	case ModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, errors.New("sentinel mode requires master_name")
+		}
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case ModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return nil, errors.Errorf("unknown redis mode %q", cfg.Mode)
+	}
+}
+
+func (c TLSConfig) build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	res := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, // nolint:gosec
+	}
+
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read redis ca file")
+		}
+
+		res.RootCAs = x509.NewCertPool()
+		if !res.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no certificates in redis ca file %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load redis client certificate")
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientMode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		want interface{}
+	}{
+		{
+			name: "single",
+			cfg:  Config{Addrs: []string{"localhost:6379"}},
+			want: &redis.Client{},
+		},
+		{
+			name: "sentinel by master name",
+			cfg:  Config{Addrs: []string{"localhost:26379", "localhost:26380"}, MasterName: "feed"},
+			want: &redis.Client{},
+		},
+		{
+			name: "cluster by addrs",
+			cfg:  Config{Addrs: []string{"localhost:7000", "localhost:7001"}},
+			want: &redis.ClusterClient{},
+		},
+		{
+			name: "cluster with one seed",
+			cfg:  Config{Mode: ModeCluster, Addrs: []string{"localhost:7000"}},
+			want: &redis.ClusterClient{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient(tc.cfg)
+			require.NoError(t, err)
+			defer client.Close()
+
+			require.IsType(t, tc.want, client)
+		})
+	}
+}
+
+func TestNewClientInvalidConfig(t *testing.T) {
+	_, err := NewClient(Config{})
+	require.Error(t, err)
+
+	_, err = NewClient(Config{Mode: ModeSentinel, Addrs: []string{"localhost:26379"}})
+	require.Error(t, err)
+
+	_, err = NewClient(Config{Mode: "replicated", Addrs: []string{"localhost:6379"}})
+	require.Error(t, err)
+
+	_, err = NewClient(Config{Addrs: []string{"localhost:6379"}, TLS: TLSConfig{Enabled: true, CAFile: "/nonexistent/ca.pem"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,141 @@
+// Package smtptest provides an in-process SMTP server recording received mail.
+package smtptest
+
+import (
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+type Message struct {
+	From string
+	To   []string
+	// Data is the message as sent after DATA, without the terminating dot.
+	Data string
+}
+
+// Server accepts plain SMTP without TLS and auth, configure senders with skip_tls.
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer listens on a random local port.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen")
+	}
+
+	s := &Server{listener: l}
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.Host(), strconv.Itoa(s.Port()))
+}
+
+// Messages returns mail received so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+func (s *Server) handle(tc *textproto.Conn) {
+	var msg Message
+
+	_ = tc.PrintfLine("220 smtptest ready")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			_ = tc.PrintfLine("250 smtptest")
+		case "MAIL":
+			msg = Message{From: address(line)}
+			_ = tc.PrintfLine("250 Sender ok")
+		case "RCPT":
+			msg.To = append(msg.To, address(line))
+			_ = tc.PrintfLine("250 Receiver ok")
+		case "DATA":
+			_ = tc.PrintfLine("354 Go ahead")
+
+			data, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+
+			_ = tc.PrintfLine("250 Data ok")
+		case "RSET", "NOOP":
+			_ = tc.PrintfLine("250 Ok")
+		case "QUIT":
+			_ = tc.PrintfLine("221 Goodbye")
+			return
+		default:
+			_ = tc.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// address extracts the path from "MAIL FROM:<a@b>" and "RCPT TO:<a@b>".
+func address(line string) string {
+	start, end := strings.IndexByte(line, '<'), strings.LastIndexByte(line, '>')
+	if start < 0 || end < start {
+		return ""
+	}
+
+	return line[start+1 : end]
+}
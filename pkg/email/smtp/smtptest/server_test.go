@@ -0,0 +1,39 @@
+package smtptest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/pkg/email"
+	"github.com/antonpriyma/otus-highload/pkg/email/smtp"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/stat/stub"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRecordsMessages(t *testing.T) {
+	server, err := NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	sender := smtp.NewSender(smtp.Config{
+		Host:    server.Host(),
+		Port:    server.Port(),
+		SkipTLS: true,
+	}, nil, log.Null, stub.NewStubRegistry())
+
+	body := email.Multipart(
+		email.Header{email.HeaderContentType: {email.ContentTypeAlternative}},
+		email.SimplePart(email.Header{email.HeaderContentType: {email.ContentTypePlain}}, []byte("plain body")),
+		email.SimplePart(email.Header{email.HeaderContentType: {email.ContentTypeHTML}}, []byte("<p>html body</p>")),
+	)
+
+	err = sender.Send(context.Background(), []string{"to@example.com"}, "subject", body, email.SendOpts{EmailFrom: "from@example.com"})
+	require.NoError(t, err)
+
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	require.Equal(t, "from@example.com", messages[0].From)
+	require.Equal(t, []string{"to@example.com"}, messages[0].To)
+	require.Contains(t, messages[0].Data, "multipart/alternative")
+}
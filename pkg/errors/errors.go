@@ -165,6 +165,10 @@ func (panicError) ErrorType() string {
 
 var ErrPanic TypedError = &panicError{}
 
+// ErrUnavailable marks errors of an overloaded or contended dependency, the
+// request may succeed when retried later.
+var ErrUnavailable = Typed("unavailable", "temporarily unavailable")
+
 func RecoverError(r interface{}) error {
 	if r == nil {
 		return nil
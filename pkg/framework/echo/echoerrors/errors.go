@@ -152,6 +152,20 @@ func AlreadyExistsError(
 	}
 }
 
+func PreconditionFailedError(
+	cause error,
+	explain string,
+) ResponseError {
+	return httpError{
+		Cause: cause,
+		Code:  http.StatusPreconditionFailed,
+		ErrorMessage: ErrorMessage{
+			Type:    "precondition_failed",
+			Explain: explain,
+		},
+	}
+}
+
 type ForbiddenReason string
 
 const (
@@ -234,3 +248,16 @@ func RetryLater(
 		},
 	}
 }
+
+func ServiceUnavailableError(
+	cause error,
+) ResponseError {
+	return httpError{
+		Cause: cause,
+		Code:  http.StatusServiceUnavailable,
+		ErrorMessage: ErrorMessage{
+			Type:    "unavailable",
+			Explain: "service is temporarily unavailable, retry again later",
+		},
+	}
+}
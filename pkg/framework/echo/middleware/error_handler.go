@@ -97,5 +97,9 @@ func extractHTTPError(
 		return respErr.HTTPError()
 	}
 
+	if errors.Is(err, errors.ErrUnavailable) {
+		return echoerrors.ServiceUnavailableError(err).HTTPError()
+	}
+
 	return echoerrors.InternalError(err).HTTPError()
 }
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/pkg/framework/grpc/interceptors/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// NewUnaryClientActorInterceptor propagates the acting user to servers using server.NewActorInterceptor.
+// Empty headerName means server.ActorHeader.
+func NewUnaryClientActorInterceptor(headerName string, actorGetter func(ctx context.Context) string) grpc.UnaryClientInterceptor {
+	if headerName == "" {
+		headerName = server.ActorHeader
+	}
+
+	return func(
+		ctx context.Context,
+		method string, req,
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) (err error) {
+		if actor := actorGetter(ctx); actor != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, headerName, actor)
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/antonpriyma/otus-highload/pkg/utils"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const ActorHeader = "x-actor-id"
+
+var (
+	ErrActorUnauthenticated = status.Error(codes.Unauthenticated, "actor unauthenticated")
+	errEmptyActor           = utils.NewTypedError("actor_empty", "empty actor header")
+)
+
+type ActorConfig struct {
+	HeaderName string `mapstructure:"header_name"`
+	Enabled    bool   `mapstructure:"enabled"`
+}
+
+// ActorStoreFunc puts the acting user into the handler context.
+type ActorStoreFunc func(ctx context.Context, actor string) context.Context
+
+type actorAuth struct {
+	Config ActorConfig
+	Store  ActorStoreFunc
+	Logger log.Logger
+}
+
+// NewActorInterceptor takes the acting user from request metadata.
+// Metadata is set by trusted callers only, so the interceptor must be chained
+// after NewServersideACLInterceptor.
+func NewActorInterceptor(cfg ActorConfig, store ActorStoreFunc, logger log.Logger) grpc.UnaryServerInterceptor {
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = ActorHeader
+	}
+
+	return actorAuth{
+		Config: cfg,
+		Store:  store,
+		Logger: logger,
+	}.interceptor
+}
+
+func (a actorAuth) interceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if !a.Config.Enabled {
+		return handler(ctx, req)
+	}
+
+	actor := a.getActorFromMetadata(ctx)
+	if actor == "" {
+		return nil, errors.Transform(errEmptyActor, ErrActorUnauthenticated)
+	}
+
+	ctx = log.AddCtxFields(ctx, map[string]interface{}{"actor": actor})
+
+	return handler(a.Store(ctx, actor), req)
+}
+
+func (a actorAuth) getActorFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	header := md.Get(a.Config.HeaderName)
+	if len(header) == 0 {
+		return ""
+	}
+
+	return header[0]
+}
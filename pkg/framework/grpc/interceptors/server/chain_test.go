@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const healthCheckMethod = "/grpc.health.v1.Health/Check"
+
+type actorKey struct{}
+
+// chain calls interceptors the way grpc.ChainUnaryInterceptor does.
+func chain(interceptors []grpc.UnaryServerInterceptor, method string, ctx context.Context, handler grpc.UnaryHandler) (interface{}, error) {
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+
+	next := handler
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, inner)
+		}
+	}
+
+	return next(ctx, nil)
+}
+
+// TestDialogsChain runs the authorization part of the cmd/dialogs chain.
+func TestDialogsChain(t *testing.T) {
+	public := DisabledHandlersList(healthCheckMethod)
+	interceptors := WrapInterceptorsWithErrorHandler(
+		DefaultErrorHandler{Logger: log.Null}.HandleError,
+		RecoverInterceptor,
+		NewOptionalInterceptor(NewServersideACLInterceptor(ACLConfig{
+			Enabled:    true,
+			HeaderName: "x-serverside-token",
+			Nodes: []ACLNode{
+				{Owner: "app", Token: "app-token", Methods: []string{"/Dialogs/SendMessage"}},
+			},
+		}, log.Null), public),
+		NewOptionalInterceptor(NewActorInterceptor(ActorConfig{Enabled: true}, func(ctx context.Context, actor string) context.Context {
+			return context.WithValue(ctx, actorKey{}, actor)
+		}, log.Null), public),
+	)
+
+	var actor interface{}
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		actor = ctx.Value(actorKey{})
+		return "ok", nil
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		md     metadata.MD
+		code   codes.Code
+		actor  interface{}
+	}{
+		{
+			name:   "health check is public",
+			method: healthCheckMethod,
+			code:   codes.OK,
+		},
+		{
+			name:   "no token",
+			method: "/Dialogs/SendMessage",
+			md:     metadata.Pairs(ActorHeader, "alice"),
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "method not allowed for the token",
+			method: "/Dialogs/CreateGroup",
+			md:     metadata.Pairs("x-serverside-token", "app-token", ActorHeader, "alice"),
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "no actor",
+			method: "/Dialogs/SendMessage",
+			md:     metadata.Pairs("x-serverside-token", "app-token"),
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "authorized",
+			method: "/Dialogs/SendMessage",
+			md:     metadata.Pairs("x-serverside-token", "app-token", ActorHeader, "alice"),
+			code:   codes.OK,
+			actor:  "alice",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actor = nil
+			ctx := context.Background()
+			if tc.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tc.md)
+			}
+
+			_, err := chain(interceptors, tc.method, ctx, handler)
+			require.Equal(t, tc.code, status.Code(err), err)
+			require.Equal(t, tc.actor, actor)
+		})
+	}
+}
+
+func TestChainRecoversPanics(t *testing.T) {
+	interceptors := WrapInterceptorsWithErrorHandler(DefaultErrorHandler{Logger: log.Null}.HandleError, RecoverInterceptor)
+
+	_, err := chain(interceptors, "/Dialogs/SendMessage", context.Background(), func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	require.Equal(t, codes.Internal, status.Code(err))
+}
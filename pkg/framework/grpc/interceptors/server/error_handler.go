@@ -120,7 +120,15 @@ func (e DefaultErrorHandler) HandleError(
 	}).Error("error happened during request")
 
 	if status.Code(err) == codes.Unknown {
-		err = status.Error(codes.Internal, err.Error())
+		code := codes.Internal
+		// status errors wrapped by typed errors, e.g. ACL rejections, keep their code
+		var grpcErr interface{ GRPCStatus() *status.Status }
+		if errors.As(err, &grpcErr) {
+			code = grpcErr.GRPCStatus().Code()
+		} else if errors.Is(err, errors.ErrUnavailable) {
+			code = codes.Unavailable
+		}
+		err = status.Error(code, err.Error())
 	}
 
 	if e.Callback != nil {
@@ -10,6 +10,8 @@ import (
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type Configured interface {
@@ -19,9 +21,13 @@ type Configured interface {
 
 var _ service.Server = &ToolSet{}
 
+// HealthCheckMethod is served without authorization, see NewOptionalInterceptor.
+const HealthCheckMethod = "/grpc.health.v1.Health/Check"
+
 type Config struct {
-	Listen           string `mapstructure:"listen"`
-	PrometheusListen string `mapstructure:"prometheus_listen"`
+	ServeConfig      service.ServeConfig `mapstructure:"serve_config"`
+	Listen           string              `mapstructure:"listen"`
+	PrometheusListen string              `mapstructure:"prometheus_listen"`
 }
 
 func New(appCfg Configured) *ToolSet {
@@ -31,7 +37,7 @@ func New(appCfg Configured) *ToolSet {
 	return &ToolSet{
 		config:  appCfg.ServerConfig(),
 		ToolSet: baseTool,
-		stopCh:  make(chan struct{}),
+		health:  health.NewServer(),
 	}
 }
 
@@ -39,27 +45,39 @@ type ToolSet struct {
 	config   Config
 	listener net.Listener
 	server   *grpc.Server
+	health   *health.Server
 	echo     *echo.Echo // using for probes and probes
-	stopCh   chan struct{}
 
 	service.ToolSet
 }
 
+// Serve runs the server until SIGINT or SIGTERM and stops it gracefully.
+func (t *ToolSet) Serve() {
+	service.Serve(context.Background(), t.Logger, t.config.ServeConfig, t)
+}
+
 func (t *ToolSet) Graceful(ctx context.Context) error {
+	t.health.Shutdown()
+
+	// closed rather than sent to, so that a call which timed out leaks nothing
+	// and a later Stop never takes the signal of this one
+	done := make(chan struct{})
 	go func() {
 		t.server.GracefulStop()
-		t.stopCh <- struct{}{}
+		close(done)
 	}()
 
 	select {
 	case <-ctx.Done():
 		return errors.New("failed to graceful shutdown")
-	case <-t.stopCh:
+	case <-done:
 		return nil
 	}
 }
 
+// SetServer sets the server to run and registers the gRPC health service on it.
 func (t *ToolSet) SetServer(s *grpc.Server) {
+	grpc_health_v1.RegisterHealthServer(s, t.health)
 	t.server = s
 }
 
@@ -71,6 +89,8 @@ func (t *ToolSet) Init(ctx context.Context) error {
 	t.listener = ln
 
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
 	e.Use(middleware.Recover(t.Logger))
 
 	e.HTTPErrorHandler = middleware.ErrorHandler{
@@ -79,6 +99,11 @@ func (t *ToolSet) Init(ctx context.Context) error {
 	}.NewHandlerFunc()
 	e.GET("/metrics", echo.WrapHandler(t.PromHandler))
 	e.GET("/ping", func(c echo.Context) error {
+		resp, err := t.health.Check(c.Request().Context(), &grpc_health_v1.HealthCheckRequest{})
+		if err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+			return c.NoContent(http.StatusServiceUnavailable)
+		}
+
 		return c.String(http.StatusOK, "")
 	})
 	e.GET("/debug/*", echo.WrapHandler(t.PProfHandler))
@@ -101,19 +126,22 @@ func (t *ToolSet) Run(ctx context.Context) error {
 		t.Logger.WithError(err).Warn("shutting down prometheus server")
 	}()
 
+	t.health.Resume()
+
 	return t.server.Serve(t.listener)
 }
 
 func (t *ToolSet) Stop(ctx context.Context) error {
+	done := make(chan struct{})
 	go func() {
 		t.server.Stop()
-		t.stopCh <- struct{}{}
+		close(done)
 	}()
 
 	select {
 	case <-ctx.Done():
 		return errors.New("failed to shutdown")
-	case <-t.stopCh:
-		return nil
+	case <-done:
+		return t.echo.Shutdown(ctx)
 	}
 }
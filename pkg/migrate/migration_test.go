@@ -0,0 +1,43 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_posts.up.sql":   {Data: []byte("CREATE TABLE post (id INT);")},
+		"0002_posts.down.sql": {Data: []byte("DROP TABLE post;")},
+		"0001_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+	}
+
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.Equal(t, []Migration{
+		{Version: 1, Name: "users", Up: "CREATE TABLE users (id INT);"},
+		{Version: 2, Name: "posts", Up: "CREATE TABLE post (id INT);", Down: "DROP TABLE post;"},
+	}, migrations)
+
+	_, err = Load(fstest.MapFS{"0001_users.down.sql": {Data: []byte("DROP TABLE users;")}})
+	require.Error(t, err)
+
+	_, err = Load(fstest.MapFS{"users.sql": {Data: []byte("CREATE TABLE users (id INT);")}})
+	require.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- users; and more
+CREATE TABLE users (name VARCHAR(10) DEFAULT 'a;b'); # trailing; comment
+/* block; comment */
+INSERT INTO users VALUES ("it\"s;"), ('o''k;');
+`
+
+	require.Equal(t, []string{
+		"CREATE TABLE users (name VARCHAR(10) DEFAULT 'a;b')",
+		`INSERT INTO users VALUES ("it\"s;"), ('o''k;')`,
+	}, splitStatements(script))
+}
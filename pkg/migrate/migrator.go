@@ -0,0 +1,396 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+const errNoSuchTable = 1146
+
+var (
+	ErrDirty           = errors.New("a migration failed halfway, fix the schema by hand and the dirty flag")
+	ErrVersionMismatch = errors.New("schema version mismatch")
+	ErrUnknownVersion  = errors.New("unknown migration version")
+	ErrLocked          = errors.New("migrations are locked by another process")
+)
+
+type Config struct {
+	// Table keeps applied versions, Table + "_lock" is the lock.
+	Table string `mapstructure:"table"`
+	// LockTimeout is how long to wait for a concurrent migrate to finish.
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	// StaleLockAfter releases locks left by crashed processes. The running
+	// process refreshes its lock three times within it.
+	StaleLockAfter time.Duration `mapstructure:"stale_lock_after"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Table == "" {
+		c.Table = "schema_migrations"
+	}
+	if c.LockTimeout <= 0 {
+		c.LockTimeout = time.Minute
+	}
+	if c.StaleLockAfter <= 0 {
+		c.StaleLockAfter = 15 * time.Minute
+	}
+
+	return c
+}
+
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedAt time.Time
+	Dirty     bool
+}
+
+type Migrator struct {
+	cfg        Config
+	db         *sqlx.DB
+	migrations []Migration
+	logger     log.Logger
+}
+
+func New(cfg Config, db *sqlx.DB, migrations []Migration, logger log.Logger) *Migrator {
+	return &Migrator{
+		cfg:        cfg.withDefaults(),
+		db:         db,
+		migrations: migrations,
+		logger:     logger,
+	}
+}
+
+// Latest is the version of the last known migration, 0 if there are none.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func() error {
+		current, err := m.current(ctx)
+		if err != nil {
+			return err
+		}
+
+		target := int64(0)
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if m.migrations[i].Version > current {
+				continue
+			}
+			if steps == 0 {
+				target = m.migrations[i].Version
+				break
+			}
+			steps--
+		}
+
+		return m.migrate(ctx, current, target)
+	})
+}
+
+// To migrates up or down to version, 0 reverts everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.index(version) < 0 {
+		return errors.Wrapf(ErrUnknownVersion, "version %d", version)
+	}
+
+	return m.withLock(ctx, func() error {
+		current, err := m.current(ctx)
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(ctx, current, version)
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var rows []struct {
+		Version   int64 `db:"version"`
+		AppliedAt int64 `db:"applied_at"`
+		Dirty     bool  `db:"dirty"`
+	}
+	err := m.db.SelectContext(ctx, &rows, "SELECT version, UNIX_TIMESTAMP(applied_at) AS applied_at, dirty FROM "+m.cfg.Table)
+	if err != nil && !isNoTable(err) {
+		return nil, errors.Wrap(err, "failed to select applied migrations")
+	}
+
+	res := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		res = append(res, Status{Migration: migration})
+	}
+	for _, row := range rows {
+		i := m.index(row.Version)
+		if i < 0 {
+			// applied by a newer build
+			res = append(res, Status{Migration: Migration{Version: row.Version}})
+			i = len(res) - 1
+		}
+		res[i].Applied = true
+		res[i].AppliedAt = time.Unix(row.AppliedAt, 0)
+		res[i].Dirty = row.Dirty
+	}
+
+	return res, nil
+}
+
+// Version returns the applied schema version, 0 for a database never migrated.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	return m.current(ctx)
+}
+
+// Check fails unless the schema is at the latest known version.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if version != m.Latest() {
+		return errors.Wrapf(ErrVersionMismatch, "schema is at %d, want %d", version, m.Latest())
+	}
+
+	return nil
+}
+
+func (m *Migrator) migrate(ctx context.Context, current int64, target int64) error {
+	if current == target {
+		m.logger.Infof("schema is at version %d, nothing to do", current)
+		return nil
+	}
+
+	if current < target {
+		for _, migration := range m.migrations {
+			if migration.Version <= current || migration.Version > target {
+				continue
+			}
+			if err := m.apply(ctx, migration, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+		if err := m.apply(ctx, migration, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply runs a migration marking it dirty until it completes. MySQL commits
+// DDL implicitly, so a failed migration cannot be rolled back.
+func (m *Migrator) apply(ctx context.Context, migration Migration, up bool) error {
+	script, direction := migration.Up, "up"
+	if !up {
+		script, direction = migration.Down, "down"
+		if script == "" {
+			return errors.Errorf("migration %d %s is irreversible", migration.Version, migration.Name)
+		}
+	}
+
+	logger := m.logger.WithFields(log.Fields{
+		"version":   migration.Version,
+		"name":      migration.Name,
+		"direction": direction,
+	})
+	logger.Info("applying migration")
+
+	_, err := m.db.ExecContext(
+		ctx,
+		"INSERT INTO "+m.cfg.Table+" (version, dirty) VALUES (?, TRUE) ON DUPLICATE KEY UPDATE dirty = TRUE",
+		migration.Version,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark migration dirty")
+	}
+
+	for _, statement := range splitStatements(script) {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return errors.Wrapf(err, "migration %d %s %s failed", migration.Version, migration.Name, direction)
+		}
+	}
+
+	if up {
+		_, err = m.db.ExecContext(ctx, "UPDATE "+m.cfg.Table+" SET dirty = FALSE, applied_at = NOW() WHERE version = ?", migration.Version)
+	} else {
+		_, err = m.db.ExecContext(ctx, "DELETE FROM "+m.cfg.Table+" WHERE version = ?", migration.Version)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to record migration")
+	}
+
+	return nil
+}
+
+func (m *Migrator) current(ctx context.Context) (int64, error) {
+	var row struct {
+		Version sql.NullInt64 `db:"version"`
+		Dirty   sql.NullBool  `db:"dirty"`
+	}
+	err := m.db.GetContext(ctx, &row, "SELECT MAX(version) AS version, MAX(dirty) AS dirty FROM "+m.cfg.Table)
+	if isNoTable(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get schema version")
+	}
+
+	if row.Dirty.Bool {
+		return 0, ErrDirty
+	}
+
+	return row.Version.Int64, nil
+}
+
+func (m *Migrator) index(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.cfg.Table+` (
+		version    BIGINT    PRIMARY KEY,
+		dirty      BOOLEAN   NOT NULL DEFAULT FALSE,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create migrations table")
+	}
+
+	_, err = m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.lockTable()+` (
+		id        TINYINT      PRIMARY KEY,
+		owner     VARCHAR(255) NOT NULL,
+		locked_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create migrations lock table")
+	}
+
+	return nil
+}
+
+func (m *Migrator) lockTable() string {
+	return m.cfg.Table + "_lock"
+}
+
+// withLock runs fn holding the row in the lock table. A row is used instead of
+// GET_LOCK, so that the lock does not depend on a pooled connection. The row
+// is refreshed while fn runs, so that long migrations are not taken for stale.
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+
+	owner := lockOwner()
+	deadline := time.Now().Add(m.cfg.LockTimeout)
+	for {
+		_, err := m.db.ExecContext(
+			ctx,
+			"DELETE FROM "+m.lockTable()+" WHERE id = 1 AND locked_at < NOW() - INTERVAL ? SECOND",
+			int64(m.cfg.StaleLockAfter.Seconds()),
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to release stale lock")
+		}
+
+		res, err := m.db.ExecContext(ctx, "INSERT IGNORE INTO "+m.lockTable()+" (id, owner) VALUES (1, ?)", owner)
+		if err != nil {
+			return errors.Wrap(err, "failed to take lock")
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+
+		m.logger.Info("waiting for migrations lock")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		m.refreshLock(refreshCtx, owner)
+	}()
+
+	defer func() {
+		stopRefresh()
+		<-refreshed
+
+		// the lock is released even when ctx is canceled
+		_, err := m.db.ExecContext(context.Background(), "DELETE FROM "+m.lockTable()+" WHERE id = 1 AND owner = ?", owner)
+		if err != nil {
+			m.logger.WithError(err).Error("failed to release migrations lock")
+		}
+	}()
+
+	return fn()
+}
+
+// refreshLock bumps locked_at of the owned lock until ctx is done.
+func (m *Migrator) refreshLock(ctx context.Context, owner string) {
+	ticker := time.NewTicker(m.cfg.StaleLockAfter / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := m.db.ExecContext(ctx, "UPDATE "+m.lockTable()+" SET locked_at = CURRENT_TIMESTAMP WHERE id = 1 AND owner = ?", owner)
+		if err != nil && ctx.Err() == nil {
+			m.logger.WithError(err).Warn("failed to refresh migrations lock")
+		}
+	}
+}
+
+func isNoTable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable
+}
+
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid()) + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
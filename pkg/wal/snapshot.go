@@ -0,0 +1,109 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+)
+
+const snapshotSuffix = ".snap"
+
+// SaveSnapshot atomically replaces the snapshot in dir with data, the state
+// after the record lsn. Segments up to lsn may be compacted afterwards.
+func SaveSnapshot(dir string, lsn uint64, data []byte) error {
+	path := filepath.Join(dir, fmt.Sprintf("%020d%s", lsn, snapshotSuffix))
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot")
+	}
+
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.Checksum(data, crcTable))
+	if _, err := file.Write(append(checksum, data...)); err != nil {
+		file.Close() // nolint:errcheck
+		return errors.Wrap(err, "failed to write snapshot")
+	}
+	if err := file.Sync(); err != nil {
+		file.Close() // nolint:errcheck
+		return errors.Wrap(err, "failed to sync snapshot")
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close snapshot")
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrap(err, "failed to rename snapshot")
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	// older snapshots are useless once the new one is durable
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.first < lsn {
+			if err := os.Remove(snapshot.path); err != nil {
+				return errors.Wrap(err, "failed to remove old snapshot")
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadSnapshot returns the latest snapshot in dir, a zero lsn and nil data
+// when there is none.
+func LoadSnapshot(dir string) (uint64, []byte, error) {
+	snapshots, err := listSnapshots(dir)
+	if err != nil || len(snapshots) == 0 {
+		return 0, nil, err
+	}
+	latest := snapshots[len(snapshots)-1]
+
+	content, err := os.ReadFile(latest.path)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to read snapshot")
+	}
+	if len(content) < 4 || binary.BigEndian.Uint32(content[:4]) != crc32.Checksum(content[4:], crcTable) {
+		return 0, nil, errors.Wrapf(ErrCorrupted, "snapshot %s checksum mismatch", latest.path)
+	}
+
+	return latest.first, content[4:], nil
+}
+
+func listSnapshots(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read snapshot dir")
+	}
+
+	var snapshots []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+
+		var lsn uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name, snapshotSuffix), "%d", &lsn); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, segment{path: filepath.Join(dir, name), first: lsn})
+	}
+
+	// names are zero padded, ReadDir sorts them by lsn
+	return snapshots, nil
+}
@@ -0,0 +1,443 @@
+// Package wal is a segmented write-ahead log on local disk.
+//
+// Every record gets a log sequence number (LSN) growing by one. A record is
+// framed as
+//
+//	length uint32 | crc32 uint32 | lsn uint64 | data
+//
+// where the checksum covers lsn and data. A torn record at the end of the last
+// segment, left by a crash in the middle of a write, is cut off on Open.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonpriyma/otus-highload/pkg/errors"
+	"github.com/antonpriyma/otus-highload/pkg/log"
+)
+
+const (
+	headerSize    = 16
+	segmentSuffix = ".wal"
+	// maxRecordSize guards against allocating garbage lengths of corrupted headers.
+	maxRecordSize = 64 << 20
+)
+
+var (
+	ErrCorrupted = errors.New("wal is corrupted")
+	ErrClosed    = errors.New("wal is closed")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type Config struct {
+	Dir string `mapstructure:"dir"`
+	// SegmentSize is the size after which appends go to a new segment.
+	SegmentSize int64 `mapstructure:"segment_size"`
+	// SyncInterval batches fsyncs, records appended within the interval may be
+	// lost on a power failure. Zero syncs every append.
+	SyncInterval time.Duration `mapstructure:"sync_interval"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.SegmentSize <= 0 {
+		c.SegmentSize = 64 << 20
+	}
+
+	return c
+}
+
+type segment struct {
+	path string
+	// first is the lsn of the first record, the one following the previous
+	// segment for an empty segment.
+	first uint64
+}
+
+type Log struct {
+	cfg    Config
+	logger log.Logger
+
+	mu       sync.Mutex
+	segments []segment
+	file     *os.File
+	size     int64
+	lastLSN  uint64
+	dirty    bool
+	closed   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open reads the segments of cfg.Dir, creating it when missing, and prepares
+// the last segment for appends.
+func Open(cfg Config, logger log.Logger) (*Log, error) {
+	cfg = cfg.withDefaults()
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create wal dir")
+	}
+
+	l := &Log{
+		cfg:    cfg,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	segments, err := listSegments(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		if i > 0 && seg.first != l.lastLSN+1 {
+			return nil, errors.Wrapf(ErrCorrupted, "segment %s starts at %d, want %d", seg.path, seg.first, l.lastLSN+1)
+		}
+
+		lastLSN, size, err := scanSegment(seg, nil)
+		if err != nil && !(last && errors.Is(err, ErrCorrupted)) {
+			return nil, err
+		}
+		if err != nil {
+			logger.WithError(err).Warnf("cutting torn tail of wal segment %s at %d", seg.path, size)
+			if err := os.Truncate(seg.path, size); err != nil {
+				return nil, errors.Wrap(err, "failed to truncate wal segment")
+			}
+		}
+
+		l.lastLSN = lastLSN
+		if last {
+			l.size = size
+		}
+	}
+	l.segments = segments
+
+	if len(l.segments) == 0 {
+		if err := l.newSegment(); err != nil {
+			return nil, err
+		}
+	} else {
+		file, err := os.OpenFile(l.segments[len(l.segments)-1].path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open wal segment")
+		}
+		l.file = file
+	}
+
+	if cfg.SyncInterval > 0 {
+		go l.syncLoop()
+	} else {
+		close(l.done)
+	}
+
+	return l, nil
+}
+
+// LastLSN is the lsn of the last appended record, 0 for an empty log.
+func (l *Log) LastLSN() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lastLSN
+}
+
+// Append writes data as the next record and returns its lsn.
+func (l *Log) Append(data []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, ErrClosed
+	}
+
+	if l.size >= l.cfg.SegmentSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	lsn := l.lastLSN + 1
+	record := encode(lsn, data)
+	if _, err := l.file.Write(record); err != nil {
+		// a partial write is cut off as a torn tail on the next Open
+		return 0, errors.Wrap(err, "failed to write wal record")
+	}
+	l.size += int64(len(record))
+	l.lastLSN = lsn
+
+	if l.cfg.SyncInterval > 0 {
+		l.dirty = true
+		return lsn, nil
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return 0, errors.Wrap(err, "failed to sync wal")
+	}
+
+	return lsn, nil
+}
+
+// Replay calls fn for every record with an lsn above after, in order.
+func (l *Log) Replay(after uint64, fn func(lsn uint64, data []byte) error) error {
+	l.mu.Lock()
+	segments := append([]segment(nil), l.segments...)
+	l.mu.Unlock()
+
+	for i, seg := range segments {
+		if i+1 < len(segments) && segments[i+1].first <= after+1 {
+			continue
+		}
+
+		_, _, err := scanSegment(seg, func(lsn uint64, data []byte) error {
+			if lsn <= after {
+				return nil
+			}
+			return fn(lsn, data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rotate starts a new segment, so that the current one can be compacted.
+func (l *Log) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.rotate()
+}
+
+// Compact deletes segments holding records up to upTo only, usually the lsn
+// of a saved snapshot. The segment taking appends is kept.
+func (l *Log) Compact(upTo uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for n+1 < len(l.segments) && l.segments[n+1].first-1 <= upTo {
+		if err := os.Remove(l.segments[n].path); err != nil {
+			return errors.Wrap(err, "failed to remove wal segment")
+		}
+		n++
+	}
+	l.segments = l.segments[n:]
+
+	return nil
+}
+
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sync()
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	if l.cfg.SyncInterval > 0 {
+		close(l.stop)
+	}
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.sync(); err != nil {
+		return err
+	}
+
+	return errors.Wrap(l.file.Close(), "failed to close wal segment")
+}
+
+func (l *Log) syncLoop() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.Sync(); err != nil {
+				l.logger.WithError(err).Error("failed to sync wal")
+			}
+		}
+	}
+}
+
+func (l *Log) sync() error {
+	if !l.dirty {
+		return nil
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync wal")
+	}
+	l.dirty = false
+
+	return nil
+}
+
+func (l *Log) rotate() error {
+	// an empty segment is already new
+	if l.size == 0 {
+		return nil
+	}
+
+	if err := l.sync(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close wal segment")
+	}
+
+	return l.newSegment()
+}
+
+func (l *Log) newSegment() error {
+	seg := segment{
+		path:  filepath.Join(l.cfg.Dir, fmt.Sprintf("%020d%s", l.lastLSN+1, segmentSuffix)),
+		first: l.lastLSN + 1,
+	}
+
+	file, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to create wal segment")
+	}
+	if err := syncDir(l.cfg.Dir); err != nil {
+		file.Close() // nolint:errcheck
+		return err
+	}
+
+	l.file = file
+	l.size = 0
+	l.segments = append(l.segments, seg)
+
+	return nil
+}
+
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read wal dir")
+	}
+
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		var first uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name, segmentSuffix), "%d", &first); err != nil {
+			return nil, errors.Wrapf(ErrCorrupted, "unexpected wal segment name %s", name)
+		}
+		segments = append(segments, segment{path: filepath.Join(dir, name), first: first})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].first < segments[j].first
+	})
+
+	return segments, nil
+}
+
+// scanSegment returns the lsn of the last valid record and the size of the
+// valid prefix, ErrCorrupted when the segment does not end there.
+func scanSegment(seg segment, fn func(lsn uint64, data []byte) error) (uint64, int64, error) {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to open wal segment")
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	lastLSN := seg.first - 1
+	var size int64
+
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return lastLSN, size, nil
+			}
+			return lastLSN, size, errors.Wrapf(ErrCorrupted, "short header at %d", size)
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		lsn := binary.BigEndian.Uint64(header[8:16])
+		if length > maxRecordSize {
+			return lastLSN, size, errors.Wrapf(ErrCorrupted, "record of %d bytes at %d", length, size)
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return lastLSN, size, errors.Wrapf(ErrCorrupted, "short record at %d", size)
+		}
+		if crc32.Update(crc32.Checksum(header[8:16], crcTable), crcTable, data) != checksum {
+			return lastLSN, size, errors.Wrapf(ErrCorrupted, "checksum mismatch at %d", size)
+		}
+		if lsn != lastLSN+1 {
+			return lastLSN, size, errors.Wrapf(ErrCorrupted, "lsn %d at %d, want %d", lsn, size, lastLSN+1)
+		}
+
+		if fn != nil {
+			if err := fn(lsn, data); err != nil {
+				return lastLSN, size, err
+			}
+		}
+
+		lastLSN = lsn
+		size += int64(headerSize + len(data))
+	}
+}
+
+func encode(lsn uint64, data []byte) []byte {
+	record := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint64(record[8:16], lsn)
+	copy(record[headerSize:], data)
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(record[8:], crcTable))
+
+	return record
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to open dir")
+	}
+	defer d.Close()
+
+	return errors.Wrap(d.Sync(), "failed to sync dir")
+}
@@ -0,0 +1,121 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/antonpriyma/otus-highload/pkg/log"
+	"github.com/stretchr/testify/require"
+)
+
+func replayAll(t *testing.T, l *Log, after uint64) []string {
+	var res []string
+	err := l.Replay(after, func(lsn uint64, data []byte) error {
+		res = append(res, strconv.FormatUint(lsn, 10)+":"+string(data))
+		return nil
+	})
+	require.NoError(t, err)
+
+	return res
+}
+
+func TestLogReopen(t *testing.T) {
+	cfg := Config{Dir: t.TempDir(), SegmentSize: 40}
+
+	l, err := Open(cfg, log.Null)
+	require.NoError(t, err)
+	for _, data := range []string{"a", "bb", "ccc", "dddd"} {
+		_, err := l.Append([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Close())
+
+	l, err = Open(cfg, log.Null)
+	require.NoError(t, err)
+	defer l.Close()
+
+	require.Equal(t, uint64(4), l.LastLSN())
+	require.Equal(t, []string{"1:a", "2:bb", "3:ccc", "4:dddd"}, replayAll(t, l, 0))
+	require.Equal(t, []string{"3:ccc", "4:dddd"}, replayAll(t, l, 2))
+
+	lsn, err := l.Append([]byte("e"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), lsn)
+}
+
+func TestLogCutsTornTail(t *testing.T) {
+	cfg := Config{Dir: t.TempDir()}
+
+	l, err := Open(cfg, log.Null)
+	require.NoError(t, err)
+	for _, data := range []string{"a", "bb"} {
+		_, err := l.Append([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Close())
+
+	// a crash in the middle of the third record
+	path := filepath.Join(cfg.Dir, "00000000000000000001.wal")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = file.Write(encode(3, []byte("ccc"))[:headerSize+1])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	l, err = Open(cfg, log.Null)
+	require.NoError(t, err)
+	defer l.Close()
+
+	require.Equal(t, uint64(2), l.LastLSN())
+	_, err = l.Append([]byte("ccc"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1:a", "2:bb", "3:ccc"}, replayAll(t, l, 0))
+}
+
+func TestLogCompact(t *testing.T) {
+	cfg := Config{Dir: t.TempDir()}
+
+	l, err := Open(cfg, log.Null)
+	require.NoError(t, err)
+	defer l.Close()
+
+	for _, data := range []string{"a", "bb"} {
+		_, err := l.Append([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Rotate())
+	require.NoError(t, l.Rotate())
+	_, err = l.Append([]byte("ccc"))
+	require.NoError(t, err)
+
+	// the first segment holds a record after 1
+	require.NoError(t, l.Compact(1))
+	require.Equal(t, []string{"1:a", "2:bb", "3:ccc"}, replayAll(t, l, 0))
+
+	require.NoError(t, l.Compact(2))
+	require.Equal(t, []string{"3:ccc"}, replayAll(t, l, 0))
+	require.Len(t, l.segments, 1)
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	lsn, data, err := LoadSnapshot(dir)
+	require.NoError(t, err)
+	require.Zero(t, lsn)
+	require.Nil(t, data)
+
+	require.NoError(t, SaveSnapshot(dir, 3, []byte("three")))
+	require.NoError(t, SaveSnapshot(dir, 7, []byte("seven")))
+
+	lsn, data, err = LoadSnapshot(dir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), lsn)
+	require.Equal(t, "seven", string(data))
+
+	snapshots, err := listSnapshots(dir)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+}